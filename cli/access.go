@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// accessCheckName is the name of the container, exec, service and node used by
+// the probes, it doesn't exist, so an allowed call is answered with a 404.
+const accessCheckName = "ofelia-access-check"
+
+// dockerEndpoint is a call to the docker API made by the jobs, with the
+// sections of a docker API proxy, as docker-socket-proxy, allowing it.
+type dockerEndpoint struct {
+	call     string
+	sections string
+	probe    func(c *docker.Client) error
+}
+
+// dockerEndpoints are the calls made by every type of job. The probes are
+// harmless: they target resources that don't exist, or an invalid spec, so the
+// daemon rejects them, while a proxy forbids them with a 403 before.
+var dockerEndpoints = map[string][]dockerEndpoint{
+	"job-exec": {
+		{"POST /containers/{id}/exec", "CONTAINERS, POST", func(c *docker.Client) error {
+			_, err := c.CreateExec(docker.CreateExecOptions{Container: accessCheckName, Cmd: []string{"true"}})
+			return err
+		}},
+		{"POST /exec/{id}/start", "EXEC, POST", func(c *docker.Client) error {
+			return c.StartExec(accessCheckName, docker.StartExecOptions{Detach: true})
+		}},
+		{"GET /exec/{id}/json", "EXEC", func(c *docker.Client) error {
+			_, err := c.InspectExec(accessCheckName)
+			return err
+		}},
+	},
+	"job-run": {
+		{"GET /images/{name}/json", "IMAGES", func(c *docker.Client) error {
+			_, err := c.InspectImage(accessCheckName)
+			return err
+		}},
+		{"POST /containers/{id}/start", "CONTAINERS, POST", func(c *docker.Client) error {
+			return c.StartContainer(accessCheckName, nil)
+		}},
+		{"POST /containers/{id}/stop", "CONTAINERS, POST", func(c *docker.Client) error {
+			return c.StopContainer(accessCheckName, 0)
+		}},
+		{"GET /containers/{id}/json", "CONTAINERS", func(c *docker.Client) error {
+			_, err := c.InspectContainer(accessCheckName)
+			return err
+		}},
+		{"DELETE /containers/{id}", "CONTAINERS, POST", func(c *docker.Client) error {
+			return c.RemoveContainer(docker.RemoveContainerOptions{ID: accessCheckName})
+		}},
+	},
+	"job-service-run": {
+		{"GET /images/{name}/json", "IMAGES", func(c *docker.Client) error {
+			_, err := c.InspectImage(accessCheckName)
+			return err
+		}},
+		{"POST /services/create", "SERVICES, POST", func(c *docker.Client) error {
+			_, err := c.CreateService(docker.CreateServiceOptions{})
+			return err
+		}},
+		{"GET /services/{id}", "SERVICES", func(c *docker.Client) error {
+			_, err := c.InspectService(accessCheckName)
+			return err
+		}},
+		{"DELETE /services/{id}", "SERVICES, POST", func(c *docker.Client) error {
+			return c.RemoveService(docker.RemoveServiceOptions{ID: accessCheckName})
+		}},
+		{"GET /tasks", "TASKS", func(c *docker.Client) error {
+			_, err := c.ListTasks(docker.ListTasksOptions{Filters: map[string][]string{"service": {accessCheckName}}})
+			return err
+		}},
+		{"GET /nodes/{id}", "NODES", func(c *docker.Client) error {
+			_, err := c.InspectNode(accessCheckName)
+			return err
+		}},
+	},
+	// the calls made only by the jobs with the given option, as `<type> <option>`
+	"job-run network": {
+		{"GET /networks/{id}", "NETWORKS", probeNetworkInfo},
+		{"POST /networks/{id}/connect", "NETWORKS, POST", func(c *docker.Client) error {
+			return c.ConnectNetwork(accessCheckName, docker.NetworkConnectionOptions{Container: accessCheckName})
+		}},
+	},
+	"job-service-run network": {
+		{"GET /networks/{id}", "NETWORKS", probeNetworkInfo},
+	},
+	"job-service-run secrets": {
+		{"GET /secrets", "SECRETS", func(c *docker.Client) error {
+			_, err := c.ListSecrets(docker.ListSecretsOptions{Filters: map[string][]string{"name": {accessCheckName}}})
+			return err
+		}},
+	},
+	"job-service-run configs": {
+		{"GET /configs", "CONFIGS", func(c *docker.Client) error {
+			_, err := c.ListConfigs(docker.ListConfigsOptions{Filters: map[string][]string{"name": {accessCheckName}}})
+			return err
+		}},
+	},
+}
+
+func probeNetworkInfo(c *docker.Client) error {
+	_, err := c.NetworkInfo(accessCheckName)
+	return err
+}
+
+// checkDockerAccess probes the calls made by the jobs of the given types,
+// and options, eg. `job-service-run secrets`, returning an error with every
+// call forbidden by the docker API, so a restricted proxy missing a section
+// fails at startup instead of at the first execution. Any other error, as a
+// daemon unreachable, is not checked here.
+func checkDockerAccess(c *docker.Client, kinds []string) error {
+	var forbidden, types []string
+	probed := make(map[string]bool, 0)
+	for _, kind := range kinds {
+		if t := strings.Fields(kind)[0]; len(types) == 0 || types[len(types)-1] != t {
+			types = append(types, t)
+		}
+
+		for _, e := range dockerEndpoints[kind] {
+			if probed[e.call] {
+				continue
+			}
+
+			probed[e.call] = true
+			if isForbidden(e.probe(c)) {
+				forbidden = append(forbidden, fmt.Sprintf("%s (%s)", e.call, e.sections))
+			}
+		}
+	}
+
+	if len(forbidden) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"the docker API at %s forbids the calls required by the %s jobs: %s",
+		c.Endpoint(), strings.Join(types, ", "), strings.Join(forbidden, ", "),
+	)
+}
+
+func isForbidden(err error) bool {
+	e, ok := err.(*docker.Error)
+	return ok && (e.Status == http.StatusForbidden || e.Status == http.StatusUnauthorized)
+}
+
+// checkDockerAccess checks the access to every docker host used by the jobs
+func (c *Config) checkDockerAccess(clients *dockerClients) error {
+	kinds := make(map[string]map[string]bool, 0)
+	add := func(host, kind string) {
+		if kinds[host] == nil {
+			kinds[host] = make(map[string]bool, 0)
+		}
+
+		kinds[host][kind] = true
+	}
+
+	for _, j := range c.ExecJobs {
+		add(j.DockerHost, "job-exec")
+	}
+
+	for _, j := range c.RunJobs {
+		add(j.DockerHost, "job-run")
+		if len(j.Network) != 0 {
+			add(j.DockerHost, "job-run network")
+		}
+	}
+
+	for _, j := range c.ServiceJobs {
+		add(j.DockerHost, "job-service-run")
+		if len(j.Network) != 0 {
+			add(j.DockerHost, "job-service-run network")
+		}
+
+		if len(j.Secrets) != 0 {
+			add(j.DockerHost, "job-service-run secrets")
+		}
+
+		if len(j.Configs) != 0 {
+			add(j.DockerHost, "job-service-run configs")
+		}
+	}
+
+	hosts := make([]string, 0, len(kinds))
+	for host := range kinds {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		client, err := clients.get(host)
+		if err != nil {
+			return err
+		}
+
+		var names []string
+		for kind := range kinds[host] {
+			names = append(names, kind)
+		}
+
+		sort.Strings(names)
+		if err := checkDockerAccess(client, names); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
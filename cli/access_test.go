@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteAccess struct{}
+
+var _ = Suite(&SuiteAccess{})
+
+// newProxyServer returns a server forbidding the paths with the given prefix,
+// as a docker API proxy does, the other calls don't find what they look for.
+func newProxyServer(forbidden string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if forbidden != "" && strings.HasPrefix(r.URL.Path, forbidden) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+}
+
+func (s *SuiteAccess) TestCheckDockerAccess(c *C) {
+	ts := newProxyServer("")
+	defer ts.Close()
+
+	client, err := docker.NewClient(ts.URL)
+	c.Assert(err, IsNil)
+
+	err = checkDockerAccess(client, []string{
+		"job-exec", "job-run", "job-run network",
+		"job-service-run", "job-service-run configs", "job-service-run network", "job-service-run secrets",
+	})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteAccess) TestCheckDockerAccessForbidden(c *C) {
+	ts := newProxyServer("/services")
+	defer ts.Close()
+
+	client, err := docker.NewClient(ts.URL)
+	c.Assert(err, IsNil)
+
+	c.Assert(checkDockerAccess(client, []string{"job-run"}), IsNil)
+
+	err = checkDockerAccess(client, []string{"job-run", "job-service-run"})
+	c.Assert(err, ErrorMatches, `the docker API at .* forbids the calls required by the job-run, job-service-run jobs: `+
+		`POST /services/create \(SERVICES, POST\), GET /services/\{id\} \(SERVICES\), DELETE /services/\{id\} \(SERVICES, POST\)`)
+}
+
+func (s *SuiteAccess) TestCheckDockerAccessSecrets(c *C) {
+	ts := newProxyServer("/secrets")
+	defer ts.Close()
+
+	client, err := docker.NewClient(ts.URL)
+	c.Assert(err, IsNil)
+
+	c.Assert(checkDockerAccess(client, []string{"job-service-run", "job-service-run configs"}), IsNil)
+
+	err = checkDockerAccess(client, []string{"job-service-run", "job-service-run secrets"})
+	c.Assert(err, ErrorMatches, `the docker API at .* forbids the calls required by the job-service-run jobs: `+
+		`GET /secrets \(SECRETS\)`)
+}
+
+func (s *SuiteAccess) TestCheckDockerAccessNetwork(c *C) {
+	ts := newProxyServer("/networks")
+	defer ts.Close()
+
+	client, err := docker.NewClient(ts.URL)
+	c.Assert(err, IsNil)
+
+	c.Assert(checkDockerAccess(client, []string{"job-run", "job-service-run"}), IsNil)
+
+	err = checkDockerAccess(client, []string{"job-run", "job-run network", "job-service-run", "job-service-run network"})
+	c.Assert(err, ErrorMatches, `the docker API at .* forbids the calls required by the job-run, job-service-run jobs: `+
+		`GET /networks/\{id\} \(NETWORKS\), POST /networks/\{id\}/connect \(NETWORKS, POST\)`)
+}
@@ -1,134 +1,378 @@
 package cli
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/Postcon/ofelia/core"
 	"github.com/Postcon/ofelia/middlewares"
-	"github.com/fsouza/go-dockerclient"
-	"github.com/op/go-logging"
 
+	"github.com/fsouza/go-dockerclient"
 	"github.com/mcuadros/go-defaults"
 	"gopkg.in/gcfg.v1"
 )
 
-const logFormat = "%{color}%{shortfile} ▶ %{level}%{color:reset} %{message}"
-
 // Config contains the configuration
 type Config struct {
 	Global struct {
+		DockerConfig
+		ServiceConfig
 		middlewares.SlackConfig
 		middlewares.SaveConfig
 		middlewares.MailConfig
-		LoggingGelfAddress  string `gcfg:"services-logging-gelf-address"`
-		PlacementConstraint string `gcfg:"services-placement-constraint"`
+		middlewares.MattermostConfig
+		middlewares.TeamsConfig
+		middlewares.NtfyConfig
+		middlewares.MatrixConfig
+		middlewares.OpsGenieConfig
+		middlewares.S3Config
+		middlewares.SentryConfig
+		middlewares.MetricsConfig
+		middlewares.NATSConfig
+		middlewares.DedupConfig
+		middlewares.LokiConfig
+		middlewares.DatabaseConfig
+		middlewares.GitHubConfig
+		middlewares.ReportConfig
+		LoggingGelfAddress  string        `gcfg:"services-logging-gelf-address"`
+		PlacementConstraint []string      `gcfg:"services-placement-constraint"`
+		PruneOrphans        bool          `gcfg:"prune-orphans"`
+		DockerAccessCheck   bool          `gcfg:"docker-access-check"`
+		PruneOrphansAge     core.Duration `gcfg:"prune-orphans-age"`
+		MaxHistory          int           `gcfg:"max-history"`
+		HistoryFile         string        `gcfg:"history-file"`
+		HistoryFsync        bool          `gcfg:"history-fsync"`
+		MaxConcurrentRuns   int           `gcfg:"max-concurrent-runs"`
+		APIToken            string        `gcfg:"api-token"`
+		APITokenFile        string        `gcfg:"api-token-file"`
+		User                string        `gcfg:"user"`
+		Registry            string        `gcfg:"registry"`
+		Network             []string      `gcfg:"network"`
 	}
 	ExecJobs    map[string]*ExecJobConfig    `gcfg:"job-exec"`
 	RunJobs     map[string]*RunJobConfig     `gcfg:"job-run"`
 	ServiceJobs map[string]*RunServiceConfig `gcfg:"job-service-run"`
 	LocalJobs   map[string]*LocalJobConfig   `gcfg:"job-local"`
+	ECSJobs     map[string]*ECSJobConfig     `gcfg:"job-ecs-run"`
+	Profiles    map[string]*ProfileConfig    `gcfg:"profile"`
+
+	// profile is the profile applied when the config is resolved
+	profile string
 }
 
-// BuildFromFile buils a scheduler using the config from a file
-func BuildFromFile(filename string) (*core.Scheduler, error) {
+// BuildFromFile buils a scheduler using the config from a file, the given
+// docker options, if any, override the ones from the config.
+func BuildFromFile(filename string, logger core.Logger, docker *DockerConfig) (*core.Scheduler, error) {
+	c, err := ReadConfigFile(filename, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.build(logger, docker)
+}
+
+// ReadConfigFile reads the config from a file, without building the scheduler,
+// in the given format, ini or yaml, by default the one of its extension.
+func ReadConfigFile(filename, format string) (*Config, error) {
+	content, err := readConfigContent(filename, format)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &Config{}
-	if err := gcfg.ReadFileInto(c, filename); err != nil {
+	if err := gcfg.ReadStringInto(c, content); err != nil {
 		return nil, err
 	}
 
-	return c.build()
+	return c, nil
 }
 
-// BuildFromString buils a scheduler using the config from a string
-func BuildFromString(config string) (*core.Scheduler, error) {
+// BuildFromString buils a scheduler using the config from a string, the given
+// docker options, if any, override the ones from the config.
+func BuildFromString(config string, logger core.Logger, docker *DockerConfig) (*core.Scheduler, error) {
 	c := &Config{}
 	if err := gcfg.ReadStringInto(c, config); err != nil {
 		return nil, err
 	}
 
-	return c.build()
+	return c.build(logger, docker)
 }
 
-func (c *Config) build() (*core.Scheduler, error) {
-	defaults.SetDefaults(c)
+func (c *Config) build(logger core.Logger, docker *DockerConfig) (*core.Scheduler, error) {
+	if err := c.resolve(); err != nil {
+		return nil, err
+	}
 
-	d, err := c.buildDockerClient()
+	if err := validateSlackConfig(&c.Global.SlackConfig); err != nil {
+		return nil, err
+	}
+
+	c.Global.DockerConfig.merge(docker)
+	d, err := c.Global.DockerConfig.negotiateClient(logger)
 	if err != nil {
 		return nil, err
 	}
 
-	sh := core.NewScheduler(c.buildLogger())
+	clients := newDockerClients(c.Global.DockerConfig, logger, d)
+
+	sh := core.NewScheduler(logger)
+	sh.MaxConcurrentRuns = c.Global.MaxConcurrentRuns
+	if c.Global.HistoryFile != "" {
+		h, err := core.OpenHistory(c.Global.HistoryFile, c.Global.HistoryFsync)
+		if err != nil {
+			return nil, err
+		}
+
+		sh.SetHistory(h)
+	}
 	c.buildSchedulerMiddlewares(sh)
 
+	if c.Global.PruneOrphans {
+		c.pruneOrphans(d, logger)
+	}
+
 	for name, j := range c.ExecJobs {
-		defaults.SetDefaults(j)
+		client, err := clients.get(j.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
 
-		j.Client = d
+		j.Client = client
 		j.Name = name
+		if err := validateSlackConfig(&j.SlackConfig); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
 		j.buildMiddlewares()
-		sh.AddJob(j)
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
 	}
 
 	for name, j := range c.RunJobs {
-		defaults.SetDefaults(j)
+		client, err := clients.get(j.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
 
-		j.Client = d
+		j.Client = client
 		j.Name = name
+		if err := validateSlackConfig(&j.SlackConfig); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
 		j.buildMiddlewares()
-		sh.AddJob(j)
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
 	}
 
 	for name, j := range c.LocalJobs {
-		defaults.SetDefaults(j)
+		j.Name = name
+		if err := validateSlackConfig(&j.SlackConfig); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
+		j.buildMiddlewares()
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+	}
 
+	for name, j := range c.ECSJobs {
 		j.Name = name
+		if err := validateSlackConfig(&j.SlackConfig); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
 		j.buildMiddlewares()
-		sh.AddJob(j)
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
 	}
 
 	for name, j := range c.ServiceJobs {
+		client, err := clients.get(j.DockerHost)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
+		j.Name = name
+		j.Client = client
+		if err := validateSlackConfig(&j.SlackConfig); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+
+		j.buildMiddlewares()
+		if err := sh.AddJob(j); err != nil {
+			return nil, fmt.Errorf("unable to add job %q: %s", name, err)
+		}
+	}
+
+	if c.Global.DockerAccessCheck {
+		if err := c.checkDockerAccess(clients); err != nil {
+			return nil, err
+		}
+	}
+
+	return sh, nil
+}
+
+// resolve reads the secret files and the Vault secrets and sets the defaults
+// of the config, the options of the jobs not given are taken from the [global]
+// section, leaving the config as the scheduler sees it.
+func (c *Config) resolve() error {
+	if err := resolveSecretFiles(c); err != nil {
+		return err
+	}
+
+	if err := resolveVaultSecrets(c); err != nil {
+		return err
+	}
+
+	if err := c.applyProfile(); err != nil {
+		return err
+	}
+
+	defaults.SetDefaults(c)
+
+	for _, j := range c.ExecJobs {
+		if j.User == "" {
+			j.User = c.Global.User
+		}
+
+		defaults.SetDefaults(j)
+		if j.MaxHistory == 0 {
+			j.MaxHistory = c.Global.MaxHistory
+		}
+	}
+
+	for _, j := range c.RunJobs {
+		if j.User == "" {
+			j.User = c.Global.User
+		}
+		if j.Registry == "" {
+			j.Registry = c.Global.Registry
+		}
+		if len(j.Network) == 0 {
+			j.Network = c.Global.Network
+		}
+
+		defaults.SetDefaults(j)
+		if j.MaxHistory == 0 {
+			j.MaxHistory = c.Global.MaxHistory
+		}
+	}
+
+	for _, j := range c.LocalJobs {
+		defaults.SetDefaults(j)
+		if j.MaxHistory == 0 {
+			j.MaxHistory = c.Global.MaxHistory
+		}
+	}
+
+	for _, j := range c.ECSJobs {
+		defaults.SetDefaults(j)
+		if j.MaxHistory == 0 {
+			j.MaxHistory = c.Global.MaxHistory
+		}
+	}
+
+	for _, j := range c.ServiceJobs {
+		if j.User == "" {
+			j.User = c.Global.User
+		}
+		if j.Registry == "" {
+			j.Registry = c.Global.Registry
+		}
+		if len(j.Network) == 0 {
+			j.Network = c.Global.Network
+		}
+
 		defaults.SetDefaults(j)
+		if j.MaxHistory == 0 {
+			j.MaxHistory = c.Global.MaxHistory
+		}
 		if j.LoggingGelfAddress == "" {
 			j.LoggingGelfAddress = c.Global.LoggingGelfAddress
 		}
-		if j.PlacementConstraint == "" {
+		if len(j.PlacementConstraint) == 0 {
 			j.PlacementConstraint = c.Global.PlacementConstraint
 		}
-		j.Name = name
-		j.Client = d
-		j.buildMiddlewares()
-		sh.AddJob(j)
+		c.Global.ServiceConfig.apply(&j.RunServiceJob)
 	}
 
-	return sh, nil
+	return nil
 }
 
-func (c *Config) buildDockerClient() (*docker.Client, error) {
-	d, err := docker.NewClientFromEnv()
-	if err != nil {
-		return nil, err
+// validateSlackConfig validates the slack-message-template, when the config is
+// loaded, instead of failing on every notification.
+func validateSlackConfig(c *middlewares.SlackConfig) error {
+	if c.SlackMessageTemplate == "" {
+		return nil
 	}
 
-	return d, nil
+	_, err := middlewares.ParseSlackMessageTemplate(c.SlackMessageTemplate)
+	return err
 }
 
-func (c *Config) buildLogger() core.Logger {
-	logging.SetFormatter(logging.MustStringFormatter(logFormat))
+const defaultPruneOrphansAge = time.Hour
 
-	return logging.MustGetLogger("ofelia")
+func (c *Config) pruneOrphans(d *docker.Client, logger core.Logger) {
+	age := time.Duration(c.Global.PruneOrphansAge)
+	if age == 0 {
+		age = defaultPruneOrphansAge
+	}
+
+	if err := core.PruneOrphans(d, age, logger); err != nil {
+		logger.Warningf("Unable to prune the orphaned containers and services: %s", err)
+	}
 }
 
 func (c *Config) buildSchedulerMiddlewares(sh *core.Scheduler) {
 	sh.Use(middlewares.NewSlack(&c.Global.SlackConfig))
 	sh.Use(middlewares.NewSave(&c.Global.SaveConfig))
 	sh.Use(middlewares.NewMail(&c.Global.MailConfig))
+	sh.Use(middlewares.NewMattermost(&c.Global.MattermostConfig))
+	sh.Use(middlewares.NewTeams(&c.Global.TeamsConfig))
+	sh.Use(middlewares.NewNtfy(&c.Global.NtfyConfig))
+	sh.Use(middlewares.NewMatrix(&c.Global.MatrixConfig))
+	sh.Use(middlewares.NewOpsGenie(&c.Global.OpsGenieConfig))
+	sh.Use(middlewares.NewS3(&c.Global.S3Config))
+	sh.Use(middlewares.NewSentry(&c.Global.SentryConfig))
+	sh.Use(middlewares.NewMetrics(&c.Global.MetricsConfig))
+	sh.Use(middlewares.NewNATS(&c.Global.NATSConfig))
+	sh.Use(middlewares.NewDedup(&c.Global.DedupConfig))
+	sh.Use(middlewares.NewLoki(&c.Global.LokiConfig))
+	sh.Use(middlewares.NewDatabase(&c.Global.DatabaseConfig))
+	sh.Use(middlewares.NewGitHub(&c.Global.GitHubConfig))
+	sh.Use(middlewares.NewReport(&c.Global.ReportConfig))
 }
 
 // ExecJobConfig contains all configuration params needed to build a ExecJob
 type ExecJobConfig struct {
 	core.ExecJob
+	DockerHost string `gcfg:"docker-host"`
 	middlewares.OverlapConfig
 	middlewares.SlackConfig
 	middlewares.SaveConfig
 	middlewares.MailConfig
+	middlewares.MattermostConfig
+	middlewares.TeamsConfig
+	middlewares.NtfyConfig
+	middlewares.MatrixConfig
+	middlewares.OpsGenieConfig
+	middlewares.S3Config
+	middlewares.SentryConfig
+	middlewares.MetricsConfig
+	middlewares.NATSConfig
+	middlewares.DedupConfig
+	middlewares.LokiConfig
+	middlewares.DatabaseConfig
+	middlewares.GitHubConfig
+	middlewares.ReportConfig
+	middlewares.ResultFileConfig
+	middlewares.HooksConfig
 }
 
 func (c *ExecJobConfig) buildMiddlewares() {
@@ -136,23 +380,73 @@ func (c *ExecJobConfig) buildMiddlewares() {
 	c.ExecJob.Use(middlewares.NewSlack(&c.SlackConfig))
 	c.ExecJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.ExecJob.Use(middlewares.NewMail(&c.MailConfig))
+	c.ExecJob.Use(middlewares.NewMattermost(&c.MattermostConfig))
+	c.ExecJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.ExecJob.Use(middlewares.NewNtfy(&c.NtfyConfig))
+	c.ExecJob.Use(middlewares.NewMatrix(&c.MatrixConfig))
+	c.ExecJob.Use(middlewares.NewOpsGenie(&c.OpsGenieConfig))
+	c.ExecJob.Use(middlewares.NewS3(&c.S3Config))
+	c.ExecJob.Use(middlewares.NewSentry(&c.SentryConfig))
+	c.ExecJob.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	c.ExecJob.Use(middlewares.NewNATS(&c.NATSConfig))
+	c.ExecJob.Use(middlewares.NewDedup(&c.DedupConfig))
+	c.ExecJob.Use(middlewares.NewLoki(&c.LokiConfig))
+	c.ExecJob.Use(middlewares.NewDatabase(&c.DatabaseConfig))
+	c.ExecJob.Use(middlewares.NewGitHub(&c.GitHubConfig))
+	c.ExecJob.Use(middlewares.NewReport(&c.ReportConfig))
+	c.ExecJob.Use(middlewares.NewResultFile(&c.ResultFileConfig))
+	c.ExecJob.Use(middlewares.NewHooks(&c.HooksConfig))
 }
 
 // RunJobConfig contains all configuration params needed to build a RunJob
 type RunServiceConfig struct {
 	core.RunServiceJob
+	DockerHost string `gcfg:"docker-host"`
 	middlewares.OverlapConfig
 	middlewares.SlackConfig
 	middlewares.SaveConfig
 	middlewares.MailConfig
+	middlewares.MattermostConfig
+	middlewares.TeamsConfig
+	middlewares.NtfyConfig
+	middlewares.MatrixConfig
+	middlewares.OpsGenieConfig
+	middlewares.S3Config
+	middlewares.SentryConfig
+	middlewares.MetricsConfig
+	middlewares.NATSConfig
+	middlewares.DedupConfig
+	middlewares.LokiConfig
+	middlewares.DatabaseConfig
+	middlewares.GitHubConfig
+	middlewares.ReportConfig
+	middlewares.ResultFileConfig
+	middlewares.HooksConfig
 }
 
 type RunJobConfig struct {
 	core.RunJob
+	DockerHost string `gcfg:"docker-host"`
 	middlewares.OverlapConfig
 	middlewares.SlackConfig
 	middlewares.SaveConfig
 	middlewares.MailConfig
+	middlewares.MattermostConfig
+	middlewares.TeamsConfig
+	middlewares.NtfyConfig
+	middlewares.MatrixConfig
+	middlewares.OpsGenieConfig
+	middlewares.S3Config
+	middlewares.SentryConfig
+	middlewares.MetricsConfig
+	middlewares.NATSConfig
+	middlewares.DedupConfig
+	middlewares.LokiConfig
+	middlewares.DatabaseConfig
+	middlewares.GitHubConfig
+	middlewares.ReportConfig
+	middlewares.ResultFileConfig
+	middlewares.HooksConfig
 }
 
 func (c *RunJobConfig) buildMiddlewares() {
@@ -160,6 +454,22 @@ func (c *RunJobConfig) buildMiddlewares() {
 	c.RunJob.Use(middlewares.NewSlack(&c.SlackConfig))
 	c.RunJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.RunJob.Use(middlewares.NewMail(&c.MailConfig))
+	c.RunJob.Use(middlewares.NewMattermost(&c.MattermostConfig))
+	c.RunJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.RunJob.Use(middlewares.NewNtfy(&c.NtfyConfig))
+	c.RunJob.Use(middlewares.NewMatrix(&c.MatrixConfig))
+	c.RunJob.Use(middlewares.NewOpsGenie(&c.OpsGenieConfig))
+	c.RunJob.Use(middlewares.NewS3(&c.S3Config))
+	c.RunJob.Use(middlewares.NewSentry(&c.SentryConfig))
+	c.RunJob.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	c.RunJob.Use(middlewares.NewNATS(&c.NATSConfig))
+	c.RunJob.Use(middlewares.NewDedup(&c.DedupConfig))
+	c.RunJob.Use(middlewares.NewLoki(&c.LokiConfig))
+	c.RunJob.Use(middlewares.NewDatabase(&c.DatabaseConfig))
+	c.RunJob.Use(middlewares.NewGitHub(&c.GitHubConfig))
+	c.RunJob.Use(middlewares.NewReport(&c.ReportConfig))
+	c.RunJob.Use(middlewares.NewResultFile(&c.ResultFileConfig))
+	c.RunJob.Use(middlewares.NewHooks(&c.HooksConfig))
 }
 
 // LocalJobConfig contains all configuration params needed to build a RunJob
@@ -169,6 +479,22 @@ type LocalJobConfig struct {
 	middlewares.SlackConfig
 	middlewares.SaveConfig
 	middlewares.MailConfig
+	middlewares.MattermostConfig
+	middlewares.TeamsConfig
+	middlewares.NtfyConfig
+	middlewares.MatrixConfig
+	middlewares.OpsGenieConfig
+	middlewares.S3Config
+	middlewares.SentryConfig
+	middlewares.MetricsConfig
+	middlewares.NATSConfig
+	middlewares.DedupConfig
+	middlewares.LokiConfig
+	middlewares.DatabaseConfig
+	middlewares.GitHubConfig
+	middlewares.ReportConfig
+	middlewares.ResultFileConfig
+	middlewares.HooksConfig
 }
 
 func (c *LocalJobConfig) buildMiddlewares() {
@@ -176,6 +502,70 @@ func (c *LocalJobConfig) buildMiddlewares() {
 	c.LocalJob.Use(middlewares.NewSlack(&c.SlackConfig))
 	c.LocalJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.LocalJob.Use(middlewares.NewMail(&c.MailConfig))
+	c.LocalJob.Use(middlewares.NewMattermost(&c.MattermostConfig))
+	c.LocalJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.LocalJob.Use(middlewares.NewNtfy(&c.NtfyConfig))
+	c.LocalJob.Use(middlewares.NewMatrix(&c.MatrixConfig))
+	c.LocalJob.Use(middlewares.NewOpsGenie(&c.OpsGenieConfig))
+	c.LocalJob.Use(middlewares.NewS3(&c.S3Config))
+	c.LocalJob.Use(middlewares.NewSentry(&c.SentryConfig))
+	c.LocalJob.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	c.LocalJob.Use(middlewares.NewNATS(&c.NATSConfig))
+	c.LocalJob.Use(middlewares.NewDedup(&c.DedupConfig))
+	c.LocalJob.Use(middlewares.NewLoki(&c.LokiConfig))
+	c.LocalJob.Use(middlewares.NewDatabase(&c.DatabaseConfig))
+	c.LocalJob.Use(middlewares.NewGitHub(&c.GitHubConfig))
+	c.LocalJob.Use(middlewares.NewReport(&c.ReportConfig))
+	c.LocalJob.Use(middlewares.NewResultFile(&c.ResultFileConfig))
+	c.LocalJob.Use(middlewares.NewHooks(&c.HooksConfig))
+}
+
+// ECSJobConfig contains all configuration params needed to build a ECSJob
+type ECSJobConfig struct {
+	core.ECSJob
+	middlewares.OverlapConfig
+	middlewares.SlackConfig
+	middlewares.SaveConfig
+	middlewares.MailConfig
+	middlewares.MattermostConfig
+	middlewares.TeamsConfig
+	middlewares.NtfyConfig
+	middlewares.MatrixConfig
+	middlewares.OpsGenieConfig
+	middlewares.S3Config
+	middlewares.SentryConfig
+	middlewares.MetricsConfig
+	middlewares.NATSConfig
+	middlewares.DedupConfig
+	middlewares.LokiConfig
+	middlewares.DatabaseConfig
+	middlewares.GitHubConfig
+	middlewares.ReportConfig
+	middlewares.ResultFileConfig
+	middlewares.HooksConfig
+}
+
+func (c *ECSJobConfig) buildMiddlewares() {
+	c.ECSJob.Use(middlewares.NewOverlap(&c.OverlapConfig))
+	c.ECSJob.Use(middlewares.NewSlack(&c.SlackConfig))
+	c.ECSJob.Use(middlewares.NewSave(&c.SaveConfig))
+	c.ECSJob.Use(middlewares.NewMail(&c.MailConfig))
+	c.ECSJob.Use(middlewares.NewMattermost(&c.MattermostConfig))
+	c.ECSJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.ECSJob.Use(middlewares.NewNtfy(&c.NtfyConfig))
+	c.ECSJob.Use(middlewares.NewMatrix(&c.MatrixConfig))
+	c.ECSJob.Use(middlewares.NewOpsGenie(&c.OpsGenieConfig))
+	c.ECSJob.Use(middlewares.NewS3(&c.S3Config))
+	c.ECSJob.Use(middlewares.NewSentry(&c.SentryConfig))
+	c.ECSJob.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	c.ECSJob.Use(middlewares.NewNATS(&c.NATSConfig))
+	c.ECSJob.Use(middlewares.NewDedup(&c.DedupConfig))
+	c.ECSJob.Use(middlewares.NewLoki(&c.LokiConfig))
+	c.ECSJob.Use(middlewares.NewDatabase(&c.DatabaseConfig))
+	c.ECSJob.Use(middlewares.NewGitHub(&c.GitHubConfig))
+	c.ECSJob.Use(middlewares.NewReport(&c.ReportConfig))
+	c.ECSJob.Use(middlewares.NewResultFile(&c.ResultFileConfig))
+	c.ECSJob.Use(middlewares.NewHooks(&c.HooksConfig))
 }
 
 func (c *RunServiceConfig) buildMiddlewares() {
@@ -183,4 +573,20 @@ func (c *RunServiceConfig) buildMiddlewares() {
 	c.RunServiceJob.Use(middlewares.NewSlack(&c.SlackConfig))
 	c.RunServiceJob.Use(middlewares.NewSave(&c.SaveConfig))
 	c.RunServiceJob.Use(middlewares.NewMail(&c.MailConfig))
+	c.RunServiceJob.Use(middlewares.NewMattermost(&c.MattermostConfig))
+	c.RunServiceJob.Use(middlewares.NewTeams(&c.TeamsConfig))
+	c.RunServiceJob.Use(middlewares.NewNtfy(&c.NtfyConfig))
+	c.RunServiceJob.Use(middlewares.NewMatrix(&c.MatrixConfig))
+	c.RunServiceJob.Use(middlewares.NewOpsGenie(&c.OpsGenieConfig))
+	c.RunServiceJob.Use(middlewares.NewS3(&c.S3Config))
+	c.RunServiceJob.Use(middlewares.NewSentry(&c.SentryConfig))
+	c.RunServiceJob.Use(middlewares.NewMetrics(&c.MetricsConfig))
+	c.RunServiceJob.Use(middlewares.NewNATS(&c.NATSConfig))
+	c.RunServiceJob.Use(middlewares.NewDedup(&c.DedupConfig))
+	c.RunServiceJob.Use(middlewares.NewLoki(&c.LokiConfig))
+	c.RunServiceJob.Use(middlewares.NewDatabase(&c.DatabaseConfig))
+	c.RunServiceJob.Use(middlewares.NewGitHub(&c.GitHubConfig))
+	c.RunServiceJob.Use(middlewares.NewReport(&c.ReportConfig))
+	c.RunServiceJob.Use(middlewares.NewResultFile(&c.ResultFileConfig))
+	c.RunServiceJob.Use(middlewares.NewHooks(&c.HooksConfig))
 }
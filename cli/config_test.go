@@ -2,6 +2,9 @@ package cli
 
 import (
 	"testing"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
 
 	. "gopkg.in/check.v1"
 )
@@ -13,6 +16,7 @@ type SuiteConfig struct{}
 var _ = Suite(&SuiteConfig{})
 
 func (s *SuiteConfig) TestBuildFromString(c *C) {
+	logger, _ := BuildLogger("text")
 	sh, err := BuildFromString(`
 		[job-exec "foo"]
 		schedule = @every 10s
@@ -28,12 +32,151 @@ func (s *SuiteConfig) TestBuildFromString(c *C) {
 
 		[job-service-run "bob"]
 		schedule = @every 10s
-  `)
+  `, logger, nil)
 
 	c.Assert(err, IsNil)
 	c.Assert(sh.Jobs, HasLen, 5)
 }
 
+func (s *SuiteConfig) TestBuildFromStringMaxHistory(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[global]
+		max-history = 5
+
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+		max-history = 2
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+	c.Assert(sh.GetJob("foo").GetMaxHistory(), Equals, 5)
+	c.Assert(sh.GetJob("bar").GetMaxHistory(), Equals, 2)
+}
+
+func (s *SuiteConfig) TestBuildFromStringDisabled(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+		enabled = false
+
+		[job-local "bar"]
+		schedule = @every 10s
+		command = echo bar
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+	c.Assert(sh.GetJob("foo").IsEnabled(), Equals, false)
+	c.Assert(sh.GetJob("bar").IsEnabled(), Equals, true)
+}
+
+func (s *SuiteConfig) TestBuildFromStringGlobalDefaults(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[global]
+		user = nobody
+		registry = registry.example.com
+		network = backend
+
+		[job-run "foo"]
+		schedule = @every 10s
+		image = busybox
+
+		[job-run "bar"]
+		schedule = @every 10s
+		image = busybox
+		user = www-data
+		registry = other.example.com
+		network = frontend
+
+		[job-exec "qux"]
+		schedule = @every 10s
+		container = foo
+
+		[job-service-run "baz"]
+		schedule = @every 10s
+		image = busybox
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+
+	foo := sh.GetJob("foo").(*RunJobConfig)
+	c.Assert(foo.User, Equals, "nobody")
+	c.Assert(foo.Registry, Equals, "registry.example.com")
+	c.Assert(foo.Network, DeepEquals, []string{"backend"})
+
+	bar := sh.GetJob("bar").(*RunJobConfig)
+	c.Assert(bar.User, Equals, "www-data")
+	c.Assert(bar.Registry, Equals, "other.example.com")
+	c.Assert(bar.Network, DeepEquals, []string{"frontend"})
+
+	c.Assert(sh.GetJob("qux").(*ExecJobConfig).User, Equals, "nobody")
+
+	baz := sh.GetJob("baz").(*RunServiceConfig)
+	c.Assert(baz.Registry, Equals, "registry.example.com")
+	c.Assert(baz.Network, DeepEquals, []string{"backend"})
+}
+
+func (s *SuiteConfig) TestBuildFromStringServiceDefaults(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[global]
+		service-poll-interval = 5s
+		service-max-runtime = 2h
+
+		[job-service-run "foo"]
+		schedule = @every 10s
+		image = busybox
+
+		[job-service-run "bar"]
+		schedule = @every 10s
+		image = busybox
+		poll-interval = 1s
+		max-runtime = 10m
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+
+	foo := sh.GetJob("foo").(*RunServiceConfig)
+	c.Assert(foo.PollInterval, Equals, core.Duration(5*time.Second))
+	c.Assert(foo.GetMaxRuntime(), Equals, 2*time.Hour)
+
+	bar := sh.GetJob("bar").(*RunServiceConfig)
+	c.Assert(bar.PollInterval, Equals, core.Duration(time.Second))
+	c.Assert(bar.GetMaxRuntime(), Equals, 10*time.Minute)
+}
+
+func (s *SuiteConfig) TestBuildFromStringInvalidSchedule(c *C) {
+	logger, _ := BuildLogger("text")
+	_, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = * * *
+		command = echo foo
+  `, logger, nil)
+
+	c.Assert(err, ErrorMatches, `unable to add job "foo": invalid schedule "\* \* \*": expected 5 or 6 fields, found 3`)
+}
+
+func (s *SuiteConfig) TestBuildFromStringInvalidSlackMessageTemplate(c *C) {
+	logger, _ := BuildLogger("text")
+	_, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @hourly
+		command = echo foo
+		slack-webhook = http://example.com/hook
+		slack-message-template = {{.Job.GetName}
+  `, logger, nil)
+
+	c.Assert(err, ErrorMatches, `unable to add job "foo": invalid slack-message-template .*`)
+}
+
 func (s *SuiteConfig) TestExecJobBuildEmpty(c *C) {
 	j := &ExecJobConfig{}
 	j.buildMiddlewares()
@@ -1,20 +1,38 @@
 package cli
 
 import (
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Postcon/ofelia/core"
+	"github.com/Postcon/ofelia/middlewares"
 )
 
 // DaemonCommand daemon process
 type DaemonCommand struct {
-	ConfigFile string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFile   string        `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string        `long:"config-format" description:"format of the configuration file, ini or yaml, by default from its extension"`
+	LogFormat    string        `long:"log-format" description:"log format, text or json" default:"text"`
+	GracePeriod  time.Duration `long:"grace-period" description:"time to wait for the running jobs before cancelling them on shutdown" default:"5s"`
+	HTTPAddr     string        `long:"http-addr" description:"address of the HTTP status API, eg. :8080, disabled by default"`
+	DryRun       bool          `long:"dry-run" description:"log the executions on schedule without running the jobs"`
+	TriggerJobs  []string      `long:"trigger-job" env:"OFELIA_TRIGGER_JOB" env-delim:"," description:"job executed on SIGUSR1, can be repeated, all the jobs by default"`
+	Once         bool          `long:"once" description:"execute the jobs due at the current minute and exit, failing if any of them failed"`
+	OnceAll      bool          `long:"once-all" description:"as --once, executing all the jobs instead of the due ones"`
+	StartupDelay time.Duration `long:"startup-delay" description:"time the run-on-start and the scheduled executions wait after the daemon starts, eg. 30s"`
+	Profile      string        `long:"profile" env:"OFELIA_PROFILE" description:"profile of the config applied, selecting the values of an environment"`
+	DockerConfig
+	ServiceConfig
 
 	config    *Config
 	scheduler *core.Scheduler
 	signals   chan os.Signal
+	triggers  chan os.Signal
 	done      chan bool
 }
 
@@ -24,6 +42,10 @@ func (c *DaemonCommand) Execute(args []string) error {
 		return err
 	}
 
+	if c.Once || c.OnceAll {
+		return c.runOnce()
+	}
+
 	if err := c.start(); err != nil {
 		return err
 	}
@@ -36,24 +58,86 @@ func (c *DaemonCommand) Execute(args []string) error {
 }
 
 func (c *DaemonCommand) boot() error {
-	sh, err := BuildFromFile(c.ConfigFile)
+	logger, err := BuildLogger(c.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	c.config, err = ReadConfigFile(c.ConfigFile, c.ConfigFormat)
 	if err != nil {
 		return err
 	}
 
+	c.config.profile = c.Profile
+	c.config.Global.ServiceConfig.merge(&c.ServiceConfig)
+
+	sh, err := c.config.build(logger, &c.DockerConfig)
+	if err != nil {
+		return err
+	}
+
+	sh.DryRun = c.DryRun
+	sh.StartupDelay = c.StartupDelay
+	if sh.DryRun {
+		logger.Warningf("Dry-run mode enabled, the jobs will not be executed")
+	}
+
 	c.scheduler = sh
 	return nil
 }
 
+// runOnce executes the jobs once, without starting the cron, for ofelia being
+// invoked by an external scheduler, eg. a CI pipeline or a k8s CronJob.
+func (c *DaemonCommand) runOnce() error {
+	failed, err := c.scheduler.RunOnce(time.Now(), c.OnceAll)
+	if err != nil {
+		return err
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("jobs failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
 func (c *DaemonCommand) start() error {
 	c.setSignals()
 	if err := c.scheduler.Start(); err != nil {
 		return err
 	}
 
+	if c.HTTPAddr != "" {
+		go c.serveHTTP()
+	}
+
+	if c.config.Global.MetricsAddress != "" {
+		go c.serveMetrics()
+	}
+
 	return nil
 }
 
+// serveMetrics serves the metrics of the executions, at /metrics, for
+// Prometheus
+func (c *DaemonCommand) serveMetrics() {
+	addr := c.config.Global.MetricsAddress
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", middlewares.DefaultPrometheusRegistry)
+
+	c.scheduler.Logger.Noticef("Serving the Prometheus metrics at %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		c.scheduler.Logger.Errorf("Unable to serve the Prometheus metrics: %s", err)
+	}
+}
+
+func (c *DaemonCommand) serveHTTP() {
+	c.scheduler.Logger.Noticef("Serving the HTTP status API at %s", c.HTTPAddr)
+	if err := http.ListenAndServe(c.HTTPAddr, NewStatusHandler(c.scheduler, c.config.Global.APIToken)); err != nil {
+		c.scheduler.Logger.Errorf("Unable to serve the HTTP status API: %s", err)
+	}
+}
+
 func (c *DaemonCommand) setSignals() {
 	c.signals = make(chan os.Signal, 1)
 	c.done = make(chan bool, 1)
@@ -68,6 +152,57 @@ func (c *DaemonCommand) setSignals() {
 
 		c.done <- true
 	}()
+
+	c.triggers = make(chan os.Signal, 1)
+	signal.Notify(c.triggers, syscall.SIGUSR1)
+
+	go func() {
+		for sig := range c.triggers {
+			c.scheduler.Logger.Noticef("Signal recieved: %s, executing the jobs\n", sig)
+			c.trigger()
+		}
+	}()
+}
+
+// trigger executes immediately the jobs of triggerableJobs, in parallel, as
+// the run endpoint of the HTTP API does, through all their middlewares, so an
+// execution of a no-overlap job still running skips the new one.
+func (c *DaemonCommand) trigger() {
+	for _, j := range c.triggerableJobs() {
+		go func(j core.Job) {
+			if _, err := c.scheduler.Trigger(j, core.TriggerSignal); err != nil {
+				c.scheduler.Logger.Warningf("Job %q not executed: %s", j.GetName(), err)
+			}
+		}(j)
+	}
+}
+
+// triggerableJobs returns the jobs of --trigger-job, or every enabled job
+// without dependencies if none is given, the dependent jobs are executed
+// after the jobs they depend on.
+func (c *DaemonCommand) triggerableJobs() []core.Job {
+	var jobs []core.Job
+	if len(c.TriggerJobs) != 0 {
+		for _, name := range c.TriggerJobs {
+			j := c.scheduler.GetJob(name)
+			if j == nil {
+				c.scheduler.Logger.Errorf("Unable to trigger the job %q, it doesn't exist", name)
+				continue
+			}
+
+			jobs = append(jobs, j)
+		}
+
+		return jobs
+	}
+
+	for _, j := range c.scheduler.Jobs {
+		if j.IsEnabled() && len(j.GetDependencies()) == 0 {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return jobs
 }
 
 func (c *DaemonCommand) shutdown() error {
@@ -77,5 +212,5 @@ func (c *DaemonCommand) shutdown() error {
 	}
 
 	c.scheduler.Logger.Warningf("Waiting running jobs.")
-	return c.scheduler.Stop()
+	return c.scheduler.Shutdown(c.GracePeriod)
 }
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDaemon struct{}
+
+var _ = Suite(&SuiteDaemon{})
+
+func (s *SuiteDaemon) buildDaemon(c *C) *DaemonCommand {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = echo foo
+
+		[job-local "bar"]
+		depends-on = foo
+		command = echo bar
+
+		[job-local "qux"]
+		schedule = @every 10s
+		enabled = false
+		command = echo qux
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+	return &DaemonCommand{scheduler: sh}
+}
+
+func (s *SuiteDaemon) TestTriggerableJobs(c *C) {
+	d := s.buildDaemon(c)
+	c.Assert(jobNames(d.triggerableJobs()), DeepEquals, []string{"foo"})
+}
+
+func (s *SuiteDaemon) TestTriggerableJobsGiven(c *C) {
+	d := s.buildDaemon(c)
+	d.TriggerJobs = []string{"bar", "qux", "baz"}
+	c.Assert(jobNames(d.triggerableJobs()), DeepEquals, []string{"bar", "qux"})
+}
+
+func jobNames(jobs []core.Job) []string {
+	var names []string
+	for _, j := range jobs {
+		names = append(names, j.GetName())
+	}
+
+	return names
+}
+
+func (s *SuiteDaemon) TestRunOnce(c *C) {
+	d := s.buildDaemon(c)
+	d.OnceAll = true
+	c.Assert(d.runOnce(), IsNil)
+	c.Assert(d.scheduler.History("foo"), HasLen, 1)
+	c.Assert(d.scheduler.History("bar"), HasLen, 1)
+	c.Assert(d.scheduler.History("qux"), HasLen, 0)
+}
+
+func (s *SuiteDaemon) TestRunOnceFailed(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @daily
+		command = false
+  `, logger, nil)
+	c.Assert(err, IsNil)
+
+	d := &DaemonCommand{scheduler: sh, OnceAll: true}
+	c.Assert(d.runOnce(), ErrorMatches, "jobs failed: foo")
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// negotiationTimeout is the time waited for the daemon to report its API
+// version, if exceeded the client is used unversioned
+var negotiationTimeout = 10 * time.Second
+
+// DockerConfig contains the options to connect to docker, when the host is not
+// given the DOCKER_HOST, DOCKER_TLS_VERIFY and DOCKER_CERT_PATH variables are
+// used, as the docker cli does.
+type DockerConfig struct {
+	DockerHost       string `gcfg:"docker-host" long:"docker-host" description:"docker endpoint, eg. tcp://swarm-manager:2376"`
+	DockerTLS        bool   `gcfg:"docker-tls" long:"docker-tls" description:"use TLS to connect to docker"`
+	DockerCertPath   string `gcfg:"docker-cert-path" long:"docker-cert-path" description:"folder with the ca.pem, cert.pem and key.pem files"`
+	DockerAPIVersion string `gcfg:"docker-api-version" long:"docker-api-version" description:"docker API version, eg. 1.41, by default the version of the daemon is negotiated"`
+}
+
+// merge overrides the options with the non empty options of o
+func (c *DockerConfig) merge(o *DockerConfig) {
+	if o == nil {
+		return
+	}
+
+	if o.DockerHost != "" {
+		c.DockerHost = o.DockerHost
+	}
+
+	if o.DockerTLS {
+		c.DockerTLS = true
+	}
+
+	if o.DockerCertPath != "" {
+		c.DockerCertPath = o.DockerCertPath
+	}
+
+	if o.DockerAPIVersion != "" {
+		c.DockerAPIVersion = o.DockerAPIVersion
+	}
+}
+
+// negotiateClient returns a client using the docker-api-version, if pinned,
+// otherwise the API version reported by the daemon, so the calls are always
+// compatible with older daemons. If the daemon can't be reached the client is
+// used unversioned.
+func (c *DockerConfig) negotiateClient(logger core.Logger) (*docker.Client, error) {
+	if c.DockerAPIVersion != "" {
+		logger.Noticef("Using the docker API version %s", c.DockerAPIVersion)
+		return c.buildClient()
+	}
+
+	client, err := c.buildVersionedClient("")
+	if err != nil {
+		return nil, err
+	}
+
+	client.SetTimeout(negotiationTimeout)
+	env, err := client.Version()
+	if err != nil || env.Get("ApiVersion") == "" {
+		logger.Warningf("Unable to negotiate the docker API version, using the daemon default: %v", err)
+		return c.buildVersionedClient("")
+	}
+
+	logger.Noticef("Using the docker API version %s, negotiated with the daemon", env.Get("ApiVersion"))
+	return c.buildVersionedClient(env.Get("ApiVersion"))
+}
+
+func (c *DockerConfig) buildClient() (*docker.Client, error) {
+	return c.buildVersionedClient(c.DockerAPIVersion)
+}
+
+// buildVersionedClient returns a client using the given API version, an empty
+// version means unversioned calls, using the version of the daemon
+func (c *DockerConfig) buildVersionedClient(version string) (*docker.Client, error) {
+	host := c.DockerHost
+	if host == "" {
+		if !c.DockerTLS {
+			return docker.NewVersionedClientFromEnv(version)
+		}
+
+		host = os.Getenv("DOCKER_HOST")
+	}
+
+	if !c.DockerTLS {
+		return docker.NewVersionedClient(host, version)
+	}
+
+	path := c.DockerCertPath
+	if path == "" {
+		path = os.Getenv("DOCKER_CERT_PATH")
+	}
+
+	return docker.NewVersionedTLSClient(
+		host,
+		filepath.Join(path, "cert.pem"),
+		filepath.Join(path, "key.pem"),
+		filepath.Join(path, "ca.pem"),
+		version,
+	)
+}
+
+// dockerClients is a pool of docker clients keyed by host, the jobs with a
+// docker-host of their own get its client, built with the TLS and API version
+// options of the [global] section. Every host has its own client, so an
+// unreachable host doesn't affect the jobs of the others.
+type dockerClients struct {
+	config  DockerConfig
+	logger  core.Logger
+	clients map[string]*docker.Client
+}
+
+// newDockerClients returns a pool using the given client for the host of the
+// given config, and for the jobs without docker-host.
+func newDockerClients(config DockerConfig, logger core.Logger, client *docker.Client) *dockerClients {
+	return &dockerClients{
+		config:  config,
+		logger:  logger,
+		clients: map[string]*docker.Client{"": client, config.DockerHost: client},
+	}
+}
+
+// get returns the client of the given host, building it the first time
+func (p *dockerClients) get(host string) (*docker.Client, error) {
+	if client, ok := p.clients[host]; ok {
+		return client, nil
+	}
+
+	config := p.config
+	config.DockerHost = host
+
+	p.logger.Noticef("Connecting to the docker host %s", host)
+	client, err := config.negotiateClient(p.logger)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to docker-host %q: %s", host, err)
+	}
+
+	p.clients[host] = client
+	return client, nil
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDocker struct{}
+
+var _ = Suite(&SuiteDocker{})
+
+func (s *SuiteDocker) TestMerge(c *C) {
+	config := &DockerConfig{DockerHost: "tcp://foo:2375", DockerCertPath: "/foo"}
+	config.merge(&DockerConfig{DockerHost: "tcp://bar:2376", DockerTLS: true})
+
+	c.Assert(config.DockerHost, Equals, "tcp://bar:2376")
+	c.Assert(config.DockerTLS, Equals, true)
+	c.Assert(config.DockerCertPath, Equals, "/foo")
+
+	config.merge(nil)
+	c.Assert(config.DockerHost, Equals, "tcp://bar:2376")
+}
+
+func (s *SuiteDocker) TestBuildClientHost(c *C) {
+	config := &DockerConfig{DockerHost: "tcp://foo:2375"}
+
+	client, err := config.buildClient()
+	c.Assert(err, IsNil)
+	c.Assert(client.Endpoint(), Equals, "tcp://foo:2375")
+}
+
+func (s *SuiteDocker) TestBuildClientTLSMissingCerts(c *C) {
+	config := &DockerConfig{DockerHost: "tcp://foo:2376", DockerTLS: true, DockerCertPath: "/non-existent"}
+
+	_, err := config.buildClient()
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteDocker) TestBuildClientVersion(c *C) {
+	config := &DockerConfig{DockerHost: "tcp://foo:2375", DockerAPIVersion: "1.30"}
+
+	_, err := config.buildClient()
+	c.Assert(err, IsNil)
+
+	config.DockerAPIVersion = "foo"
+	_, err = config.buildClient()
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteDocker) TestNegotiateClient(c *C) {
+	var lock sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ApiVersion": "1.30"}`))
+	}))
+
+	defer ts.Close()
+
+	logger, _ := BuildLogger("text")
+	config := &DockerConfig{DockerHost: ts.URL}
+
+	client, err := config.negotiateClient(logger)
+	c.Assert(err, IsNil)
+
+	client.Version()
+	c.Assert(paths[0], Equals, "/version")
+	c.Assert(paths[len(paths)-1], Equals, "/v1.30/version")
+}
+
+func (s *SuiteDocker) TestNegotiateClientPinned(c *C) {
+	var lock sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ApiVersion": "1.30"}`))
+	}))
+
+	defer ts.Close()
+
+	logger, _ := BuildLogger("text")
+	config := &DockerConfig{DockerHost: ts.URL, DockerAPIVersion: "1.25"}
+
+	client, err := config.negotiateClient(logger)
+	c.Assert(err, IsNil)
+
+	client.Version()
+	c.Assert(paths[len(paths)-1], Equals, "/v1.25/version")
+}
+
+func (s *SuiteDocker) TestDockerClients(c *C) {
+	logger, _ := BuildLogger("text")
+	config := &DockerConfig{DockerHost: "tcp://foo:2375", DockerAPIVersion: "1.30"}
+	global, err := config.buildClient()
+	c.Assert(err, IsNil)
+
+	clients := newDockerClients(*config, logger, global)
+
+	client, err := clients.get("")
+	c.Assert(err, IsNil)
+	c.Assert(client, Equals, global)
+
+	client, err = clients.get("tcp://foo:2375")
+	c.Assert(err, IsNil)
+	c.Assert(client, Equals, global)
+
+	client, err = clients.get("tcp://bar:2375")
+	c.Assert(err, IsNil)
+	c.Assert(client.Endpoint(), Equals, "tcp://bar:2375")
+
+	again, err := clients.get("tcp://bar:2375")
+	c.Assert(err, IsNil)
+	c.Assert(again, Equals, client)
+}
+
+func (s *SuiteDocker) TestDockerClientsInvalidHost(c *C) {
+	logger, _ := BuildLogger("text")
+	clients := newDockerClients(DockerConfig{DockerAPIVersion: "1.30"}, logger, nil)
+
+	_, err := clients.get("foo://bar")
+	c.Assert(err, ErrorMatches, `unable to connect to docker-host "foo://bar": .*`)
+}
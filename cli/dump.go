@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const redacted = "<redacted>"
+
+// ConfigCommand groups the commands inspecting the config file
+type ConfigCommand struct {
+	Dump ConfigDumpCommand `command:"dump" description:"prints the resolved config, with the secrets redacted"`
+}
+
+// ConfigDumpCommand prints the config as the scheduler sees it
+type ConfigDumpCommand struct {
+	ConfigFile   string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string `long:"config-format" description:"format of the configuration file, ini or yaml, by default from its extension"`
+	Format       string `long:"format" description:"output format, ini or json" default:"ini" choice:"ini" choice:"json"`
+	Profile      string `long:"profile" env:"OFELIA_PROFILE" description:"profile of the config applied, selecting the values of an environment"`
+}
+
+// Execute prints the config file with the secret files read, the defaults set
+// and the options of the [global] section applied to the jobs, the secrets are
+// redacted. The scheduler is not started, no connection to docker is required.
+func (c *ConfigDumpCommand) Execute(args []string) error {
+	config, err := ReadConfigFile(c.ConfigFile, c.ConfigFormat)
+	if err != nil {
+		return err
+	}
+
+	config.profile = c.Profile
+	if err := config.resolve(); err != nil {
+		return err
+	}
+
+	return config.dump(os.Stdout, c.Format)
+}
+
+// dump writes the config in the given format, ini or json, only the options
+// with a value are written.
+func (c *Config) dump(w io.Writer, format string) error {
+	sections := c.dumpSections()
+
+	switch format {
+	case "json":
+		return dumpJSON(w, sections)
+	case "ini":
+		return dumpINI(w, sections)
+	}
+
+	return fmt.Errorf("unknown format %q, expected ini or json", format)
+}
+
+type dumpSection struct {
+	kind, name string
+	options    []dumpOption
+}
+
+type dumpOption struct {
+	key      string
+	values   []reflect.Value
+	repeated bool
+}
+
+// dumpSections returns the [global] section followed by the jobs, sorted by
+// type and name.
+func (c *Config) dumpSections() []dumpSection {
+	sections := []dumpSection{{kind: "global", options: dumpOptions(reflect.ValueOf(c.Global))}}
+	for _, jobs := range []struct {
+		kind string
+		jobs interface{}
+	}{
+		{"job-exec", c.ExecJobs},
+		{"job-run", c.RunJobs},
+		{"job-service-run", c.ServiceJobs},
+		{"job-local", c.LocalJobs},
+		{"job-ecs-run", c.ECSJobs},
+	} {
+		m := reflect.ValueOf(jobs.jobs)
+		names := make([]string, 0, m.Len())
+		for _, k := range m.MapKeys() {
+			names = append(names, k.String())
+		}
+
+		sort.Strings(names)
+		for _, name := range names {
+			sections = append(sections, dumpSection{
+				kind:    jobs.kind,
+				name:    name,
+				options: dumpOptions(m.MapIndex(reflect.ValueOf(name)).Elem()),
+			})
+		}
+	}
+
+	return sections
+}
+
+// dumpOptions returns the options with a value of the given struct, including
+// the embedded ones, the keys with a secret file twin, as `slack-webhook`, are
+// redacted.
+func dumpOptions(v reflect.Value) []dumpOption {
+	var options []dumpOption
+	keys := make(map[string]bool, 0)
+	collectDumpOptions(v, &options, keys)
+
+	for i, o := range options {
+		if keys[o.key+secretFileSuffix] {
+			options[i].values = []reflect.Value{reflect.ValueOf(redacted)}
+			options[i].repeated = false
+		}
+	}
+
+	return options
+}
+
+func collectDumpOptions(v reflect.Value, options *[]dumpOption, keys map[string]bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			collectDumpOptions(v.Field(i), options, keys)
+			continue
+		}
+
+		key := f.Tag.Get("gcfg")
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+
+		keys[key] = true
+
+		values := dumpValues(v.Field(i))
+		if len(values) != 0 {
+			*options = append(*options, dumpOption{
+				key:      key,
+				values:   values,
+				repeated: f.Type.Kind() == reflect.Slice,
+			})
+		}
+	}
+}
+
+// dumpValues returns the values of the given field, one per repeated key, none
+// if the field is empty or can't be set from the config.
+func dumpValues(v reflect.Value) []reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Func, reflect.Chan, reflect.Struct:
+		return nil
+	case reflect.Slice:
+		values := make([]reflect.Value, v.Len())
+		for i := range values {
+			values[i] = v.Index(i)
+		}
+
+		return values
+	}
+
+	if v.Interface() == reflect.Zero(v.Type()).Interface() {
+		return nil
+	}
+
+	return []reflect.Value{v}
+}
+
+func dumpString(v reflect.Value) string {
+	return fmt.Sprint(dumpValue(v))
+}
+
+// dumpValue returns the value of the given field, the types read from text,
+// as the durations, are returned as text.
+func dumpValue(v reflect.Value) interface{} {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+
+	return v.Interface()
+}
+
+func dumpINI(w io.Writer, sections []dumpSection) error {
+	for i, s := range sections {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+
+		if s.name == "" {
+			fmt.Fprintf(w, "[%s]\n", s.kind)
+		} else {
+			fmt.Fprintf(w, "[%s %s]\n", s.kind, quoteINI(s.name, true))
+		}
+
+		for _, o := range s.options {
+			for _, v := range o.values {
+				if _, err := fmt.Fprintf(w, "%s = %s\n", o.key, quoteINI(dumpString(v), false)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// quoteINI quotes the given value if it would not be read back as is by gcfg,
+// the subsection names are always quoted.
+func quoteINI(value string, always bool) string {
+	if !always && value != "" && strings.TrimSpace(value) == value && !strings.ContainsAny(value, `;#"\`+"\n\t") {
+		return value
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// dumpJSON writes the config as an object with the global options and an
+// object by job type with the jobs by name, the repeated keys are arrays.
+func dumpJSON(w io.Writer, sections []dumpSection) error {
+	out := make(map[string]interface{}, 0)
+	for _, s := range sections {
+		options := make(map[string]interface{}, len(s.options))
+		for _, o := range s.options {
+			values := make([]interface{}, len(o.values))
+			for i, v := range o.values {
+				values[i] = dumpValue(v)
+			}
+
+			if o.repeated {
+				options[o.key] = values
+			} else {
+				options[o.key] = values[0]
+			}
+		}
+
+		if s.name == "" {
+			out[s.kind] = options
+			continue
+		}
+
+		jobs, _ := out[s.kind].(map[string]interface{})
+		if jobs == nil {
+			jobs = make(map[string]interface{}, 0)
+			out[s.kind] = jobs
+		}
+
+		jobs[s.name] = options
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(out)
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/gcfg.v1"
+)
+
+type SuiteDump struct{}
+
+var _ = Suite(&SuiteDump{})
+
+const dumpConfigFixture = `
+	[global]
+	slack-webhook = http://example.com/hook
+	user = nobody
+	max-history = 5
+
+	[job-run "foo"]
+	schedule = @every 10s
+	image = busybox
+	command = echo "foo; bar"
+	dns = 1.1.1.1
+	dns = 8.8.8.8
+	max-runtime = 90s
+
+	[job-local "bar"]
+	schedule = @hourly
+	command = echo bar
+	max-history = 2
+	`
+
+func (s *SuiteDump) readConfig(c *C, config string) *Config {
+	cfg := &Config{}
+	c.Assert(gcfg.ReadStringInto(cfg, config), IsNil)
+	c.Assert(cfg.resolve(), IsNil)
+
+	return cfg
+}
+
+func (s *SuiteDump) TestDumpINI(c *C) {
+	var out bytes.Buffer
+	c.Assert(s.readConfig(c, dumpConfigFixture).dump(&out, "ini"), IsNil)
+
+	dump := out.String()
+	c.Assert(strings.HasPrefix(dump, "[global]\n"), Equals, true)
+	c.Assert(strings.Contains(dump, "slack-webhook = <redacted>\n"), Equals, true)
+	c.Assert(strings.Contains(dump, "http://example.com/hook"), Equals, false)
+
+	foo := dump[strings.Index(dump, `[job-run "foo"]`):strings.Index(dump, `[job-local "bar"]`)]
+	c.Assert(strings.Contains(foo, "user = nobody\n"), Equals, true)
+	c.Assert(strings.Contains(foo, "max-history = 5\n"), Equals, true)
+	c.Assert(strings.Contains(foo, "max-runtime = 1m30s\n"), Equals, true)
+	c.Assert(strings.Contains(foo, "dns = 1.1.1.1\ndns = 8.8.8.8\n"), Equals, true)
+	c.Assert(strings.Contains(foo, `command = "echo \"foo; bar\""`+"\n"), Equals, true)
+	c.Assert(strings.Contains(foo, "delete = true\n"), Equals, true)
+
+	bar := dump[strings.Index(dump, `[job-local "bar"]`):]
+	c.Assert(strings.Contains(bar, "max-history = 2\n"), Equals, true)
+}
+
+func (s *SuiteDump) TestDumpINIReadBack(c *C) {
+	var first, second bytes.Buffer
+	c.Assert(s.readConfig(c, dumpConfigFixture).dump(&first, "ini"), IsNil)
+	c.Assert(s.readConfig(c, first.String()).dump(&second, "ini"), IsNil)
+	c.Assert(second.String(), Equals, first.String())
+}
+
+func (s *SuiteDump) TestDumpJSON(c *C) {
+	var out bytes.Buffer
+	c.Assert(s.readConfig(c, dumpConfigFixture).dump(&out, "json"), IsNil)
+
+	var dump map[string]map[string]interface{}
+	c.Assert(json.Unmarshal(out.Bytes(), &dump), IsNil)
+	c.Assert(dump["global"]["slack-webhook"], Equals, redacted)
+	c.Assert(dump["global"]["max-history"], Equals, float64(5))
+
+	foo := dump["job-run"]["foo"].(map[string]interface{})
+	c.Assert(foo["image"], Equals, "busybox")
+	c.Assert(foo["max-runtime"], Equals, "1m30s")
+	c.Assert(foo["dns"], DeepEquals, []interface{}{"1.1.1.1", "8.8.8.8"})
+
+	c.Assert(dump["job-local"]["bar"], NotNil)
+	c.Assert(dump["job-exec"], IsNil)
+}
+
+func (s *SuiteDump) TestDumpUnknownFormat(c *C) {
+	c.Assert((&Config{}).dump(&bytes.Buffer{}, "yaml"), ErrorMatches, `unknown format "yaml".*`)
+}
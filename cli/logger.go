@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+	"github.com/op/go-logging"
+)
+
+const logFormat = "%{color}%{shortfile} ▶ %{level}%{color:reset} %{message}"
+
+// BuildLogger returns a logger for the given format, `text` or `json`
+func BuildLogger(format string) (core.Logger, error) {
+	switch format {
+	case "", "text":
+		logging.SetFormatter(logging.MustStringFormatter(logFormat))
+		return NewTextLogger(logging.MustGetLogger("ofelia")), nil
+	case "json":
+		return NewJSONLogger(os.Stderr), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// TextLogger is a core.Logger writing the entries as text lines, the entries
+// logged during an execution are prefixed with the job, the instance and the
+// ID of the execution, eg. `[backup/backup_1 run=4f1c2a] Created service`.
+type TextLogger struct {
+	l   *logging.Logger
+	job core.Job
+	e   *core.Execution
+}
+
+// NewTextLogger returns a new TextLogger writing to l, the file reported at
+// the entries is still the caller, not this logger.
+func NewTextLogger(l *logging.Logger) *TextLogger {
+	l.ExtraCalldepth = 1
+	return &TextLogger{l: l}
+}
+
+// WithExecution returns a copy of the logger prefixing the entries with the
+// given job and execution
+func (l *TextLogger) WithExecution(j core.Job, e *core.Execution) core.Logger {
+	return &TextLogger{l: l.l, job: j, e: e}
+}
+
+func (l *TextLogger) Criticalf(format string, args ...interface{}) {
+	l.l.Criticalf(l.prefix()+format, args...)
+}
+
+func (l *TextLogger) Debugf(format string, args ...interface{}) {
+	l.l.Debugf(l.prefix()+format, args...)
+}
+
+func (l *TextLogger) Errorf(format string, args ...interface{}) {
+	l.l.Errorf(l.prefix()+format, args...)
+}
+
+func (l *TextLogger) Noticef(format string, args ...interface{}) {
+	l.l.Noticef(l.prefix()+format, args...)
+}
+
+func (l *TextLogger) Warningf(format string, args ...interface{}) {
+	l.l.Warningf(l.prefix()+format, args...)
+}
+
+// prefix returns the prefix of the entries, the instance is read on every
+// entry since it's set once the execution starts.
+func (l *TextLogger) prefix() string {
+	if l.job == nil {
+		return ""
+	}
+
+	prefix, instance := l.job.GetName(), l.job.GetInstanceName()
+	if instance != "" && instance != prefix {
+		prefix += "/" + instance
+	}
+
+	if l.e != nil {
+		prefix += " run=" + l.e.ID
+	}
+
+	return "[" + strings.Replace(prefix, "%", "%%", -1) + "] "
+}
+
+// JSONLogger is a core.Logger writing every entry as a JSON object per line,
+// the entries logged during an execution contain the job, the instance and
+// the ID of the execution.
+type JSONLogger struct {
+	w   io.Writer
+	m   *sync.Mutex
+	job core.Job
+	e   *core.Execution
+}
+
+// NewJSONLogger returns a new JSONLogger writing to w
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{w: w, m: &sync.Mutex{}}
+}
+
+// WithExecution returns a copy of the logger tagging the entries with the
+// given job and execution
+func (l *JSONLogger) WithExecution(j core.Job, e *core.Execution) core.Logger {
+	return &JSONLogger{w: l.w, m: l.m, job: j, e: e}
+}
+
+func (l *JSONLogger) Criticalf(format string, args ...interface{}) {
+	l.log("CRITICAL", format, args...)
+}
+
+func (l *JSONLogger) Debugf(format string, args ...interface{}) {
+	l.log("DEBUG", format, args...)
+}
+
+func (l *JSONLogger) Errorf(format string, args ...interface{}) {
+	l.log("ERROR", format, args...)
+}
+
+func (l *JSONLogger) Noticef(format string, args ...interface{}) {
+	l.log("NOTICE", format, args...)
+}
+
+func (l *JSONLogger) Warningf(format string, args ...interface{}) {
+	l.log("WARNING", format, args...)
+}
+
+type jsonEntry struct {
+	Level     string `json:"level"`
+	Timestamp string `json:"ts"`
+	Job       string `json:"job,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	Message   string `json:"msg"`
+}
+
+func (l *JSONLogger) log(level, format string, args ...interface{}) {
+	e := &jsonEntry{
+		Level:     level,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Message:   strings.TrimSpace(fmt.Sprintf(format, args...)),
+	}
+
+	if l.job != nil {
+		e.Job = l.job.GetName()
+		e.Instance = l.job.GetInstanceName()
+	}
+
+	if l.e != nil {
+		e.RunID = l.e.ID
+	}
+
+	js, _ := json.Marshal(e)
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.w.Write(append(js, '\n'))
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/Postcon/ofelia/core"
+	"github.com/op/go-logging"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLogger struct{}
+
+var _ = Suite(&SuiteLogger{})
+
+func (s *SuiteLogger) TestBuildLoggerUnknown(c *C) {
+	_, err := BuildLogger("foo")
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteLogger) TestJSONLogger(c *C) {
+	b := bytes.NewBuffer(nil)
+	l := NewJSONLogger(b)
+	l.Noticef("foo %s\n", "bar")
+
+	var e jsonEntry
+	c.Assert(json.Unmarshal(b.Bytes(), &e), IsNil)
+	c.Assert(e.Level, Equals, "NOTICE")
+	c.Assert(e.Message, Equals, "foo bar")
+	c.Assert(e.Job, Equals, "")
+	c.Assert(e.Timestamp, Not(Equals), "")
+}
+
+func (s *SuiteLogger) TestJSONLoggerWithExecution(c *C) {
+	j := &core.LocalJob{}
+	j.Name = "foo"
+	j.InstanceName = "foo_1"
+
+	b := bytes.NewBuffer(nil)
+	NewJSONLogger(b).WithExecution(j, &core.Execution{ID: "bar"}).Errorf("qux")
+
+	var e jsonEntry
+	c.Assert(json.Unmarshal(b.Bytes(), &e), IsNil)
+	c.Assert(e.Level, Equals, "ERROR")
+	c.Assert(e.Job, Equals, "foo")
+	c.Assert(e.Instance, Equals, "foo_1")
+	c.Assert(e.RunID, Equals, "bar")
+}
+
+func (s *SuiteLogger) TestTextLoggerPrefix(c *C) {
+	j := &core.LocalJob{}
+	j.Name = "foo"
+
+	l := NewTextLogger(logging.MustGetLogger("ofelia"))
+	c.Assert(l.prefix(), Equals, "")
+
+	jl := l.WithExecution(j, nil).(*TextLogger)
+	c.Assert(jl.prefix(), Equals, "[foo] ")
+
+	j.InstanceName = "foo_1"
+	c.Assert(jl.prefix(), Equals, "[foo/foo_1] ")
+
+	j.Name, j.InstanceName = "100%", ""
+	c.Assert(jl.prefix(), Equals, "[100%%] ")
+
+	jl = l.WithExecution(j, &core.Execution{ID: "bar"}).(*TextLogger)
+	c.Assert(jl.prefix(), Equals, "[100%% run=bar] ")
+}
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ProfileConfig is a named group of values selected with --profile, allowing
+// a single config to serve several environments, eg. staging and production
+// pulling the same images from different registries.
+type ProfileConfig struct {
+	Registry string   `gcfg:"registry"`
+	Var      []string `gcfg:"var"`
+}
+
+var variableRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// applyProfile applies the selected profile, its registry replaces the one of
+// the [global] section, and expands the variables, as `${TAG}`, at the
+// registry and the image of the jobs, from the vars of the profile or the
+// environment variables, in this order. An unknown profile or an undefined
+// variable is an error.
+func (c *Config) applyProfile() error {
+	vars := make(map[string]string, 0)
+	if c.profile != "" {
+		p, ok := c.Profiles[c.profile]
+		if !ok {
+			return fmt.Errorf("unknown profile %q", c.profile)
+		}
+
+		if p.Registry != "" {
+			c.Global.Registry = p.Registry
+		}
+
+		for _, v := range p.Var {
+			parts := strings.SplitN(v, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("invalid var %q of profile %q, expected NAME=value", v, c.profile)
+			}
+
+			vars[parts[0]] = parts[1]
+		}
+	}
+
+	expand := func(section, name, option string, value *string) error {
+		expanded, err := expandVariables(*value, vars)
+		if err != nil && name == "" {
+			return fmt.Errorf("[%s] %s: %s", section, option, err)
+		}
+
+		if err != nil {
+			return fmt.Errorf("[%s %q] %s: %s", section, name, option, err)
+		}
+
+		*value = expanded
+		return nil
+	}
+
+	if err := expand("global", "", "registry", &c.Global.Registry); err != nil {
+		return err
+	}
+
+	for name, j := range c.RunJobs {
+		if err := expand("job-run", name, "registry", &j.Registry); err != nil {
+			return err
+		}
+
+		if err := expand("job-run", name, "image", &j.Image); err != nil {
+			return err
+		}
+	}
+
+	for name, j := range c.ServiceJobs {
+		if err := expand("job-service-run", name, "registry", &j.Registry); err != nil {
+			return err
+		}
+
+		if err := expand("job-service-run", name, "image", &j.Image); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expandVariables replaces the variables of the value, as `${NAME}`, by the
+// given vars or, when not given, by the environment variables.
+func expandVariables(value string, vars map[string]string) (string, error) {
+	var err error
+	expanded := variableRegexp.ReplaceAllStringFunc(value, func(v string) string {
+		name := variableRegexp.FindStringSubmatch(v)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+
+		if err == nil {
+			err = fmt.Errorf("undefined variable %q", name)
+		}
+
+		return v
+	})
+
+	return expanded, err
+}
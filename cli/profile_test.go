@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"os"
+
+	. "gopkg.in/check.v1"
+	"gopkg.in/gcfg.v1"
+)
+
+type SuiteProfile struct{}
+
+var _ = Suite(&SuiteProfile{})
+
+const profileConfig = `
+	[global]
+	registry = registry.example.com
+
+	[profile "staging"]
+	registry = registry.staging.example.com
+	var = TAG=latest
+
+	[job-run "foo"]
+	schedule = @hourly
+	image = app:${TAG}
+
+	[job-run "bar"]
+	schedule = @hourly
+	image = app
+	registry = ${BAR_REGISTRY}
+
+	[job-service-run "baz"]
+	schedule = @hourly
+	image = worker:${TAG}
+`
+
+func (s *SuiteProfile) readConfig(c *C, profile string) *Config {
+	config := &Config{}
+	c.Assert(gcfg.ReadStringInto(config, profileConfig), IsNil)
+	config.profile = profile
+
+	return config
+}
+
+func (s *SuiteProfile) TestApplyProfile(c *C) {
+	os.Setenv("TAG", "1.2.3")
+	os.Setenv("BAR_REGISTRY", "other.example.com")
+	defer os.Unsetenv("TAG")
+	defer os.Unsetenv("BAR_REGISTRY")
+
+	config := s.readConfig(c, "staging")
+	c.Assert(config.resolve(), IsNil)
+
+	c.Assert(config.RunJobs["foo"].Image, Equals, "app:latest")
+	c.Assert(config.RunJobs["foo"].Registry, Equals, "registry.staging.example.com")
+	c.Assert(config.RunJobs["bar"].Registry, Equals, "other.example.com")
+	c.Assert(config.ServiceJobs["baz"].Image, Equals, "worker:latest")
+	c.Assert(config.ServiceJobs["baz"].Registry, Equals, "registry.staging.example.com")
+}
+
+func (s *SuiteProfile) TestApplyProfileEnvironment(c *C) {
+	os.Setenv("TAG", "1.2.3")
+	os.Setenv("BAR_REGISTRY", "other.example.com")
+	defer os.Unsetenv("TAG")
+	defer os.Unsetenv("BAR_REGISTRY")
+
+	config := s.readConfig(c, "")
+	c.Assert(config.resolve(), IsNil)
+
+	c.Assert(config.RunJobs["foo"].Image, Equals, "app:1.2.3")
+	c.Assert(config.RunJobs["foo"].Registry, Equals, "registry.example.com")
+}
+
+func (s *SuiteProfile) TestApplyProfileUndefined(c *C) {
+	config := s.readConfig(c, "staging")
+	c.Assert(config.resolve(), ErrorMatches, `\[job-run "bar"\] registry: undefined variable "BAR_REGISTRY"`)
+}
+
+func (s *SuiteProfile) TestApplyProfileUnknown(c *C) {
+	config := s.readConfig(c, "production")
+	c.Assert(config.resolve(), ErrorMatches, `unknown profile "production"`)
+}
+
+func (s *SuiteProfile) TestValidateTemplated(c *C) {
+	_, errs := ValidateString(profileConfig)
+	c.Assert(errs, HasLen, 0)
+}
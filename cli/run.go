@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// RunCommand runs a single job immediately
+type RunCommand struct {
+	ConfigFile   string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string `long:"config-format" description:"format of the configuration file, ini or yaml, by default from its extension"`
+	LogFormat    string `long:"log-format" description:"log format, text or json" default:"text"`
+	Profile      string `long:"profile" env:"OFELIA_PROFILE" description:"profile of the config applied, selecting the values of an environment"`
+	Job          string `long:"job" description:"name of the job to run" required:"true"`
+	DockerConfig
+	ServiceConfig
+}
+
+// Execute runs the job through all its middlewares, the output of the job is
+// written to the terminal. If the job finishes with a non-zero exit code a
+// core.NonZeroExitError is returned.
+func (c *RunCommand) Execute(args []string) error {
+	logger, err := BuildLogger(c.LogFormat)
+	if err != nil {
+		return err
+	}
+
+	config, err := ReadConfigFile(c.ConfigFile, c.ConfigFormat)
+	if err != nil {
+		return err
+	}
+
+	config.profile = c.Profile
+	config.Global.ServiceConfig.merge(&c.ServiceConfig)
+	sh, err := config.build(logger, &c.DockerConfig)
+	if err != nil {
+		return err
+	}
+
+	j := sh.GetJob(c.Job)
+	if j == nil {
+		return fmt.Errorf("unable to find job %q", c.Job)
+	}
+
+	e := core.NewExecution()
+	e.LimitOutput(j.GetMaxOutputBytes())
+	if j.ShouldStripANSI() {
+		e.StripANSI()
+	}
+
+	e.OutputStream = &teeStream{e.OutputStream, os.Stdout}
+	e.ErrorStream = &teeStream{e.ErrorStream, os.Stderr}
+
+	sh.RunJob(j, e)
+	if e.Failed {
+		return e.Error
+	}
+
+	return nil
+}
+
+// teeStream writes to the terminal everything written to the stream, while
+// keeping it readable for the middlewares.
+type teeStream struct {
+	io.ReadWriter
+	w io.Writer
+}
+
+func (t *teeStream) Write(p []byte) (int, error) {
+	t.w.Write(p)
+	return t.ReadWriter.Write(p)
+}
+
+// Bytes returns the content of the wrapped stream, without consuming it, so
+// every middleware reads the whole output, as without the terminal.
+func (t *teeStream) Bytes() []byte {
+	if b, ok := t.ReadWriter.(interface{ Bytes() []byte }); ok {
+		return b.Bytes()
+	}
+
+	content, _ := ioutil.ReadAll(t.ReadWriter)
+	return content
+}
@@ -0,0 +1,23 @@
+package cli
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRun struct{}
+
+var _ = Suite(&SuiteRun{})
+
+func (s *SuiteRun) TestTeeStream(c *C) {
+	terminal := bytes.NewBuffer(nil)
+	t := &teeStream{bytes.NewBuffer(nil), terminal}
+	t.Write([]byte("foo"))
+
+	c.Assert(terminal.String(), Equals, "foo")
+
+	// the content is still there for the next middlewares
+	c.Assert(string(t.Bytes()), Equals, "foo")
+	c.Assert(string(t.Bytes()), Equals, "foo")
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+const secretFileSuffix = "-file"
+
+// resolveSecretFiles walks the given config looking for keys ending with
+// `-file`, as `slack-webhook-file`, the trimmed content of the file is stored
+// at the key without the suffix, allowing to keep the secrets out of the
+// config, eg: at a docker secret.
+func resolveSecretFiles(v interface{}) error {
+	return resolveSecretFilesValue(reflect.ValueOf(v))
+}
+
+func resolveSecretFilesValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return resolveSecretFilesValue(v.Elem())
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := resolveSecretFilesValue(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return resolveSecretFilesStruct(v)
+	}
+
+	return nil
+}
+
+func resolveSecretFilesStruct(v reflect.Value) error {
+	t := v.Type()
+	keys := make(map[string]reflect.Value, 0)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			continue
+		}
+
+		if key := t.Field(i).Tag.Get("gcfg"); key != "" {
+			keys[key] = v.Field(i)
+		}
+
+		if err := resolveSecretFilesValue(v.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	for key, f := range keys {
+		if !strings.HasSuffix(key, secretFileSuffix) || f.Kind() != reflect.String || f.String() == "" {
+			continue
+		}
+
+		name := strings.TrimSuffix(key, secretFileSuffix)
+		target, ok := keys[name]
+		if !ok || target.Kind() != reflect.String {
+			continue
+		}
+
+		if target.String() != "" {
+			return fmt.Errorf("only one of %q or %q can be set", name, key)
+		}
+
+		content, err := ioutil.ReadFile(f.String())
+		if err != nil {
+			return fmt.Errorf("unable to read %q: %s", key, err)
+		}
+
+		target.SetString(strings.TrimSpace(string(content)))
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/Postcon/ofelia/middlewares"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSecrets struct {
+	dir string
+}
+
+var _ = Suite(&SuiteSecrets{})
+
+func (s *SuiteSecrets) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+}
+
+func (s *SuiteSecrets) writeSecret(c *C, name, content string) string {
+	path := filepath.Join(s.dir, name)
+	c.Assert(ioutil.WriteFile(path, []byte(content), 0600), IsNil)
+
+	return path
+}
+
+func (s *SuiteSecrets) TestResolveSecretFiles(c *C) {
+	config := &Config{}
+	config.Global.SlackWebhookFile = s.writeSecret(c, "webhook", "http://example.com/hook\n")
+	config.ExecJobs = map[string]*ExecJobConfig{"foo": {}}
+	config.ExecJobs["foo"].SMTPPasswordFile = s.writeSecret(c, "password", "  secret  ")
+
+	c.Assert(resolveSecretFiles(config), IsNil)
+	c.Assert(config.Global.SlackWebhook, Equals, "http://example.com/hook")
+	c.Assert(config.ExecJobs["foo"].SMTPPassword, Equals, "secret")
+}
+
+func (s *SuiteSecrets) TestResolveSecretFilesBoth(c *C) {
+	config := &middlewares.SlackConfig{
+		SlackWebhook:     "http://example.com/hook",
+		SlackWebhookFile: s.writeSecret(c, "webhook", "http://example.com/other"),
+	}
+
+	c.Assert(resolveSecretFiles(config), ErrorMatches, `only one of "slack-webhook" or "slack-webhook-file" can be set`)
+}
+
+func (s *SuiteSecrets) TestResolveSecretFilesMissing(c *C) {
+	config := &middlewares.MatrixConfig{
+		MatrixTokenFile: filepath.Join(s.dir, "missing"),
+	}
+
+	c.Assert(resolveSecretFiles(config), ErrorMatches, `unable to read "matrix-token-file": .*`)
+}
@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// StatusHandler serves the HTTP API of the scheduler:
+//   - GET /health returns 200 if the docker daemon is reachable, 503 otherwise.
+//   - GET /api/jobs returns the jobs, its schedule and the last execution.
+//   - POST /api/jobs/{name}/run executes the job and returns the result, it
+//     requires the api-token given as a bearer token, disabled without it.
+//   - POST /api/jobs/{name}/reset clears the consecutive failures of the job,
+//     scheduling it again if it reached its failure-threshold, it requires
+//     the api-token as the run endpoint.
+//   - GET /api/running returns the executions being run.
+//   - POST /api/running/{id}/cancel cancels a running execution, it requires
+//     the api-token as the run endpoint.
+type StatusHandler struct {
+	scheduler *core.Scheduler
+	token     string
+	mux       *http.ServeMux
+}
+
+// NewStatusHandler returns a StatusHandler for the given scheduler, the token
+// protects the run, reset and cancel endpoints, if empty the endpoints are
+// disabled.
+func NewStatusHandler(sh *core.Scheduler, token string) *StatusHandler {
+	h := &StatusHandler{scheduler: sh, token: token, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/health", h.health)
+	h.mux.HandleFunc("/api/jobs", h.jobs)
+	h.mux.HandleFunc("/api/jobs/", h.action)
+	h.mux.HandleFunc("/api/running", h.running)
+	h.mux.HandleFunc("/api/running/", h.cancel)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler, only GET requests are allowed, except
+// for the run, reset and cancel endpoints, only allowing POST requests
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := "GET"
+	if strings.HasPrefix(r.URL.Path, "/api/jobs/") || strings.HasPrefix(r.URL.Path, "/api/running/") {
+		method = "POST"
+	}
+
+	if r.Method != method {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *StatusHandler) health(w http.ResponseWriter, r *http.Request) {
+	if !core.IsDockerConnected() {
+		http.Error(w, "docker unreachable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+type jobStatus struct {
+	Name          string     `json:"name"`
+	Type          string     `json:"type"`
+	Schedule      string     `json:"schedule"`
+	Enabled       bool       `json:"enabled"`
+	NextRun       *time.Time `json:"next_run,omitempty"`
+	LastID        string     `json:"last_id,omitempty"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+	LastRunEnd    *time.Time `json:"last_run_end,omitempty"`
+	LastStatus    string     `json:"last_status,omitempty"`
+	LastDuration  string     `json:"last_duration,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastTrigger   string     `json:"last_trigger,omitempty"`
+	LastUnhealthy int        `json:"last_unhealthy_periods,omitempty"`
+	Failures      int        `json:"consecutive_failures,omitempty"`
+	Tripped       bool       `json:"tripped,omitempty"`
+}
+
+func (h *StatusHandler) jobs(w http.ResponseWriter, r *http.Request) {
+	jobs := make([]jobStatus, 0, len(h.scheduler.Jobs))
+	for _, j := range h.scheduler.Jobs {
+		jobs = append(jobs, h.jobStatus(j))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (h *StatusHandler) jobStatus(j core.Job) jobStatus {
+	s := jobStatus{
+		Name:     j.GetName(),
+		Type:     core.JobType(j),
+		Schedule: j.GetSchedule(),
+		Enabled:  j.IsEnabled(),
+		Failures: h.scheduler.ConsecutiveFailures(j.GetName()),
+		Tripped:  h.scheduler.IsTripped(j.GetName()),
+	}
+
+	if next, ok := h.scheduler.NextRun(j.GetName()); ok && !s.Tripped {
+		s.NextRun = &next
+	}
+
+	history := h.scheduler.History(j.GetName())
+	if len(history) != 0 {
+		last := history[len(history)-1]
+		s.LastID = last.ID
+		s.LastRun = &last.StartedAt
+		s.LastRunEnd = &last.EndedAt
+		s.LastStatus = last.Status
+		s.LastDuration = last.Duration.String()
+		s.LastError = last.Error
+		s.LastTrigger = last.Trigger
+		s.LastUnhealthy = last.Unhealthy
+	}
+
+	return s
+}
+
+type runResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// action serves the endpoints acting on a job, /api/jobs/{name}/{action}
+func (h *StatusHandler) action(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	name, action := path[:i], path[i+1:]
+	if action != "run" && action != "reset" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !h.allowed(w, r, action) {
+		return
+	}
+
+	j := h.scheduler.GetJob(name)
+	if j == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if action == "reset" {
+		h.reset(w, j)
+		return
+	}
+
+	h.run(w, j)
+}
+
+func (h *StatusHandler) reset(w http.ResponseWriter, j core.Job) {
+	h.scheduler.Reset(j.GetName())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.jobStatus(j))
+}
+
+func (h *StatusHandler) run(w http.ResponseWriter, j core.Job) {
+	e, err := h.scheduler.Trigger(j, core.TriggerAPI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newRunResult(e))
+}
+
+type runningExecution struct {
+	Job       string    `json:"job"`
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	Target    string    `json:"target,omitempty"`
+}
+
+func (h *StatusHandler) running(w http.ResponseWriter, r *http.Request) {
+	running := h.scheduler.Running()
+
+	executions := make([]runningExecution, 0, len(running))
+	for _, e := range running {
+		executions = append(executions, runningExecution{
+			Job:       e.Job,
+			ID:        e.ID,
+			StartedAt: e.StartedAt,
+			Target:    e.Target,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(executions)
+}
+
+// cancel serves /api/running/{id}/cancel, the execution is cancelled and the
+// request returns right away, the job reports the cancellation once it has
+// cleaned up its container or service.
+func (h *StatusHandler) cancel(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/running/")
+	if !strings.HasSuffix(path, "/cancel") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !h.allowed(w, r, "cancel") {
+		return
+	}
+
+	if !h.scheduler.Cancel(strings.TrimSuffix(path, "/cancel")) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// allowed returns true if the request can call the given action, replying
+// with the error otherwise
+func (h *StatusHandler) allowed(w http.ResponseWriter, r *http.Request, action string) bool {
+	if h.token == "" {
+		http.Error(w, "the "+action+" endpoint is disabled, no api-token is set", http.StatusForbidden)
+		return false
+	}
+
+	if !h.authorized(r) {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// authorized returns true if the request has the api-token as bearer token
+func (h *StatusHandler) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func newRunResult(e *core.Execution) runResult {
+	record := core.NewExecutionRecord(e)
+	r := runResult{
+		ID:       record.ID,
+		Status:   record.Status,
+		Duration: record.Duration.String(),
+		Error:    record.Error,
+	}
+
+	code := 0
+	if exit, ok := e.Error.(core.NonZeroExitError); ok {
+		code = exit.ExitCode
+	}
+
+	if record.Status == core.StatusSuccessful || code != 0 {
+		r.ExitCode = &code
+	}
+
+	return r
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteStatusHandler struct{}
+
+var _ = Suite(&SuiteStatusHandler{})
+
+func (s *SuiteStatusHandler) buildScheduler(c *C) *core.Scheduler {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = sh -c "exit 1"
+
+		[job-local "bar"]
+		depends-on = foo
+		command = echo bar
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+	return sh
+}
+
+func (s *SuiteStatusHandler) TestJobs(c *C) {
+	sh := s.buildScheduler(c)
+	sh.RunJob(sh.GetJob("foo"), core.NewExecution())
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(sh, "").ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json")
+
+	var jobs []jobStatus
+	c.Assert(json.NewDecoder(w.Body).Decode(&jobs), IsNil)
+	c.Assert(jobs, HasLen, 2)
+
+	byName := map[string]jobStatus{}
+	for _, j := range jobs {
+		byName[j.Name] = j
+	}
+
+	foo := byName["foo"]
+	c.Assert(foo.Type, Equals, "job-local")
+	c.Assert(foo.Schedule, Equals, "@every 10s")
+	c.Assert(foo.LastRun, NotNil)
+	c.Assert(foo.LastID, Not(Equals), "")
+	c.Assert(foo.LastStatus, Equals, core.StatusFailed)
+	c.Assert(foo.LastError, Equals, "error non-zero exit code: 1")
+	c.Assert(foo.LastTrigger, Equals, core.TriggerManual)
+
+	bar := byName["bar"]
+	c.Assert(bar.NextRun, IsNil)
+	c.Assert(bar.LastRun, IsNil)
+}
+
+func (s *SuiteStatusHandler) TestHealth(c *C) {
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "").ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
+
+func (s *SuiteStatusHandler) TestReadOnly(c *C) {
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "").ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs", nil))
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *SuiteStatusHandler) TestRun(c *C) {
+	sh := s.buildScheduler(c)
+	c.Assert(sh.Start(), IsNil)
+	defer sh.Stop()
+
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(sh, "secret").ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var result runResult
+	c.Assert(json.NewDecoder(w.Body).Decode(&result), IsNil)
+	c.Assert(result.Status, Equals, core.StatusFailed)
+	c.Assert(*result.ExitCode, Equals, 1)
+	c.Assert(result.Error, Equals, "error non-zero exit code: 1")
+	c.Assert(sh.History("foo"), HasLen, 1)
+}
+
+func (s *SuiteStatusHandler) TestRunUnauthorized(c *C) {
+	h := NewStatusHandler(s.buildScheduler(c), "secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs/foo/run", nil))
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run", nil)
+	r.Header.Set("Authorization", "Bearer other")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+}
+
+func (s *SuiteStatusHandler) TestRunDisabled(c *C) {
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "").ServeHTTP(w, httptest.NewRequest("POST", "/api/jobs/foo/run", nil))
+	c.Assert(w.Code, Equals, http.StatusForbidden)
+}
+
+func (s *SuiteStatusHandler) TestRunNotFound(c *C) {
+	r := httptest.NewRequest("POST", "/api/jobs/qux/run", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "secret").ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
+
+func (s *SuiteStatusHandler) TestRunNotRunning(c *C) {
+	r := httptest.NewRequest("POST", "/api/jobs/foo/run", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "secret").ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+}
+
+func (s *SuiteStatusHandler) TestReset(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @every 10s
+		command = sh -c "exit 1"
+		failure-threshold = 1
+  `, logger, nil)
+
+	c.Assert(err, IsNil)
+	sh.RunJob(sh.GetJob("foo"), core.NewExecution())
+
+	h := NewStatusHandler(sh, "secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/jobs", nil))
+
+	var jobs []jobStatus
+	c.Assert(json.NewDecoder(w.Body).Decode(&jobs), IsNil)
+	c.Assert(jobs, HasLen, 1)
+	c.Assert(jobs[0].Tripped, Equals, true)
+	c.Assert(jobs[0].Failures, Equals, 1)
+
+	r := httptest.NewRequest("POST", "/api/jobs/foo/reset", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var status jobStatus
+	c.Assert(json.NewDecoder(w.Body).Decode(&status), IsNil)
+	c.Assert(status.Tripped, Equals, false)
+	c.Assert(status.Failures, Equals, 0)
+	c.Assert(sh.IsTripped("foo"), Equals, false)
+}
+
+func (s *SuiteStatusHandler) TestRunningCancel(c *C) {
+	logger, _ := BuildLogger("text")
+	sh, err := BuildFromString(`
+		[job-local "foo"]
+		schedule = @hourly
+		command = sleep 10
+  `, logger, nil)
+	c.Assert(err, IsNil)
+
+	e := core.NewExecution()
+	done := make(chan struct{})
+	go func() {
+		sh.RunJob(sh.GetJob("foo"), e)
+		close(done)
+	}()
+
+	time.Sleep(time.Millisecond * 200)
+	h := NewStatusHandler(sh, "secret")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/running", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	var running []runningExecution
+	c.Assert(json.NewDecoder(w.Body).Decode(&running), IsNil)
+	c.Assert(running, HasLen, 1)
+	c.Assert(running[0].Job, Equals, "foo")
+	c.Assert(running[0].ID, Equals, e.ID)
+
+	r := httptest.NewRequest("POST", "/api/running/"+e.ID+"/cancel", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusUnauthorized)
+
+	r = httptest.NewRequest("POST", "/api/running/"+e.ID+"/cancel", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusAccepted)
+
+	<-done
+	c.Assert(e.Error, Equals, core.ErrCancelled)
+
+	r = httptest.NewRequest("POST", "/api/running/"+e.ID+"/cancel", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
+
+func (s *SuiteStatusHandler) TestUnknownAction(c *C) {
+	r := httptest.NewRequest("POST", "/api/jobs/foo/qux", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	NewStatusHandler(s.buildScheduler(c), "secret").ServeHTTP(w, r)
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+}
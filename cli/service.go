@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"github.com/Postcon/ofelia/core"
+)
+
+// ServiceConfig contains the defaults of the job-service-run jobs, the options
+// set at a job override them. When not set the compiled defaults are used, a
+// poll every 100ms and a max runtime of 24h.
+type ServiceConfig struct {
+	ServicePollInterval core.Duration `gcfg:"service-poll-interval" long:"service-poll-interval" description:"default interval between the checks of the service status, eg. 5s"`
+	ServiceMaxRuntime   core.Duration `gcfg:"service-max-runtime" long:"service-max-runtime" description:"default max runtime of the services, eg. 2h"`
+}
+
+// merge overrides the options with the non empty options of o
+func (c *ServiceConfig) merge(o *ServiceConfig) {
+	if o == nil {
+		return
+	}
+
+	if o.ServicePollInterval > 0 {
+		c.ServicePollInterval = o.ServicePollInterval
+	}
+
+	if o.ServiceMaxRuntime > 0 {
+		c.ServiceMaxRuntime = o.ServiceMaxRuntime
+	}
+}
+
+// apply sets the defaults to the given job, unless the job sets its own
+func (c *ServiceConfig) apply(j *core.RunServiceJob) {
+	if j.PollInterval == 0 {
+		j.PollInterval = c.ServicePollInterval
+	}
+
+	if j.MaxRuntime == 0 {
+		j.MaxRuntime = c.ServiceMaxRuntime
+	}
+}
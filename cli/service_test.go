@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteService struct{}
+
+var _ = Suite(&SuiteService{})
+
+func (s *SuiteService) TestMerge(c *C) {
+	config := &ServiceConfig{
+		ServicePollInterval: core.Duration(time.Second),
+		ServiceMaxRuntime:   core.Duration(time.Hour),
+	}
+
+	config.merge(&ServiceConfig{ServiceMaxRuntime: core.Duration(2 * time.Hour)})
+	c.Assert(config.ServicePollInterval, Equals, core.Duration(time.Second))
+	c.Assert(config.ServiceMaxRuntime, Equals, core.Duration(2*time.Hour))
+
+	config.merge(nil)
+	c.Assert(config.ServiceMaxRuntime, Equals, core.Duration(2*time.Hour))
+}
+
+func (s *SuiteService) TestApply(c *C) {
+	config := &ServiceConfig{
+		ServicePollInterval: core.Duration(time.Second),
+		ServiceMaxRuntime:   core.Duration(time.Hour),
+	}
+
+	j := &core.RunServiceJob{}
+	j.PollInterval = core.Duration(5 * time.Second)
+	config.apply(j)
+
+	c.Assert(j.PollInterval, Equals, core.Duration(5*time.Second))
+	c.Assert(j.GetMaxRuntime(), Equals, time.Hour)
+}
+
+func (s *SuiteService) TestUnmarshalFlag(c *C) {
+	var d core.Duration
+	c.Assert(d.UnmarshalFlag("90s"), IsNil)
+	c.Assert(d, Equals, core.Duration(90*time.Second))
+	c.Assert(d.UnmarshalFlag("foo"), NotNil)
+}
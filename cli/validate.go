@@ -1,25 +1,49 @@
 package cli
 
-import "fmt"
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+	"github.com/Postcon/ofelia/middlewares"
+	"gopkg.in/gcfg.v1"
+)
 
 // ValidateCommand validates the config file
 type ValidateCommand struct {
-	ConfigFile string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFile   string `long:"config" description:"configuration file" default:"/etc/ofelia.conf"`
+	ConfigFormat string `long:"config-format" description:"format of the configuration file, ini or yaml, by default from its extension"`
 }
 
-// Execute runs the validation command
+// Execute runs the validation command, all the errors found are reported, no
+// connection to docker is required.
 func (c *ValidateCommand) Execute(args []string) error {
 	fmt.Printf("Validating %q ... ", c.ConfigFile)
-	config, err := BuildFromFile(c.ConfigFile)
+	content, err := readConfigContent(c.ConfigFile, c.ConfigFormat)
 	if err != nil {
 		fmt.Println("ERROR")
 		return err
 	}
 
+	config, errs := ValidateString(content)
+	if len(errs) != 0 {
+		fmt.Println("ERROR")
+		for _, err := range errs {
+			fmt.Printf("- %s\n", err)
+		}
+
+		return fmt.Errorf("found %d errors at %q", len(errs), c.ConfigFile)
+	}
+
 	fmt.Println("OK")
-	fmt.Printf("Found %d jobs:\n", len(config.Jobs))
 
-	for _, j := range config.Jobs {
+	jobs := config.jobs()
+	fmt.Printf("Found %d jobs:\n", len(jobs))
+
+	for _, j := range jobs {
 		fmt.Printf(
 			"- name: %s schedule: %q command: %q\n",
 			j.GetName(), j.GetSchedule(), j.GetCommand(),
@@ -28,3 +52,372 @@ func (c *ValidateCommand) Execute(args []string) error {
 
 	return nil
 }
+
+// ValidateString parses and validates the given config, returning all the
+// errors found.
+func ValidateString(config string) (*Config, []error) {
+	c := &Config{}
+
+	var errs []error
+	if err := gcfg.ReadStringInto(c, config); err != nil {
+		// unknown variables are reported as warnings, the jobs are still
+		// validated to report all the errors at once
+		if gcfg.FatalOnly(err) != nil {
+			return nil, []error{err}
+		}
+
+		errs = append(errs, err)
+	}
+
+	v := &validator{lines: sectionLines(config)}
+	v.validate(c)
+
+	for _, err := range v.errs {
+		errs = append(errs, err)
+	}
+
+	return c, errs
+}
+
+// jobs returns all the jobs of the config, sorted by name
+func (c *Config) jobs() []core.Job {
+	var jobs []core.Job
+	for name, j := range c.ExecJobs {
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.RunJobs {
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.LocalJobs {
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.ServiceJobs {
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	for name, j := range c.ECSJobs {
+		j.Name = name
+		jobs = append(jobs, j)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].GetName() < jobs[j].GetName()
+	})
+
+	return jobs
+}
+
+var (
+	imageRegexp    = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*(:[0-9]+)?(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[\w][\w.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+	registryRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*(:[0-9]+)?$`)
+	networkRegexp  = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	sectionRegexp  = regexp.MustCompile(`^\s*\[\s*([\w-]+)\s*(?:"((?:[^"\\]|\\.)*)")?\s*\]`)
+)
+
+// ValidationError is an error found validating a job of the config
+type ValidationError struct {
+	Line    int
+	Section string
+	Job     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("line %d [%s %q]: %s", e.Line, e.Section, e.Job, e.Message)
+}
+
+type validator struct {
+	lines map[string]int
+	names map[string]bool
+	errs  []*ValidationError
+}
+
+func (v *validator) validate(c *Config) {
+	v.names = make(map[string]bool, 0)
+	for _, j := range c.jobs() {
+		v.names[j.GetName()] = true
+	}
+
+	v.validateSlack("global", "", &c.Global.SlackConfig)
+
+	for name, j := range c.ExecJobs {
+		v.validateJob("job-exec", name, &j.BareJob)
+		v.validateSlack("job-exec", name, &j.SlackConfig)
+		if j.Container == "" {
+			v.errorf("job-exec", name, "container is required")
+		}
+	}
+
+	for name, j := range c.RunJobs {
+		v.validateJob("job-run", name, &j.BareJob)
+		v.validateSlack("job-run", name, &j.SlackConfig)
+		if j.Image == "" && j.Container == "" {
+			v.errorf("job-run", name, "image or container is required")
+		}
+
+		if j.GuardCommand != "" && j.Container != "" {
+			v.errorf("job-run", name, "%s", core.ErrGuardContainer)
+		}
+
+		v.validateImage("job-run", name, j.Image, j.Registry)
+		v.validateNetworks("job-run", name, j.Network)
+		v.validateExtraHosts("job-run", name, j.ExtraHosts)
+		v.validateDNS("job-run", name, j.DNS)
+		v.validateTmpfs("job-run", name, j.Tmpfs)
+		v.validateUser("job-run", name, j.User, j.Groups)
+		v.validatePlatform("job-run", name, j.Platform)
+
+		for _, spec := range j.Ulimit {
+			if _, err := core.ParseUlimit(spec); err != nil {
+				v.errorf("job-run", name, "%s", err)
+			}
+		}
+
+		for _, spec := range j.Sysctl {
+			if _, _, err := core.ParseSysctl(spec); err != nil {
+				v.errorf("job-run", name, "%s", err)
+			}
+		}
+	}
+
+	for name, j := range c.LocalJobs {
+		v.validateJob("job-local", name, &j.BareJob)
+		v.validateSlack("job-local", name, &j.SlackConfig)
+		if len(j.GetCommandArgs()) == 0 {
+			v.errorf("job-local", name, "command is required")
+		}
+	}
+
+	for name, j := range c.ECSJobs {
+		v.validateJob("job-ecs-run", name, &j.BareJob)
+		v.validateSlack("job-ecs-run", name, &j.SlackConfig)
+		if j.TaskDefinition == "" {
+			v.errorf("job-ecs-run", name, "task-definition is required")
+		}
+
+		if (len(j.GetCommandArgs()) != 0 || len(j.Environment) != 0) && j.Container == "" {
+			v.errorf("job-ecs-run", name, "container is required to override the command or the environment")
+		}
+	}
+
+	for name, j := range c.ServiceJobs {
+		v.validateJob("job-service-run", name, &j.BareJob)
+		v.validateSlack("job-service-run", name, &j.SlackConfig)
+		if j.Image == "" && j.ImageFromService == "" {
+			v.errorf("job-service-run", name, "image or image-from-service is required")
+		}
+
+		v.validateImage("job-service-run", name, j.Image, j.Registry)
+		v.validateNetworks("job-service-run", name, j.Network)
+
+		for _, constraint := range j.PlacementConstraint {
+			if err := core.ValidatePlacementConstraint(constraint); err != nil {
+				v.errorf("job-service-run", name, "%s", err)
+			}
+		}
+
+		for _, preference := range j.PlacementPreference {
+			if _, err := core.ParsePlacementPreference(preference); err != nil {
+				v.errorf("job-service-run", name, "%s", err)
+			}
+		}
+
+		for _, resource := range j.GenericResources {
+			if _, err := core.ParseGenericResource(resource); err != nil {
+				v.errorf("job-service-run", name, "%s", err)
+			}
+		}
+
+		v.validateExtraHosts("job-service-run", name, j.ExtraHosts)
+		v.validateDNS("job-service-run", name, j.DNS)
+		v.validateTmpfs("job-service-run", name, j.Tmpfs)
+		v.validateEnvironment("job-service-run", name, j.Environment)
+
+		for _, refs := range [][]string{j.Secrets, j.Configs} {
+			for _, ref := range refs {
+				if _, _, err := core.ParseFileReference(ref); err != nil {
+					v.errorf("job-service-run", name, "%s", err)
+				}
+			}
+		}
+
+		if err := j.ValidateResources(); err != nil {
+			v.errorf("job-service-run", name, "%s", err)
+		}
+		v.validateUser("job-service-run", name, j.User, j.Groups)
+		v.validatePlatform("job-service-run", name, j.Platform)
+
+		if err := j.ValidateWaitFor(); err != nil {
+			v.errorf("job-service-run", name, "%s", err)
+		}
+
+		if err := j.ValidateLogDriver(); err != nil {
+			v.errorf("job-service-run", name, "%s", err)
+		}
+
+		for _, port := range j.Ports {
+			if _, err := core.ParsePortConfig(port); err != nil {
+				v.errorf("job-service-run", name, "%s", err)
+			}
+		}
+
+		if j.InstanceNameTemplate != "" {
+			if _, err := core.ParseInstanceNameTemplate(j.InstanceNameTemplate); err != nil {
+				v.errorf("job-service-run", name, "%s", err)
+			}
+		}
+	}
+
+	sort.Slice(v.errs, func(i, j int) bool {
+		if v.errs[i].Line != v.errs[j].Line {
+			return v.errs[i].Line < v.errs[j].Line
+		}
+
+		return v.errs[i].Message < v.errs[j].Message
+	})
+}
+
+func (v *validator) validateJob(section, name string, j *core.BareJob) {
+	if j.Schedule == "" && j.DependsOn == "" && !j.RunOnStart {
+		v.errorf(section, name, "schedule is required")
+	}
+
+	if _, err := j.GetCalendar(); err != nil {
+		v.errorf(section, name, "%s", err)
+	}
+
+	if err := j.ValidateCommand(); err != nil {
+		v.errorf(section, name, "%s", err)
+	}
+
+	if j.Schedule != "" {
+		if _, err := core.ParseSchedule(j.Schedule); err != nil {
+			v.errorf(section, name, "invalid schedule %q: %s", j.Schedule, err)
+		}
+	}
+
+	for _, dep := range j.GetDependencies() {
+		if !v.names[dep] {
+			v.errorf(section, name, "depends on unknown job %q", dep)
+		}
+	}
+}
+
+func (v *validator) validateSlack(section, name string, c *middlewares.SlackConfig) {
+	if err := validateSlackConfig(c); err != nil {
+		v.errorf(section, name, "%s", err)
+	}
+}
+
+// validateImage validates the image and the registry of a job, the ones with
+// variables, as `${TAG}`, are only known once the profile is applied.
+func (v *validator) validateImage(section, name, image, registry string) {
+	if image != "" && !variableRegexp.MatchString(image) && !imageRegexp.MatchString(image) {
+		v.errorf(section, name, "invalid image %q", image)
+	}
+
+	if registry != "" && !variableRegexp.MatchString(registry) && !registryRegexp.MatchString(registry) {
+		v.errorf(section, name, "invalid registry %q", registry)
+	}
+}
+
+// validateNetworks validates the networks of a job, given as `network` or
+// `network:alias,...`, the aliases aren't validated.
+func (v *validator) validateNetworks(section, name string, networks []string) {
+	for _, network := range networks {
+		network = strings.TrimSpace(strings.SplitN(network, ":", 2)[0])
+		if !networkRegexp.MatchString(network) {
+			v.errorf(section, name, "invalid network %q", network)
+		}
+	}
+}
+
+func (v *validator) validateExtraHosts(section, name string, hosts []string) {
+	for _, entry := range hosts {
+		if _, _, err := core.ParseExtraHost(entry); err != nil {
+			v.errorf(section, name, "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateDNS(section, name string, servers []string) {
+	for _, server := range servers {
+		if err := core.ValidateDNS(server); err != nil {
+			v.errorf(section, name, "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateTmpfs(section, name string, mounts []string) {
+	for _, spec := range mounts {
+		if _, _, err := core.ParseTmpfs(spec); err != nil {
+			v.errorf(section, name, "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateEnvironment(section, name string, env []string) {
+	for _, entry := range env {
+		if err := core.ValidateEnv(entry); err != nil {
+			v.errorf(section, name, "%s", err)
+		}
+	}
+}
+
+func (v *validator) validatePlatform(section, name, platform string) {
+	if platform == "" {
+		return
+	}
+
+	if _, _, _, err := core.ParsePlatform(platform); err != nil {
+		v.errorf(section, name, "%s", err)
+	}
+}
+
+func (v *validator) validateUser(section, name, user string, groups []string) {
+	if err := core.ValidateUser(user); err != nil {
+		v.errorf(section, name, "%s", err)
+	}
+
+	for _, group := range groups {
+		if err := core.ValidateGroup(group); err != nil {
+			v.errorf(section, name, "%s", err)
+		}
+	}
+}
+
+func (v *validator) errorf(section, name, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Line:    v.lines[section+" "+name],
+		Section: section,
+		Job:     name,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// sectionLines returns the line number of every section of the config, keyed
+// by section and subsection, eg.: `job-exec foo`
+func sectionLines(config string) map[string]int {
+	lines := make(map[string]int, 0)
+
+	var n int
+	scanner := bufio.NewScanner(strings.NewReader(config))
+	for scanner.Scan() {
+		n++
+		m := sectionRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+
+		lines[strings.ToLower(m[1])+" "+m[2]] = n
+	}
+
+	return lines
+}
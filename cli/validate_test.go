@@ -0,0 +1,192 @@
+package cli
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SuiteValidate struct{}
+
+var _ = Suite(&SuiteValidate{})
+
+func (s *SuiteValidate) TestValidateString(c *C) {
+	config, errs := ValidateString(`
+		[job-exec "foo"]
+		schedule = @every 10s
+		container = foo
+
+		[job-run "qux"]
+		schedule = 0 */5 * * * *
+		image = docker-registry.company.de:5000/srcd/rest:qux
+		network = foo_default
+		network = storage:db,database
+
+		[job-local "baz"]
+		depends-on = foo
+		command = echo foo
+
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+	`)
+
+	c.Assert(errs, HasLen, 0)
+	c.Assert(config.jobs(), HasLen, 4)
+}
+
+func (s *SuiteValidate) TestValidateStringErrors(c *C) {
+	_, errs := ValidateString(`
+		[job-exec "foo"]
+		schedule = @every foo
+		container = foo
+
+		[job-run "qux"]
+		schedule = @hourly
+		image = Foo Bar
+		network = foo bar
+
+		[job-local "baz"]
+		depends-on = bar
+	`)
+
+	c.Assert(errs, HasLen, 5)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-exec "foo"\]: invalid schedule "@every foo".*`)
+	c.Assert(errs[1], ErrorMatches, `line 6 \[job-run "qux"\]: invalid image "Foo Bar"`)
+	c.Assert(errs[2], ErrorMatches, `line 6 \[job-run "qux"\]: invalid network "foo bar"`)
+	c.Assert(errs[3], ErrorMatches, `line 11 \[job-local "baz"\]: command is required`)
+	c.Assert(errs[4], ErrorMatches, `line 11 \[job-local "baz"\]: depends on unknown job "bar"`)
+}
+
+func (s *SuiteValidate) TestValidateStringECS(c *C) {
+	config, errs := ValidateString(`
+		[job-ecs-run "foo"]
+		schedule = @hourly
+		cluster = default
+		task-definition = app:3
+		container = app
+		command = echo foo
+		subnet = subnet-1
+		subnet = subnet-2
+
+		[job-ecs-run "bar"]
+		schedule = @hourly
+		command = echo bar
+	`)
+
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0], ErrorMatches, `line 11 \[job-ecs-run "bar"\]: task-definition is required`)
+	c.Assert(errs[1], ErrorMatches, `line 11 \[job-ecs-run "bar"\]: container is required .*`)
+	c.Assert(config.ECSJobs["foo"].Subnet, DeepEquals, []string{"subnet-1", "subnet-2"})
+}
+
+func (s *SuiteValidate) TestValidateStringPlacement(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		placement-constraint = node.role == worker
+		placement-constraint = node.role
+		placement-preference = spread=node.labels.zone
+		placement-preference = pack=node.labels.zone
+	`)
+
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid placement constraint "node.role"`)
+	c.Assert(errs[1], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid placement preference "pack=node.labels.zone"`)
+}
+
+func (s *SuiteValidate) TestValidateStringEnvironment(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		environment = FOO=bar
+		environment = BAR
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid environment variable "BAR", expected KEY=VALUE`)
+}
+
+func (s *SuiteValidate) TestValidateStringResources(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		memory-limit = 512m
+		memory-reservation = 1g
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: memory-reservation "1g" exceeds the memory-limit "512m"`)
+}
+
+func (s *SuiteValidate) TestValidateStringWaitFor(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		wait-for = ready
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid wait-for "ready", expected one of: exit, healthy`)
+}
+
+func (s *SuiteValidate) TestValidateStringGuardContainer(c *C) {
+	_, errs := ValidateString(`
+		[job-run "bob"]
+		schedule = @hourly
+		container = backup
+		guard-command = true
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-run "bob"\]: guard-command can't be used with container, .*`)
+}
+
+func (s *SuiteValidate) TestValidateStringInstanceNameTemplate(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		instance-name-template = {{.Name}-{{.Seq}}
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid instance-name-template .*`)
+}
+
+func (s *SuiteValidate) TestValidateStringGelfOptions(c *C) {
+	_, errs := ValidateString(`
+		[job-service-run "bob"]
+		schedule = @hourly
+		image = ubuntu
+		logging-gelf-address = tcp://graylog:12201
+		log-opt = gelf-tls-cert=/certs/client.pem
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-service-run "bob"\]: invalid log-opt "gelf-tls-cert", the gelf driver doesn't support TLS, .*`)
+}
+
+func (s *SuiteValidate) TestValidateStringSlackMessageTemplate(c *C) {
+	_, errs := ValidateString(`
+		[job-local "bob"]
+		schedule = @hourly
+		command = echo bob
+		slack-webhook = http://example.com/hook
+		slack-message-template = {{.Job.GetName}
+	`)
+
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `line 2 \[job-local "bob"\]: invalid slack-message-template .*`)
+}
+
+func (s *SuiteValidate) TestValidateStringSyntaxError(c *C) {
+	_, errs := ValidateString(`
+		[job-exec "foo"
+		schedule = @hourly
+	`)
+
+	c.Assert(errs, HasLen, 1)
+}
@@ -0,0 +1,162 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const vaultPrefix = "vault://"
+
+// vaultTimeout is the timeout of the requests to Vault
+const vaultTimeout = time.Second * 10
+
+// resolveVaultSecrets walks the given config looking for values as
+// `vault://path#field`, eg. `vault://secret/data/ofelia#slack-webhook`, the
+// value is replaced by the field of the secret read from Vault, at VAULT_ADDR
+// with VAULT_TOKEN, allowing to keep the secrets out of the config. Every path
+// is read once, the kv version 1 and 2 secrets are supported.
+func resolveVaultSecrets(v interface{}) error {
+	r := &vaultResolver{
+		addr:      strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		token:     os.Getenv("VAULT_TOKEN"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: vaultTimeout},
+		cache:     make(map[string]map[string]interface{}),
+	}
+
+	return r.resolveValue(reflect.ValueOf(v))
+}
+
+type vaultResolver struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+	cache     map[string]map[string]interface{}
+}
+
+func (r *vaultResolver) resolveValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+
+		return r.resolveValue(v.Elem())
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if err := r.resolveValue(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue
+			}
+
+			if err := r.resolveValue(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := r.resolveValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !strings.HasPrefix(v.String(), vaultPrefix) || !v.CanSet() {
+			return nil
+		}
+
+		secret, err := r.read(v.String())
+		if err != nil {
+			return err
+		}
+
+		v.SetString(secret)
+	}
+
+	return nil
+}
+
+// read returns the field of the secret referenced by the given value
+func (r *vaultResolver) read(ref string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(ref, vaultPrefix), "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid vault secret %q, expected vault://path#field", ref)
+	}
+
+	path, field := strings.Trim(parts[0], "/"), parts[1]
+	data, ok := r.cache[path]
+	if !ok {
+		var err error
+		if data, err = r.fetch(path); err != nil {
+			return "", fmt.Errorf("unable to read vault secret %q: %s", ref, err)
+		}
+
+		r.cache[path] = data
+	}
+
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no field %q", path, field)
+	}
+
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// fetch returns the data of the secret at the given path, the data of the kv
+// version 2 secrets is nested at `data` along with its `metadata`.
+func (r *vaultResolver) fetch(path string) (map[string]interface{}, error) {
+	if r.addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequest("GET", r.addr+"/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("X-Vault-Token", r.token)
+	if r.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.namespace)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("invalid response: %s", err)
+	}
+
+	if nested, ok := secret.Data["data"].(map[string]interface{}); ok {
+		if _, ok := secret.Data["metadata"]; ok {
+			return nested, nil
+		}
+	}
+
+	return secret.Data, nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteVault struct {
+	server   *httptest.Server
+	requests int
+}
+
+var _ = Suite(&SuiteVault{})
+
+func (s *SuiteVault) SetUpTest(c *C) {
+	s.requests = 0
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests++
+		if r.Header.Get("X-Vault-Token") != "qux" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/ofelia":
+			w.Write([]byte(`{"data": {"data": {"webhook": "http://example.com/hook", "password": "secret"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/ofelia":
+			w.Write([]byte(`{"data": {"token": "foo"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	os.Setenv("VAULT_ADDR", s.server.URL)
+	os.Setenv("VAULT_TOKEN", "qux")
+}
+
+func (s *SuiteVault) TearDownTest(c *C) {
+	s.server.Close()
+	os.Unsetenv("VAULT_ADDR")
+	os.Unsetenv("VAULT_TOKEN")
+}
+
+func (s *SuiteVault) TestResolveVaultSecrets(c *C) {
+	config := &Config{}
+	config.Global.SlackWebhook = "vault://secret/data/ofelia#webhook"
+	config.ExecJobs = map[string]*ExecJobConfig{"foo": {}}
+	config.ExecJobs["foo"].SMTPPassword = "vault://secret/data/ofelia#password"
+	config.ExecJobs["foo"].Command = "echo foo"
+	config.ExecJobs["foo"].Environment = []string{"USER=foo", "vault://kv/ofelia#token"}
+
+	c.Assert(resolveVaultSecrets(config), IsNil)
+	c.Assert(config.Global.SlackWebhook, Equals, "http://example.com/hook")
+	c.Assert(config.ExecJobs["foo"].SMTPPassword, Equals, "secret")
+	c.Assert(config.ExecJobs["foo"].Command, Equals, "echo foo")
+	c.Assert(config.ExecJobs["foo"].Environment, DeepEquals, []string{"USER=foo", "foo"})
+	c.Assert(s.requests, Equals, 2)
+}
+
+func (s *SuiteVault) TestResolveVaultSecretsMissingField(c *C) {
+	config := &Config{}
+	config.Global.SlackWebhook = "vault://secret/data/ofelia#missing"
+
+	c.Assert(resolveVaultSecrets(config), ErrorMatches, `vault secret "secret/data/ofelia" has no field "missing"`)
+}
+
+func (s *SuiteVault) TestResolveVaultSecretsInvalid(c *C) {
+	config := &Config{}
+	config.Global.SlackWebhook = "vault://secret/data/ofelia"
+
+	c.Assert(resolveVaultSecrets(config), ErrorMatches, `invalid vault secret .*, expected vault://path#field`)
+}
+
+func (s *SuiteVault) TestResolveVaultSecretsUnreachable(c *C) {
+	s.server.Close()
+
+	config := &Config{}
+	config.Global.SlackWebhook = "vault://secret/data/ofelia#webhook"
+
+	c.Assert(resolveVaultSecrets(config), ErrorMatches, `unable to read vault secret "vault://secret/data/ofelia#webhook": .*`)
+}
+
+func (s *SuiteVault) TestResolveVaultSecretsNoAddr(c *C) {
+	os.Unsetenv("VAULT_ADDR")
+
+	config := &Config{}
+	config.Global.SlackWebhook = "vault://secret/data/ofelia#webhook"
+
+	c.Assert(resolveVaultSecrets(config), ErrorMatches, `.*VAULT_ADDR is not set`)
+}
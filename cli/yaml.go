@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	formatINI  = "ini"
+	formatYAML = "yaml"
+)
+
+// configFormat returns the format of the given config file, the given one, ini
+// or yaml, or when empty the one of its extension, .yml or .yaml for yaml,
+// anything else for ini.
+func configFormat(filename, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case formatINI:
+		return formatINI, nil
+	case formatYAML, "yml":
+		return formatYAML, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown config format %q, expected ini or yaml", format)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		return formatYAML, nil
+	}
+
+	return formatINI, nil
+}
+
+// readConfigContent returns the content of the given config file as ini, the
+// yaml files are converted by yamlToINI.
+func readConfigContent(filename, format string) (string, error) {
+	format, err := configFormat(filename, format)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if format == formatYAML {
+		return yamlToINI(content)
+	}
+
+	return string(content), nil
+}
+
+// yamlToINI converts a yaml config to the ini one, so both are read into the
+// same Config, with the same options, defaults and validations. The top level
+// keys are the sections, the global options at `global` and the jobs by name
+// under its type, eg. `job-exec: {backup: {schedule: "@daily"}}`, the lists
+// are the repeated options, eg. `network: [backend, storage]`.
+func yamlToINI(content []byte) (string, error) {
+	var sections yaml.MapSlice
+	if err := yaml.Unmarshal(content, &sections); err != nil {
+		return "", fmt.Errorf("invalid yaml config: %s", err)
+	}
+
+	var b bytes.Buffer
+	for _, section := range sections {
+		kind := fmt.Sprint(section.Key)
+		items, ok := section.Value.(yaml.MapSlice)
+		if !ok && section.Value != nil {
+			return "", fmt.Errorf("invalid yaml config, %q must be a mapping", kind)
+		}
+
+		if kind == "global" {
+			fmt.Fprintf(&b, "[global]\n")
+			if err := writeINIOptions(&b, kind, items); err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		for _, job := range items {
+			name := fmt.Sprint(job.Key)
+			options, ok := job.Value.(yaml.MapSlice)
+			if !ok && job.Value != nil {
+				return "", fmt.Errorf("invalid yaml config, %s %q must be a mapping", kind, name)
+			}
+
+			fmt.Fprintf(&b, "[%s %s]\n", kind, quoteINI(name))
+			if err := writeINIOptions(&b, kind+" "+name, options); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+func writeINIOptions(b *bytes.Buffer, section string, options yaml.MapSlice) error {
+	for _, option := range options {
+		key := fmt.Sprint(option.Key)
+
+		values, ok := option.Value.([]interface{})
+		if !ok {
+			values = []interface{}{option.Value}
+		}
+
+		for _, value := range values {
+			switch value.(type) {
+			case yaml.MapSlice, []interface{}:
+				return fmt.Errorf("invalid yaml config, %q of %s must be a value or a list of values", key, section)
+			case nil:
+				value = ""
+			}
+
+			fmt.Fprintf(b, "%s = %s\n", key, quoteINI(fmt.Sprint(value)))
+		}
+	}
+
+	b.WriteString("\n")
+	return nil
+}
+
+var iniEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+
+// quoteINI quotes the given value as a gcfg string, so it's read verbatim
+func quoteINI(value string) string {
+	return `"` + iniEscaper.Replace(value) + `"`
+}
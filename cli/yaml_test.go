@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/gcfg.v1"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteYAML struct{}
+
+var _ = Suite(&SuiteYAML{})
+
+func (s *SuiteYAML) TestConfigFormat(c *C) {
+	format, err := configFormat("/etc/ofelia.conf", "")
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, formatINI)
+
+	format, err = configFormat("/etc/ofelia.YML", "")
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, formatYAML)
+
+	format, err = configFormat("/etc/ofelia.conf", "yaml")
+	c.Assert(err, IsNil)
+	c.Assert(format, Equals, formatYAML)
+
+	_, err = configFormat("/etc/ofelia.conf", "toml")
+	c.Assert(err, ErrorMatches, `unknown config format "toml", expected ini or yaml`)
+}
+
+func (s *SuiteYAML) TestYAMLToINI(c *C) {
+	ini, err := yamlToINI([]byte(`
+global:
+  slack-webhook: https://hooks.slack.com/foo
+  max-concurrent-runs: 2
+job-service-run:
+  report:
+    schedule: "@daily"
+    image: company/report
+    command: echo "foo; bar"
+    network: [backend, storage]
+    success-exit-codes: [0, 2]
+    run-on-start: true
+`))
+
+	c.Assert(err, IsNil)
+
+	config := &Config{}
+	c.Assert(gcfg.ReadStringInto(config, ini), IsNil)
+	c.Assert(config.Global.SlackWebhook, Equals, "https://hooks.slack.com/foo")
+	c.Assert(config.Global.MaxConcurrentRuns, Equals, 2)
+
+	job := config.ServiceJobs["report"]
+	c.Assert(job, NotNil)
+	c.Assert(job.Schedule, Equals, "@daily")
+	c.Assert(job.Command, Equals, `echo "foo; bar"`)
+	c.Assert(job.Network, DeepEquals, []string{"backend", "storage"})
+	c.Assert(job.SuccessExitCodes, DeepEquals, []int{0, 2})
+	c.Assert(job.RunOnStart, Equals, true)
+}
+
+func (s *SuiteYAML) TestYAMLToINIInvalid(c *C) {
+	_, err := yamlToINI([]byte("job-run:\n  report:\n    network:\n      foo: bar\n"))
+	c.Assert(err, ErrorMatches, `invalid yaml config, "network" of job-run report must be a value or a list of values`)
+
+	_, err = yamlToINI([]byte("job-run: foo\n"))
+	c.Assert(err, ErrorMatches, `invalid yaml config, "job-run" must be a mapping`)
+}
+
+func (s *SuiteYAML) TestReadConfigFileYAML(c *C) {
+	filename := filepath.Join(c.MkDir(), "ofelia.yml")
+	c.Assert(ioutil.WriteFile(filename, []byte("job-local:\n  foo:\n    schedule: '@hourly'\n    command: ls\n"), 0644), IsNil)
+
+	config, err := ReadConfigFile(filename, "")
+	c.Assert(err, IsNil)
+	c.Assert(config.LocalJobs["foo"].Command, Equals, "ls")
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// The states of the ANSIStripper, inside of an escape sequence or not
+const (
+	ansiText = iota
+	ansiEscape
+	ansiCSI
+	ansiOSC
+	ansiOSCEscape
+)
+
+// ANSIStripper is a stream removing the ANSI escape sequences, as the colors
+// or the cursor movements, from the output written to it, the sequences split
+// across writes are removed too. The reads are served by the wrapped stream.
+type ANSIStripper struct {
+	io.ReadWriter
+	state int
+	lock  sync.Mutex
+}
+
+// NewANSIStripper returns a ANSIStripper writing to the given stream
+func NewANSIStripper(s io.ReadWriter) *ANSIStripper {
+	return &ANSIStripper{ReadWriter: s}
+}
+
+// Write writes p to the stream without the escape sequences, it returns
+// len(p), even if some bytes were removed.
+func (s *ANSIStripper) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch s.state {
+		case ansiText:
+			if b == 0x1b {
+				s.state = ansiEscape
+				continue
+			}
+
+			out = append(out, b)
+		case ansiEscape:
+			switch b {
+			case '[':
+				s.state = ansiCSI
+			case ']':
+				s.state = ansiOSC
+			default:
+				// the intermediate bytes, as at ESC ( B, until the final one
+				if b >= 0x20 && b <= 0x2f {
+					continue
+				}
+
+				s.state = ansiText
+			}
+		case ansiCSI:
+			// the parameters and intermediate bytes, until the final one
+			if b >= 0x40 && b <= 0x7e {
+				s.state = ansiText
+			}
+		case ansiOSC:
+			// terminated by BEL or by ESC \
+			if b == 0x07 {
+				s.state = ansiText
+			} else if b == 0x1b {
+				s.state = ansiOSCEscape
+			}
+		case ansiOSCEscape:
+			s.state = ansiText
+		}
+	}
+
+	if _, err := s.ReadWriter.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Bytes returns the unread content of the wrapped stream, without consuming
+// it, if the stream supports it.
+func (s *ANSIStripper) Bytes() []byte {
+	if b, ok := s.ReadWriter.(interface{ Bytes() []byte }); ok {
+		return b.Bytes()
+	}
+
+	content, _ := ioutil.ReadAll(s.ReadWriter)
+	return content
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"bytes"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteANSIStripper struct{}
+
+var _ = Suite(&SuiteANSIStripper{})
+
+func (s *SuiteANSIStripper) TestWrite(c *C) {
+	b := bytes.NewBuffer(nil)
+	w := NewANSIStripper(b)
+
+	n, err := w.Write([]byte("\x1b[1;31mfoo\x1b[0m bar\x1b]0;title\x07 qux\x1b]8;;http://foo\x1b\\link\x1b(B"))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 56)
+	c.Assert(b.String(), Equals, "foo bar quxlink")
+}
+
+func (s *SuiteANSIStripper) TestWriteSplit(c *C) {
+	b := bytes.NewBuffer(nil)
+	w := NewANSIStripper(b)
+
+	for _, p := range []string{"foo\x1b", "[3", "2m", "bar\x1b[0", "m"} {
+		w.Write([]byte(p))
+	}
+
+	c.Assert(b.String(), Equals, "foobar")
+	c.Assert(string(w.Bytes()), Equals, "foobar")
+}
+
+func (s *SuiteANSIStripper) TestExecutionStripANSI(c *C) {
+	e := NewExecution()
+	e.LimitOutput(1024)
+	e.StripANSI()
+
+	e.OutputStream.Write([]byte("\x1b[32mok\x1b[0m"))
+	c.Assert(string(e.OutputStream.(*ANSIStripper).Bytes()), Equals, "ok")
+}
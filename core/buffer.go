@@ -0,0 +1,82 @@
+package core
+
+import (
+	"bytes"
+	"sync"
+)
+
+const defaultMaxOutputBytes = 1 << 20
+
+// TruncatedMarker is appended to the output of an execution when it exceeds
+// the max-output-bytes of the job
+const TruncatedMarker = "\n[truncated]\n"
+
+// LimitedBuffer is a buffer keeping up to the given number of bytes, the
+// writes beyond it are discarded, without failing, and the TruncatedMarker is
+// appended once. It's safe for concurrent use.
+type LimitedBuffer struct {
+	max       int
+	written   int
+	truncated bool
+	buf       bytes.Buffer
+	lock      sync.Mutex
+}
+
+// NewLimitedBuffer returns a LimitedBuffer keeping up to max bytes
+func NewLimitedBuffer(max int) *LimitedBuffer {
+	return &LimitedBuffer{max: max}
+}
+
+// Write writes p to the buffer up to the limit, it always returns len(p), so
+// the writer, eg. the output of a container, is not interrupted.
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.truncated {
+		return len(p), nil
+	}
+
+	n := len(p)
+	if left := b.max - b.written; n > left {
+		n = left
+		b.truncated = true
+	}
+
+	b.buf.Write(p[:n])
+	b.written += n
+	if b.truncated {
+		b.buf.WriteString(TruncatedMarker)
+	}
+
+	return len(p), nil
+}
+
+// Read reads from the buffer, the bytes read are consumed
+func (b *LimitedBuffer) Read(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Read(p)
+}
+
+// Bytes returns the unread content of the buffer, without consuming it
+func (b *LimitedBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Bytes()
+}
+
+// String returns the unread content of the buffer as a string
+func (b *LimitedBuffer) String() string {
+	return string(b.Bytes())
+}
+
+// Truncated returns true if any write has been discarded
+func (b *LimitedBuffer) Truncated() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.truncated
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLimitedBuffer struct{}
+
+var _ = Suite(&SuiteLimitedBuffer{})
+
+func (s *SuiteLimitedBuffer) TestWrite(c *C) {
+	b := NewLimitedBuffer(8)
+
+	n, err := b.Write([]byte("foo"))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(b.Truncated(), Equals, false)
+
+	n, err = b.Write([]byte("barbaz"))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 6)
+	c.Assert(b.Truncated(), Equals, true)
+
+	n, err = b.Write([]byte("qux"))
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+	c.Assert(b.String(), Equals, "foobarba"+TruncatedMarker)
+}
+
+func (s *SuiteLimitedBuffer) TestWriteExact(c *C) {
+	b := NewLimitedBuffer(3)
+	b.Write([]byte("foo"))
+
+	c.Assert(b.Truncated(), Equals, false)
+	c.Assert(b.String(), Equals, "foo")
+}
+
+func (s *SuiteLimitedBuffer) TestRead(c *C) {
+	b := NewLimitedBuffer(3)
+	b.Write([]byte("foobar"))
+
+	content, err := ioutil.ReadAll(b)
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "foo"+TruncatedMarker)
+
+	b.Write([]byte("qux"))
+	c.Assert(b.String(), Equals, "")
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CalendarDateFormat is the format of the dates of exclude-dates and
+// only-dates, eg. 2017-12-25
+const CalendarDateFormat = "2006-01-02"
+
+// Calendar filters the days a job is executed, the executions on excluded
+// days, or out of the allowed range, are skipped. The days are compared using
+// the local time of the daemon.
+type Calendar struct {
+	excluded map[string]bool
+	from, to string
+}
+
+// ParseCalendar builds a calendar from the given exclude-dates and
+// only-dates. An exclude-dates entry is a date or the path of a file, with a
+// date per line, the empty lines and lines starting with # are ignored, and
+// anything after the date is considered a comment, eg. "2017-12-25 Christmas".
+// The only-dates range is given as "from..to", both inclusive, any of them can
+// be omitted, eg. "2017-01-01..".
+func ParseCalendar(exclude []string, only string) (*Calendar, error) {
+	c := &Calendar{excluded: make(map[string]bool, 0)}
+	for _, entry := range exclude {
+		entry = strings.TrimSpace(entry)
+		if strings.ContainsRune(entry, os.PathSeparator) {
+			if err := c.readFile(entry); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if err := c.exclude(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if only = strings.TrimSpace(only); only != "" {
+		parts := strings.SplitN(only, "..", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid only-dates %q, expected from..to", only)
+		}
+
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+			if parts[i] == "" {
+				continue
+			}
+
+			if _, err := time.Parse(CalendarDateFormat, parts[i]); err != nil {
+				return nil, fmt.Errorf("invalid only-dates %q, expected dates as %s", only, CalendarDateFormat)
+			}
+		}
+
+		c.from, c.to = parts[0], parts[1]
+		if c.from != "" && c.to != "" && c.from > c.to {
+			return nil, fmt.Errorf("invalid only-dates %q, %s is after %s", only, c.from, c.to)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Calendar) readFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("unable to read exclude-dates file: %s", err)
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if err := c.exclude(fields[0]); err != nil {
+			return fmt.Errorf("%s at %s:%d", err, filename, line)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (c *Calendar) exclude(date string) error {
+	if _, err := time.Parse(CalendarDateFormat, date); err != nil {
+		return fmt.Errorf("invalid exclude-dates %q, expected a date as %s or a file", date, CalendarDateFormat)
+	}
+
+	c.excluded[date] = true
+	return nil
+}
+
+// Allows returns true if the job can be executed at the given time, otherwise
+// the reason of the exclusion is returned.
+func (c *Calendar) Allows(t time.Time) (bool, string) {
+	date := t.Local().Format(CalendarDateFormat)
+	switch {
+	case c.excluded[date]:
+		return false, fmt.Sprintf("%s is an excluded date", date)
+	case c.from != "" && date < c.from:
+		return false, fmt.Sprintf("%s is before the only-dates range", date)
+	case c.to != "" && date > c.to:
+		return false, fmt.Sprintf("%s is after the only-dates range", date)
+	}
+
+	return true, ""
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteCalendar struct{}
+
+var _ = Suite(&SuiteCalendar{})
+
+func (s *SuiteCalendar) TestAllows(c *C) {
+	cal, err := ParseCalendar([]string{"2017-12-25", " 2017-12-26"}, "2017-01-01..2017-12-31")
+	c.Assert(err, IsNil)
+
+	allowed, _ := cal.Allows(time.Date(2017, 12, 24, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, true)
+
+	allowed, reason := cal.Allows(time.Date(2017, 12, 25, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, false)
+	c.Assert(reason, Equals, "2017-12-25 is an excluded date")
+
+	allowed, reason = cal.Allows(time.Date(2016, 12, 31, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, false)
+	c.Assert(reason, Equals, "2016-12-31 is before the only-dates range")
+
+	allowed, reason = cal.Allows(time.Date(2018, 1, 1, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, false)
+	c.Assert(reason, Equals, "2018-01-01 is after the only-dates range")
+}
+
+func (s *SuiteCalendar) TestAllowsOpenRange(c *C) {
+	cal, err := ParseCalendar(nil, "2017-06-01..")
+	c.Assert(err, IsNil)
+
+	allowed, _ := cal.Allows(time.Date(2030, 1, 1, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, true)
+
+	allowed, _ = cal.Allows(time.Date(2017, 5, 31, 12, 0, 0, 0, time.Local))
+	c.Assert(allowed, Equals, false)
+}
+
+func (s *SuiteCalendar) TestAllowsEmpty(c *C) {
+	cal, err := ParseCalendar(nil, "")
+	c.Assert(err, IsNil)
+
+	allowed, _ := cal.Allows(time.Now())
+	c.Assert(allowed, Equals, true)
+}
+
+func (s *SuiteCalendar) TestParseCalendarFile(c *C) {
+	dir, err := ioutil.TempDir("", "calendar")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "holidays")
+	c.Assert(ioutil.WriteFile(filename, []byte("# holidays\n2017-12-25 Christmas\n\n2018-01-01\n"), 0644), IsNil)
+
+	cal, err := ParseCalendar([]string{filename}, "")
+	c.Assert(err, IsNil)
+	c.Assert(cal.excluded, DeepEquals, map[string]bool{"2017-12-25": true, "2018-01-01": true})
+
+	c.Assert(ioutil.WriteFile(filename, []byte("2017-12-25\nchristmas\n"), 0644), IsNil)
+	_, err = ParseCalendar([]string{filename}, "")
+	c.Assert(err, ErrorMatches, `invalid exclude-dates "christmas".* at .*holidays:2`)
+
+	_, err = ParseCalendar([]string{filepath.Join(dir, "missing")}, "")
+	c.Assert(err, ErrorMatches, "unable to read exclude-dates file: .*")
+}
+
+func (s *SuiteCalendar) TestParseCalendarInvalid(c *C) {
+	_, err := ParseCalendar([]string{"25-12-2017"}, "")
+	c.Assert(err, NotNil)
+
+	for _, only := range []string{"2017-01-01", "2017-01-01..foo", "2017-12-31..2017-01-01"} {
+		_, err := ParseCalendar(nil, only)
+		c.Assert(err, NotNil, Commentf("only-dates %q", only))
+	}
+}
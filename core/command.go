@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// CommandData is the data available at the commands of the jobs with
+// command-template = true, eg. "pg_dump -f backup-{{.Date}}.sql". The values
+// are taken when the execution starts, using the local time of the daemon.
+type CommandData struct {
+	// JobName is the name of the job
+	JobName string
+	// Date is the start of the execution as 2006-01-02
+	Date string
+	// Time is the start of the execution as 15:04:05
+	Time string
+	// Timestamp is the start of the execution as an unix timestamp
+	Timestamp int64
+}
+
+// NewCommandData returns the data of an execution of the given job started at
+// the given time
+func NewCommandData(name string, t time.Time) *CommandData {
+	t = t.Local()
+	return &CommandData{
+		JobName:   name,
+		Date:      t.Format("2006-01-02"),
+		Time:      t.Format("15:04:05"),
+		Timestamp: t.Unix(),
+	}
+}
+
+// ExpandCommand executes the given command as a template with the given data
+func ExpandCommand(cmd string, data *CommandData) (string, error) {
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(cmd)
+	if err != nil {
+		return "", fmt.Errorf("invalid command template: %s", err)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid command template: %s", err)
+	}
+
+	return b.String(), nil
+}
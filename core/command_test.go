@@ -0,0 +1,45 @@
+package core
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteCommand struct{}
+
+var _ = Suite(&SuiteCommand{})
+
+func (s *SuiteCommand) TestNewCommandData(c *C) {
+	t := time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+
+	data := NewCommandData("backup", t)
+	c.Assert(data, DeepEquals, &CommandData{
+		JobName:   "backup",
+		Date:      "2018-01-02",
+		Time:      "03:04:05",
+		Timestamp: t.Unix(),
+	})
+}
+
+func (s *SuiteCommand) TestExpandCommand(c *C) {
+	data := NewCommandData("backup", time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local))
+
+	cmd, err := ExpandCommand("pg_dump -f {{.JobName}}-{{.Date}}.sql", data)
+	c.Assert(err, IsNil)
+	c.Assert(cmd, Equals, "pg_dump -f backup-2018-01-02.sql")
+
+	cmd, err = ExpandCommand("echo foo", data)
+	c.Assert(err, IsNil)
+	c.Assert(cmd, Equals, "echo foo")
+}
+
+func (s *SuiteCommand) TestExpandCommandInvalid(c *C) {
+	data := NewCommandData("backup", time.Now())
+
+	_, err := ExpandCommand("echo {{.Date", data)
+	c.Assert(err, ErrorMatches, "invalid command template: .*")
+
+	_, err = ExpandCommand("echo {{.Foo}}", data)
+	c.Assert(err, ErrorMatches, "invalid command template: .*")
+}
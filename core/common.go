@@ -1,13 +1,20 @@
 package core
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
@@ -19,13 +26,104 @@ var (
 	ErrSkippedExecution = errors.New("skipped execution")
 	ErrUnexpected       = errors.New("error unexpected, docker has returned exit code -1, maybe wrong user?")
 	ErrMaxTimeRunning   = errors.New("the job has exceed the maximum allowed time running.")
+	ErrEmptyCommand     = errors.New("unable to run a job with a empty command.")
+	ErrCancelled        = errors.New("the job has been cancelled.")
+	ErrTaskNotFound     = errors.New("the task of the service is gone before reporting its exit code.")
+	ErrGuardContainer   = errors.New("guard-command can't be used with container, it runs at a new container of the image.")
 )
 
+// NonZeroExitError is returned when the command of a job finishes with a
+// non-zero exit code, OOMKilled is set when the container was killed by the
+// kernel running out of memory and Node, for the swarm services, is the node
+// where the failed task ran.
+type NonZeroExitError struct {
+	ExitCode  int
+	OOMKilled bool
+	Node      string
+	// Reason is the error reported by swarm for the failed task of a
+	// job-service-run, if any.
+	Reason string
+}
+
+func (e NonZeroExitError) Error() string {
+	msg := fmt.Sprintf("error non-zero exit code: %d", e.ExitCode)
+	if e.OOMKilled {
+		msg += ", killed: out of memory"
+	}
+
+	if e.Node != "" {
+		msg += ", node: " + e.Node
+	}
+
+	if e.Reason != "" {
+		msg += ", reason: " + e.Reason
+	}
+
+	return msg
+}
+
+// TaskRejectedError is returned when the task of a job-service-run is rejected
+// by swarm, eg. no node satisfies its constraints or its image can't be pulled,
+// so the job never ran, unlike a NonZeroExitError.
+type TaskRejectedError struct {
+	Node   string
+	Reason string
+}
+
+func (e TaskRejectedError) Error() string {
+	msg := "the task of the service has been rejected"
+	if e.Node != "" {
+		msg += " at node " + e.Node
+	}
+
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+
+	return msg
+}
+
+// PlatformMismatchError is returned when a task is rejected because its image
+// can't run at the platform of the node, eg. an amd64 image at an arm64 node.
+type PlatformMismatchError struct {
+	Image         string
+	ImagePlatform string
+	Node          string
+	NodePlatform  string
+	Reason        string
+}
+
+func (e PlatformMismatchError) Error() string {
+	return fmt.Sprintf(
+		"image %s platform %s incompatible with node %s (%s): %s",
+		e.Image, e.ImagePlatform, e.Node, e.NodePlatform, e.Reason,
+	)
+}
+
+// Job is a task executed by the Scheduler, the RunJob, RunServiceJob, ExecJob,
+// LocalJob and ECSJob satisfy it embedding a BareJob, which implements everything but
+// Run, the execution itself. The jobs may be built from the config files or
+// by its constructors, eg. NewRunServiceJob, and registered with
+// Scheduler.AddJob or Scheduler.ScheduleJob.
 type Job interface {
 	GetName() string
 	GetInstanceName() string
 	GetSchedule() string
 	GetCommand() string
+	GetMaxRuntime() time.Duration
+	GetDependencies() []string
+	GetMaxHistory() int
+	IsEnabled() bool
+	IsConcurrencyLimited() bool
+	ShouldRunOnStart() bool
+	GetCalendar() (*Calendar, error)
+	CheckFlagFiles() (bool, string)
+	ValidateCommand() error
+	GetMaxOutputBytes() int
+	GetFailureThreshold() int
+	GetPriority() int
+	ShouldStripANSI() bool
+	GetStartDelay() time.Duration
 	Middlewares() []Middleware
 	Use(...Middleware)
 	Run(*Context) error
@@ -36,6 +134,41 @@ type Job interface {
 	NotifyStop()
 }
 
+var jobTypes = map[reflect.Type]string{
+	reflect.TypeOf(ExecJob{}):       "job-exec",
+	reflect.TypeOf(RunJob{}):        "job-run",
+	reflect.TypeOf(LocalJob{}):      "job-local",
+	reflect.TypeOf(RunServiceJob{}): "job-service-run",
+	reflect.TypeOf(ECSJob{}):        "job-ecs-run",
+}
+
+// JobType returns the config section of the given job, the jobs are wrapped by
+// its config, so the embedded core job is looked up too.
+func JobType(j Job) string {
+	t := reflect.TypeOf(j)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if s, ok := jobTypes[t]; ok {
+		return s
+	}
+
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Anonymous {
+			if s, ok := jobTypes[f.Type]; ok {
+				return s
+			}
+		}
+	}
+
+	return ""
+}
+
 type Context struct {
 	Scheduler *Scheduler
 	Logger    Logger
@@ -45,18 +178,87 @@ type Context struct {
 	current     int
 	executed    bool
 	middlewares []Middleware
+
+	done       chan struct{}
+	cancelOnce sync.Once
+	lock       sync.Mutex
+	target     string
 }
 
 func NewContext(s *Scheduler, j Job, e *Execution) *Context {
+	l := s.Logger
+	if cl, ok := l.(ContextLogger); ok {
+		l = cl.WithExecution(j, e)
+	}
+
 	return &Context{
 		Scheduler:   s,
-		Logger:      s.Logger,
+		Logger:      l,
 		Job:         j,
 		Execution:   e,
 		middlewares: j.Middlewares(),
+		done:        make(chan struct{}),
+	}
+}
+
+// Done returns a channel that is closed when the execution is cancelled, by
+// the API or because the scheduler is shutting down, and the job should stop,
+// cleaning up its containers or services.
+func (c *Context) Done() <-chan struct{} {
+	if c.done != nil {
+		return c.done
+	}
+
+	if c.Scheduler == nil {
+		return nil
+	}
+
+	return c.Scheduler.done
+}
+
+// Cancel cancels the execution, closing the Done channel.
+func (c *Context) Cancel() {
+	if c.done == nil {
+		return
+	}
+
+	c.cancelOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// ShuttingDown returns true if the execution was cancelled because the
+// scheduler is shutting down, instead of by the API.
+func (c *Context) ShuttingDown() bool {
+	if c.Scheduler == nil {
+		return false
+	}
+
+	select {
+	case <-c.Scheduler.done:
+		return true
+	default:
+		return false
 	}
 }
 
+// SetTarget sets the ID of the container, service or task running the
+// execution, reported by the scheduler while the execution runs.
+func (c *Context) SetTarget(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.target = id
+}
+
+// Target returns the ID set by SetTarget
+func (c *Context) Target() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.target
+}
+
 func (c *Context) Start() {
 	c.Execution.Start()
 	c.Job.AddHistory(c.Execution)
@@ -90,9 +292,28 @@ func (c *Context) doNext() error {
 	}
 
 	c.executed = true
+	if c.Execution.DryRun {
+		c.Logger.Noticef("%s - Dry run %q, would execute %s", c.Job.GetName(), c.Execution.ID, describeJob(c.Job))
+		return nil
+	}
+
 	return c.Job.Run(c)
 }
 
+// Describer is implemented by the jobs able to describe what an execution
+// does, without running it.
+type Describer interface {
+	Describe() string
+}
+
+func describeJob(j Job) string {
+	if d, ok := j.(Describer); ok {
+		return d.Describe()
+	}
+
+	return fmt.Sprintf("%q", j.GetCommand())
+}
+
 func (c *Context) getNext() (Middleware, bool) {
 	if c.current >= len(c.middlewares) {
 		return nil, true
@@ -111,15 +332,50 @@ func (c *Context) Stop(err error) {
 	c.Job.NotifyStop()
 }
 
+// The sources of an execution, set when the execution is initiated
+const (
+	TriggerScheduled  = "scheduled"
+	TriggerManual     = "manual"
+	TriggerAPI        = "api"
+	TriggerSignal     = "signal"
+	TriggerOnStart    = "on-start"
+	TriggerDependency = "dependency"
+)
+
 // Execution contains all the information relative to a Job execution.
 type Execution struct {
 	ID        string
-	Date      time.Time
+	StartedAt time.Time
+	EndedAt   time.Time
 	Duration  time.Duration
 	IsRunning bool
 	Failed    bool
 	Skipped   bool
+	DryRun    bool
 	Error     error
+	Stats     *ContainerStats
+	// ContainerID is the container swarm scheduled for the task of a
+	// job-service-run, reported once the task finishes.
+	ContainerID string
+	// UnhealthyPeriods is the times the container of a job-run went unhealthy
+	// during the execution, as reported by the healthcheck of its image.
+	UnhealthyPeriods int
+	// Attempts is the times a job-service-run with retries ran its service
+	// during the execution, zero for the jobs without retries.
+	Attempts int
+	// TriggerSource is what initiated the execution, eg. TriggerScheduled for
+	// the executions of cron or TriggerAPI for the HTTP API.
+	TriggerSource string
+	// Cancelled is set when the execution was stopped with ErrCancelled, by
+	// the API or on shutdown, it's still failed but not reported as one.
+	Cancelled bool
+	// Suppressed is set when the notifiers must not report the execution,
+	// eg. a repeated failure silenced by the Dedup middleware.
+	Suppressed bool
+	// Note is a remark added to the notifications of the execution, eg.
+	// "still failing (12 times)", the executions with a note are always
+	// reported.
+	Note string
 
 	OutputStream, ErrorStream io.ReadWriter `json:"-"`
 }
@@ -133,27 +389,59 @@ func NewExecution() *Execution {
 	}
 }
 
+// LimitOutput caps the output captured by the execution to the given bytes
+// per stream, the output beyond it is discarded, zero or less means no limit.
+// It should be called before the execution starts.
+func (e *Execution) LimitOutput(max int) {
+	if max <= 0 {
+		return
+	}
+
+	e.OutputStream = NewLimitedBuffer(max)
+	e.ErrorStream = NewLimitedBuffer(max)
+}
+
+// StripANSI removes the ANSI escape sequences, as the colors, from the output
+// captured by the execution. It should be called before the execution starts.
+func (e *Execution) StripANSI() {
+	e.OutputStream = NewANSIStripper(e.OutputStream)
+	e.ErrorStream = NewANSIStripper(e.ErrorStream)
+}
+
 // Start start the exection, initialize the running flags and the start date.
 func (e *Execution) Start() {
 	e.IsRunning = true
-	e.Date = time.Now()
+	e.StartedAt = time.Now()
 }
 
 // Stop stops the executions, if a ErrSkippedExecution is given the exection
 // is mark as skipped, if any other error is given the exection is mark as
-// failed. Also mark the exection as IsRunning false and save the duration time
+// failed. Also mark the exection as IsRunning false and save the end date and
+// the duration. The dates keep the monotonic clock reading, so the duration is
+// not affected by changes of the wall clock during the execution.
 func (e *Execution) Stop(err error) {
 	e.IsRunning = false
-	e.Duration = time.Since(e.Date)
+	e.EndedAt = time.Now()
+	e.Duration = e.EndedAt.Sub(e.StartedAt)
 
 	if err != nil && err != ErrSkippedExecution {
 		e.Error = err
 		e.Failed = true
+		e.Cancelled = err == ErrCancelled
 	} else if err == ErrSkippedExecution {
 		e.Skipped = true
 	}
 }
 
+// ContainerStats contains the peak resources used by the container of an
+// execution, only collected when the job is configured to do it.
+type ContainerStats struct {
+	// MaxMemory is the peak RSS of the container in bytes
+	MaxMemory uint64
+	// CPUSeconds is the CPU time consumed by the container
+	CPUSeconds float64
+}
+
 // Middleware can wrap any job execution, allowing to execution code before
 // or/and after of each `Job.Run`
 type Middleware interface {
@@ -166,6 +454,53 @@ type Middleware interface {
 	ContinueOnStop() bool
 }
 
+// PrioritizedMiddleware is a Middleware that declares its position in the
+// chain, the middlewares with lower priority wrap the ones with higher
+// priority. The middlewares not implementing it have MiddlewarePriorityDefault.
+type PrioritizedMiddleware interface {
+	Middleware
+	Priority() int
+}
+
+const (
+	// MiddlewarePriorityGuard is the priority of the middlewares deciding if a
+	// job is executed, eg. Overlap, they wrap the rest of the chain.
+	MiddlewarePriorityGuard = 100
+	// MiddlewarePriorityDefault is the priority of the notifiers and, in
+	// general, of the middlewares without an explicit priority.
+	MiddlewarePriorityDefault = 500
+	// MiddlewarePriorityReport is the priority of the middlewares deciding how
+	// an execution is reported, eg. Dedup, they are wrapped by the notifiers,
+	// so they see the result of the execution before it is notified.
+	MiddlewarePriorityReport = 700
+	// MiddlewarePriorityExecution is the priority of the middlewares wrapping
+	// the job itself, they are wrapped by the notifiers, so these report the
+	// final result of the execution.
+	MiddlewarePriorityExecution = 900
+)
+
+func middlewarePriority(m Middleware) int {
+	if p, ok := m.(PrioritizedMiddleware); ok {
+		return p.Priority()
+	}
+
+	return MiddlewarePriorityDefault
+}
+
+// MiddlewareChain returns a description of the middlewares of the job, in the
+// order they are executed, useful for debugging.
+func MiddlewareChain(j Job) []string {
+	var chain []string
+	for _, m := range j.Middlewares() {
+		chain = append(chain, fmt.Sprintf(
+			"%s (priority: %d, continue-on-stop: %t)",
+			reflect.TypeOf(m).String(), middlewarePriority(m), m.ContinueOnStop(),
+		))
+	}
+
+	return chain
+}
+
 type middlewareContainer struct {
 	m     map[string]Middleware
 	order []string
@@ -191,15 +526,67 @@ func (c *middlewareContainer) Use(ms ...Middleware) {
 	}
 }
 
+// Middlewares returns the middlewares sorted by priority, the middlewares with
+// the same priority are kept in the order they were added.
 func (c *middlewareContainer) Middlewares() []Middleware {
 	var ms []Middleware
 	for _, t := range c.order {
 		ms = append(ms, c.m[t])
 	}
 
+	sort.SliceStable(ms, func(i, j int) bool {
+		return middlewarePriority(ms[i]) < middlewarePriority(ms[j])
+	})
+
 	return ms
 }
 
+// Toggle is a bool, read from the config files, that is true unless it's set
+// to false, since the defaults can't tell apart a missing value from false.
+type Toggle string
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (t *Toggle) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseBool(string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = Toggle(strconv.FormatBool(v))
+	return nil
+}
+
+// IsOn returns false only if the toggle was set to false
+func (t Toggle) IsOn() bool {
+	return t != "false"
+}
+
+// Duration is a time.Duration that can be read from the config files using the
+// time.ParseDuration format, eg.: "1h30m"
+type Duration time.Duration
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalFlag implements flags.Unmarshaler, so a Duration can be a command
+// line flag
+func (d *Duration) UnmarshalFlag(value string) error {
+	return d.UnmarshalText([]byte(value))
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
 type Logger interface {
 	Criticalf(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
@@ -208,6 +595,26 @@ type Logger interface {
 	Warningf(format string, args ...interface{})
 }
 
+// ContextLogger is a Logger able to tag every entry with the job being
+// executed and the ID of its execution, if the Scheduler logger implements
+// it, an execution Logger is given to every Context.
+type ContextLogger interface {
+	Logger
+	WithExecution(Job, *Execution) Logger
+}
+
+// guardResult returns ErrSkippedExecution if the guard-command, run before the
+// command of the job, exited with the given non-zero exit code, the execution
+// is skipped instead of failed, eg. when there is no new data to process.
+func guardResult(ctx *Context, name string, exitCode int) error {
+	if exitCode == 0 {
+		return nil
+	}
+
+	ctx.Logger.Noticef("%s - Skipping the execution, the guard-command exited with %d", name, exitCode)
+	return ErrSkippedExecution
+}
+
 func randomID() string {
 	b := make([]byte, 6)
 	if _, err := rand.Read(b); err != nil {
@@ -218,14 +625,10 @@ func randomID() string {
 }
 
 func buildPullOptions(image string, registry string) (docker.PullImageOptions, docker.AuthConfiguration) {
-	tag := "latest"
-	name := image
-
-	parts := strings.Split(image, ":")
-
-	if len(parts) == 2 {
-		tag = parts[1]
-		name = parts[0]
+	name, tag, digest := splitImage(image)
+	if digest != "" {
+		// the daemon pulls the exact image when the tag is a digest
+		tag = digest
 	}
 
 	return docker.PullImageOptions{
@@ -235,6 +638,50 @@ func buildPullOptions(image string, registry string) (docker.PullImageOptions, d
 	}, buildAuthConfiguration(registry)
 }
 
+// splitImage splits an image into its name and its tag, "latest" by default,
+// or its digest when it's pinned as "name@sha256:...". The port of a registry
+// at the name, as "registry:5000/name", is not taken as a tag.
+func splitImage(image string) (name, tag, digest string) {
+	if i := strings.Index(image, "@"); i != -1 {
+		image, digest = image[:i], image[i+1:]
+	}
+
+	name, tag = image, "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		name, tag = image[:i], image[i+1:]
+	}
+
+	return name, tag, digest
+}
+
+// verifyImageDigest checks that the local image of a reference pinned by
+// digest has that digest, so the job runs the exact image that was vetted.
+// The images pinned by tag are not checked.
+func verifyImageDigest(c *docker.Client, image string, registry string) error {
+	_, _, digest := splitImage(image)
+	if digest == "" {
+		return nil
+	}
+
+	var img *docker.Image
+	err := withDockerRetry(func() (err error) {
+		img, err = c.InspectImage(fullImageName(registry, image))
+		return
+	})
+
+	if err != nil {
+		return fmt.Errorf("error inspecting image %q: %s", fullImageName(registry, image), err)
+	}
+
+	for _, repoDigest := range img.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+digest) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("image %q doesn't match its digest %s", fullImageName(registry, image), digest)
+}
+
 func buildAuthConfiguration(registry string) docker.AuthConfiguration {
 	var auth docker.AuthConfiguration
 	if dockercfg == nil {
@@ -245,6 +692,204 @@ func buildAuthConfiguration(registry string) docker.AuthConfiguration {
 	return auth
 }
 
+// ParseExtraHost parses an extra entry of the /etc/hosts of a container, given
+// as "host:ip", the ip can be an IPv4 or an IPv6 address.
+func ParseExtraHost(entry string) (host, ip string, err error) {
+	parts := strings.SplitN(entry, ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid extra host %q, expected host:ip", entry)
+	}
+
+	host, ip = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if host == "" || net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("invalid extra host %q, expected host:ip", entry)
+	}
+
+	return host, ip, nil
+}
+
+// ParseTmpfs parses a tmpfs mount given as "/path:size", the size is optional,
+// in bytes or with a k, m or g suffix, eg. "/tmp:64m".
+func ParseTmpfs(spec string) (path string, size int64, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	path = strings.TrimSpace(parts[0])
+	if !strings.HasPrefix(path, "/") {
+		return "", 0, fmt.Errorf("invalid tmpfs %q, the path must be absolute", spec)
+	}
+
+	if len(parts) == 1 {
+		return path, 0, nil
+	}
+
+	size, err = parseSize(parts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid tmpfs %q, %s", spec, err)
+	}
+
+	return path, size, nil
+}
+
+// ValidateEnv validates an environment variable given as "KEY=VALUE", the
+// value can be empty.
+func ValidateEnv(entry string) error {
+	parts := strings.SplitN(entry, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.ContainsAny(parts[0], " \t") {
+		return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", entry)
+	}
+
+	return nil
+}
+
+// ReadEnvFile reads the environment variables of a file, one "KEY=VALUE" by
+// line, as the --env-file of docker, the empty lines and the ones starting
+// with # are ignored.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		if err := ValidateEnv(entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+
+		env = append(env, entry)
+	}
+
+	return env, scanner.Err()
+}
+
+// MergeEnv returns the given environment variables overridden by the ones of
+// override with the same key, keeping the order of the first ones.
+func MergeEnv(env, override []string) []string {
+	merged := make([]string, 0, len(env)+len(override))
+	index := make(map[string]int, 0)
+	for _, entries := range [][]string{env, override} {
+		for _, entry := range entries {
+			key := strings.SplitN(entry, "=", 2)[0]
+			if i, ok := index[key]; ok {
+				merged[i] = entry
+				continue
+			}
+
+			index[key] = len(merged)
+			merged = append(merged, entry)
+		}
+	}
+
+	return merged
+}
+
+// ParsePlatform parses a platform given as "os/arch[/variant]", eg.
+// "linux/arm64" or "linux/arm/v7"
+func ParsePlatform(platform string) (osName, arch, variant string, err error) {
+	parts := strings.Split(strings.TrimSpace(platform), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", "", "", fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return "", "", "", fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+		}
+	}
+
+	if len(parts) == 3 {
+		variant = parts[2]
+	}
+
+	return parts[0], parts[1], variant, nil
+}
+
+var sizeUnits = map[byte]int64{'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}
+
+// parseSize parses a size in bytes, with an optional k, m or g suffix
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b")
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	unit := int64(1)
+	if u, ok := sizeUnits[s[len(s)-1]]; ok {
+		unit = u
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return n * unit, nil
+}
+
+// ParseMemory parses an amount of memory in bytes, with an optional k, m or g
+// suffix, eg. "512m" or "2g"
+func ParseMemory(s string) (int64, error) {
+	n, err := parseSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory %q, expected bytes or a k, m or g suffix", s)
+	}
+
+	return n, nil
+}
+
+// ParseCPUs parses a number of CPUs, can be fractional as "1.5", into nano
+// CPUs, as expected by docker
+func ParseCPUs(s string) (int64, error) {
+	cpus, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || cpus <= 0 {
+		return 0, fmt.Errorf("invalid cpus %q, expected a positive number", s)
+	}
+
+	return int64(cpus * 1e9), nil
+}
+
+// ValidateDNS returns an error if the given DNS server is not an IP address
+func ValidateDNS(server string) error {
+	if net.ParseIP(strings.TrimSpace(server)) == nil {
+		return fmt.Errorf("invalid dns %q, expected an IP address", server)
+	}
+
+	return nil
+}
+
+var (
+	userRegexp  = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(:[a-zA-Z0-9_.-]+)?$`)
+	groupRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+// ValidateUser validates the user of a container, as a name or an UID,
+// optionally followed by a group name or a GID, eg. "1000:1000"
+func ValidateUser(user string) error {
+	if user != "" && !userRegexp.MatchString(user) {
+		return fmt.Errorf("invalid user %q, expected user[:group] or uid[:gid]", user)
+	}
+
+	return nil
+}
+
+// ValidateGroup validates a supplementary group of a container, as a name or
+// a GID
+func ValidateGroup(group string) error {
+	if !groupRegexp.MatchString(group) {
+		return fmt.Errorf("invalid group %q, expected a group name or a gid", group)
+	}
+
+	return nil
+}
+
 func fullImageName(registry string, image string) string {
 	if registry == "" {
 		return image
@@ -3,8 +3,11 @@ package core
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
+	"unsafe"
 
 	. "gopkg.in/check.v1"
 )
@@ -29,6 +32,16 @@ func (s *SuiteCommon) TestNewContext(c *C) {
 	c.Assert(ctx.middlewares, HasLen, 1)
 }
 
+func (s *SuiteCommon) TestNewContextLoggerWithExecution(c *C) {
+	h := NewScheduler(&TestContextLogger{})
+	j := &TestJob{}
+	e := NewExecution()
+
+	ctx := NewContext(h, j, e)
+	c.Assert(ctx.Logger.(*TestContextLogger).Job, Equals, j)
+	c.Assert(ctx.Logger.(*TestContextLogger).Execution, Equals, e)
+}
+
 func (s *SuiteCommon) TestContextNextError(c *C) {
 	mA := &TestMiddlewareAltA{}
 	mB := &TestMiddlewareAltB{}
@@ -184,12 +197,62 @@ func (s *SuiteCommon) TestContextNext(c *C) {
 	c.Assert(j.Called, Equals, 1)
 }
 
+func (s *SuiteCommon) TestContextNextDryRun(c *C) {
+	m := &TestMiddleware{Nested: true}
+
+	j := &TestJob{}
+	j.Use(m)
+
+	e := NewExecution()
+	e.DryRun = true
+
+	h := NewScheduler(&TestLogger{})
+	ctx := NewContext(h, j, e)
+	ctx.Start()
+
+	err := ctx.Next()
+	c.Assert(err, IsNil)
+	c.Assert(m.Called, Equals, 1)
+	c.Assert(j.Called, Equals, 0)
+	c.Assert(ctx.Execution.Failed, Equals, false)
+}
+
+func (s *SuiteCommon) TestDescribeJob(c *C) {
+	c.Assert(describeJob(&TestJob{BareJob: BareJob{Command: "foo"}}), Equals, `"foo"`)
+
+	j := &RunJob{Image: "busybox", Registry: "registry.example.com"}
+	j.Command = "echo foo"
+	c.Assert(describeJob(j), Equals, `"echo foo" with image "registry.example.com/busybox"`)
+}
+
+func (s *SuiteCommon) TestJobType(c *C) {
+	c.Assert(JobType(&RunJob{}), Equals, "job-run")
+	c.Assert(JobType(&struct{ RunServiceJob }{}), Equals, "job-service-run")
+	c.Assert(JobType(&struct{ ECSJob }{}), Equals, "job-ecs-run")
+	c.Assert(JobType(&TestJob{}), Equals, "")
+}
+
 func (s *SuiteCommon) TestExecutionStart(c *C) {
 	exe := &Execution{}
 	exe.Start()
 
 	c.Assert(exe.IsRunning, Equals, true)
-	c.Assert(exe.Date.IsZero(), Equals, false)
+	c.Assert(exe.StartedAt.IsZero(), Equals, false)
+}
+
+func (s *SuiteCommon) TestExecutionLimitOutput(c *C) {
+	e := NewExecution()
+	e.LimitOutput(3)
+	e.OutputStream.Write([]byte("foobar"))
+	e.ErrorStream.Write([]byte("qux"))
+
+	c.Assert(e.OutputStream.(*LimitedBuffer).String(), Equals, "foo"+TruncatedMarker)
+	c.Assert(e.ErrorStream.(*LimitedBuffer).String(), Equals, "qux")
+
+	e = NewExecution()
+	e.LimitOutput(-1)
+	_, ok := e.OutputStream.(*LimitedBuffer)
+	c.Assert(ok, Equals, false)
 }
 
 func (s *SuiteCommon) TestExecutionStop(c *C) {
@@ -204,6 +267,45 @@ func (s *SuiteCommon) TestExecutionStop(c *C) {
 	c.Assert(exe.Duration.Seconds() > .0, Equals, true)
 }
 
+func (s *SuiteCommon) TestExecutionStopCancelled(c *C) {
+	exe := &Execution{}
+	exe.Start()
+	exe.Stop(ErrCancelled)
+
+	c.Assert(exe.Failed, Equals, true)
+	c.Assert(exe.Cancelled, Equals, true)
+	c.Assert(exe.Error, Equals, ErrCancelled)
+}
+
+func (s *SuiteCommon) TestExecutionStopMonotonic(c *C) {
+	exe := &Execution{}
+	exe.Start()
+
+	// the wall clock is set back an hour during the execution, simulated with
+	// a start an hour ahead by the wall clock with the same monotonic reading
+	exe.StartedAt = jumpWallClock(exe.StartedAt, time.Hour)
+	c.Assert(exe.StartedAt.Round(0).Sub(time.Now().Round(0)) > time.Minute*59, Equals, true)
+
+	time.Sleep(time.Millisecond * 10)
+	exe.Stop(nil)
+
+	wall := exe.EndedAt.Round(0).Sub(exe.StartedAt.Round(0))
+	c.Assert(wall < 0, Equals, true)
+	c.Assert(exe.Duration, Equals, exe.EndedAt.Sub(exe.StartedAt))
+	c.Assert(exe.Duration >= time.Millisecond*10, Equals, true)
+	c.Assert(exe.Duration < time.Minute, Equals, true)
+}
+
+// jumpWallClock returns the given time moved by d by the wall clock, keeping
+// its monotonic clock reading, as if the wall clock changed. The time package
+// doesn't allow it, the wall seconds are stored after the 30 bits of the
+// nanoseconds of the first word of a time.Time with a monotonic reading.
+func jumpWallClock(t time.Time, d time.Duration) time.Time {
+	wall := (*uint64)(unsafe.Pointer(&t))
+	*wall += uint64(d/time.Second) << 30
+	return t
+}
+
 func (s *SuiteCommon) TestExecutionStopError(c *C) {
 	err := errors.New("foo")
 
@@ -230,6 +332,96 @@ func (s *SuiteCommon) TestExecutionStopErrorSkip(c *C) {
 	c.Assert(exe.Duration.Seconds() > .0, Equals, true)
 }
 
+func (s *SuiteCommon) TestParsePlatform(c *C) {
+	osName, arch, variant, err := ParsePlatform("linux/arm64")
+	c.Assert(err, IsNil)
+	c.Assert([]string{osName, arch, variant}, DeepEquals, []string{"linux", "arm64", ""})
+
+	osName, arch, variant, err = ParsePlatform("linux/arm/v7")
+	c.Assert(err, IsNil)
+	c.Assert([]string{osName, arch, variant}, DeepEquals, []string{"linux", "arm", "v7"})
+
+	for _, platform := range []string{"linux", "linux/", "/amd64", "linux/arm/v7/foo"} {
+		_, _, _, err := ParsePlatform(platform)
+		c.Assert(err, ErrorMatches, "invalid platform .*")
+	}
+}
+
+func (s *SuiteCommon) TestParseTmpfs(c *C) {
+	for spec, size := range map[string]int64{
+		"/tmp":       0,
+		"/tmp:1024":  1024,
+		"/tmp:512k":  512 << 10,
+		"/tmp:64m":   64 << 20,
+		"/tmp:2G":    2 << 30,
+		"/tmp:64mb":  64 << 20,
+		"/tmp: 64m ": 64 << 20,
+	} {
+		path, got, err := ParseTmpfs(spec)
+		c.Assert(err, IsNil)
+		c.Assert(path, Equals, "/tmp")
+		c.Assert(got, Equals, size)
+	}
+
+	for _, spec := range []string{"tmp:64m", "/tmp:", "/tmp:64x", "/tmp:-1m", "/tmp:m"} {
+		_, _, err := ParseTmpfs(spec)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *SuiteCommon) TestValidateEnv(c *C) {
+	for _, entry := range []string{"FOO=bar", "FOO=", "FOO=bar=baz"} {
+		c.Assert(ValidateEnv(entry), IsNil)
+	}
+
+	for _, entry := range []string{"FOO", "=bar", "FOO BAR=baz"} {
+		c.Assert(ValidateEnv(entry), ErrorMatches, "invalid environment variable .*")
+	}
+}
+
+func (s *SuiteCommon) TestReadEnvFile(c *C) {
+	f, err := ioutil.TempFile("", "env")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+
+	f.WriteString("# comment\nFOO=bar\n\nBAZ=qux\n")
+	f.Close()
+
+	env, err := ReadEnvFile(f.Name())
+	c.Assert(err, IsNil)
+	c.Assert(env, DeepEquals, []string{"FOO=bar", "BAZ=qux"})
+
+	c.Assert(ioutil.WriteFile(f.Name(), []byte("FOO=bar\nBAZ\n"), 0644), IsNil)
+	_, err = ReadEnvFile(f.Name())
+	c.Assert(err, ErrorMatches, `.*:2: invalid environment variable "BAZ", expected KEY=VALUE`)
+}
+
+func (s *SuiteCommon) TestMergeEnv(c *C) {
+	env := MergeEnv([]string{"FOO=bar", "BAZ=qux"}, []string{"BAZ=quux", "QUX=1"})
+	c.Assert(env, DeepEquals, []string{"FOO=bar", "BAZ=quux", "QUX=1"})
+}
+
+func (s *SuiteCommon) TestDurationUnmarshalText(c *C) {
+	var d Duration
+	c.Assert(d.UnmarshalText([]byte("1h30m")), IsNil)
+	c.Assert(time.Duration(d), Equals, time.Minute*90)
+
+	c.Assert(d.UnmarshalText([]byte("foo")), NotNil)
+}
+
+func (s *SuiteCommon) TestToggleUnmarshalText(c *C) {
+	var t Toggle
+	c.Assert(t.IsOn(), Equals, true)
+
+	c.Assert(t.UnmarshalText([]byte("false")), IsNil)
+	c.Assert(t.IsOn(), Equals, false)
+
+	c.Assert(t.UnmarshalText([]byte("1")), IsNil)
+	c.Assert(t.IsOn(), Equals, true)
+
+	c.Assert(t.UnmarshalText([]byte("foo")), NotNil)
+}
+
 func (s *SuiteCommon) TestMiddlewareContainerUseTwice(c *C) {
 	mA := &TestMiddleware{}
 	mB := &TestMiddleware{}
@@ -267,6 +459,40 @@ func (s *SuiteCommon) TestMiddlewareContainerUseOder(c *C) {
 	c.Assert(ms[1], Equals, mA)
 }
 
+func (s *SuiteCommon) TestMiddlewareContainerPriority(c *C) {
+	mA := &TestMiddleware{}
+	mB := &TestMiddlewareAltA{}
+	mC := &TestPrioritizedMiddleware{priority: MiddlewarePriorityGuard}
+
+	container := &middlewareContainer{}
+	container.Use(mA, mB, mC)
+
+	ms := container.Middlewares()
+	c.Assert(ms, HasLen, 3)
+	c.Assert(ms[0], Equals, mC)
+	c.Assert(ms[1], Equals, mA)
+	c.Assert(ms[2], Equals, mB)
+}
+
+func (s *SuiteCommon) TestMiddlewareChain(c *C) {
+	j := &TestJob{}
+	j.Use(&TestMiddleware{OnStop: true}, &TestPrioritizedMiddleware{priority: MiddlewarePriorityExecution})
+
+	c.Assert(MiddlewareChain(j), DeepEquals, []string{
+		"*core.TestMiddleware (priority: 500, continue-on-stop: true)",
+		"*core.TestPrioritizedMiddleware (priority: 900, continue-on-stop: false)",
+	})
+}
+
+type TestPrioritizedMiddleware struct {
+	TestMiddleware
+	priority int
+}
+
+func (m *TestPrioritizedMiddleware) Priority() int {
+	return m.priority
+}
+
 type TestMiddleware struct {
 	Called int
 	Nested bool
@@ -316,3 +542,19 @@ func (*TestLogger) Debugf(format string, args ...interface{})    {}
 func (*TestLogger) Errorf(format string, args ...interface{})    {}
 func (*TestLogger) Noticef(format string, args ...interface{})   {}
 func (*TestLogger) Warningf(format string, args ...interface{})  {}
+
+type TestContextLogger struct {
+	TestLogger
+	Job       Job
+	Execution *Execution
+}
+
+func (l *TestContextLogger) WithExecution(j Job, e *Execution) Logger {
+	return &TestContextLogger{Job: j, Execution: e}
+}
+
+func (s *SuiteCommon) TestGuardResult(c *C) {
+	ctx := &Context{Logger: &TestLogger{}}
+	c.Assert(guardResult(ctx, "foo", 0), IsNil)
+	c.Assert(guardResult(ctx, "foo", 1), Equals, ErrSkippedExecution)
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+var (
+	// dockerRetryBackoff is the initial wait between retries of a docker call
+	// failing with a connection error, it's doubled on every retry up to
+	// dockerRetryMaxBackoff, until dockerRetryTimeout is exceeded.
+	dockerRetryBackoff    = time.Millisecond * 250
+	dockerRetryMaxBackoff = time.Second * 10
+	dockerRetryTimeout    = time.Minute * 2
+)
+
+// defaultPullRetryDelay is the wait before the first retry of a failed pull
+// when no pull-retry-delay is given
+var defaultPullRetryDelay = time.Second * 5
+
+// withPullRetry calls fn, pulling the given image, retrying it up to the given
+// retries when it fails, the delay is doubled on every retry. The connection
+// errors are already retried by withDockerRetry at fn, this covers the errors
+// of the registry, eg.: a timeout or a 5xx.
+func withPullRetry(ctx *Context, image string, retries int, delay time.Duration, fn func() error) error {
+	if delay <= 0 {
+		delay = defaultPullRetryDelay
+	}
+
+	for i := 1; ; i++ {
+		err := fn()
+		if err == nil || i > retries {
+			return err
+		}
+
+		ctx.Logger.Warningf(
+			"Pulling image %q failed, retrying in %s (%d/%d): %s",
+			image, delay, i, retries, err,
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+	}
+}
+
+// dockerDisconnected is set while the docker calls are failing with
+// connection errors
+var dockerDisconnected int32
+
+// IsDockerConnected returns false while the docker daemon is unreachable and
+// the docker calls are being retried.
+func IsDockerConnected() bool {
+	return atomic.LoadInt32(&dockerDisconnected) == 0
+}
+
+// withDockerRetry calls fn retrying it with an exponential backoff while it
+// fails with a connection error, eg.: while the docker daemon is restarting.
+// Only idempotent calls should be retried.
+func withDockerRetry(fn func() error) error {
+	backoff := dockerRetryBackoff
+	deadline := time.Now().Add(dockerRetryTimeout)
+
+	for {
+		err := fn()
+		if !isConnectionError(err) {
+			atomic.StoreInt32(&dockerDisconnected, 0)
+			return err
+		}
+
+		atomic.StoreInt32(&dockerDisconnected, 1)
+		if time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > dockerRetryMaxBackoff {
+			backoff = dockerRetryMaxBackoff
+		}
+	}
+}
+
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if err == docker.ErrConnectionRefused || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// buildNetworkAttachment returns the attachment for a network given as
+// `network` or `network:alias,...`, the network can be a name or an ID.
+func buildNetworkAttachment(network string) swarm.NetworkAttachmentConfig {
+	parts := strings.SplitN(network, ":", 2)
+
+	cfg := swarm.NetworkAttachmentConfig{Target: strings.TrimSpace(parts[0])}
+	if len(parts) == 2 {
+		for _, alias := range strings.Split(parts[1], ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				cfg.Aliases = append(cfg.Aliases, alias)
+			}
+		}
+	}
+
+	return cfg
+}
+
+// resolveNetwork returns the ID of the given network, by name or ID, so a
+// missing network fails before creating the container or the service, with a
+// clear error.
+func resolveNetwork(client *docker.Client, network string) (string, error) {
+	var n *docker.Network
+	err := withDockerRetry(func() (err error) {
+		n, err = client.NetworkInfo(network)
+		return
+	})
+
+	if _, ok := err.(*docker.NoSuchNetwork); ok {
+		return "", fmt.Errorf("network %q not found", network)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error inspecting network %q: %s", network, err)
+	}
+
+	return n.ID, nil
+}
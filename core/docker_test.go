@@ -0,0 +1,104 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDocker struct{}
+
+var _ = Suite(&SuiteDocker{})
+
+func (s *SuiteDocker) SetUpTest(c *C) {
+	dockerRetryBackoff = time.Millisecond
+	dockerRetryTimeout = time.Millisecond * 50
+}
+
+func (s *SuiteDocker) TearDownTest(c *C) {
+	dockerRetryBackoff = time.Millisecond * 250
+	dockerRetryTimeout = time.Minute * 2
+}
+
+func (s *SuiteDocker) TestWithDockerRetry(c *C) {
+	var calls int
+	err := withDockerRetry(func() error {
+		calls++
+		if calls < 3 {
+			c.Assert(IsDockerConnected(), Equals, calls == 1)
+			return docker.ErrConnectionRefused
+		}
+
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 3)
+	c.Assert(IsDockerConnected(), Equals, true)
+}
+
+func (s *SuiteDocker) TestWithDockerRetryTimeout(c *C) {
+	err := withDockerRetry(func() error {
+		return &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	})
+
+	c.Assert(err, NotNil)
+	c.Assert(IsDockerConnected(), Equals, false)
+
+	withDockerRetry(func() error { return nil })
+	c.Assert(IsDockerConnected(), Equals, true)
+}
+
+func (s *SuiteDocker) TestWithDockerRetryOtherError(c *C) {
+	var calls int
+	err := withDockerRetry(func() error {
+		calls++
+		return errors.New("foo")
+	})
+
+	c.Assert(err, ErrorMatches, "foo")
+	c.Assert(calls, Equals, 1)
+}
+
+func (s *SuiteDocker) TestWithPullRetry(c *C) {
+	defer func(d time.Duration) { defaultPullRetryDelay = d }(defaultPullRetryDelay)
+	defaultPullRetryDelay = time.Millisecond
+
+	var calls int
+	err := withPullRetry(&Context{Logger: &TestLogger{}}, "foo", 3, 0, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("timeout")
+		}
+
+		return nil
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(calls, Equals, 3)
+}
+
+func (s *SuiteDocker) TestWithPullRetryExhausted(c *C) {
+	var calls int
+	err := withPullRetry(&Context{Logger: &TestLogger{}}, "foo", 2, time.Millisecond, func() error {
+		calls++
+		return errors.New("timeout")
+	})
+
+	c.Assert(err, ErrorMatches, "timeout")
+	c.Assert(calls, Equals, 3)
+}
+
+func (s *SuiteDocker) TestWithPullRetryDisabled(c *C) {
+	var calls int
+	err := withPullRetry(&Context{Logger: &TestLogger{}}, "foo", 0, 0, func() error {
+		calls++
+		return errors.New("timeout")
+	})
+
+	c.Assert(err, NotNil)
+	c.Assert(calls, Equals, 1)
+}
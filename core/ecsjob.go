@@ -0,0 +1,411 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mcuadros/go-defaults"
+)
+
+const (
+	defaultECSPollInterval = time.Second * 5
+	ecsTargetPrefix        = "AmazonEC2ContainerServiceV20141113."
+	ecsStatusStopped       = "STOPPED"
+)
+
+// ECSJob runs a task definition of AWS ECS once, waiting for the task to stop,
+// as RunServiceJob does with a swarm service. The command and the environment
+// override the ones of the container of the task definition.
+type ECSJob struct {
+	BareJob
+	Cluster        string
+	TaskDefinition string   `gcfg:"task-definition"`
+	Container      string   `gcfg:"container"`
+	LaunchType     string   `gcfg:"launch-type"`
+	Subnet         []string `gcfg:"subnet"`
+	SecurityGroup  []string `gcfg:"security-group"`
+	AssignPublicIP bool     `default:"false" gcfg:"assign-public-ip"`
+	Environment    []string
+	Region         string
+	Endpoint       string
+	AccessKey      string   `gcfg:"access-key"`
+	SecretKey      string   `gcfg:"secret-key"`
+	SecretKeyFile  string   `gcfg:"secret-key-file"`
+	SessionToken   string   `gcfg:"session-token"`
+	PollInterval   Duration `gcfg:"poll-interval"`
+}
+
+// NewECSJob returns a ECSJob with the defaults of its options, as the ones read
+// from the config files.
+func NewECSJob() *ECSJob {
+	j := &ECSJob{}
+	defaults.SetDefaults(j)
+
+	return j
+}
+
+// Describe returns what an execution of the job does, used on dry-run mode.
+func (j *ECSJob) Describe() string {
+	return fmt.Sprintf("%q with task definition %q at cluster %q", j.Command, j.TaskDefinition, j.Cluster)
+}
+
+func (j *ECSJob) Run(ctx *Context) error {
+	arn, err := j.runTask(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Noticef("Started ECS task %s for job %s\n", arn, j.Name)
+	ctx.SetTarget(arn)
+
+	task, err := j.waitTask(ctx, arn)
+	if err == ErrMaxTimeRunning || err == ErrCancelled {
+		// the task is always stopped, it keeps running otherwise
+		if err2 := j.stopTask(arn, err.Error()); err2 != nil {
+			ctx.Logger.Errorf("error stopping ECS task %s: %s", arn, err2)
+		}
+
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := j.taskExitCode(task)
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Noticef("ECS task %s has stopped with exit code %d\n", arn, exitCode)
+	if j.IsSuccessExitCode(exitCode) {
+		return nil
+	}
+
+	return NonZeroExitError{ExitCode: exitCode}
+}
+
+type ecsContainer struct {
+	Name     string `json:"name"`
+	ExitCode *int   `json:"exitCode"`
+	Reason   string `json:"reason"`
+}
+
+type ecsTask struct {
+	TaskArn       string          `json:"taskArn"`
+	LastStatus    string          `json:"lastStatus"`
+	StoppedReason string          `json:"stoppedReason"`
+	Containers    []*ecsContainer `json:"containers"`
+}
+
+type ecsFailure struct {
+	Arn    string `json:"arn"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+type ecsTasksOutput struct {
+	Tasks    []*ecsTask    `json:"tasks"`
+	Failures []*ecsFailure `json:"failures"`
+}
+
+// runTask starts a task of the task definition, returning its ARN
+func (j *ECSJob) runTask(ctx *Context) (string, error) {
+	input := map[string]interface{}{
+		"cluster":        j.Cluster,
+		"taskDefinition": j.TaskDefinition,
+		"count":          1,
+		"startedBy":      "ofelia",
+	}
+
+	if j.LaunchType != "" {
+		input["launchType"] = j.LaunchType
+	}
+
+	if len(j.Subnet) != 0 {
+		assign := "DISABLED"
+		if j.AssignPublicIP {
+			assign = "ENABLED"
+		}
+
+		input["networkConfiguration"] = map[string]interface{}{
+			"awsvpcConfiguration": map[string]interface{}{
+				"subnets":        j.Subnet,
+				"securityGroups": j.SecurityGroup,
+				"assignPublicIp": assign,
+			},
+		}
+	}
+
+	if override := j.buildContainerOverride(); override != nil {
+		input["overrides"] = map[string]interface{}{
+			"containerOverrides": []interface{}{override},
+		}
+	}
+
+	output := &ecsTasksOutput{}
+	if err := j.call("RunTask", input, output); err != nil {
+		return "", err
+	}
+
+	if len(output.Tasks) == 0 {
+		if len(output.Failures) != 0 {
+			f := output.Failures[0]
+			return "", fmt.Errorf("ECS task not started: %s %s", f.Reason, f.Detail)
+		}
+
+		return "", fmt.Errorf("ECS task not started")
+	}
+
+	return output.Tasks[0].TaskArn, nil
+}
+
+// buildContainerOverride returns the override of the command and the
+// environment of the container, nil if none of them are given.
+func (j *ECSJob) buildContainerOverride() map[string]interface{} {
+	args := j.GetCommandArgs()
+	if len(args) == 0 && len(j.Environment) == 0 {
+		return nil
+	}
+
+	override := map[string]interface{}{"name": j.Container}
+	if len(args) != 0 {
+		override["command"] = args
+	}
+
+	if len(j.Environment) != 0 {
+		env := make([]map[string]string, 0, len(j.Environment))
+		for _, e := range j.Environment {
+			parts := strings.SplitN(e, "=", 2)
+			if len(parts) == 1 {
+				parts = append(parts, os.Getenv(parts[0]))
+			}
+
+			env = append(env, map[string]string{"name": parts[0], "value": parts[1]})
+		}
+
+		override["environment"] = env
+	}
+
+	return override
+}
+
+// waitTask waits until the task is stopped, up to the max runtime of the job,
+// the errors describing the task are logged and retried on the next check.
+func (j *ECSJob) waitTask(ctx *Context, arn string) (*ecsTask, error) {
+	start := time.Now()
+	max := j.GetMaxRuntime()
+
+	interval := time.Duration(j.PollInterval)
+	if interval <= 0 {
+		interval = defaultECSPollInterval
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrCancelled
+		case <-time.After(interval):
+		}
+
+		if time.Since(start) > max {
+			return nil, ErrMaxTimeRunning
+		}
+
+		output := &ecsTasksOutput{}
+		err := j.call("DescribeTasks", map[string]interface{}{
+			"cluster": j.Cluster,
+			"tasks":   []string{arn},
+		}, output)
+
+		if err != nil {
+			ctx.Logger.Warningf("Failed to describe ECS task %s: %s", arn, err)
+			continue
+		}
+
+		if len(output.Tasks) == 0 {
+			return nil, fmt.Errorf("ECS task %s not found", arn)
+		}
+
+		if task := output.Tasks[0]; task.LastStatus == ecsStatusStopped {
+			return task, nil
+		}
+	}
+}
+
+// taskExitCode returns the exit code of the container, or of the first one of
+// the task if no container is given, an error if the container never ran.
+func (j *ECSJob) taskExitCode(task *ecsTask) (int, error) {
+	for _, c := range task.Containers {
+		if j.Container != "" && c.Name != j.Container {
+			continue
+		}
+
+		if c.ExitCode == nil {
+			reason := c.Reason
+			if reason == "" {
+				reason = task.StoppedReason
+			}
+
+			return 0, fmt.Errorf("ECS task %s stopped without exit code: %s", task.TaskArn, reason)
+		}
+
+		return *c.ExitCode, nil
+	}
+
+	return 0, fmt.Errorf("ECS task %s stopped without container %q: %s", task.TaskArn, j.Container, task.StoppedReason)
+}
+
+func (j *ECSJob) stopTask(arn, reason string) error {
+	return j.call("StopTask", map[string]interface{}{
+		"cluster": j.Cluster,
+		"task":    arn,
+		"reason":  reason,
+	}, nil)
+}
+
+// call calls the given action of the ECS API, signed with the credentials of
+// the job, or the AWS_ environment variables when not given.
+func (j *ECSJob) call(action string, input, output interface{}) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	region := j.region()
+	endpoint := j.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://ecs.%s.amazonaws.com", region)
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecsTargetPrefix+action)
+
+	accessKey, secretKey, sessionToken := j.credentials()
+	signAWSRequest(req, payload, "ecs", region, accessKey, secretKey, sessionToken, time.Now().UTC())
+
+	client := &http.Client{Timeout: time.Second * 30}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("ECS %s failed: %s", action, err)
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ECS %s failed: %s", action, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ECS %s failed with status code %d: %s", action, resp.StatusCode, body)
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(body, output); err != nil {
+		return fmt.Errorf("ECS %s invalid response: %s", action, err)
+	}
+
+	return nil
+}
+
+func (j *ECSJob) region() string {
+	for _, region := range []string{j.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region
+		}
+	}
+
+	return "us-east-1"
+}
+
+func (j *ECSJob) credentials() (string, string, string) {
+	if j.AccessKey != "" {
+		return j.AccessKey, j.SecretKey, j.SessionToken
+	}
+
+	return os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+}
+
+// signAWSRequest signs a request to the root path of an AWS JSON API using
+// AWS Signature Version 4
+func signAWSRequest(req *http.Request, payload []byte, service, region, accessKey, secretKey, sessionToken string, now time.Time) {
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	// the canonical headers sorted by name
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-security-token", "x-amz-target"}
+	var signed, canonical []string
+	for _, h := range headers {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+
+		if value == "" {
+			continue
+		}
+
+		signed = append(signed, h)
+		canonical = append(canonical, h+":"+strings.TrimSpace(value))
+	}
+
+	signedHeaders := strings.Join(signed, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		strings.Join(canonical, "\n"),
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
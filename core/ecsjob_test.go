@@ -0,0 +1,174 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteECSJob struct {
+	server *httptest.Server
+
+	lock     sync.Mutex
+	calls    []string
+	inputs   map[string]map[string]interface{}
+	status   string
+	exitCode *int
+}
+
+var _ = Suite(&SuiteECSJob{})
+
+func (s *SuiteECSJob) SetUpTest(c *C) {
+	s.calls = nil
+	s.inputs = make(map[string]map[string]interface{})
+	s.status = "RUNNING"
+	s.exitCode = nil
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		c.Assert(r.Header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 Credential=foo/.*/eu-west-1/ecs/aws4_request, .*")
+
+		action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), ecsTargetPrefix)
+		body, _ := ioutil.ReadAll(r.Body)
+		input := make(map[string]interface{})
+		c.Assert(json.Unmarshal(body, &input), IsNil)
+
+		s.calls = append(s.calls, action)
+		s.inputs[action] = input
+
+		switch action {
+		case "RunTask":
+			if input["taskDefinition"] == "missing" {
+				w.Write([]byte(`{"tasks": [], "failures": [{"reason": "MISSING", "detail": "no task definition"}]}`))
+				return
+			}
+
+			w.Write([]byte(`{"tasks": [{"taskArn": "arn:task/1", "lastStatus": "PROVISIONING"}]}`))
+		case "DescribeTasks":
+			task := &ecsTask{
+				TaskArn:       "arn:task/1",
+				LastStatus:    s.status,
+				StoppedReason: "Essential container in task exited",
+				Containers:    []*ecsContainer{{Name: "app", ExitCode: s.exitCode}},
+			}
+
+			json.NewEncoder(w).Encode(&ecsTasksOutput{Tasks: []*ecsTask{task}})
+		case "StopTask":
+			w.Write([]byte(`{}`))
+		}
+	}))
+}
+
+func (s *SuiteECSJob) TearDownTest(c *C) {
+	s.server.Close()
+}
+
+func (s *SuiteECSJob) buildJob() *ECSJob {
+	job := NewECSJob()
+	job.Name = "foo"
+	job.Cluster = "default"
+	job.TaskDefinition = "app:3"
+	job.Container = "app"
+	job.Region = "eu-west-1"
+	job.Endpoint = s.server.URL
+	job.AccessKey = "foo"
+	job.SecretKey = "bar"
+	job.PollInterval = Duration(time.Millisecond * 50)
+
+	return job
+}
+
+// stopTask makes the task stop with the given exit code
+func (s *SuiteECSJob) stopTask(exitCode int) {
+	time.Sleep(time.Millisecond * 200)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status, s.exitCode = ecsStatusStopped, &exitCode
+}
+
+func (s *SuiteECSJob) TestRun(c *C) {
+	job := s.buildJob()
+	job.Command = `echo "foo bar"`
+	job.Environment = []string{"FOO=bar"}
+	job.Subnet = []string{"subnet-1"}
+	job.LaunchType = "FARGATE"
+
+	go s.stopTask(0)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c.Assert(s.calls[0], Equals, "RunTask")
+	c.Assert(s.calls[len(s.calls)-1], Equals, "DescribeTasks")
+
+	input := s.inputs["RunTask"]
+	c.Assert(input["taskDefinition"], Equals, "app:3")
+	c.Assert(input["launchType"], Equals, "FARGATE")
+
+	overrides := input["overrides"].(map[string]interface{})["containerOverrides"].([]interface{})
+	override := overrides[0].(map[string]interface{})
+	c.Assert(override["name"], Equals, "app")
+	c.Assert(override["command"], DeepEquals, []interface{}{"echo", "foo bar"})
+	c.Assert(override["environment"], DeepEquals, []interface{}{
+		map[string]interface{}{"name": "FOO", "value": "bar"},
+	})
+
+	vpc := input["networkConfiguration"].(map[string]interface{})["awsvpcConfiguration"].(map[string]interface{})
+	c.Assert(vpc["subnets"], DeepEquals, []interface{}{"subnet-1"})
+	c.Assert(vpc["assignPublicIp"], Equals, "DISABLED")
+}
+
+func (s *SuiteECSJob) TestRunNonZeroExitCode(c *C) {
+	job := s.buildJob()
+
+	go s.stopTask(3)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+	c.Assert(s.inputs["RunTask"]["overrides"], IsNil)
+}
+
+func (s *SuiteECSJob) TestRunNotStarted(c *C) {
+	job := s.buildJob()
+	job.TaskDefinition = "missing"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, "ECS task not started: MISSING no task definition")
+}
+
+func (s *SuiteECSJob) TestRunMaxRuntime(c *C) {
+	job := s.buildJob()
+	job.MaxRuntime = Duration(time.Millisecond * 120)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c.Assert(s.calls[len(s.calls)-1], Equals, "StopTask")
+	c.Assert(s.inputs["StopTask"]["task"], Equals, "arn:task/1")
+}
+
+func (s *SuiteECSJob) TestTaskExitCodeNoExitCode(c *C) {
+	job := s.buildJob()
+
+	_, err := job.taskExitCode(&ecsTask{
+		TaskArn:       "arn:task/1",
+		StoppedReason: "CannotPullContainerError",
+		Containers:    []*ecsContainer{{Name: "app"}},
+	})
+
+	c.Assert(err, ErrorMatches, "ECS task arn:task/1 stopped without exit code: CannotPullContainerError")
+}
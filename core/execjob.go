@@ -1,46 +1,91 @@
 package core
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/fsouza/go-dockerclient"
-	"github.com/gobs/args"
+	"github.com/mcuadros/go-defaults"
 )
 
 type ExecJob struct {
 	BareJob
-	Client    *docker.Client `json:"-"`
-	Container string
-	User      string `default:"root"`
-	TTY       bool   `default:"false"`
+	Client       *docker.Client `json:"-"`
+	Container    string
+	User         string `default:"root"`
+	TTY          bool   `default:"false"`
+	Environment  []string
+	GuardCommand string `gcfg:"guard-command"`
 }
 
+// NewExecJob returns a ExecJob with the defaults of its options, as the ones read
+// from the config files.
 func NewExecJob(c *docker.Client) *ExecJob {
-	return &ExecJob{Client: c}
+	j := &ExecJob{Client: c}
+	defaults.SetDefaults(j)
+
+	return j
+}
+
+// Describe returns what an execution of the job does, used on dry-run mode.
+func (j *ExecJob) Describe() string {
+	return fmt.Sprintf("%q at container %q", j.Command, j.Container)
 }
 
 func (j *ExecJob) Run(ctx *Context) error {
-	exec, err := j.buildExec()
+	if j.GuardCommand != "" {
+		code, err := j.runExec(ctx, j.splitCommand(j.GuardCommand))
+		if err != nil {
+			return err
+		}
+
+		if err := guardResult(ctx, j.Name, code); err != nil {
+			return err
+		}
+	}
+
+	code, err := j.runExec(ctx, j.GetCommandArgs())
 	if err != nil {
 		return err
 	}
 
-	if err := j.startExec(ctx.Execution, exec); err != nil {
-		return err
+	if j.IsSuccessExitCode(code) {
+		return nil
+	}
+
+	switch code {
+	case -1:
+		return ErrUnexpected
+	default:
+		return NonZeroExitError{ExitCode: code}
+	}
+}
+
+// runExec runs the given args at the container, returning its exit code
+func (j *ExecJob) runExec(ctx *Context, args []string) (int, error) {
+	exec, err := j.buildExec(args)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx.SetTarget(j.Container)
+	if err := j.startExec(ctx, exec); err != nil {
+		return 0, err
 	}
 
 	return j.inspectExec(exec)
 }
 
-func (j *ExecJob) buildExec() (*docker.Exec, error) {
+func (j *ExecJob) buildExec(args []string) (*docker.Exec, error) {
 	exec, err := j.Client.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  false,
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          j.TTY,
-		Cmd:          args.GetArgs(j.Command),
+		Cmd:          args,
 		Container:    j.Container,
 		User:         j.User,
+		Env:          j.Environment,
 	})
 
 	if err != nil {
@@ -50,14 +95,37 @@ func (j *ExecJob) buildExec() (*docker.Exec, error) {
 	return exec, nil
 }
 
-func (j *ExecJob) startExec(e *Execution, exec *docker.Exec) error {
+// startExec starts the exec and waits until it finishes, the docker API doesn't
+// provide a way to kill an exec, so when max-runtime is exceeded, or the job is
+// cancelled, we stop waiting for it and the process may keep running inside of
+// the container.
+func (j *ExecJob) startExec(ctx *Context, exec *docker.Exec) error {
+	execCtx, cancel := context.WithTimeout(context.Background(), j.GetMaxRuntime())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-execCtx.Done():
+		}
+	}()
+
 	err := j.Client.StartExec(exec.ID, docker.StartExecOptions{
 		Tty:          j.TTY,
-		OutputStream: e.OutputStream,
-		ErrorStream:  e.ErrorStream,
+		OutputStream: ctx.Execution.OutputStream,
+		ErrorStream:  ctx.Execution.ErrorStream,
 		RawTerminal:  j.TTY,
+		Context:      execCtx,
 	})
 
+	switch execCtx.Err() {
+	case context.DeadlineExceeded:
+		return ErrMaxTimeRunning
+	case context.Canceled:
+		return ErrCancelled
+	}
+
 	if err != nil {
 		return fmt.Errorf("error starting exec: %s", err)
 	}
@@ -65,19 +133,16 @@ func (j *ExecJob) startExec(e *Execution, exec *docker.Exec) error {
 	return nil
 }
 
-func (j *ExecJob) inspectExec(exec *docker.Exec) error {
-	i, err := j.Client.InspectExec(exec.ID)
+func (j *ExecJob) inspectExec(exec *docker.Exec) (int, error) {
+	var i *docker.ExecInspect
+	err := withDockerRetry(func() (err error) {
+		i, err = j.Client.InspectExec(exec.ID)
+		return
+	})
 
 	if err != nil {
-		return fmt.Errorf("error inspecting exec: %s", err)
+		return 0, fmt.Errorf("error inspecting exec: %s", err)
 	}
 
-	switch i.ExitCode {
-	case 0:
-		return nil
-	case -1:
-		return ErrUnexpected
-	default:
-		return fmt.Errorf("error non-zero exit code: %d", i.ExitCode)
-	}
+	return i.ExitCode, nil
 }
@@ -58,6 +58,35 @@ func (s *SuiteExecJob) TestRun(c *C) {
 	c.Assert(exec.ProcessConfig.Tty, Equals, true)
 }
 
+func (s *SuiteExecJob) TestRunGuard(c *C) {
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = `echo foo`
+	job.GuardCommand = `test -f /data/new`
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+
+	container, err := s.client.InspectContainer(ContainerFixture)
+	c.Assert(err, IsNil)
+	c.Assert(container.ExecIDs, HasLen, 2)
+
+	exec, err := s.client.InspectExec(container.ExecIDs[0])
+	c.Assert(err, IsNil)
+	c.Assert(exec.ProcessConfig.EntryPoint, Equals, "test")
+	c.Assert(exec.ProcessConfig.Arguments, DeepEquals, []string{"-f", "/data/new"})
+}
+
+func (s *SuiteExecJob) TestRunEnvironment(c *C) {
+	job := &ExecJob{Client: s.client}
+	job.Container = ContainerFixture
+	job.Command = `env`
+	job.Environment = []string{"FOO=bar"}
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+}
+
 func (s *SuiteExecJob) buildContainer(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultMaxHistory = 10
+
+// The status of a finished execution
+const (
+	StatusSuccessful = "successful"
+	StatusFailed     = "failed"
+	StatusSkipped    = "skipped"
+)
+
+// ExecutionRecord is the snapshot of a finished execution kept at the history
+type ExecutionRecord struct {
+	ID        string        `json:"id"`
+	StartedAt time.Time     `json:"started_at"`
+	EndedAt   time.Time     `json:"ended_at"`
+	Duration  time.Duration `json:"duration"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	Trigger   string        `json:"trigger,omitempty"`
+	Unhealthy int           `json:"unhealthy_periods,omitempty"`
+	Attempts  int           `json:"attempts,omitempty"`
+}
+
+// NewExecutionRecord returns a ExecutionRecord from a finished Execution
+func NewExecutionRecord(e *Execution) ExecutionRecord {
+	r := ExecutionRecord{
+		ID:        e.ID,
+		StartedAt: e.StartedAt,
+		EndedAt:   e.EndedAt,
+		Duration:  e.Duration,
+		Status:    StatusSuccessful,
+		Trigger:   e.TriggerSource,
+		Unhealthy: e.UnhealthyPeriods,
+		Attempts:  e.Attempts,
+	}
+
+	if e.Skipped {
+		r.Status = StatusSkipped
+	} else if e.Failed {
+		r.Status = StatusFailed
+	}
+
+	if e.Error != nil {
+		r.Error = e.Error.Error()
+	}
+
+	return r
+}
+
+// History keeps the last executions of every job, keyed by job name, up to
+// the max-history of each job.
+type History struct {
+	lock    sync.RWMutex
+	records map[string][]ExecutionRecord
+	path    string
+	fsync   bool
+}
+
+// NewHistory returns a new empty History
+func NewHistory() *History {
+	return &History{records: make(map[string][]ExecutionRecord, 0)}
+}
+
+// OpenHistory returns a History persisted at the given file, as JSON, loading
+// the executions stored by a previous run, if any. The file is rewritten after
+// every execution, with fsync the data is flushed to the disk before, so the
+// history survives a crash of the host, not only of the daemon.
+func OpenHistory(path string, fsync bool) (*History, error) {
+	h := NewHistory()
+	h.path, h.fsync = path, fsync
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history file %q: %s", path, err)
+	}
+
+	if err := json.Unmarshal(content, &h.records); err != nil {
+		return nil, fmt.Errorf("invalid history file %q: %s", path, err)
+	}
+
+	if h.records == nil {
+		h.records = make(map[string][]ExecutionRecord, 0)
+	}
+
+	return h, nil
+}
+
+// Add stores the given execution at the history of the job, the oldest
+// executions are dropped when the max-history of the job is exceeded. The
+// history is saved to its file, if any, returning the error writing it.
+func (h *History) Add(j Job, e *Execution) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	name := j.GetName()
+	h.records[name] = limitRecords(append(h.records[name], NewExecutionRecord(e)), j.GetMaxHistory())
+
+	return h.save()
+}
+
+// limit drops the oldest executions of the given job over its max-history,
+// applied to the executions loaded from the history file, the max-history may
+// have been lowered since they were stored.
+func (h *History) limit(j Job) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	name := j.GetName()
+	if records, ok := h.records[name]; ok {
+		h.records[name] = limitRecords(records, j.GetMaxHistory())
+	}
+}
+
+func limitRecords(records []ExecutionRecord, max int) []ExecutionRecord {
+	if len(records) > max {
+		return append([]ExecutionRecord(nil), records[len(records)-max:]...)
+	}
+
+	return records
+}
+
+// save writes the history to a temporary file renamed to its path, so the
+// file is never left half written.
+func (h *History) save() error {
+	if h.path == "" {
+		return nil
+	}
+
+	content, err := json.Marshal(h.records)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(h.path), filepath.Base(h.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write history file %q: %s", h.path, err)
+	}
+
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to write history file %q: %s", h.path, err)
+	}
+
+	if h.fsync {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return fmt.Errorf("unable to sync history file %q: %s", h.path, err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to write history file %q: %s", h.path, err)
+	}
+
+	if err := os.Rename(f.Name(), h.path); err != nil {
+		return fmt.Errorf("unable to write history file %q: %s", h.path, err)
+	}
+
+	return nil
+}
+
+// Get returns the executions of the given job, from the oldest to the newest.
+func (h *History) Get(name string) []ExecutionRecord {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return append([]ExecutionRecord(nil), h.records[name]...)
+}
+
+// Last returns the last execution of the given job, false if the job has not
+// been executed yet.
+func (h *History) Last(name string) (ExecutionRecord, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	records := h.records[name]
+	if len(records) == 0 {
+		return ExecutionRecord{}, false
+	}
+
+	return records[len(records)-1], true
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteHistory struct{}
+
+var _ = Suite(&SuiteHistory{})
+
+func (s *SuiteHistory) TestNewExecutionRecord(c *C) {
+	e := NewExecution()
+	e.Start()
+	e.Stop(errors.New("foo"))
+
+	r := NewExecutionRecord(e)
+	c.Assert(r.ID, Equals, e.ID)
+	c.Assert(r.StartedAt, Equals, e.StartedAt)
+	c.Assert(r.EndedAt, Equals, e.EndedAt)
+	c.Assert(r.Duration, Equals, e.Duration)
+	c.Assert(r.Status, Equals, StatusFailed)
+	c.Assert(r.Error, Equals, "foo")
+
+	e = NewExecution()
+	e.Start()
+	e.Stop(ErrSkippedExecution)
+	c.Assert(NewExecutionRecord(e).Status, Equals, StatusSkipped)
+
+	e = NewExecution()
+	e.Start()
+	e.Stop(nil)
+	c.Assert(NewExecutionRecord(e).Status, Equals, StatusSuccessful)
+	c.Assert(NewExecutionRecord(e).Error, Equals, "")
+}
+
+func (s *SuiteHistory) TestAdd(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.MaxHistory = 2
+
+	h := NewHistory()
+	_, ok := h.Last("foo")
+	c.Assert(ok, Equals, false)
+
+	var executions []*Execution
+	for i := 0; i < 3; i++ {
+		e := NewExecution()
+		h.Add(job, e)
+		executions = append(executions, e)
+	}
+
+	records := h.Get("foo")
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].ID, Equals, executions[1].ID)
+	c.Assert(records[1].ID, Equals, executions[2].ID)
+
+	last, ok := h.Last("foo")
+	c.Assert(ok, Equals, true)
+	c.Assert(last.ID, Equals, executions[2].ID)
+
+	c.Assert(h.Get("bar"), HasLen, 0)
+}
+
+func (s *SuiteHistory) TestOpenHistory(c *C) {
+	path := filepath.Join(c.MkDir(), "history.json")
+
+	job := &TestJob{}
+	job.Name = "foo"
+	job.MaxHistory = 3
+
+	h, err := OpenHistory(path, true)
+	c.Assert(err, IsNil)
+	c.Assert(h.Get("foo"), HasLen, 0)
+
+	var executions []*Execution
+	for i := 0; i < 3; i++ {
+		e := NewExecution()
+		e.Start()
+		e.Stop(nil)
+		c.Assert(h.Add(job, e), IsNil)
+		executions = append(executions, e)
+	}
+
+	h, err = OpenHistory(path, false)
+	c.Assert(err, IsNil)
+
+	records := h.Get("foo")
+	c.Assert(records, HasLen, 3)
+	c.Assert(records[2].ID, Equals, executions[2].ID)
+	c.Assert(records[2].Status, Equals, StatusSuccessful)
+
+	// the max-history lowered since the executions were stored
+	job.MaxHistory = 1
+	h.limit(job)
+
+	records = h.Get("foo")
+	c.Assert(records, HasLen, 1)
+	c.Assert(records[0].ID, Equals, executions[2].ID)
+}
+
+func (s *SuiteHistory) TestOpenHistoryInvalid(c *C) {
+	path := filepath.Join(c.MkDir(), "history.json")
+	c.Assert(ioutil.WriteFile(path, []byte("foo"), 0644), IsNil)
+
+	_, err := OpenHistory(path, false)
+	c.Assert(err, ErrorMatches, `invalid history file .*`)
+}
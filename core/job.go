@@ -1,15 +1,41 @@
 package core
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/gobs/args"
 )
 
 type BareJob struct {
-	Schedule     string
-	Name         string
-	Command      string
-	InstanceName string `default:""`
+	Schedule           string
+	Name               string
+	Command            string
+	InstanceName       string   `default:""`
+	MaxRuntime         Duration `gcfg:"max-runtime"`
+	DependsOn          string   `gcfg:"depends-on"`
+	MaxHistory         int      `gcfg:"max-history"`
+	Enabled            Toggle   `gcfg:"enabled"`
+	NoConcurrencyLimit bool     `gcfg:"no-concurrency-limit"`
+	RunOnStart         bool     `gcfg:"run-on-start"`
+	SuccessExitCodes   []int    `gcfg:"success-exit-codes"`
+	ExcludeDates       []string `gcfg:"exclude-dates"`
+	OnlyDates          string   `gcfg:"only-dates"`
+	MaxOutputBytes     int      `gcfg:"max-output-bytes"`
+	CommandTemplate    bool     `gcfg:"command-template"`
+	FailureThreshold   int      `gcfg:"failure-threshold"`
+	Priority           int      `gcfg:"priority"`
+	StripANSI          Toggle   `gcfg:"strip-ansi"`
+	StartDelay         Duration `gcfg:"start-delay"`
+	SkipIfExists       string   `gcfg:"skip-if-exists"`
+	RunIfExists        string   `gcfg:"run-if-exists"`
+	Shell              string   `gcfg:"shell"`
+	Args               []string
 
 	middlewareContainer
 	running int32
@@ -29,10 +55,238 @@ func (j *BareJob) GetSchedule() string {
 	return j.Schedule
 }
 
+// SetSchedule sets the schedule of the job, used by Scheduler.ScheduleJob on
+// the jobs built without a config file.
+func (j *BareJob) SetSchedule(schedule string) {
+	j.Schedule = schedule
+}
+
 func (j *BareJob) GetCommand() string {
 	return j.Command
 }
 
+// GetCommandArgs returns the command split in arguments, respecting the shell
+// quoting, if Args is given it's returned as is, without any parsing. With
+// command-template = true the command, or every argument of Args, is expanded
+// before, with the CommandData of the current time, and then split, so the
+// quoting applies to the expanded values. With shell the command is not split,
+// it's given to the shell as `sh -c <command>`.
+func (j *BareJob) GetCommandArgs() []string {
+	args, _ := j.commandArgs(time.Now())
+	return args
+}
+
+// ValidateCommand returns an error if the command template can't be expanded,
+// the command is returned as is at the executions when it fails.
+func (j *BareJob) ValidateCommand() error {
+	_, err := j.commandArgs(time.Now())
+	return err
+}
+
+func (j *BareJob) commandArgs(now time.Time) ([]string, error) {
+	if !j.CommandTemplate {
+		if len(j.Args) != 0 {
+			return j.Args, nil
+		}
+
+		return j.splitCommand(j.Command), nil
+	}
+
+	data := NewCommandData(j.Name, now)
+	if len(j.Args) != 0 {
+		args := make([]string, len(j.Args))
+		for i, arg := range j.Args {
+			expanded, err := ExpandCommand(arg, data)
+			if err != nil {
+				return j.Args, err
+			}
+
+			args[i] = expanded
+		}
+
+		return args, nil
+	}
+
+	cmd, err := ExpandCommand(j.Command, data)
+	if err != nil {
+		return j.splitCommand(j.Command), err
+	}
+
+	return j.splitCommand(cmd), nil
+}
+
+// defaultShell is the shell used with `shell = true`
+const defaultShell = "/bin/sh"
+
+// GetShell returns the shell running the command, empty if the command is
+// executed directly. The shell option is a boolean, true for defaultShell, or
+// the path of the shell, eg. /bin/bash.
+func (j *BareJob) GetShell() string {
+	shell := strings.TrimSpace(j.Shell)
+	if on, err := strconv.ParseBool(shell); err == nil {
+		if on {
+			return defaultShell
+		}
+
+		return ""
+	}
+
+	return shell
+}
+
+// splitCommand returns the arguments of the given command, the shell with the
+// command as its script if shell is set.
+func (j *BareJob) splitCommand(cmd string) []string {
+	if strings.TrimSpace(cmd) == "" {
+		return nil
+	}
+
+	if shell := j.GetShell(); shell != "" {
+		return []string{shell, "-c", cmd}
+	}
+
+	return splitCommand(cmd)
+}
+
+// GetMaxRuntime returns the maximum time an execution is allowed to run, if
+// max-runtime is not configured maxProcessDuration is used.
+func (j *BareJob) GetMaxRuntime() time.Duration {
+	if j.MaxRuntime <= 0 {
+		return maxProcessDuration
+	}
+
+	return time.Duration(j.MaxRuntime)
+}
+
+// GetMaxHistory returns the number of executions kept at the history, if
+// max-history is not configured defaultMaxHistory is used.
+func (j *BareJob) GetMaxHistory() int {
+	if j.MaxHistory <= 0 {
+		return defaultMaxHistory
+	}
+
+	return j.MaxHistory
+}
+
+// IsEnabled returns false if the job has been disabled with enabled = false
+func (j *BareJob) IsEnabled() bool {
+	return j.Enabled.IsOn()
+}
+
+// IsConcurrencyLimited returns false if the job bypasses the limit of
+// concurrent runs of the scheduler, with no-concurrency-limit = true
+func (j *BareJob) IsConcurrencyLimited() bool {
+	return !j.NoConcurrencyLimit
+}
+
+// ShouldRunOnStart returns true if the job is executed when the scheduler
+// starts, with run-on-start = true
+func (j *BareJob) ShouldRunOnStart() bool {
+	return j.RunOnStart
+}
+
+// GetMaxOutputBytes returns the bytes of output captured per stream, if
+// max-output-bytes is not configured defaultMaxOutputBytes is used, a negative
+// value disables the limit.
+func (j *BareJob) GetMaxOutputBytes() int {
+	if j.MaxOutputBytes == 0 {
+		return defaultMaxOutputBytes
+	}
+
+	return j.MaxOutputBytes
+}
+
+// GetFailureThreshold returns the consecutive failures after which the job is
+// not scheduled anymore, zero or less means never.
+func (j *BareJob) GetFailureThreshold() int {
+	return j.FailureThreshold
+}
+
+// GetPriority returns the priority of the job, the executions waiting for a
+// slot of max-concurrent-runs with a higher priority are admitted first, zero
+// by default.
+func (j *BareJob) GetPriority() int {
+	return j.Priority
+}
+
+// ShouldStripANSI returns true if the escape sequences are removed from the
+// captured output, unless strip-ansi = false
+func (j *BareJob) ShouldStripANSI() bool {
+	return j.StripANSI.IsOn()
+}
+
+// GetStartDelay returns the time the run-on-start and the scheduled executions
+// wait after the scheduler starts, zero to use the startup delay of the
+// scheduler.
+func (j *BareJob) GetStartDelay() time.Duration {
+	return time.Duration(j.StartDelay)
+}
+
+// CheckFlagFiles returns false, with the reason, if the execution is skipped
+// because the file of skip-if-exists exists, or the one of run-if-exists
+// doesn't, allowing an external process to pause the job, eg. during a
+// maintenance. The files are checked on every call.
+func (j *BareJob) CheckFlagFiles() (bool, string) {
+	if j.SkipIfExists != "" {
+		if _, err := os.Stat(j.SkipIfExists); err == nil {
+			return false, fmt.Sprintf("%s exists", j.SkipIfExists)
+		}
+	}
+
+	if j.RunIfExists != "" {
+		if _, err := os.Stat(j.RunIfExists); err != nil {
+			return false, fmt.Sprintf("%s doesn't exist", j.RunIfExists)
+		}
+	}
+
+	return true, ""
+}
+
+// GetCalendar returns the calendar of the job, from exclude-dates and
+// only-dates, the files are read on every call, so they can be updated without
+// restarting the daemon.
+func (j *BareJob) GetCalendar() (*Calendar, error) {
+	return ParseCalendar(j.ExcludeDates, j.OnlyDates)
+}
+
+// IsSuccessExitCode returns true if the given exit code is one of the
+// success-exit-codes, by default only 0.
+func (j *BareJob) IsSuccessExitCode(code int) bool {
+	if len(j.SuccessExitCodes) == 0 {
+		return code == 0
+	}
+
+	for _, c := range j.SuccessExitCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetDependencies returns the names of the jobs given at depends-on, a comma
+// separated list.
+func (j *BareJob) GetDependencies() []string {
+	var deps []string
+	for _, name := range strings.Split(j.DependsOn, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			deps = append(deps, name)
+		}
+	}
+
+	return deps
+}
+
+// splitCommand splits a command in arguments respecting the shell quoting
+func splitCommand(cmd string) []string {
+	if strings.TrimSpace(cmd) == "" {
+		return nil
+	}
+
+	return args.GetArgs(cmd)
+}
+
 func (j *BareJob) History() []*Execution {
 	return j.history
 }
@@ -41,6 +295,10 @@ func (j *BareJob) AddHistory(e ...*Execution) {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 	j.history = append(j.history, e...)
+
+	if max := j.GetMaxHistory(); len(j.history) > max {
+		j.history = append([]*Execution(nil), j.history[len(j.history)-max:]...)
+	}
 }
 
 func (j *BareJob) Running() int32 {
@@ -1,6 +1,13 @@
 package core
 
-import . "gopkg.in/check.v1"
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
 
 type SuiteBareJob struct{}
 
@@ -18,6 +25,118 @@ func (s *SuiteBareJob) TestGetters(c *C) {
 	c.Assert(job.GetCommand(), Equals, "qux")
 }
 
+func (s *SuiteBareJob) TestGetMaxRuntime(c *C) {
+	job := &BareJob{}
+	c.Assert(job.GetMaxRuntime(), Equals, maxProcessDuration)
+
+	job.MaxRuntime = Duration(time.Minute)
+	c.Assert(job.GetMaxRuntime(), Equals, time.Minute)
+}
+
+func (s *SuiteBareJob) TestGetCommandArgs(c *C) {
+	job := &BareJob{}
+	c.Assert(job.GetCommandArgs(), IsNil)
+
+	job.Command = "  "
+	c.Assert(job.GetCommandArgs(), IsNil)
+
+	job.Command = `sh -c "echo hello world"`
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"sh", "-c", "echo hello world"})
+
+	job.Command = `echo "foo \"bar\""`
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"echo", `foo "bar"`})
+
+	job.Command = `echo 'foo bar' qux`
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"echo", "foo bar", "qux"})
+}
+
+func (s *SuiteBareJob) TestGetCommandArgsShell(c *C) {
+	job := &BareJob{Shell: "true"}
+	job.Command = `echo $HOME && ls "foo bar"`
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"/bin/sh", "-c", `echo $HOME && ls "foo bar"`})
+
+	job.Shell = "/bin/bash"
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"/bin/bash", "-c", `echo $HOME && ls "foo bar"`})
+
+	job.Shell = "false"
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"echo", "$HOME", "&&", "ls", "foo bar"})
+
+	job.Shell = "true"
+	job.Command = " "
+	c.Assert(job.GetCommandArgs(), IsNil)
+}
+
+func (s *SuiteBareJob) TestGetCommandArgsLiteral(c *C) {
+	job := &BareJob{}
+	job.Command = "foo"
+	job.Args = []string{"sh", "-c", `echo "foo bar"`}
+
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"sh", "-c", `echo "foo bar"`})
+}
+
+func (s *SuiteBareJob) TestCommandArgsTemplate(c *C) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.Local)
+
+	job := &BareJob{Name: "my backup", CommandTemplate: true}
+	job.Command = `touch '{{.JobName}}' {{.Date}}-{{.Timestamp}}.log`
+
+	args, err := job.commandArgs(now)
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{
+		"touch", "my backup", fmt.Sprintf("2018-01-02-%d.log", now.Unix()),
+	})
+
+	job.Args = []string{"backup", "{{.Date}} {{.Time}}"}
+	args, err = job.commandArgs(now)
+	c.Assert(err, IsNil)
+	c.Assert(args, DeepEquals, []string{"backup", "2018-01-02 03:04:05"})
+}
+
+func (s *SuiteBareJob) TestCommandArgsNoTemplate(c *C) {
+	job := &BareJob{}
+	job.Command = `docker ps --format "{{.Names}}"`
+
+	c.Assert(job.ValidateCommand(), IsNil)
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"docker", "ps", "--format", "{{.Names}}"})
+}
+
+func (s *SuiteBareJob) TestValidateCommand(c *C) {
+	job := &BareJob{CommandTemplate: true}
+	job.Command = "echo {{.Date}}"
+	c.Assert(job.ValidateCommand(), IsNil)
+
+	job.Command = "echo {{.Foo}}"
+	c.Assert(job.ValidateCommand(), ErrorMatches, "invalid command template: .*")
+	c.Assert(job.GetCommandArgs(), DeepEquals, []string{"echo", "{{.Foo}}"})
+}
+
+func (s *SuiteBareJob) TestGetDependencies(c *C) {
+	job := &BareJob{}
+	c.Assert(job.GetDependencies(), HasLen, 0)
+
+	job.DependsOn = "foo, bar,"
+	c.Assert(job.GetDependencies(), DeepEquals, []string{"foo", "bar"})
+}
+
+func (s *SuiteBareJob) TestCheckFlagFiles(c *C) {
+	dir := c.MkDir()
+	lock := filepath.Join(dir, "maintenance.lock")
+
+	job := &BareJob{SkipIfExists: lock, RunIfExists: lock}
+	allowed, reason := job.CheckFlagFiles()
+	c.Assert(allowed, Equals, false)
+	c.Assert(reason, Equals, lock+" doesn't exist")
+
+	c.Assert(ioutil.WriteFile(lock, nil, 0644), IsNil)
+	allowed, reason = job.CheckFlagFiles()
+	c.Assert(allowed, Equals, false)
+	c.Assert(reason, Equals, lock+" exists")
+
+	job.SkipIfExists = ""
+	allowed, _ = job.CheckFlagFiles()
+	c.Assert(allowed, Equals, true)
+}
+
 func (s *SuiteBareJob) TestHistory(c *C) {
 	eA := NewExecution()
 	eB := NewExecution()
@@ -31,6 +150,49 @@ func (s *SuiteBareJob) TestHistory(c *C) {
 	c.Assert(h[1], DeepEquals, eB)
 }
 
+func (s *SuiteBareJob) TestHistoryMax(c *C) {
+	eA := NewExecution()
+	eB := NewExecution()
+	eC := NewExecution()
+
+	job := &BareJob{MaxHistory: 2}
+	job.AddHistory(eA, eB)
+	job.AddHistory(eC)
+
+	h := job.History()
+	c.Assert(h, HasLen, 2)
+	c.Assert(h[0], DeepEquals, eB)
+	c.Assert(h[1], DeepEquals, eC)
+}
+
+func (s *SuiteBareJob) TestGetMaxHistory(c *C) {
+	job := &BareJob{}
+	c.Assert(job.GetMaxHistory(), Equals, defaultMaxHistory)
+
+	job.MaxHistory = 5
+	c.Assert(job.GetMaxHistory(), Equals, 5)
+}
+
+func (s *SuiteBareJob) TestGetMaxOutputBytes(c *C) {
+	job := &BareJob{}
+	c.Assert(job.GetMaxOutputBytes(), Equals, defaultMaxOutputBytes)
+
+	job.MaxOutputBytes = 1024
+	c.Assert(job.GetMaxOutputBytes(), Equals, 1024)
+}
+
+func (s *SuiteBareJob) TestIsSuccessExitCode(c *C) {
+	job := &BareJob{}
+	c.Assert(job.IsSuccessExitCode(0), Equals, true)
+	c.Assert(job.IsSuccessExitCode(2), Equals, false)
+
+	job.SuccessExitCodes = []int{0, 2, 3}
+	c.Assert(job.IsSuccessExitCode(0), Equals, true)
+	c.Assert(job.IsSuccessExitCode(2), Equals, true)
+	c.Assert(job.IsSuccessExitCode(3), Equals, true)
+	c.Assert(job.IsSuccessExitCode(1), Equals, false)
+}
+
 func (s *SuiteBareJob) TestNotifyStartStop(c *C) {
 	job := &BareJob{}
 
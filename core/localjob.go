@@ -1,19 +1,33 @@
 package core
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
+	"syscall"
+	"time"
 
-	"github.com/gobs/args"
+	"github.com/mcuadros/go-defaults"
 )
 
 type LocalJob struct {
 	BareJob
-	Dir         string
+	Dir         string `gcfg:"working-directory"`
 	Environment []string
 }
 
+// NewLocalJob returns a LocalJob with the defaults of its options, as the ones read
+// from the config files.
 func NewLocalJob() *LocalJob {
-	return &LocalJob{}
+	j := &LocalJob{}
+	defaults.SetDefaults(j)
+
+	return j
+}
+
+// Describe returns what an execution of the job does, used on dry-run mode.
+func (j *LocalJob) Describe() string {
+	return fmt.Sprintf("%q locally", j.Command)
 }
 
 func (j *LocalJob) Run(ctx *Context) error {
@@ -22,11 +36,46 @@ func (j *LocalJob) Run(ctx *Context) error {
 		return err
 	}
 
-	return cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	wait := make(chan error, 1)
+	go func() {
+		wait <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-wait:
+	case <-time.After(j.GetMaxRuntime()):
+		cmd.Process.Kill()
+		<-wait
+		return ErrMaxTimeRunning
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-wait
+		return ErrCancelled
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if j.IsSuccessExitCode(status.ExitStatus()) {
+				return nil
+			}
+
+			return NonZeroExitError{ExitCode: status.ExitStatus()}
+		}
+	}
+
+	return err
 }
 
 func (j *LocalJob) buildCommand(ctx *Context) (*exec.Cmd, error) {
-	args := args.GetArgs(j.Command)
+	args := j.GetCommandArgs()
+	if len(args) == 0 {
+		return nil, ErrEmptyCommand
+	}
+
 	bin, err := exec.LookPath(args[0])
 	if err != nil {
 		return nil, err
@@ -37,7 +86,7 @@ func (j *LocalJob) buildCommand(ctx *Context) (*exec.Cmd, error) {
 		Args:   args,
 		Stdout: ctx.Execution.OutputStream,
 		Stderr: ctx.Execution.ErrorStream,
-		Env:    j.Environment,
+		Env:    append(os.Environ(), j.Environment...),
 		Dir:    j.Dir,
 	}, nil
 }
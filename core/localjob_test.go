@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -22,3 +23,81 @@ func (s *SuiteLocalJob) TestRun(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(b.String(), Equals, "foo bar\n")
 }
+
+func (s *SuiteLocalJob) TestRunDirEnvironment(c *C) {
+	job := &LocalJob{}
+	job.Command = `sh -c "pwd; echo $FOO"`
+	job.Dir = "/tmp"
+	job.Environment = []string{"FOO=bar"}
+
+	b := bytes.NewBuffer(nil)
+	e := NewExecution()
+	e.OutputStream = b
+
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(b.String(), Equals, "/tmp\nbar\n")
+}
+
+func (s *SuiteLocalJob) TestRunShell(c *C) {
+	job := &LocalJob{}
+	job.Command = `echo $FOO && echo bar | tr a-z A-Z`
+	job.Shell = "true"
+	job.Environment = []string{"FOO=foo"}
+
+	b := bytes.NewBuffer(nil)
+	e := NewExecution()
+	e.OutputStream = b
+
+	err := job.Run(&Context{Execution: e})
+	c.Assert(err, IsNil)
+	c.Assert(b.String(), Equals, "foo\nBAR\n")
+}
+
+func (s *SuiteLocalJob) TestRunEmptyCommand(c *C) {
+	job := &LocalJob{}
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, Equals, ErrEmptyCommand)
+}
+
+func (s *SuiteLocalJob) TestRunMaxRuntime(c *C) {
+	job := &LocalJob{}
+	job.Command = `sleep 10`
+	job.MaxRuntime = Duration(time.Millisecond * 100)
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+}
+
+func (s *SuiteLocalJob) TestRunNonZeroExitCode(c *C) {
+	job := &LocalJob{}
+	job.Command = `sh -c "exit 3"`
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+}
+
+func (s *SuiteLocalJob) TestRunSuccessExitCodes(c *C) {
+	job := &LocalJob{}
+	job.Command = `sh -c "exit 2"`
+	job.SuccessExitCodes = []int{0, 2}
+
+	err := job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, IsNil)
+
+	job.Command = `sh -c "exit 3"`
+	err = job.Run(&Context{Execution: NewExecution()})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+}
+
+func (s *SuiteLocalJob) TestRunCancelled(c *C) {
+	job := &LocalJob{}
+	job.Command = `sleep 10`
+
+	sc := NewScheduler(&TestLogger{})
+	sc.cancel()
+
+	err := job.Run(&Context{Scheduler: sc, Execution: NewExecution()})
+	c.Assert(err, Equals, ErrCancelled)
+}
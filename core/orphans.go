@@ -0,0 +1,75 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// LabelJobName is the label set at the containers and services created by
+// ofelia, containing the name of the job.
+const LabelJobName = "ofelia.job-name"
+
+// LabelPersistent is set at the services kept between the executions, with
+// update-existing, they are never pruned.
+const LabelPersistent = "ofelia.persistent"
+
+// PruneOrphans removes the containers and services created by ofelia older
+// than the given age. They are left behind when ofelia is stopped in the
+// middle of an execution, since they are only removed once it finishes.
+func PruneOrphans(c *docker.Client, age time.Duration, l Logger) error {
+	deadline := time.Now().Add(-age)
+	filters := map[string][]string{"label": {LabelJobName}}
+
+	containers, err := c.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: filters,
+	})
+
+	if err != nil {
+		return fmt.Errorf("error listing containers: %s", err)
+	}
+
+	for _, container := range containers {
+		if container.Labels[LabelJobName] == "" {
+			continue
+		}
+
+		if !time.Unix(container.Created, 0).Before(deadline) {
+			continue
+		}
+
+		l.Noticef("Removing orphaned container %s of job %q", container.ID, container.Labels[LabelJobName])
+		if err := c.RemoveContainer(docker.RemoveContainerOptions{
+			ID:    container.ID,
+			Force: true,
+		}); err != nil {
+			l.Warningf("Unable to remove orphaned container %s: %s", container.ID, err)
+		}
+	}
+
+	services, err := c.ListServices(docker.ListServicesOptions{Filters: filters})
+	if err != nil {
+		// the node may not be part of a swarm, so there aren't services to prune
+		l.Debugf("Unable to list services: %s", err)
+		return nil
+	}
+
+	for _, svc := range services {
+		if svc.Spec.Labels[LabelJobName] == "" || svc.Spec.Labels[LabelPersistent] != "" {
+			continue
+		}
+
+		if !svc.CreatedAt.Before(deadline) {
+			continue
+		}
+
+		l.Noticef("Removing orphaned service %s of job %q", svc.ID, svc.Spec.Labels[LabelJobName])
+		if err := c.RemoveService(docker.RemoveServiceOptions{ID: svc.ID}); err != nil {
+			l.Warningf("Unable to remove orphaned service %s: %s", svc.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/fsouza/go-dockerclient/testing"
+	. "gopkg.in/check.v1"
+)
+
+type SuiteOrphans struct {
+	server *testing.DockerServer
+	client *docker.Client
+}
+
+var _ = Suite(&SuiteOrphans{})
+
+func (s *SuiteOrphans) SetUpTest(c *C) {
+	var err error
+	s.server, err = testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, IsNil)
+
+	s.client, err = docker.NewClient(s.server.URL())
+	c.Assert(err, IsNil)
+
+	err = s.client.PullImage(docker.PullImageOptions{Repository: ImageFixture}, docker.AuthConfiguration{})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteOrphans) TestPruneOrphans(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+
+	_, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	_, err = s.client.CreateContainer(docker.CreateContainerOptions{
+		Config: &docker.Config{Image: ImageFixture, Cmd: []string{"echo", "bar"}},
+	})
+	c.Assert(err, IsNil)
+
+	err = PruneOrphans(s.client, time.Hour, &TestLogger{})
+	c.Assert(err, IsNil)
+	s.assertContainers(c, 2)
+
+	err = PruneOrphans(s.client, -time.Hour, &TestLogger{})
+	c.Assert(err, IsNil)
+	s.assertContainers(c, 1)
+}
+
+func (s *SuiteOrphans) assertContainers(c *C, count int) {
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{
+		All: true,
+	})
+
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, count)
+}
@@ -1,11 +1,17 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/fsouza/go-dockerclient"
-	"github.com/gobs/args"
+	"github.com/mcuadros/go-defaults"
 )
 
 var dockercfg *docker.AuthConfigurations
@@ -16,28 +22,92 @@ func init() {
 
 type RunJob struct {
 	BareJob
-	Client    *docker.Client `json:"-"`
-	User      string         `default:"root"`
-	TTY       bool           `default:"false"`
-	Delete    bool           `default:"true"`
-	Image     string
-	Network   string
-	Container string
-	Registry  string		 `default:""`
+	Client         *docker.Client `json:"-"`
+	User           string         `default:"root"`
+	TTY            bool           `default:"false"`
+	Delete         bool           `default:"true"`
+	Image          string
+	Entrypoint     string
+	WorkDir        string
+	Network        []string
+	Container      string
+	Registry       string   `default:""`
+	CollectStats   bool     `default:"false" gcfg:"collect-stats"`
+	ContainerName  string   `gcfg:"container-name"`
+	Replace        bool     `default:"false"`
+	Init           bool     `default:"false"`
+	StopSignal     string   `gcfg:"stop-signal"`
+	StopTimeout    Duration `gcfg:"stop-timeout"`
+	Hostname       string
+	ExtraHosts     []string `gcfg:"extra-hosts"`
+	DNS            []string `gcfg:"dns"`
+	DNSSearch      []string `gcfg:"dns-search"`
+	DNSOption      []string `gcfg:"dns-option"`
+	CapAdd         []string `gcfg:"cap-add"`
+	CapDrop        []string `gcfg:"cap-drop"`
+	Privileged     bool     `default:"false"`
+	Tmpfs          []string `gcfg:"tmpfs"`
+	ReadOnly       bool     `default:"false" gcfg:"read-only"`
+	Platform       string   `gcfg:"platform"`
+	Groups         []string `gcfg:"groups"`
+	Ulimit         []string `gcfg:"ulimit"`
+	Sysctl         []string `gcfg:"sysctl"`
+	PullRetries    int      `gcfg:"pull-retries"`
+	PullRetryDelay Duration `gcfg:"pull-retry-delay"`
+	GuardCommand   string   `gcfg:"guard-command"`
+	HealthCmd      string   `gcfg:"health-cmd"`
+	HealthInterval Duration `gcfg:"health-interval"`
+	HealthTimeout  Duration `gcfg:"health-timeout"`
+	HealthRetries  int      `gcfg:"health-retries"`
+	WaitHealthy    bool     `default:"false" gcfg:"wait-healthy"`
 }
 
+// NewRunJob returns a RunJob with the defaults of its options, as the ones read
+// from the config files.
 func NewRunJob(c *docker.Client) *RunJob {
-	return &RunJob{Client: c}
+	j := &RunJob{Client: c}
+	defaults.SetDefaults(j)
+
+	return j
+}
+
+// ValidateCommand returns an error if the command template can't be expanded,
+// or if guard-command is given with container, where it would never run.
+func (j *RunJob) ValidateCommand() error {
+	if j.GuardCommand != "" && j.Container != "" {
+		return ErrGuardContainer
+	}
+
+	return j.BareJob.ValidateCommand()
+}
+
+// Describe returns what an execution of the job does, used on dry-run mode.
+func (j *RunJob) Describe() string {
+	if j.Image != "" && j.Container == "" {
+		return fmt.Sprintf("%q with image %q", j.Command, fullImageName(j.Registry, j.Image))
+	}
+
+	return fmt.Sprintf("%q at container %q", j.Command, j.Container)
 }
 
 func (j *RunJob) Run(ctx *Context) error {
 	var container *docker.Container
 	var err error
 	if j.Image != "" && j.Container == "" {
-		if err = j.pullImage(); err != nil {
+		if j.Privileged {
+			ctx.Logger.Warningf("%s - Running a privileged container, with full access to the host", j.Name)
+		}
+
+		if err = j.pullImage(ctx); err != nil {
 			return err
 		}
 
+		if j.GuardCommand != "" {
+			if err := j.runGuard(ctx); err != nil {
+				return err
+			}
+		}
+
 		container, err = j.buildContainer()
 		if err != nil {
 			return err
@@ -49,11 +119,28 @@ func (j *RunJob) Run(ctx *Context) error {
 		}
 	}
 
+	ctx.SetTarget(container.ID)
 	if err := j.startContainer(ctx.Execution, container); err != nil {
 		return err
 	}
 
-	if err := j.watchContainer(container.ID); err != nil {
+	var stopStats func()
+	if j.CollectStats {
+		stopStats = j.collectStats(ctx.Execution, container.ID)
+	}
+
+	err = j.watchContainer(ctx, container.ID)
+	if stopStats != nil {
+		stopStats()
+	}
+
+	j.captureLogs(ctx, container.ID)
+
+	if err != nil {
+		if (err == ErrMaxTimeRunning || err == ErrCancelled) && j.Container == "" {
+			j.deleteContainer(container.ID)
+		}
+
 		return err
 	}
 
@@ -63,53 +150,364 @@ func (j *RunJob) Run(ctx *Context) error {
 	return nil
 }
 
-func (j *RunJob) pullImage() error {
+// containerLogsTimeout is the max time spent reading the logs of a stopped
+// container
+var containerLogsTimeout = 10 * time.Second
+
+// captureLogs writes the logs of the container, once it stops and before it's
+// deleted, to the output of the execution, so the middlewares can report them.
+// Only the logs since the start of the execution are read, leaving out the
+// previous runs of a `container`, and they are only available with the log
+// drivers readable by `docker logs`. The errors are logged without failing the
+// execution.
+func (j *RunJob) captureLogs(ctx *Context, containerID string) {
+	logsCtx, cancel := context.WithTimeout(context.Background(), containerLogsTimeout)
+	defer cancel()
+
+	var since int64
+	if !ctx.Execution.StartedAt.IsZero() {
+		since = ctx.Execution.StartedAt.Unix()
+	}
+
+	err := j.Client.Logs(docker.LogsOptions{
+		Context:      logsCtx,
+		Container:    containerID,
+		OutputStream: ctx.Execution.OutputStream,
+		ErrorStream:  ctx.Execution.ErrorStream,
+		Since:        since,
+		Stdout:       true,
+		Stderr:       true,
+		RawTerminal:  j.TTY,
+	})
+
+	if err != nil {
+		ctx.Logger.Warningf("%s - Cannot read the logs of container %s: %s", j.Name, containerID, err)
+	}
+}
+
+func (j *RunJob) pullImage(ctx *Context) error {
 	o, a := buildPullOptions(j.Image, j.Registry)
-	if err := j.Client.PullImage(o, a); err != nil {
+	o.Platform = j.Platform
+	err := withPullRetry(ctx, j.Image, j.PullRetries, time.Duration(j.PullRetryDelay), func() error {
+		return withDockerRetry(func() error {
+			return j.Client.PullImage(o, a)
+		})
+	})
+
+	if err != nil {
 		return fmt.Errorf("error pulling image %q: %s", j.Image, err)
 	}
 
-	return nil
+	return verifyImageDigest(j.Client, j.Image, j.Registry)
 }
 
 func (j *RunJob) buildContainer() (*docker.Container, error) {
-	c, err := j.Client.CreateContainer(docker.CreateContainerOptions{
+	return j.createContainer(j.ContainerName, j.GetCommandArgs())
+}
+
+// runGuard runs the guard-command in a new container, with the options of the
+// job, removed once it finishes, returning ErrSkippedExecution if it fails.
+func (j *RunJob) runGuard(ctx *Context) error {
+	c, err := j.createContainer("", j.splitCommand(j.GuardCommand))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := j.Client.RemoveContainer(docker.RemoveContainerOptions{ID: c.ID, Force: true}); err != nil {
+			ctx.Logger.Errorf("%s - Error removing the guard-command container %s: %s", j.Name, c.ID, err)
+		}
+	}()
+
+	if err := j.startContainer(ctx.Execution, c); err != nil {
+		return err
+	}
+
+	s, err := j.waitContainer(ctx, c.ID, false)
+	if err != nil {
+		return err
+	}
+
+	return guardResult(ctx, j.Name, s.ExitCode)
+}
+
+// createContainer creates a container with the given name, docker generates
+// one if empty, and args, with the options of the job
+func (j *RunJob) createContainer(name string, args []string) (*docker.Container, error) {
+	if err := ValidateUser(j.User); err != nil {
+		return nil, err
+	}
+
+	for _, group := range j.Groups {
+		if err := ValidateGroup(group); err != nil {
+			return nil, err
+		}
+	}
+
+	var hosts []string
+	for _, entry := range j.ExtraHosts {
+		host, ip, err := ParseExtraHost(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, host+":"+ip)
+	}
+
+	for _, server := range j.DNS {
+		if err := ValidateDNS(server); err != nil {
+			return nil, err
+		}
+	}
+
+	var tmpfs map[string]string
+	for _, spec := range j.Tmpfs {
+		path, size, err := ParseTmpfs(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if tmpfs == nil {
+			tmpfs = make(map[string]string, 0)
+		}
+
+		tmpfs[path] = ""
+		if size != 0 {
+			tmpfs[path] = fmt.Sprintf("size=%d", size)
+		}
+	}
+
+	var ulimits []docker.ULimit
+	for _, spec := range j.Ulimit {
+		ulimit, err := ParseUlimit(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		ulimits = append(ulimits, ulimit)
+	}
+
+	var sysctls map[string]string
+	for _, spec := range j.Sysctl {
+		key, value, err := ParseSysctl(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		if sysctls == nil {
+			sysctls = make(map[string]string, 0)
+		}
+
+		sysctls[key] = value
+	}
+
+	if j.Platform != "" {
+		if _, _, _, err := ParsePlatform(j.Platform); err != nil {
+			return nil, err
+		}
+	}
+
+	// the networks are resolved as the ones of the services, by name or ID,
+	// before creating the container
+	var networks []swarm.NetworkAttachmentConfig
+	for _, network := range j.Network {
+		cfg := buildNetworkAttachment(network)
+		id, err := resolveNetwork(j.Client, cfg.Target)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Target = id
+		networks = append(networks, cfg)
+	}
+
+	opts := docker.CreateContainerOptions{
+		Name:     name,
+		Platform: j.Platform,
 		Config: &docker.Config{
 			Image:        fullImageName(j.Registry, j.Image),
 			AttachStdin:  false,
 			AttachStdout: true,
 			AttachStderr: true,
 			Tty:          j.TTY,
-			Cmd:          args.GetArgs(j.Command),
+			Entrypoint:   splitCommand(j.Entrypoint),
+			Cmd:          args,
 			User:         j.User,
+			Hostname:     j.Hostname,
+			WorkingDir:   j.WorkDir,
+			Labels:       map[string]string{LabelJobName: j.Name},
+			StopSignal:   j.StopSignal,
+			Healthcheck:  j.buildHealthcheck(),
+		},
+		HostConfig: &docker.HostConfig{
+			Init:           j.Init,
+			ExtraHosts:     hosts,
+			DNS:            j.DNS,
+			DNSSearch:      j.DNSSearch,
+			DNSOptions:     j.DNSOption,
+			CapAdd:         j.CapAdd,
+			CapDrop:        j.CapDrop,
+			Privileged:     j.Privileged,
+			Tmpfs:          tmpfs,
+			GroupAdd:       j.Groups,
+			Ulimits:        ulimits,
+			Sysctls:        sysctls,
+			ReadonlyRootfs: j.ReadOnly,
 		},
 		NetworkingConfig: &docker.NetworkingConfig{},
-	})
+	}
+
+	c, err := j.Client.CreateContainer(opts)
+	if err == docker.ErrContainerAlreadyExists {
+		if !j.Replace {
+			return c, fmt.Errorf("error creating container, a container named %q already exists, use replace to remove it", name)
+		}
+
+		if err := j.Client.RemoveContainer(docker.RemoveContainerOptions{
+			ID:    name,
+			Force: true,
+		}); err != nil {
+			return c, fmt.Errorf("error removing container %q: %s", name, err)
+		}
+
+		c, err = j.Client.CreateContainer(opts)
+	}
 
 	if err != nil {
 		return c, fmt.Errorf("error creating exec: %s", err)
 	}
 
-	if j.Network != "" {
-		networkOpts := docker.NetworkFilterOpts{}
-		networkOpts["name"] = map[string]bool{}
-		networkOpts["name"][j.Network] = true
-		if networks, err := j.Client.FilteredListNetworks(networkOpts); err == nil {
-			for _, network := range networks {
-				if err := j.Client.ConnectNetwork(network.ID, docker.NetworkConnectionOptions{
-					Container: c.ID,
-				}); err != nil {
-					return c, fmt.Errorf("error connecting container to network: %s", err)
-				}
-			}
+	for _, network := range networks {
+		if err := j.Client.ConnectNetwork(network.Target, docker.NetworkConnectionOptions{
+			Container:      c.ID,
+			EndpointConfig: &docker.EndpointConfig{Aliases: network.Aliases},
+		}); err != nil {
+			return c, fmt.Errorf("error connecting container to network: %s", err)
 		}
 	}
 
 	return c, nil
 }
 
+// buildHealthcheck returns the healthcheck overriding the one of the image,
+// nil when no health-cmd is given, `none` disables the one of the image.
+func (j *RunJob) buildHealthcheck() *docker.HealthConfig {
+	if j.HealthCmd == "" {
+		return nil
+	}
+
+	if strings.EqualFold(j.HealthCmd, "none") {
+		return &docker.HealthConfig{Test: []string{"NONE"}}
+	}
+
+	return &docker.HealthConfig{
+		Test:     []string{"CMD-SHELL", j.HealthCmd},
+		Interval: time.Duration(j.HealthInterval),
+		Timeout:  time.Duration(j.HealthTimeout),
+		Retries:  j.HealthRetries,
+	}
+}
+
+var ulimitNames = map[string]bool{
+	"core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+	"memlock": true, "msgqueue": true, "nice": true, "nofile": true, "nproc": true,
+	"rss": true, "rtprio": true, "rttime": true, "sigpending": true, "stack": true,
+}
+
+// ParseUlimit parses an ulimit given as "name=soft:hard", the hard limit is
+// optional, being the same as the soft one, eg. "nofile=1024:65536"
+func ParseUlimit(spec string) (docker.ULimit, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return docker.ULimit{}, fmt.Errorf("invalid ulimit %q, expected name=soft:hard", spec)
+	}
+
+	name := strings.TrimSpace(parts[0])
+	if !ulimitNames[name] {
+		names := make([]string, 0, len(ulimitNames))
+		for n := range ulimitNames {
+			names = append(names, n)
+		}
+
+		sort.Strings(names)
+		return docker.ULimit{}, fmt.Errorf("invalid ulimit %q, unknown name %q, expected one of %s", spec, name, strings.Join(names, ", "))
+	}
+
+	limits := strings.SplitN(parts[1], ":", 2)
+	soft, err := strconv.ParseInt(strings.TrimSpace(limits[0]), 10, 64)
+	if err != nil {
+		return docker.ULimit{}, fmt.Errorf("invalid ulimit %q, the limits must be numbers", spec)
+	}
+
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = strconv.ParseInt(strings.TrimSpace(limits[1]), 10, 64); err != nil {
+			return docker.ULimit{}, fmt.Errorf("invalid ulimit %q, the limits must be numbers", spec)
+		}
+	}
+
+	if soft < 0 || hard < 0 || soft > hard {
+		return docker.ULimit{}, fmt.Errorf("invalid ulimit %q, the soft limit must be between 0 and the hard limit", spec)
+	}
+
+	return docker.ULimit{Name: name, Soft: soft, Hard: hard}, nil
+}
+
+var sysctlRegexp = regexp.MustCompile(`^[a-z0-9_]+(\.[a-zA-Z0-9_-]+)+$`)
+
+// ParseSysctl parses a namespaced kernel parameter given as "key=value", eg.
+// "net.core.somaxconn=1024"
+func ParseSysctl(spec string) (key, value string, err error) {
+	parts := strings.SplitN(spec, "=", 2)
+	key = strings.TrimSpace(parts[0])
+	if len(parts) != 2 || !sysctlRegexp.MatchString(key) || strings.TrimSpace(parts[1]) == "" {
+		return "", "", fmt.Errorf("invalid sysctl %q, expected key=value", spec)
+	}
+
+	return key, strings.TrimSpace(parts[1]), nil
+}
+
 func (j *RunJob) startContainer(e *Execution, c *docker.Container) error {
-	return j.Client.StartContainer(c.ID, &docker.HostConfig{})
+	// the host config is given at the creation of the container
+	return j.Client.StartContainer(c.ID, nil)
+}
+
+// collectStats streams the stats of the container, storing the peak usage at
+// the Execution, the returned function stops the collection.
+func (j *RunJob) collectStats(e *Execution, containerID string) func() {
+	e.Stats = &ContainerStats{}
+
+	stats := make(chan *docker.Stats)
+	done := make(chan bool)
+	finished := make(chan bool)
+
+	go func() {
+		j.Client.Stats(docker.StatsOptions{
+			ID:     containerID,
+			Stats:  stats,
+			Stream: true,
+			Done:   done,
+		})
+	}()
+
+	go func() {
+		defer close(finished)
+		for s := range stats {
+			if s.MemoryStats.Stats.Rss > e.Stats.MaxMemory {
+				e.Stats.MaxMemory = s.MemoryStats.Stats.Rss
+			}
+
+			cpu := float64(s.CPUStats.CPUUsage.TotalUsage) / float64(time.Second)
+			if cpu > e.Stats.CPUSeconds {
+				e.Stats.CPUSeconds = cpu
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
 }
 
 func (j *RunJob) getContainer(id string) (*docker.Container, error) {
@@ -125,36 +523,132 @@ const (
 	maxProcessDuration = time.Hour * 24
 )
 
-func (j *RunJob) watchContainer(containerID string) error {
-	var s docker.State
+func (j *RunJob) watchContainer(ctx *Context, containerID string) error {
+	s, err := j.waitContainer(ctx, containerID, true)
+	if err != nil {
+		return err
+	}
+
+	if j.WaitHealthy {
+		return healthyResult(s)
+	}
+
+	if s.OOMKilled {
+		return NonZeroExitError{ExitCode: s.ExitCode, OOMKilled: true}
+	}
+
+	if j.IsSuccessExitCode(s.ExitCode) {
+		return nil
+	}
+
+	switch s.ExitCode {
+	case -1:
+		return ErrUnexpected
+	default:
+		return NonZeroExitError{ExitCode: s.ExitCode}
+	}
+}
+
+// waitContainer waits until the container stops, up to the max runtime of the
+// job, returning its final state, the container is stopped when the max
+// runtime is exceeded or the job is cancelled. With health, the health status
+// of the container is tracked by trackHealth, and with wait-healthy the
+// container is stopped as soon as it's healthy or unhealthy, returning the
+// state it had.
+func (j *RunJob) waitContainer(ctx *Context, containerID string, health bool) (docker.State, error) {
 	var r time.Duration
+	var status string
+	max := j.GetMaxRuntime()
 	for {
-		time.Sleep(watchDuration)
+		select {
+		case <-ctx.Done():
+			if err := j.Client.StopContainer(containerID, j.stopTimeout()); err != nil {
+				return docker.State{}, fmt.Errorf("error stopping container after cancellation: %s", err)
+			}
+
+			return docker.State{}, ErrCancelled
+		case <-time.After(watchDuration):
+		}
+
 		r += watchDuration
 
-		if r > maxProcessDuration {
-			return ErrMaxTimeRunning
+		if r > max {
+			if err := j.Client.StopContainer(containerID, j.stopTimeout()); err != nil {
+				return docker.State{}, fmt.Errorf("error stopping container after max runtime: %s", err)
+			}
+
+			return docker.State{}, ErrMaxTimeRunning
 		}
 
-		c, err := j.Client.InspectContainer(containerID)
+		var c *docker.Container
+		err := withDockerRetry(func() (err error) {
+			c, err = j.Client.InspectContainer(containerID)
+			return
+		})
+
 		if err != nil {
-			return err
+			return docker.State{}, err
+		}
+
+		if health {
+			status = j.trackHealth(ctx, containerID, status, c.State.Health.Status)
+			if j.WaitHealthy && c.State.Running && (status == "healthy" || status == "unhealthy") {
+				if err := j.Client.StopContainer(containerID, j.stopTimeout()); err != nil {
+					return docker.State{}, fmt.Errorf("error stopping container once %s: %s", status, err)
+				}
+
+				return c.State, nil
+			}
 		}
 
 		if !c.State.Running {
-			s = c.State
-			break
+			return c.State, nil
 		}
 	}
+}
 
-	switch s.ExitCode {
-	case 0:
+// healthyResult returns the result of a job waiting for its container to be
+// healthy, a container stopping before being healthy fails the job, even if
+// its exit code is 0.
+func healthyResult(s docker.State) error {
+	switch s.Health.Status {
+	case "healthy":
 		return nil
-	case -1:
-		return ErrUnexpected
-	default:
-		return fmt.Errorf("error non-zero exit code: %d", s.ExitCode)
+	case "unhealthy":
+		return fmt.Errorf("container is unhealthy")
+	}
+
+	return fmt.Errorf("container exited with code %d before being healthy", s.ExitCode)
+}
+
+// trackHealth logs the transitions of the health status of the container,
+// counting at the execution every time it goes unhealthy, returns the current
+// status. The containers without healthcheck have no status.
+func (j *RunJob) trackHealth(ctx *Context, containerID, last, current string) string {
+	if current == last || current == "" {
+		return last
+	}
+
+	if last != "" {
+		ctx.Logger.Noticef("Container %s health changed from %s to %s", containerID, last, current)
+	}
+
+	if current == "unhealthy" {
+		ctx.Execution.UnhealthyPeriods++
+		ctx.Logger.Warningf("Container %s is unhealthy", containerID)
+	}
+
+	return current
+}
+
+// stopTimeout returns the seconds docker waits, after sending the stop signal,
+// before killing the container, rounded up.
+func (j *RunJob) stopTimeout() uint {
+	if j.StopTimeout <= 0 {
+		return 0
 	}
+
+	return uint((time.Duration(j.StopTimeout) + time.Second - 1) / time.Second)
 }
 
 func (j *RunJob) deleteContainer(containerID string) error {
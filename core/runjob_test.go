@@ -3,6 +3,7 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"net/http"
 	"sync"
 	"time"
 
@@ -39,7 +40,7 @@ func (s *SuiteRunJob) TestRun(c *C) {
 	job.User = "foo"
 	job.TTY = true
 	job.Delete = true
-	job.Network = "foo"
+	job.Network = []string{"foo"}
 
 	e := NewExecution()
 
@@ -59,7 +60,7 @@ func (s *SuiteRunJob) TestRun(c *C) {
 		wg.Done()
 	}()
 
-	err := job.Run(&Context{Execution: e})
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
 	c.Assert(err, IsNil)
 	wg.Wait()
 
@@ -70,6 +71,554 @@ func (s *SuiteRunJob) TestRun(c *C) {
 	c.Assert(containers, HasLen, 0)
 }
 
+func (s *SuiteRunJob) TestRunGuardSkipped(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+	job.GuardCommand = `test -f "/data/new file"`
+	job.Delete = true
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(containers, HasLen, 1)
+		c.Assert(containers[0].Command, Equals, "test -f /data/new file")
+
+		err = s.server.MutateContainer(containers[0].ID, docker.State{ExitCode: 1})
+		c.Assert(err, IsNil)
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrSkippedExecution)
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 0)
+}
+
+func (s *SuiteRunJob) TestRunGuard(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+	job.GuardCommand = `true`
+	job.Delete = true
+
+	go func() {
+		for _, command := range []string{"true", "echo foo"} {
+			time.Sleep(time.Millisecond * 200)
+
+			containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+			c.Assert(err, IsNil)
+			c.Assert(containers, HasLen, 1)
+			c.Assert(containers[0].Command, Equals, command)
+
+			err = s.client.StopContainer(containers[0].ID, 0)
+			c.Assert(err, IsNil)
+		}
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunJob) TestValidateCommandGuardContainer(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+	job.GuardCommand = `true`
+	c.Assert(job.ValidateCommand(), IsNil)
+
+	job.Container = "foo"
+	c.Assert(job.ValidateCommand(), Equals, ErrGuardContainer)
+}
+
+func (s *SuiteRunJob) TestBuildContainerEntrypoint(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Entrypoint = `/bin/sh -c`
+	job.Command = `"echo foo"`
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Entrypoint, DeepEquals, []string{"/bin/sh", "-c"})
+	c.Assert(container.Config.Cmd, DeepEquals, []string{"echo foo"})
+
+	job.Entrypoint = ""
+	job.Command = `echo foo`
+
+	container, err = job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Entrypoint, HasLen, 0)
+	c.Assert(container.Config.Cmd, DeepEquals, []string{"echo", "foo"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerWorkDir(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.WorkDir = "/opt/scripts"
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.WorkingDir, Equals, "/opt/scripts")
+}
+
+func (s *SuiteRunJob) TestBuildContainerName(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.ContainerName = "backup"
+
+	first, err := job.buildContainer()
+	c.Assert(err, IsNil)
+	c.Assert(first.Name, Equals, "backup")
+
+	_, err = job.buildContainer()
+	c.Assert(err, ErrorMatches, `.*a container named "backup" already exists.*`)
+
+	job.Replace = true
+	second, err := job.buildContainer()
+	c.Assert(err, IsNil)
+	c.Assert(second.ID, Not(Equals), first.ID)
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{All: true})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 1)
+}
+
+func (s *SuiteRunJob) TestRunCaptureLogs(c *C) {
+	s.server.CustomHandler("/containers/.*/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("follow"), Not(Equals), "1")
+		writeLogFrame(w, 1, "foo\n")
+		writeLogFrame(w, 2, "bar\n")
+	}))
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+
+		err = s.server.MutateContainer(containers[0].ID, docker.State{ExitCode: 1})
+		c.Assert(err, IsNil)
+	}()
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 1})
+	c.Assert(e.OutputStream.(*bytes.Buffer).String(), Equals, "foo\n")
+	c.Assert(e.ErrorStream.(*bytes.Buffer).String(), Equals, "bar\n")
+}
+
+func (s *SuiteRunJob) TestRunOOMKilled(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = true
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+
+		err = s.server.MutateContainer(containers[0].ID, docker.State{
+			ExitCode:  137,
+			OOMKilled: true,
+		})
+		c.Assert(err, IsNil)
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 137, OOMKilled: true})
+	c.Assert(err, ErrorMatches, "error non-zero exit code: 137, killed: out of memory")
+}
+
+func (s *SuiteRunJob) TestRunWaitHealthy(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = true
+	job.WaitHealthy = true
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+
+		err = s.server.MutateContainer(containers[0].ID, docker.State{
+			Running: true,
+			Health:  docker.Health{Status: "healthy"},
+		})
+		c.Assert(err, IsNil)
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunJob) TestRunWaitHealthyExited(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = true
+	job.WaitHealthy = true
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+
+		err = s.server.MutateContainer(containers[0].ID, docker.State{ExitCode: 0})
+		c.Assert(err, IsNil)
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, ErrorMatches, "container exited with code 0 before being healthy")
+}
+
+func (s *SuiteRunJob) TestBuildContainerHealthcheck(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.HealthCmd = "curl -f http://localhost/"
+	job.HealthInterval = Duration(time.Second * 5)
+	job.HealthRetries = 3
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Healthcheck, DeepEquals, &docker.HealthConfig{
+		Test:     []string{"CMD-SHELL", "curl -f http://localhost/"},
+		Interval: time.Second * 5,
+		Retries:  3,
+	})
+
+	job.HealthCmd = "none"
+	c.Assert(job.buildHealthcheck().Test, DeepEquals, []string{"NONE"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerInit(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.Init = true
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Init, Equals, true)
+}
+
+func (s *SuiteRunJob) TestBuildContainerStopSignal(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.StopSignal = "SIGINT"
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.StopSignal, Equals, "SIGINT")
+}
+
+func (s *SuiteRunJob) TestBuildContainerHosts(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.Hostname = "legacy"
+	job.ExtraHosts = []string{"db:10.0.0.2", "cache:fe80::1"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.Hostname, Equals, "legacy")
+	c.Assert(container.HostConfig.ExtraHosts, DeepEquals, []string{"db:10.0.0.2", "cache:fe80::1"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworks(c *C) {
+	bar, err := s.client.CreateNetwork(docker.CreateNetworkOptions{Name: "bar", Driver: "bridge"})
+	c.Assert(err, IsNil)
+
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = []string{"foo", bar.ID + ":db"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	for _, name := range []string{"foo", "bar"} {
+		network, err := s.client.NetworkInfo(name)
+		c.Assert(err, IsNil)
+
+		_, ok := network.Containers[container.ID]
+		c.Assert(ok, Equals, true)
+	}
+}
+
+func (s *SuiteRunJob) TestBuildContainerNetworkNotFound(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Network = []string{"missing"}
+
+	_, err := job.buildContainer()
+	c.Assert(err, ErrorMatches, `network "missing" not found`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerHostsInvalid(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.ExtraHosts = []string{"db"}
+
+	_, err := job.buildContainer()
+	c.Assert(err, ErrorMatches, `invalid extra host "db", expected host:ip`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerDNS(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.DNS = []string{"10.0.0.53"}
+	job.DNSSearch = []string{"internal.example.com"}
+	job.DNSOption = []string{"ndots:2"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.DNS, DeepEquals, []string{"10.0.0.53"})
+	c.Assert(container.HostConfig.DNSSearch, DeepEquals, []string{"internal.example.com"})
+	c.Assert(container.HostConfig.DNSOptions, DeepEquals, []string{"ndots:2"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerDNSInvalid(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.DNS = []string{"resolver"}
+
+	_, err := job.buildContainer()
+	c.Assert(err, ErrorMatches, `invalid dns "resolver", expected an IP address`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerCapabilities(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.CapAdd = []string{"NET_ADMIN"}
+	job.CapDrop = []string{"ALL"}
+	job.Privileged = true
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.CapAdd, DeepEquals, []string{"NET_ADMIN"})
+	c.Assert(container.HostConfig.CapDrop, DeepEquals, []string{"ALL"})
+	c.Assert(container.HostConfig.Privileged, Equals, true)
+}
+
+func (s *SuiteRunJob) TestBuildContainerTmpfs(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.Tmpfs = []string{"/scratch:64m", "/tmp"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Tmpfs, DeepEquals, map[string]string{
+		"/scratch": "size=67108864",
+		"/tmp":     "",
+	})
+}
+
+func (s *SuiteRunJob) TestBuildContainerReadOnly(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.ReadOnly = true
+	job.Tmpfs = []string{"/tmp"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.ReadonlyRootfs, Equals, true)
+	c.Assert(container.HostConfig.Tmpfs, DeepEquals, map[string]string{"/tmp": ""})
+}
+
+func (s *SuiteRunJob) TestBuildContainerUser(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.User = "1000:1000"
+	job.Groups = []string{"999", "docker"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.Config.User, Equals, "1000:1000")
+	c.Assert(container.HostConfig.GroupAdd, DeepEquals, []string{"999", "docker"})
+}
+
+func (s *SuiteRunJob) TestBuildContainerUserInvalid(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.User = "1000:1000:1000"
+
+	_, err := job.buildContainer()
+	c.Assert(err, ErrorMatches, `invalid user "1000:1000:1000".*`)
+
+	job.User = "1000"
+	job.Groups = []string{"a b"}
+	_, err = job.buildContainer()
+	c.Assert(err, ErrorMatches, `invalid group "a b".*`)
+}
+
+func (s *SuiteRunJob) TestBuildContainerUlimitSysctl(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.Ulimit = []string{"nofile=1024:65536", "nproc=512"}
+	job.Sysctl = []string{"net.core.somaxconn=1024"}
+
+	container, err := job.buildContainer()
+	c.Assert(err, IsNil)
+
+	container, err = s.client.InspectContainer(container.ID)
+	c.Assert(err, IsNil)
+	c.Assert(container.HostConfig.Ulimits, DeepEquals, []docker.ULimit{
+		{Name: "nofile", Soft: 1024, Hard: 65536},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	})
+	c.Assert(container.HostConfig.Sysctls, DeepEquals, map[string]string{"net.core.somaxconn": "1024"})
+}
+
+func (s *SuiteRunJob) TestParseUlimitInvalid(c *C) {
+	for _, spec := range []string{"nofile", "files=1024", "nofile=foo", "nofile=1024:bar", "nofile=2048:1024", "nofile=-1"} {
+		_, err := ParseUlimit(spec)
+		c.Assert(err, NotNil, Commentf("ulimit %q", spec))
+	}
+
+	_, err := ParseUlimit("files=1024")
+	c.Assert(err, ErrorMatches, `invalid ulimit "files=1024", unknown name "files", expected one of core, cpu, .*`)
+}
+
+func (s *SuiteRunJob) TestParseSysctlInvalid(c *C) {
+	for _, spec := range []string{"net.core.somaxconn", "somaxconn=1024", "net.core.somaxconn=", "=1"} {
+		_, _, err := ParseSysctl(spec)
+		c.Assert(err, NotNil, Commentf("sysctl %q", spec))
+	}
+}
+
+func (s *SuiteRunJob) TestStopTimeout(c *C) {
+	job := &RunJob{}
+	c.Assert(job.stopTimeout(), Equals, uint(0))
+
+	job.StopTimeout = Duration(time.Second * 30)
+	c.Assert(job.stopTimeout(), Equals, uint(30))
+
+	job.StopTimeout = Duration(time.Millisecond * 1500)
+	c.Assert(job.stopTimeout(), Equals, uint(2))
+}
+
+func (s *SuiteRunJob) TestRunMaxRuntime(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = true
+	job.MaxRuntime = Duration(time.Millisecond * 300)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: &TestLogger{}})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+
+	containers, err := s.client.ListContainers(docker.ListContainersOptions{
+		All: true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 0)
+}
+
+func (s *SuiteRunJob) TestRunCollectStats(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.CollectStats = true
+
+	e := NewExecution()
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+
+		containers, err := s.client.ListContainers(docker.ListContainersOptions{})
+		c.Assert(err, IsNil)
+
+		s.server.PrepareStats(containers[0].ID, func(string) docker.Stats {
+			var stats docker.Stats
+			stats.MemoryStats.Stats.Rss = 42
+			stats.CPUStats.CPUUsage.TotalUsage = uint64(time.Second * 2)
+			return stats
+		})
+
+		time.Sleep(time.Millisecond * 200)
+		err = s.client.StopContainer(containers[0].ID, 0)
+		c.Assert(err, IsNil)
+	}()
+
+	err := job.Run(&Context{Execution: e, Logger: &TestLogger{}})
+	c.Assert(err, IsNil)
+	c.Assert(e.Stats.MaxMemory, Equals, uint64(42))
+	c.Assert(e.Stats.CPUSeconds, Equals, 2.0)
+}
+
+func (s *SuiteRunJob) TestTrackHealth(c *C) {
+	job := &RunJob{}
+	ctx := &Context{Execution: NewExecution(), Logger: &TestLogger{}}
+
+	health := ""
+	for _, status := range []string{"", "starting", "healthy", "unhealthy", "unhealthy", "healthy", "unhealthy"} {
+		health = job.trackHealth(ctx, "foo", health, status)
+	}
+
+	c.Assert(health, Equals, "unhealthy")
+	c.Assert(ctx.Execution.UnhealthyPeriods, Equals, 2)
+}
+
 func (s *SuiteRunJob) TestBuildPullImageOptionsBareImage(c *C) {
 	o, _ := buildPullOptions("foo", "")
 	c.Assert(o.Repository, Equals, "foo")
@@ -91,6 +640,36 @@ func (s *SuiteRunJob) TestBuildPullImageOptionsRegistry(c *C) {
 	c.Assert(o.Registry, Equals, "docker-registry.company.de:5000")
 }
 
+func (s *SuiteRunJob) TestBuildPullImageOptionsDigest(c *C) {
+	o, _ := buildPullOptions("srcd/rest:qux@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "docker-registry.company.de:5000")
+	c.Assert(o.Repository, Equals, "docker-registry.company.de:5000/srcd/rest")
+	c.Assert(o.Tag, Equals, "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+}
+
+func (s *SuiteRunJob) TestBuildPullImageOptionsRegistryPort(c *C) {
+	o, _ := buildPullOptions("localhost:5000/srcd/rest", "")
+	c.Assert(o.Repository, Equals, "localhost:5000/srcd/rest")
+	c.Assert(o.Tag, Equals, "latest")
+}
+
+func (s *SuiteRunJob) TestVerifyImageDigest(c *C) {
+	c.Assert(verifyImageDigest(s.client, ImageFixture, ""), IsNil)
+
+	// the local image has no digest, it's not the pinned one
+	err := verifyImageDigest(s.client, ImageFixture+"@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "")
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunJob) TestBuildContainerPlatformInvalid(c *C) {
+	job := &RunJob{Client: s.client}
+	job.Image = ImageFixture
+	job.Command = `ls`
+	job.Platform = "linux/"
+
+	_, err := job.buildContainer()
+	c.Assert(err, ErrorMatches, `invalid platform "linux/".*`)
+}
+
 func (s *SuiteRunJob) buildImage(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
@@ -0,0 +1,92 @@
+package core
+
+import "sync"
+
+// runQueue limits the executions running at the same time, the executions
+// over the limit wait at the queue until a running one finishes. The waiting
+// executions with the highest priority are admitted first, the ones with the
+// same priority in the order they arrived.
+type runQueue struct {
+	mu      sync.Mutex
+	size    int
+	running int
+	waiting []*runQueueEntry
+}
+
+type runQueueEntry struct {
+	priority int
+	admitted chan struct{}
+}
+
+func newRunQueue(size int) *runQueue {
+	return &runQueue{size: size}
+}
+
+// tryAcquire takes a slot if one is free and no execution is waiting for it
+func (q *runQueue) tryAcquire() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running >= q.size || len(q.waiting) != 0 {
+		return false
+	}
+
+	q.running++
+	return true
+}
+
+// enqueue adds an execution with the given priority to the queue, the entry
+// admitted channel is closed once a slot is handed over to it.
+func (q *runQueue) enqueue(priority int) *runQueueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e := &runQueueEntry{priority: priority, admitted: make(chan struct{})}
+	if q.running < q.size && len(q.waiting) == 0 {
+		q.running++
+		close(e.admitted)
+		return e
+	}
+
+	q.waiting = append(q.waiting, e)
+	return e
+}
+
+// cancel removes the given entry from the queue, returns false if it was
+// already admitted, then its slot has to be released.
+func (q *runQueue) cancel(e *runQueueEntry) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, w := range q.waiting {
+		if w == e {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// release frees a slot, handing it over to the waiting execution with the
+// highest priority, if any.
+func (q *runQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.running--
+		return
+	}
+
+	next := 0
+	for i, w := range q.waiting {
+		if w.priority > q.waiting[next].priority {
+			next = i
+		}
+	}
+
+	e := q.waiting[next]
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+	close(e.admitted)
+}
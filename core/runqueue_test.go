@@ -0,0 +1,71 @@
+package core
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type SuiteRunQueue struct{}
+
+var _ = Suite(&SuiteRunQueue{})
+
+func (s *SuiteRunQueue) TestTryAcquire(c *C) {
+	q := newRunQueue(2)
+	c.Assert(q.tryAcquire(), Equals, true)
+	c.Assert(q.tryAcquire(), Equals, true)
+	c.Assert(q.tryAcquire(), Equals, false)
+
+	q.release()
+	c.Assert(q.tryAcquire(), Equals, true)
+}
+
+func (s *SuiteRunQueue) TestReleasePriority(c *C) {
+	q := newRunQueue(1)
+	c.Assert(q.tryAcquire(), Equals, true)
+
+	low := q.enqueue(0)
+	high := q.enqueue(10)
+	same := q.enqueue(0)
+	c.Assert(q.tryAcquire(), Equals, false)
+
+	q.release()
+	c.Assert(isAdmitted(high), Equals, true)
+	c.Assert(isAdmitted(low), Equals, false)
+
+	q.release()
+	c.Assert(isAdmitted(low), Equals, true)
+	c.Assert(isAdmitted(same), Equals, false)
+
+	q.release()
+	c.Assert(isAdmitted(same), Equals, true)
+
+	q.release()
+	c.Assert(q.running, Equals, 0)
+}
+
+func (s *SuiteRunQueue) TestEnqueueFree(c *C) {
+	q := newRunQueue(1)
+	c.Assert(isAdmitted(q.enqueue(0)), Equals, true)
+	c.Assert(q.running, Equals, 1)
+}
+
+func (s *SuiteRunQueue) TestCancel(c *C) {
+	q := newRunQueue(1)
+	c.Assert(q.tryAcquire(), Equals, true)
+
+	e := q.enqueue(0)
+	c.Assert(q.cancel(e), Equals, true)
+	c.Assert(q.waiting, HasLen, 0)
+
+	e = q.enqueue(0)
+	q.release()
+	c.Assert(q.cancel(e), Equals, false)
+}
+
+func isAdmitted(e *runQueueEntry) bool {
+	select {
+	case <-e.admitted:
+		return true
+	default:
+		return false
+	}
+}
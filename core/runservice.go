@@ -1,11 +1,23 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/fsouza/go-dockerclient"
+	"github.com/mcuadros/go-defaults"
+	"io"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
@@ -13,151 +25,1523 @@ import (
 
 type RunServiceJob struct {
 	BareJob
-	Client              *docker.Client `json:"-"`
-	User                string         `default:"root"`
-	TTY                 bool           `default:"false"`
-	Delete              bool           `default:"true"`
-	Image               string
-	Network             string
-	Registry            string `default:""`
-	LoggingGelfAddress  string `default:"" gcfg:"logging-gelf-address"`
-	PlacementConstraint string `default:"" gcfg:"placement-constraint"`
+	Client                *docker.Client `json:"-"`
+	User                  string         `default:"root"`
+	TTY                   bool           `default:"false"`
+	Delete                bool           `default:"true"`
+	DeleteOnFailure       Toggle         `gcfg:"delete-on-failure"`
+	DeleteOnShutdown      Toggle         `gcfg:"delete-on-shutdown"`
+	Image                 string
+	Entrypoint            string
+	WorkDir               string
+	Network               []string
+	Registry              string   `default:""`
+	RegistryUser          string   `gcfg:"registry-user"`
+	RegistryPassword      string   `gcfg:"registry-password"`
+	RegistryPasswordFile  string   `gcfg:"registry-password-file"`
+	RegistryAuthToken     string   `gcfg:"registry-auth-token"`
+	RegistryAuthTokenFile string   `gcfg:"registry-auth-token-file"`
+	LoggingGelfAddress    string   `default:"" gcfg:"logging-gelf-address"`
+	LogDriver             string   `gcfg:"log-driver"`
+	LogOpt                []string `gcfg:"log-opt"`
+	PlacementConstraint   []string `gcfg:"placement-constraint"`
+	PlacementPreference   []string `gcfg:"placement-preference"`
+	GenericResources      []string `gcfg:"generic-resources"`
+	MemoryLimit           string   `gcfg:"memory-limit"`
+	MemoryReservation     string   `gcfg:"memory-reservation"`
+	CPULimit              string   `gcfg:"cpu-limit"`
+	CPUReservation        string   `gcfg:"cpu-reservation"`
+	Init                  bool     `default:"false"`
+	StopSignal            string   `gcfg:"stop-signal"`
+	StopTimeout           Duration `gcfg:"stop-timeout"`
+	StopGracePeriod       Duration `gcfg:"stop-grace-period"`
+	Replicas              uint64
+	PollInterval          Duration `gcfg:"poll-interval"`
+	PollMaxInterval       Duration `gcfg:"poll-max-interval"`
+	ImageFromService      string   `gcfg:"image-from-service"`
+	Ports                 []string `gcfg:"ports"`
+	Hostname              string
+	ExtraHosts            []string `gcfg:"extra-hosts"`
+	DNS                   []string `gcfg:"dns"`
+	DNSSearch             []string `gcfg:"dns-search"`
+	DNSOption             []string `gcfg:"dns-option"`
+	Tmpfs                 []string `gcfg:"tmpfs"`
+	InstanceNameTemplate  string   `gcfg:"instance-name-template"`
+	Groups                []string `gcfg:"groups"`
+	ReadOnly              bool     `default:"false" gcfg:"read-only"`
+	Environment           []string `gcfg:"environment"`
+	EnvFile               string   `gcfg:"env-file"`
+	Secrets               []string `gcfg:"secrets"`
+	Configs               []string `gcfg:"configs"`
+	Platform              string   `gcfg:"platform"`
+	OnFailureCommand      string   `gcfg:"on-failure-command"`
+	LogFlushDelay         Duration `gcfg:"log-flush-delay"`
+	PullRetries           int      `gcfg:"pull-retries"`
+	PullRetryDelay        Duration `gcfg:"pull-retry-delay"`
+	WaitForRemoval        bool     `default:"false" gcfg:"wait-for-removal"`
+	WaitFor               string   `gcfg:"wait-for"`
+	RemovalTimeout        Duration `gcfg:"removal-timeout"`
+	UpdateExisting        bool     `default:"false" gcfg:"update-existing"`
+	UpdateParallelism     uint64   `gcfg:"update-parallelism"`
+	UpdateDelay           Duration `gcfg:"update-delay"`
+	UpdateFailureAction   string   `gcfg:"update-failure-action"`
+	UpdateOrder           string   `gcfg:"update-order"`
+	NoNodeRetries         int      `gcfg:"no-node-retries"`
+	NoNodeRetryDelay      Duration `gcfg:"no-node-retry-delay"`
+	Retries               int      `gcfg:"retries"`
+	RetryDelay            Duration `gcfg:"retry-delay"`
+
+	seq uint32
+}
+
+// NewRunServiceJob returns a RunServiceJob with the defaults of its options, as the ones read
+// from the config files.
+func NewRunServiceJob(c *docker.Client) *RunServiceJob {
+	j := &RunServiceJob{Client: c}
+	defaults.SetDefaults(j)
+
+	return j
+}
+
+// Describe returns what an execution of the job does, used on dry-run mode.
+func (j *RunServiceJob) Describe() string {
+	if j.ImageFromService != "" {
+		return fmt.Sprintf("%q with the image of service %q", j.Command, j.ImageFromService)
+	}
+
+	return fmt.Sprintf("%q with image %q", j.Command, fullImageName(j.Registry, j.Image))
+}
+
+var (
+	// defaultRetryDelay is the time waited before the first retry of a failed
+	// execution when no retry-delay is given
+	defaultRetryDelay = 10 * time.Second
+	// maxRetryDelay is the limit of the retry-delay doubled on every retry, a
+	// longer retry-delay is still waited as given
+	maxRetryDelay = time.Hour
+)
+
+// Run runs the service of the job, a failed run is retried up to the given
+// retries, each one with a new service, waiting retry-delay before the first
+// retry, doubled on every retry. The executions exceeding the max runtime or
+// cancelled aren't retried. Only the last attempt runs the on-failure-command
+// and follows delete-on-failure, the services of the previous ones are removed.
+func (j *RunServiceJob) Run(ctx *Context) error {
+	if j.Retries <= 0 {
+		return j.run(ctx, true)
+	}
+
+	ctx.Execution.Attempts = 1
+	err := j.run(ctx, false)
+	for retry := 1; retry <= j.Retries && isRetryable(err); retry++ {
+		delay := j.retryDelay(retry)
+		ctx.Logger.Warningf("%s failed, retrying in %s (%d/%d): %s", j.Name, delay, retry, j.Retries, err)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ErrCancelled
+		}
+
+		ctx.Execution.Attempts++
+		err = j.run(ctx, retry == j.Retries)
+	}
+
+	if isRetryable(err) {
+		ctx.Execution.Note = fmt.Sprintf("failed after %d retries", j.Retries)
+		if j.Retries == 1 {
+			ctx.Execution.Note = "failed after 1 retry"
+		}
+	}
+
+	return err
+}
+
+// isRetryable returns true if the given error of a run can be retried
+func isRetryable(err error) bool {
+	return err != nil && err != ErrMaxTimeRunning && err != ErrCancelled
+}
+
+// retryDelay returns the time waited before the given retry, doubled on every
+// retry up to maxRetryDelay
+func (j *RunServiceJob) retryDelay(retry int) time.Duration {
+	delay := time.Duration(j.RetryDelay)
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for i := 1; i < retry && delay < maxRetryDelay; i++ {
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+
+	return delay
+}
+
+// run runs a single attempt of the job, a failed attempt that isn't the last
+// one only removes its service, since it's going to be retried.
+func (j *RunServiceJob) run(ctx *Context, last bool) error {
+	if err := j.ValidateWaitFor(); err != nil {
+		return err
+	}
+
+	image, err := j.resolveImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	if j.UpdateExisting {
+		return j.runExisting(ctx, image, last)
+	}
+
+	svc, err := j.buildService(image)
+
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Noticef("Created service %s (%s) for job %s\n", svc.ID, j.InstanceName, j.Name)
+	ctx.SetTarget(svc.ID)
+
+	if err := j.watchContainer(ctx, svc.ID, 0); err != nil {
+		if err == ErrMaxTimeRunning || err == ErrCancelled {
+			j.stopService(ctx, svc.ID, err)
+			return err
+		}
+
+		if !last {
+			if err2 := j.removeService(ctx, svc.ID); err2 != nil {
+				ctx.Logger.Errorf("error removing service %s (%s): %s", svc.ID, j.InstanceName, err2)
+			}
+
+			return err
+		}
+
+		if j.OnFailureCommand != "" {
+			if err2 := j.runOnFailureCommand(ctx, image); err2 != nil {
+				ctx.Logger.Errorf("%s - on-failure-command failed: %s", j.Name, err2)
+			}
+		}
+
+		if !j.DeleteOnFailure.IsOn() {
+			ctx.Logger.Noticef("Keeping the failed service %s (%s) for inspection", svc.ID, j.InstanceName)
+			return err
+		}
+
+		if err2 := j.deleteService(ctx, svc.ID); err2 != nil {
+			ctx.Logger.Errorf("error deleting service %q: %s", fullImageName(j.Registry, j.Image), err2)
+		}
+
+		return err
+	}
+
+	return j.deleteService(ctx, svc.ID)
+}
+
+// stopService stops the task of a service exceeding its max runtime or
+// cancelled, removing the service regardless of the delete option, since this
+// is the only way to stop it. On shutdown, with `delete-on-shutdown = false`,
+// the service is left running to finish instead, as a detached task.
+func (j *RunServiceJob) stopService(ctx *Context, svcID string, err error) {
+	if err == ErrCancelled && ctx.ShuttingDown() && !j.DeleteOnShutdown.IsOn() {
+		ctx.Logger.Noticef("Leaving the service %s (%s) running on shutdown", svcID, j.InstanceName)
+		return
+	}
+
+	if err := j.removeService(ctx, svcID); err != nil {
+		ctx.Logger.Errorf("error removing service %q: %s", fullImageName(j.Registry, j.Image), err)
+	}
+}
+
+// runExisting runs the job at a service named after the job, kept between the
+// executions: it's created on the first one, and updated on the next ones with
+// the options of the job, forcing new tasks, as `docker service update --force`.
+// The service is never deleted, unless it exceeds the max runtime or it is
+// cancelled, since this is the only way to stop its tasks.
+func (j *RunServiceJob) runExisting(ctx *Context, image string, last bool) error {
+	name, err := sanitizeServiceName(j.Name)
+	if err != nil {
+		return err
+	}
+
+	j.InstanceName = name
+	svcID, forceUpdate, err := j.updateService(ctx, image, name)
+	if err != nil {
+		return err
+	}
+
+	ctx.SetTarget(svcID)
+	err = j.watchContainer(ctx, svcID, forceUpdate)
+	if err == ErrMaxTimeRunning || err == ErrCancelled {
+		j.stopService(ctx, svcID, err)
+		return err
+	}
+
+	if err != nil && last && j.OnFailureCommand != "" {
+		if err2 := j.runOnFailureCommand(ctx, image); err2 != nil {
+			ctx.Logger.Errorf("%s - on-failure-command failed: %s", j.Name, err2)
+		}
+	}
+
+	return err
+}
+
+// updateService creates the service with the given name, or updates it if it
+// exists, returning its ID and the ForceUpdate counter of its new tasks.
+func (j *RunServiceJob) updateService(ctx *Context, image, name string) (string, uint64, error) {
+	spec, err := j.buildServiceSpec(image, name, j.replicas(), j.GetCommandArgs())
+	if err != nil {
+		return "", 0, err
+	}
+
+	spec.Annotations.Labels[LabelPersistent] = "true"
+
+	var svc *swarm.Service
+	err = withDockerRetry(func() (err error) {
+		svc, err = j.Client.InspectService(name)
+		return
+	})
+
+	if _, is := err.(*docker.NoSuchService); is {
+		svc, err := j.Client.CreateService(docker.CreateServiceOptions{
+			ServiceSpec: spec,
+			Auth:        j.registryAuth(),
+		})
+		if err != nil {
+			return "", 0, err
+		}
+
+		ctx.Logger.Noticef("Created service %s (%s) for job %s\n", svc.ID, name, j.Name)
+		return svc.ID, 0, nil
+	}
+
+	if err != nil {
+		return "", 0, fmt.Errorf("Failed to inspect service %s: %s", name, err)
+	}
+
+	spec.TaskTemplate.ForceUpdate = svc.Spec.TaskTemplate.ForceUpdate + 1
+	if err := j.Client.UpdateService(svc.ID, docker.UpdateServiceOptions{
+		ServiceSpec: spec,
+		Version:     svc.Version.Index,
+		Auth:        j.registryAuth(),
+	}); err != nil {
+		return "", 0, err
+	}
+
+	ctx.Logger.Noticef("Updated service %s (%s) for job %s\n", svc.ID, name, j.Name)
+	return svc.ID, spec.TaskTemplate.ForceUpdate, nil
+}
+
+// maxServiceNameLength is the longest service name accepted by swarm
+const maxServiceNameLength = 63
+
+var serviceNameInvalidRegexp = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// InstanceNameData is the data available at the instance-name-template, eg.
+// "{{.Name}}-{{.Date}}-{{.Seq}}"
+type InstanceNameData struct {
+	// Name is the name of the job
+	Name string
+	// Date is the start of the execution as 20060102150405
+	Date string
+	// Timestamp is the start of the execution as an unix timestamp
+	Timestamp int64
+	// Seq is the number of the execution since the daemon started, from 1
+	Seq uint64
+}
+
+// ParseInstanceNameTemplate parses an instance-name-template
+func ParseInstanceNameTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("instance-name").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance-name-template %q: %s", tmpl, err)
+	}
+
+	return t, nil
+}
+
+// buildInstanceName returns the name of the service of a new execution, by
+// default `name_timestamp`, or the result of the instance-name-template. The
+// name is sanitized to the characters and length allowed by swarm.
+func (j *RunServiceJob) buildInstanceName(now time.Time) (string, error) {
+	seq := atomic.AddUint32(&j.seq, 1)
+	if j.InstanceNameTemplate == "" {
+		return sanitizeServiceName(fmt.Sprintf("%s_%d", j.Name, now.Unix()))
+	}
+
+	t, err := ParseInstanceNameTemplate(j.InstanceNameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, &InstanceNameData{
+		Name:      j.Name,
+		Date:      now.Format("20060102150405"),
+		Timestamp: now.Unix(),
+		Seq:       uint64(seq),
+	}); err != nil {
+		return "", fmt.Errorf("error executing instance-name-template %q: %s", j.InstanceNameTemplate, err)
+	}
+
+	return sanitizeServiceName(b.String())
+}
+
+// sanitizeServiceName replaces the characters not allowed at a service name
+// by dashes, a name should start with an alphanumeric character and have at
+// most 63 characters.
+func sanitizeServiceName(name string) (string, error) {
+	sanitized := serviceNameInvalidRegexp.ReplaceAllString(name, "-")
+	sanitized = strings.TrimLeft(sanitized, "_.-")
+	if len(sanitized) > maxServiceNameLength {
+		sanitized = sanitized[:maxServiceNameLength]
+	}
+
+	sanitized = strings.TrimRight(sanitized, "_.-")
+	if sanitized == "" {
+		return "", fmt.Errorf("invalid instance name %q, no valid characters", name)
+	}
+
+	return sanitized, nil
+}
+
+var placementConstraintRegexp = regexp.MustCompile(`^[\w.\-]+\s*(==|!=)\s*\S+$`)
+
+// ValidatePlacementConstraint validates the syntax of a placement constraint,
+// eg. "node.role == worker"
+func ValidatePlacementConstraint(constraint string) error {
+	if !placementConstraintRegexp.MatchString(strings.TrimSpace(constraint)) {
+		return fmt.Errorf("invalid placement constraint %q", constraint)
+	}
+
+	return nil
+}
+
+// ParsePlacementPreference parses a placement preference, the only strategy
+// supported by swarm is spread, eg. "spread=node.labels.zone"
+func ParsePlacementPreference(preference string) (swarm.PlacementPreference, error) {
+	parts := strings.SplitN(preference, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) != "spread" || strings.TrimSpace(parts[1]) == "" {
+		return swarm.PlacementPreference{}, fmt.Errorf("invalid placement preference %q", preference)
+	}
+
+	return swarm.PlacementPreference{
+		Spread: &swarm.SpreadOver{SpreadDescriptor: strings.TrimSpace(parts[1])},
+	}, nil
+}
+
+// ParseGenericResource parses a generic resource reservation, as in docker
+// service create, a count of a discrete resource, eg. "gpu=1", or a named
+// resource, eg. "gpu=UUID1".
+func ParseGenericResource(resource string) (swarm.GenericResource, error) {
+	parts := strings.SplitN(resource, "=", 2)
+	if len(parts) != 2 {
+		return swarm.GenericResource{}, fmt.Errorf("invalid generic resource %q", resource)
+	}
+
+	kind, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if kind == "" || value == "" {
+		return swarm.GenericResource{}, fmt.Errorf("invalid generic resource %q", resource)
+	}
+
+	if count, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if count <= 0 {
+			return swarm.GenericResource{}, fmt.Errorf("invalid generic resource %q, the count must be positive", resource)
+		}
+
+		return swarm.GenericResource{
+			DiscreteResourceSpec: &swarm.DiscreteGenericResource{Kind: kind, Value: count},
+		}, nil
+	}
+
+	return swarm.GenericResource{
+		NamedResourceSpec: &swarm.NamedGenericResource{Kind: kind, Value: value},
+	}, nil
+}
+
+// ParsePortConfig parses a port published on the swarm ingress, as
+// "published:target/protocol", eg. "8080:80/tcp", the protocol is tcp by
+// default.
+func ParsePortConfig(port string) (swarm.PortConfig, error) {
+	spec, protocol := strings.TrimSpace(port), swarm.PortConfigProtocolTCP
+	if i := strings.Index(spec, "/"); i != -1 {
+		protocol = swarm.PortConfigProtocol(strings.ToLower(spec[i+1:]))
+		spec = spec[:i]
+	}
+
+	switch protocol {
+	case swarm.PortConfigProtocolTCP, swarm.PortConfigProtocolUDP:
+	default:
+		return swarm.PortConfig{}, fmt.Errorf("invalid port %q, unknown protocol %q", port, protocol)
+	}
+
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return swarm.PortConfig{}, fmt.Errorf("invalid port %q, expected published:target/protocol", port)
+	}
+
+	published, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil || published == 0 {
+		return swarm.PortConfig{}, fmt.Errorf("invalid port %q, invalid published port %q", port, parts[0])
+	}
+
+	target, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil || target == 0 {
+		return swarm.PortConfig{}, fmt.Errorf("invalid port %q, invalid target port %q", port, parts[1])
+	}
+
+	return swarm.PortConfig{
+		Protocol:      protocol,
+		PublishedPort: uint32(published),
+		TargetPort:    uint32(target),
+	}, nil
+}
+
+// buildPlacement returns the placement of the service, nil if no constraints,
+// preferences or platform are given. The platform restricts the nodes to the
+// ones matching it, so the right variant of a multi-arch image is run.
+func (j *RunServiceJob) buildPlacement() (*swarm.Placement, error) {
+	if len(j.PlacementConstraint) == 0 && len(j.PlacementPreference) == 0 && j.Platform == "" {
+		return nil, nil
+	}
+
+	p := &swarm.Placement{}
+	for _, constraint := range j.PlacementConstraint {
+		if err := ValidatePlacementConstraint(constraint); err != nil {
+			return nil, err
+		}
+
+		p.Constraints = append(p.Constraints, strings.TrimSpace(constraint))
+	}
+
+	for _, preference := range j.PlacementPreference {
+		pref, err := ParsePlacementPreference(preference)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Preferences = append(p.Preferences, pref)
+	}
+
+	if j.Platform != "" {
+		osName, arch, _, err := ParsePlatform(j.Platform)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Platforms = []swarm.Platform{{OS: osName, Architecture: arch}}
+	}
+
+	return p, nil
+}
+
+// stopGracePeriod returns the time swarm waits for the container to exit after
+// the stop signal, stop-grace-period as named by swarm, or stop-timeout.
+func (j *RunServiceJob) stopGracePeriod() time.Duration {
+	if j.StopGracePeriod > 0 {
+		return time.Duration(j.StopGracePeriod)
+	}
+
+	return time.Duration(j.StopTimeout)
+}
+
+var (
+	updateFailureActions = []string{
+		swarm.UpdateFailureActionPause,
+		swarm.UpdateFailureActionContinue,
+		swarm.UpdateFailureActionRollback,
+	}
+
+	updateOrders = []string{
+		swarm.UpdateOrderStopFirst,
+		swarm.UpdateOrderStartFirst,
+	}
+
+	waitForModes = []string{WaitForExit, WaitForHealthy}
+)
+
+// The modes of wait-for, when the execution of a job-service-run is done
+const (
+	// WaitForExit waits for the tasks to exit, the default
+	WaitForExit = "exit"
+	// WaitForHealthy waits for the tasks to be healthy
+	WaitForHealthy = "healthy"
+)
+
+// ValidateWaitFor returns an error if wait-for is not a valid mode
+func (j *RunServiceJob) ValidateWaitFor() error {
+	return validateOneOf("wait-for", j.WaitFor, waitForModes)
+}
+
+// buildUpdateConfig returns how swarm updates the tasks of the service, as
+// `docker service update` does with update-existing, nil if no update option
+// is given, so the defaults of swarm are used.
+func (j *RunServiceJob) buildUpdateConfig() (*swarm.UpdateConfig, error) {
+	if j.UpdateParallelism == 0 && j.UpdateDelay == 0 && j.UpdateFailureAction == "" && j.UpdateOrder == "" {
+		return nil, nil
+	}
+
+	if j.UpdateDelay < 0 {
+		return nil, fmt.Errorf("invalid update-delay %q, it can't be negative", time.Duration(j.UpdateDelay))
+	}
+
+	if err := validateOneOf("update-failure-action", j.UpdateFailureAction, updateFailureActions); err != nil {
+		return nil, err
+	}
+
+	if err := validateOneOf("update-order", j.UpdateOrder, updateOrders); err != nil {
+		return nil, err
+	}
+
+	return &swarm.UpdateConfig{
+		Parallelism:   j.UpdateParallelism,
+		Delay:         time.Duration(j.UpdateDelay),
+		FailureAction: j.UpdateFailureAction,
+		Order:         j.UpdateOrder,
+	}, nil
+}
+
+// validateOneOf returns an error if the given value of the option is not one
+// of the valid ones, an empty value is valid.
+func validateOneOf(option, value string, valid []string) error {
+	if value == "" {
+		return nil
+	}
+
+	for _, v := range valid {
+		if value == v {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid %s %q, expected one of: %s", option, value, strings.Join(valid, ", "))
+}
+
+// buildLogDriver returns the logging driver of the service, nil if none is
+// given, logging-gelf-address is a shortcut for the gelf driver with the
+// gelf-address option.
+func (j *RunServiceJob) buildLogDriver() (*swarm.Driver, error) {
+	driver := j.LogDriver
+	if driver == "" && j.LoggingGelfAddress != "" {
+		driver = "gelf"
+	}
+
+	if driver == "" {
+		if len(j.LogOpt) != 0 {
+			return nil, fmt.Errorf("log-opt requires a log-driver")
+		}
+
+		return nil, nil
+	}
+
+	d := &swarm.Driver{Name: driver, Options: map[string]string{}}
+	if driver == "gelf" && j.LoggingGelfAddress != "" {
+		d.Options["gelf-address"] = j.LoggingGelfAddress
+	}
+
+	for _, opt := range j.LogOpt {
+		key, value, err := ParseLogOpt(opt)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Options[key] = value
+	}
+
+	if driver == "gelf" {
+		if err := ValidateGelfOptions(d.Options); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// ValidateLogDriver validates the log-driver and log-opt options, as they are
+// validated when the service is created.
+func (j *RunServiceJob) ValidateLogDriver() error {
+	_, err := j.buildLogDriver()
+	return err
+}
+
+// gelfOptions are the options supported by the gelf logging driver of docker
+var gelfOptions = map[string]bool{
+	"gelf-address": true, "gelf-compression-type": true, "gelf-compression-level": true,
+	"gelf-tcp-max-reconnect": true, "gelf-tcp-reconnect-delay": true,
+	"tag": true, "labels": true, "labels-regex": true, "env": true, "env-regex": true,
+}
+
+// ValidateGelfOptions validates the options of the gelf logging driver, the
+// docker daemon only checks them when the task is created, so a typo would
+// make the service fail on every node. The gelf-address sets the transport,
+// udp:// or tcp://, the reconnect options only apply to tcp and the compression
+// ones to udp. The gelf driver doesn't support TLS, the TLS options are
+// rejected since they would be silently ignored.
+func ValidateGelfOptions(options map[string]string) error {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(key, "tls") {
+			return fmt.Errorf("invalid log-opt %q, the gelf driver doesn't support TLS, use a tcp:// gelf-address to a TLS terminating proxy", key)
+		}
+
+		if !gelfOptions[key] {
+			return fmt.Errorf("invalid log-opt %q, unknown option of the gelf driver", key)
+		}
+	}
+
+	address := options["gelf-address"]
+	if address == "" {
+		return fmt.Errorf("the gelf driver requires a gelf-address")
+	}
+
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+		return fmt.Errorf("invalid gelf-address %q, expected udp://host:port or tcp://host:port", address)
+	}
+
+	for _, key := range keys {
+		switch {
+		case u.Scheme == "udp" && strings.HasPrefix(key, "gelf-tcp-"):
+			return fmt.Errorf("invalid log-opt %q, it requires a tcp:// gelf-address", key)
+		case u.Scheme == "tcp" && strings.HasPrefix(key, "gelf-compression-"):
+			return fmt.Errorf("invalid log-opt %q, the compression is not supported with a tcp:// gelf-address", key)
+		}
+	}
+
+	return nil
+}
+
+// ParseLogOpt parses an option of the logging driver, given as "key=value"
+func ParseLogOpt(opt string) (key, value string, err error) {
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("invalid log-opt %q, expected key=value", opt)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// resolveImage returns the image of the service, when image-from-service is
+// set the current image of the given service is used, including its digest,
+// otherwise the image is pulled.
+func (j *RunServiceJob) resolveImage(ctx *Context) (string, error) {
+	if j.ImageFromService == "" {
+		if err := j.pullImage(ctx); err != nil {
+			return "", err
+		}
+
+		return fullImageName(j.Registry, j.Image), nil
+	}
+
+	var svc *swarm.Service
+	err := withDockerRetry(func() (err error) {
+		svc, err = j.Client.InspectService(j.ImageFromService)
+		return
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error inspecting service %q: %s", j.ImageFromService, err)
+	}
+
+	spec := svc.Spec.TaskTemplate.ContainerSpec
+	if spec == nil || spec.Image == "" {
+		return "", fmt.Errorf("service %q has no image", j.ImageFromService)
+	}
+
+	return spec.Image, nil
+}
+
+// registryAuth returns the credentials of the registry of the job, the ones
+// given with registry-user and registry-password, or registry-auth-token, or
+// else the ones of the docker config. They are sent along with the service, so
+// the nodes of the swarm can pull the image without a docker login.
+func (j *RunServiceJob) registryAuth() docker.AuthConfiguration {
+	if j.RegistryUser == "" && j.RegistryPassword == "" && j.RegistryAuthToken == "" {
+		return buildAuthConfiguration(j.Registry)
+	}
+
+	return docker.AuthConfiguration{
+		Username:      j.RegistryUser,
+		Password:      j.RegistryPassword,
+		RegistryToken: j.RegistryAuthToken,
+		ServerAddress: j.Registry,
+	}
+}
+
+func (j *RunServiceJob) pullImage(ctx *Context) error {
+	o, _ := buildPullOptions(j.Image, j.Registry)
+	a := j.registryAuth()
+	o.Platform = j.Platform
+	err := withPullRetry(ctx, fullImageName(j.Registry, j.Image), j.PullRetries, time.Duration(j.PullRetryDelay), func() error {
+		return withDockerRetry(func() error {
+			return j.Client.PullImage(o, a)
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("error pulling image %q: %s", fullImageName(j.Registry, j.Image), err)
+	}
+
+	return verifyImageDigest(j.Client, j.Image, j.Registry)
+}
+
+func (j *RunServiceJob) buildService(image string) (*swarm.Service, error) {
+	name, err := j.buildInstanceName(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	j.InstanceName = name
+	return j.createService(image, name, j.replicas(), j.GetCommandArgs())
+}
+
+// onFailureSuffix is appended to the instance name of the failed execution to
+// name the service of the on-failure-command
+const onFailureSuffix = "-on-failure"
+
+// runOnFailureCommand runs the on-failure-command, once the tasks of the
+// execution failed and before its service is deleted, at a new service with a
+// single replica and the options of the job. The service is always removed,
+// the output of the command is not collected.
+func (j *RunServiceJob) runOnFailureCommand(ctx *Context, image string) error {
+	name := j.InstanceName
+	if len(name)+len(onFailureSuffix) > maxServiceNameLength {
+		name = name[:maxServiceNameLength-len(onFailureSuffix)]
+	}
+
+	name, err := sanitizeServiceName(name + onFailureSuffix)
+	if err != nil {
+		return err
+	}
+
+	svc, err := j.createService(image, name, 1, j.splitCommand(j.OnFailureCommand))
+	if err != nil {
+		return err
+	}
+
+	ctx.Logger.Noticef("Created service %s (%s) for the on-failure-command of job %s\n", svc.ID, name, j.Name)
+	defer func() {
+		if err := j.removeService(ctx, svc.ID); err != nil {
+			ctx.Logger.Errorf("error removing service %s (%s): %s", svc.ID, name, err)
+		}
+	}()
+
+	exitCode, _, err := j.waitTasks(ctx, svc.ID, 1, 0)
+	if err != nil {
+		return err
+	}
+
+	if exitCode == swarmError {
+		return ErrTaskNotFound
+	}
+
+	if exitCode != 0 {
+		return NonZeroExitError{ExitCode: exitCode}
+	}
+
+	return nil
+}
+
+// createService creates a service named as given with the options of the job,
+// running the given args with the given replicas.
+func (j *RunServiceJob) createService(image, name string, replicas uint64, args []string) (*swarm.Service, error) {
+	spec, err := j.buildServiceSpec(image, name, replicas, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.Client.CreateService(docker.CreateServiceOptions{
+		ServiceSpec: spec,
+		Auth:        j.registryAuth(),
+	})
+}
+
+// buildResources returns the limits and the reservations of memory and CPUs
+// of the tasks, nil when none is given, leaving the defaults of swarm.
+func (j *RunServiceJob) buildResources() (*swarm.ResourceRequirements, error) {
+	limits, err := parseResources(j.MemoryLimit, j.CPULimit)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := parseResources(j.MemoryReservation, j.CPUReservation)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits == nil && reservations == nil {
+		return nil, nil
+	}
+
+	if limits != nil && reservations != nil {
+		if limits.MemoryBytes > 0 && reservations.MemoryBytes > limits.MemoryBytes {
+			return nil, fmt.Errorf("memory-reservation %q exceeds the memory-limit %q", j.MemoryReservation, j.MemoryLimit)
+		}
+
+		if limits.NanoCPUs > 0 && reservations.NanoCPUs > limits.NanoCPUs {
+			return nil, fmt.Errorf("cpu-reservation %q exceeds the cpu-limit %q", j.CPUReservation, j.CPULimit)
+		}
+	}
+
+	return &swarm.ResourceRequirements{Limits: limits, Reservations: reservations}, nil
+}
+
+// ValidateResources returns an error if the limits or the reservations of
+// memory and CPUs are invalid, as done when the service is created.
+func (j *RunServiceJob) ValidateResources() error {
+	_, err := j.buildResources()
+	return err
+}
+
+// parseResources returns the resources with the given memory and CPUs, nil
+// when both are empty
+func parseResources(memory, cpus string) (*swarm.Resources, error) {
+	if memory == "" && cpus == "" {
+		return nil, nil
+	}
+
+	r := &swarm.Resources{}
+	if memory != "" {
+		size, err := ParseMemory(memory)
+		if err != nil {
+			return nil, err
+		}
+
+		r.MemoryBytes = size
+	}
+
+	if cpus != "" {
+		nano, err := ParseCPUs(cpus)
+		if err != nil {
+			return nil, err
+		}
+
+		r.NanoCPUs = nano
+	}
+
+	return r, nil
+}
+
+// buildSecrets returns the secrets mounted at the tasks, given by name as
+// `name` or `name:target`, mounted at /run/secrets/<name> by default or at
+// the given target, relative to /run/secrets unless it's absolute.
+func (j *RunServiceJob) buildSecrets() ([]*swarm.SecretReference, error) {
+	var secrets []*swarm.SecretReference
+	for _, secret := range j.Secrets {
+		name, target, err := ParseFileReference(secret)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := resolveSecret(j.Client, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if target == "" {
+			target = name
+		}
+
+		secrets = append(secrets, &swarm.SecretReference{
+			SecretID:   id,
+			SecretName: name,
+			File:       &swarm.SecretReferenceFileTarget{Name: target, UID: "0", GID: "0", Mode: 0444},
+		})
+	}
+
+	return secrets, nil
+}
+
+// buildConfigs returns the configs mounted at the tasks, given by name as
+// `name` or `name:target`, mounted at /<name> by default, as docker does, or
+// at the given target.
+func (j *RunServiceJob) buildConfigs() ([]*swarm.ConfigReference, error) {
+	var configs []*swarm.ConfigReference
+	for _, config := range j.Configs {
+		name, target, err := ParseFileReference(config)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := resolveConfig(j.Client, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if target == "" {
+			target = "/" + name
+		}
+
+		configs = append(configs, &swarm.ConfigReference{
+			ConfigID:   id,
+			ConfigName: name,
+			File:       &swarm.ConfigReferenceFileTarget{Name: target, UID: "0", GID: "0", Mode: 0444},
+		})
+	}
+
+	return configs, nil
 }
 
-func NewRunServiceJob(c *docker.Client) *RunServiceJob {
-	return &RunServiceJob{Client: c}
+// ParseFileReference parses a secret or a config mounted at the tasks of a
+// service, given as `name` or `name:target`.
+func ParseFileReference(ref string) (name, target string, err error) {
+	parts := strings.SplitN(ref, ":", 2)
+	name = strings.TrimSpace(parts[0])
+	if name == "" {
+		return "", "", fmt.Errorf("invalid reference %q, expected name or name:target", ref)
+	}
+
+	if len(parts) == 2 {
+		target = strings.TrimSpace(parts[1])
+		if target == "" {
+			return "", "", fmt.Errorf("invalid reference %q, expected name or name:target", ref)
+		}
+	}
+
+	return name, target, nil
+}
+
+// resolveSecret returns the ID of the secret with the given name, so a
+// missing secret fails before creating the service, with a clear error.
+func resolveSecret(client *docker.Client, name string) (string, error) {
+	var secrets []swarm.Secret
+	err := withDockerRetry(func() (err error) {
+		secrets, err = client.ListSecrets(docker.ListSecretsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+
+		return
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error listing the secrets: %s", err)
+	}
+
+	// the name filter also matches the secrets with the name as prefix
+	for _, s := range secrets {
+		if s.Spec.Name == name {
+			return s.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("secret %q not found", name)
+}
+
+// resolveConfig returns the ID of the config with the given name, as
+// resolveSecret does for the secrets.
+func resolveConfig(client *docker.Client, name string) (string, error) {
+	var configs []swarm.Config
+	err := withDockerRetry(func() (err error) {
+		configs, err = client.ListConfigs(docker.ListConfigsOptions{
+			Filters: map[string][]string{"name": {name}},
+		})
+
+		return
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error listing the configs: %s", err)
+	}
+
+	for _, c := range configs {
+		if c.Spec.Name == name {
+			return c.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("config %q not found", name)
+}
+
+// buildEnv returns the environment variables of the service, the ones of the
+// env-file, read on every execution, are overridden by the environment ones.
+func (j *RunServiceJob) buildEnv() ([]string, error) {
+	for _, entry := range j.Environment {
+		if err := ValidateEnv(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if j.EnvFile == "" {
+		return j.Environment, nil
+	}
+
+	env, err := ReadEnvFile(j.EnvFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading env-file: %s", err)
+	}
+
+	return MergeEnv(env, j.Environment), nil
+}
+
+// buildServiceSpec returns the spec of a service named as given with the
+// options of the job, running the given args with the given replicas.
+func (j *RunServiceJob) buildServiceSpec(image, name string, replicas uint64, args []string) (swarm.ServiceSpec, error) {
+	max := uint64(1)
+	spec := swarm.ServiceSpec{}
+
+	if err := ValidateUser(j.User); err != nil {
+		return spec, err
+	}
+
+	for _, group := range j.Groups {
+		if err := ValidateGroup(group); err != nil {
+			return spec, err
+		}
+	}
+
+	spec.Annotations.Name = name
+	spec.Annotations.Labels = map[string]string{LabelJobName: j.Name}
+
+	spec.TaskTemplate.ContainerSpec =
+		&swarm.ContainerSpec{
+			Image:    image,
+			Dir:      j.WorkDir,
+			Hostname: j.Hostname,
+			User:     j.User,
+			Groups:   j.Groups,
+			ReadOnly: j.ReadOnly,
+		}
+
+	env, err := j.buildEnv()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.ContainerSpec.Env = env
+
+	for _, tmpfs := range j.Tmpfs {
+		path, size, err := ParseTmpfs(tmpfs)
+		if err != nil {
+			return spec, err
+		}
+
+		spec.TaskTemplate.ContainerSpec.Mounts = append(
+			spec.TaskTemplate.ContainerSpec.Mounts, mount.Mount{
+				Type:         mount.TypeTmpfs,
+				Target:       path,
+				TmpfsOptions: &mount.TmpfsOptions{SizeBytes: size},
+			},
+		)
+	}
+
+	// swarm expects the entries of the hosts file as "ip host"
+	for _, entry := range j.ExtraHosts {
+		host, ip, err := ParseExtraHost(entry)
+		if err != nil {
+			return spec, err
+		}
+
+		spec.TaskTemplate.ContainerSpec.Hosts = append(
+			spec.TaskTemplate.ContainerSpec.Hosts, ip+" "+host,
+		)
+	}
+
+	if j.Init {
+		spec.TaskTemplate.ContainerSpec.Init = &j.Init
+	}
+
+	if len(j.DNS) != 0 || len(j.DNSSearch) != 0 || len(j.DNSOption) != 0 {
+		for _, server := range j.DNS {
+			if err := ValidateDNS(server); err != nil {
+				return spec, err
+			}
+		}
+
+		spec.TaskTemplate.ContainerSpec.DNSConfig = &swarm.DNSConfig{
+			Nameservers: j.DNS,
+			Search:      j.DNSSearch,
+			Options:     j.DNSOption,
+		}
+	}
+
+	// the stop signal and the grace period are used by swarm when the service
+	// is removed before the task finishes, eg. exceeding the max runtime
+	spec.TaskTemplate.ContainerSpec.StopSignal = j.StopSignal
+	if grace := j.stopGracePeriod(); grace > 0 {
+		spec.TaskTemplate.ContainerSpec.StopGracePeriod = &grace
+	}
+
+	updateConfig, err := j.buildUpdateConfig()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.UpdateConfig = updateConfig
+
+	spec.Mode = swarm.ServiceMode{
+		Replicated: &swarm.ReplicatedService{Replicas: &replicas},
+	}
+
+	// Make the service run once and not restart
+	spec.TaskTemplate.RestartPolicy =
+		&swarm.RestartPolicy{
+			MaxAttempts: &max,
+			Condition:   swarm.RestartPolicyConditionNone,
+		}
+
+	// For a service to interact with other services in a stack,
+	// we need to attach it to the same network
+	for _, network := range j.Network {
+		cfg := buildNetworkAttachment(network)
+		id, err := resolveNetwork(j.Client, cfg.Target)
+		if err != nil {
+			return spec, err
+		}
+
+		cfg.Target = id
+		spec.Networks = append(spec.Networks, cfg)
+	}
+
+	secrets, err := j.buildSecrets()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.ContainerSpec.Secrets = secrets
+
+	configs, err := j.buildConfigs()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.ContainerSpec.Configs = configs
+
+	logDriver, err := j.buildLogDriver()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.LogDriver = logDriver
+
+	placement, err := j.buildPlacement()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.Placement = placement
+
+	resources, err := j.buildResources()
+	if err != nil {
+		return spec, err
+	}
+
+	spec.TaskTemplate.Resources = resources
+
+	for _, resource := range j.GenericResources {
+		r, err := ParseGenericResource(resource)
+		if err != nil {
+			return spec, err
+		}
+
+		if spec.TaskTemplate.Resources == nil {
+			spec.TaskTemplate.Resources = &swarm.ResourceRequirements{}
+		}
+
+		if spec.TaskTemplate.Resources.Reservations == nil {
+			spec.TaskTemplate.Resources.Reservations = &swarm.Resources{}
+		}
+
+		reservations := spec.TaskTemplate.Resources.Reservations
+		reservations.GenericResources = append(reservations.GenericResources, r)
+	}
+
+	for _, port := range j.Ports {
+		p, err := ParsePortConfig(port)
+		if err != nil {
+			return spec, err
+		}
+
+		if spec.EndpointSpec == nil {
+			spec.EndpointSpec = &swarm.EndpointSpec{}
+		}
+
+		spec.EndpointSpec.Ports = append(spec.EndpointSpec.Ports, p)
+	}
+
+	// As in docker, the entrypoint of the image is the Command of the swarm
+	// container spec, and the command are the Args given to the entrypoint
+	if entrypoint := splitCommand(j.Entrypoint); len(entrypoint) != 0 {
+		spec.TaskTemplate.ContainerSpec.Command = entrypoint
+	}
+
+	if len(args) != 0 {
+		spec.TaskTemplate.ContainerSpec.Args = args
+	}
+
+	return spec, nil
 }
 
-func (j *RunServiceJob) Run(ctx *Context) error {
-	if err := j.pullImage(); err != nil {
+const (
+
+	// TODO are these const defined somewhere in the docker API?
+	swarmError   = -999
+	timeoutError = -998
+)
+
+func (j *RunServiceJob) watchContainer(ctx *Context, svcID string, forceUpdate uint64) error {
+	ctx.Logger.Noticef("Checking for service ID %s (%s) termination\n", svcID, j.InstanceName)
+
+	exitCode, reported, err := j.waitTasks(ctx, svcID, j.replicas(), forceUpdate)
+	for retry := 1; err == nil && retry <= j.NoNodeRetries && isNoSuitableNode(reported); retry++ {
+		if forceUpdate, err = j.rescheduleService(ctx, svcID, reported, retry); err == nil {
+			exitCode, reported, err = j.waitTasks(ctx, svcID, j.replicas(), forceUpdate)
+		}
+	}
+
+	if err == ErrMaxTimeRunning {
+		ctx.Logger.Warningf("Service ID %s (%s) exceeded the max runtime of %s\n", svcID, j.InstanceName, j.GetMaxRuntime())
 		return err
 	}
 
-	svc, err := j.buildService()
+	if err == ErrCancelled {
+		ctx.Logger.Warningf("Service ID %s (%s) has been cancelled\n", svcID, j.InstanceName)
+		return err
+	}
 
 	if err != nil {
 		return err
 	}
 
-	ctx.Logger.Noticef("Created service %s (%s) for job %s\n", svc.ID, j.InstanceName, j.Name)
+	ctx.Execution.ContainerID = reported.Status.ContainerStatus.ContainerID
+	ctx.Logger.Noticef(
+		"Service ID %s (%s) has completed at container %s\n",
+		svcID, j.InstanceName, ctx.Execution.ContainerID,
+	)
 
-	if err := j.watchContainer(ctx, svc.ID); err != nil {
-		if err2 := j.deleteService(ctx, svc.ID); err2 != nil {
-			ctx.Logger.Errorf("error deleting service %q: %s", fullImageName(j.Registry, j.Image), err2)
-		}
+	if exitCode == swarmError {
+		return ErrTaskNotFound
+	}
 
-		return err
+	j.captureLogs(ctx, svcID, reported.ID)
+
+	if isPlatformMismatch(reported) {
+		return j.platformMismatch(ctx, reported)
 	}
 
-	return j.deleteService(ctx, svc.ID)
-}
+	// a rejected task never ran, regardless of the exit code forced for it
+	if reported.Status.State == swarm.TaskStateRejected {
+		return TaskRejectedError{Node: j.nodeHostname(ctx, reported.NodeID), Reason: taskReason(reported)}
+	}
 
-func (j *RunServiceJob) pullImage() error {
-	o, a := buildPullOptions(j.Image, j.Registry)
-	if err := j.Client.PullImage(o, a); err != nil {
-		return fmt.Errorf("error pulling image %q: %s", fullImageName(j.Registry, j.Image), err)
+	if j.IsSuccessExitCode(exitCode) {
+		return nil
 	}
 
-	return nil
+	return NonZeroExitError{
+		ExitCode: exitCode,
+		Node:     j.nodeHostname(ctx, reported.NodeID),
+		Reason:   taskReason(reported),
+	}
 }
 
-func (j *RunServiceJob) buildService() (*swarm.Service, error) {
-
-	//createOptions := types.ServiceCreateOptions{}
+// taskReason returns the error reported by swarm for the given task, the
+// generic one of the tasks exiting with a non-zero code is left out since the
+// exit code is already reported.
+func taskReason(task swarm.Task) string {
+	reason := strings.TrimSpace(task.Status.Err)
+	if strings.HasPrefix(reason, "task: non-zero exit") {
+		return ""
+	}
 
-	max := uint64(1)
-	createSvcOpts := docker.CreateServiceOptions{}
+	return reason
+}
 
-	j.InstanceName = fmt.Sprintf("%s_%d", j.Name, time.Now().Unix())
+// platformMismatchReasons are the errors of the tasks whose image can't run
+// at the platform of its node, as reported by swarm or the docker daemon
+var platformMismatchReasons = []string{
+	"exec format error",
+	"no matching manifest",
+	"does not match the specified platform",
+	"cannot be used on this platform",
+}
 
-	createSvcOpts.ServiceSpec.Annotations.Name = j.InstanceName
+// isPlatformMismatch returns true if the given task was rejected, or failed,
+// because its image can't run at the platform of the node.
+func isPlatformMismatch(task swarm.Task) bool {
+	if task.Status.State != swarm.TaskStateRejected && task.Status.State != swarm.TaskStateFailed {
+		return false
+	}
 
-	createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec =
-		&swarm.ContainerSpec{
-			Image: fullImageName(j.Registry, j.Image),
+	reason := strings.ToLower(task.Status.Err)
+	for _, r := range platformMismatchReasons {
+		if strings.Contains(reason, r) {
+			return true
 		}
+	}
 
-	// Make the service run once and not restart
-	createSvcOpts.ServiceSpec.TaskTemplate.RestartPolicy =
-		&swarm.RestartPolicy{
-			MaxAttempts: &max,
-			Condition:   swarm.RestartPolicyConditionNone,
-		}
+	return false
+}
 
-	// For a service to interact with other services in a stack,
-	// we need to attach it to the same network
-	if j.Network != "" {
-		createSvcOpts.Networks = []swarm.NetworkAttachmentConfig{
-			swarm.NetworkAttachmentConfig{
-				Target: j.Network,
-			},
-		}
+// platformMismatch returns the PlatformMismatchError of the given task, with
+// the platform of the image, the platform option or the one of the local
+// image, and the platform of its node, "unknown" when they can't be inspected.
+func (j *RunServiceJob) platformMismatch(ctx *Context, task swarm.Task) error {
+	e := PlatformMismatchError{
+		Image:         fullImageName(j.Registry, j.Image),
+		ImagePlatform: j.Platform,
+		Node:          task.NodeID,
+		NodePlatform:  "unknown",
+		Reason:        task.Status.Err,
 	}
 
-	if j.LoggingGelfAddress != "" {
-		createSvcOpts.ServiceSpec.TaskTemplate.LogDriver =
-			&swarm.Driver{
-				Name:    "gelf",
-				Options: map[string]string{"gelf-address": j.LoggingGelfAddress},
-			}
+	if task.Spec.ContainerSpec != nil && task.Spec.ContainerSpec.Image != "" {
+		e.Image = task.Spec.ContainerSpec.Image
 	}
 
-	if j.PlacementConstraint != "" {
-		createSvcOpts.ServiceSpec.TaskTemplate.Placement =
-			&swarm.Placement{
-				Constraints: []string{j.PlacementConstraint},
-			}
+	if e.ImagePlatform == "" {
+		e.ImagePlatform = "unknown"
+		if img, err := j.Client.InspectImage(e.Image); err == nil && img.Architecture != "" {
+			e.ImagePlatform = img.OS + "/" + img.Architecture
+		}
 	}
 
-	if j.Command != "" {
-		createSvcOpts.ServiceSpec.TaskTemplate.ContainerSpec.Command = strings.Split(j.Command, " ")
+	if task.NodeID == "" {
+		e.Node = "unknown"
+		return e
 	}
 
-	svc, err := j.Client.CreateService(createSvcOpts)
+	var node *swarm.Node
+	err := withDockerRetry(func() (err error) {
+		node, err = j.Client.InspectNode(task.NodeID)
+		return
+	})
+
 	if err != nil {
-		return nil, err
+		ctx.Logger.Warningf("Failed to inspect node %s: %s", task.NodeID, err)
+		return e
+	}
+
+	if node.Description.Hostname != "" {
+		e.Node = node.Description.Hostname
+	}
+
+	if p := node.Description.Platform; p.Architecture != "" {
+		e.NodePlatform = p.OS + "/" + p.Architecture
 	}
 
-	return svc, err
+	return e
 }
 
-const (
+// defaultNoNodeRetryDelay is the delay before the first reschedule of a
+// service rejected with no suitable node, doubled on every retry
+const defaultNoNodeRetryDelay = time.Second * 5
 
-	// TODO are these const defined somewhere in the docker API?
-	swarmError   = -999
-	timeoutError = -998
-)
+// isNoSuitableNode returns true if the given task was rejected by the swarm
+// scheduler since no node satisfies its constraints or resources, a transient
+// condition during a rolling update of the nodes.
+func isNoSuitableNode(task swarm.Task) bool {
+	return task.Status.State == swarm.TaskStateRejected &&
+		strings.Contains(task.Status.Err, "no suitable node")
+}
+
+// rescheduleService forces new tasks of the given service, after the
+// no-node-retry-delay doubled on every retry, with a jitter of +-50% so the
+// services rejected together are not rescheduled at once. It returns the
+// ForceUpdate counter of the new tasks.
+func (j *RunServiceJob) rescheduleService(ctx *Context, svcID string, rejected swarm.Task, retry int) (uint64, error) {
+	delay := time.Duration(j.NoNodeRetryDelay)
+	if delay <= 0 {
+		delay = defaultNoNodeRetryDelay
+	}
+
+	delay <<= uint(retry - 1)
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay)))
+
+	ctx.Logger.Warningf(
+		"Service ID %s (%s) rejected, rescheduling in %s (%d/%d): %s",
+		svcID, j.InstanceName, delay, retry, j.NoNodeRetries, rejected.Status.Err,
+	)
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return 0, ErrCancelled
+	}
+
+	var svc *swarm.Service
+	err := withDockerRetry(func() (err error) {
+		svc, err = j.Client.InspectService(svcID)
+		return
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("Failed to inspect service %s: %s", svcID, err)
+	}
 
-var svcChecker = time.NewTicker(watchDuration)
+	spec := svc.Spec
+	spec.TaskTemplate.ForceUpdate++
+	if err := j.Client.UpdateService(svc.ID, docker.UpdateServiceOptions{
+		ServiceSpec: spec,
+		Version:     svc.Version.Index,
+		Auth:        j.registryAuth(),
+	}); err != nil {
+		return 0, fmt.Errorf("Failed to reschedule service %s: %s", svcID, err)
+	}
 
-func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
+	return spec.TaskTemplate.ForceUpdate, nil
+}
 
+// waitTasks waits until the given replicas of the service have finished, up to
+// the max runtime of the job, returning the exit code and the task reporting
+// it as tasksExitCode does. Only the tasks with the given ForceUpdate counter
+// are waited, the ones of the last update of the service.
+func (j *RunServiceJob) waitTasks(ctx *Context, svcID string, replicas, forceUpdate uint64) (int, swarm.Task, error) {
 	exitCode := swarmError
+	var reported swarm.Task
 
-	ctx.Logger.Noticef("Checking for service ID %s (%s) termination\n", svcID, j.InstanceName)
+	var svc *swarm.Service
+	err := withDockerRetry(func() (err error) {
+		svc, err = j.Client.InspectService(svcID)
+		return
+	})
 
-	svc, err := j.Client.InspectService(svcID)
 	if err != nil {
-		return fmt.Errorf("Failed to inspect service %s: %s", svcID, err.Error())
+		return exitCode, reported, fmt.Errorf("Failed to inspect service %s: %s", svcID, err.Error())
 	}
 
 	// On every tick, check if all the services have completed, or have error out
 	var wg sync.WaitGroup
 	wg.Add(1)
 
+	start := time.Now()
+	max := j.GetMaxRuntime()
+	interval := j.pollInterval()
+
+	// last state seen of the task, used when the task is gone
+	var last swarm.TaskState
+
+	// finished tasks by slot, kept between the ticks
+	finished := make(map[int]swarm.Task)
+
+	healthy := j.WaitFor == WaitForHealthy && j.hasHealthcheck(ctx, svc)
+
 	go func() {
 		defer wg.Done()
-		for _ = range svcChecker.C {
+		for {
+			select {
+			case <-ctx.Done():
+				err = ErrCancelled
+				return
+			case <-time.After(interval):
+			}
 
-			if svc.CreatedAt.After(time.Now().Add(maxProcessDuration)) {
+			interval = j.nextPollInterval(interval)
+
+			if time.Since(start) > max {
 				err = ErrMaxTimeRunning
 				return
 			}
 
-			taskExitCode, found := j.findTaskStatus(ctx, svc.ID)
+			taskExitCode, task, found := j.findTaskStatus(ctx, svc.ID, replicas, forceUpdate, healthy, finished, &last)
 
 			if found {
-				exitCode = taskExitCode
+				exitCode, reported = taskExitCode, task
 				return
 			}
 		}
@@ -165,64 +1549,260 @@ func (j *RunServiceJob) watchContainer(ctx *Context, svcID string) error {
 
 	wg.Wait()
 
-	ctx.Logger.Noticef("Service ID %s (%s) has completed\n", svcID, j.InstanceName)
+	return exitCode, reported, err
+}
 
-	switch exitCode {
-	case 0:
-		return nil
-	default:
-		return fmt.Errorf("exit code: %d", exitCode)
+// nodeHostname returns the hostname of the given node, or its ID if the node
+// can't be inspected, eg. it already left the swarm.
+func (j *RunServiceJob) nodeHostname(ctx *Context, nodeID string) string {
+	if nodeID == "" {
+		return ""
+	}
+
+	var node *swarm.Node
+	err := withDockerRetry(func() (err error) {
+		node, err = j.Client.InspectNode(nodeID)
+		return
+	})
+
+	if err != nil {
+		ctx.Logger.Warningf("Failed to inspect node %s: %s", nodeID, err)
+		return nodeID
+	}
+
+	if node.Description.Hostname == "" {
+		return nodeID
+	}
+
+	return node.Description.Hostname
+}
+
+// pollInterval returns the interval between the checks of the service status,
+// by default watchDuration
+func (j *RunServiceJob) pollInterval() time.Duration {
+	if j.PollInterval <= 0 {
+		return watchDuration
+	}
+
+	return time.Duration(j.PollInterval)
+}
+
+// nextPollInterval doubles the given interval up to the poll-max-interval, when
+// no max interval is configured the interval is constant.
+func (j *RunServiceJob) nextPollInterval(interval time.Duration) time.Duration {
+	max := time.Duration(j.PollMaxInterval)
+	if max <= interval {
+		return interval
+	}
+
+	interval *= 2
+	if interval > max {
+		return max
 	}
+
+	return interval
 }
 
-func (j *RunServiceJob) findTaskStatus(ctx *Context, svcID string) (int, bool) {
+// findTaskStatus returns the exit code of the given replicas of the service,
+// the task reporting it, with its node and container, and if all of them have
+// finished, the state of the last task seen is stored at last. The tasks of a
+// previous update of the service, with other ForceUpdate counter, are ignored.
+//
+// All the replicas are fetched with a single ListTasks call, the finished
+// ones are stored at finished by slot, since they don't change anymore, so
+// they are still reported if swarm reaps them before the others finish. With
+// healthy, the replicas are done once all of them are running, see tasksHealthy.
+func (j *RunServiceJob) findTaskStatus(ctx *Context, svcID string, replicas, forceUpdate uint64, healthy bool, finished map[int]swarm.Task, last *swarm.TaskState) (int, swarm.Task, bool) {
 	taskFilters := make(map[string][]string)
 	taskFilters["service"] = []string{svcID}
 
-	tasks, err := j.Client.ListTasks(docker.ListTasksOptions{
-		Filters: taskFilters,
+	var tasks []swarm.Task
+	err := withDockerRetry(func() (err error) {
+		tasks, err = j.Client.ListTasks(docker.ListTasksOptions{
+			Filters: taskFilters,
+		})
+
+		return
 	})
 
 	if err != nil {
 		ctx.Logger.Errorf("Failed to find task ID %s. Considering the task terminated: %s\n", svcID, err.Error())
-		return 0, false
+		return 0, swarm.Task{}, false
+	}
+
+	// the tasks of the update may not have been created yet, tasksExitCode
+	// waits for them
+	current := make([]swarm.Task, 0, len(tasks)+len(finished))
+	for _, task := range finished {
+		current = append(current, task)
+	}
+
+	for _, task := range tasks {
+		if task.Spec.ForceUpdate != forceUpdate {
+			continue
+		}
+
+		if _, cached := finished[task.Slot]; cached {
+			continue
+		}
+
+		if taskStopped(task.Status.State) {
+			finished[task.Slot] = task
+		}
+
+		current = append(current, task)
+	}
+
+	if len(tasks) == 0 && uint64(len(current)) < replicas {
+		// That task is gone now, maybe someone else removed it or swarm reaped
+		// it, is only successful if we saw it completed
+		if *last == swarm.TaskStateComplete {
+			return 0, swarm.Task{}, true
+		}
+
+		return swarmError, swarm.Task{}, true
+	}
+
+	if healthy {
+		return tasksHealthy(current, replicas, last, j.IsSuccessExitCode)
 	}
 
-	if len(tasks) == 0 {
-		// That task is gone now (maybe someone else removed it. Our work here is done
-		return 0, true
+	return tasksExitCode(current, replicas, last, j.IsSuccessExitCode)
+}
+
+// taskStopped returns if the given task state is final, the task finished
+func taskStopped(state swarm.TaskState) bool {
+	switch state {
+	case swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected:
+		return true
+	}
+
+	return false
+}
+
+// tasksExitCode returns the exit code of the first failed replica, by slot,
+// or the exit code of the first replica if all of them are successful, with
+// the task of that replica, and true if all the replicas have finished.
+func tasksExitCode(tasks []swarm.Task, replicas uint64, last *swarm.TaskState, success func(int) bool) (int, swarm.Task, bool) {
+	if uint64(len(tasks)) < replicas {
+		// not all the tasks have been created yet
+		return 1, swarm.Task{}, false
+	}
+
+	sort.Slice(tasks, func(a, b int) bool {
+		return tasks[a].Slot < tasks[b].Slot
+	})
+
+	exitCode, reported, failed := 0, swarm.Task{}, false
+	for i, task := range tasks {
+		*last = task.Status.State
+
+		if !taskStopped(task.Status.State) {
+			return 1, swarm.Task{}, false
+		}
+
+		code := task.Status.ContainerStatus.ExitCode
+		if code == 0 && task.Status.State == swarm.TaskStateRejected {
+			code = 255 // force non-zero exit for task rejected
+		}
+
+		if i == 0 {
+			exitCode, reported = code, task
+		}
+
+		if !failed && !success(code) {
+			exitCode, reported, failed = code, task, true
+		}
 	}
 
-	exitCode := 1
-	var done bool
-	stopStates := []swarm.TaskState{
-		swarm.TaskStateComplete,
-		swarm.TaskStateFailed,
-		swarm.TaskStateRejected,
+	return exitCode, reported, true
+}
+
+// tasksHealthy returns the task of the first replica, with exit code 0, once
+// all the replicas are running, since swarm keeps the tasks of an image with a
+// healthcheck starting until they are healthy, and fails the ones going
+// unhealthy. A replica stopping before is reported by its exit code, as
+// tasksExitCode does.
+func tasksHealthy(tasks []swarm.Task, replicas uint64, last *swarm.TaskState, success func(int) bool) (int, swarm.Task, bool) {
+	if uint64(len(tasks)) < replicas {
+		// not all the tasks have been created yet
+		return 1, swarm.Task{}, false
 	}
 
+	sort.Slice(tasks, func(a, b int) bool {
+		return tasks[a].Slot < tasks[b].Slot
+	})
+
+	running := true
 	for _, task := range tasks {
+		*last = task.Status.State
 
-		stop := false
-		for _, stopState := range stopStates {
-			if task.Status.State == stopState {
-				stop = true
-				break
-			}
+		if taskStopped(task.Status.State) {
+			return tasksExitCode([]swarm.Task{task}, 1, last, success)
+		}
+
+		if task.Status.State != swarm.TaskStateRunning {
+			running = false
 		}
+	}
+
+	if !running {
+		return 1, swarm.Task{}, false
+	}
 
-		if stop {
+	return 0, tasks[0], true
+}
 
-			exitCode = task.Status.ContainerStatus.ExitCode
+// hasHealthcheck returns if the tasks of the service have a healthcheck, the
+// one of the service or else the one of its image, to wait for them to be
+// healthy. Without it, the tasks are running as soon as they start, so the
+// execution falls back to wait for them to exit, noted at the execution, as
+// it does when the image can't be inspected, eg. it's only pulled by the nodes.
+func (j *RunServiceJob) hasHealthcheck(ctx *Context, svc *swarm.Service) bool {
+	spec := svc.Spec.TaskTemplate.ContainerSpec
+	if spec != nil && spec.Healthcheck != nil && len(spec.Healthcheck.Test) > 0 {
+		if spec.Healthcheck.Test[0] != "NONE" {
+			return true
+		}
 
-			if exitCode == 0 && task.Status.State == swarm.TaskStateRejected {
-				exitCode = 255 // force non-zero exit for task rejected
-			}
-			done = true
-			break
+		return j.waitForExit(ctx, svc, "the service has the healthcheck disabled")
+	}
+
+	if spec == nil || spec.Image == "" {
+		return j.waitForExit(ctx, svc, "the service has no image")
+	}
+
+	img, err := j.Client.InspectImage(spec.Image)
+	if err != nil {
+		ctx.Logger.Errorf("Failed to inspect image %s: %s", spec.Image, err)
+		return j.waitForExit(ctx, svc, "the image can't be inspected")
+	}
+
+	if img.Config != nil && img.Config.Healthcheck != nil {
+		test := img.Config.Healthcheck.Test
+		if len(test) > 0 && test[0] != "NONE" {
+			return true
 		}
 	}
-	return exitCode, done
+
+	return j.waitForExit(ctx, svc, "the image has no HEALTHCHECK")
+}
+
+// waitForExit reports that the tasks of the service can't be waited to be
+// healthy, for the given reason, so their exit is waited for, returns false.
+func (j *RunServiceJob) waitForExit(ctx *Context, svc *swarm.Service, reason string) bool {
+	ctx.Logger.Errorf("Can't wait for service %s (%s) to be healthy, %s, waiting for the exit of its tasks", svc.ID, j.InstanceName, reason)
+	ctx.Execution.Note = "wait-for = healthy ignored, " + reason
+	return false
+}
+
+// replicas returns the number of replicas of the service, by default one
+func (j *RunServiceJob) replicas() uint64 {
+	if j.Replicas == 0 {
+		return 1
+	}
+
+	return j.Replicas
 }
 
 func (j *RunServiceJob) deleteService(ctx *Context, svcID string) error {
@@ -230,6 +1810,191 @@ func (j *RunServiceJob) deleteService(ctx *Context, svcID string) error {
 		return nil
 	}
 
+	if delay := j.logFlushDelay(); delay > 0 {
+		ctx.Logger.Debugf("Waiting %s for the logs of service %s (%s) to be flushed", delay, svcID, j.InstanceName)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	if err := j.removeService(ctx, svcID); err != nil || !j.WaitForRemoval {
+		return err
+	}
+
+	return j.waitRemoval(ctx, svcID)
+}
+
+// defaultRemovalTimeout is the time waited for a removed service to disappear
+// when no removal-timeout is given
+var defaultRemovalTimeout = 30 * time.Second
+
+// waitRemoval polls the service, every poll-interval, until the manager no
+// longer reports it, so the service is actually gone when Run returns, eg. for
+// a job with the same instance name or a tool listing the services. An error
+// is returned if it still exists after the removal-timeout.
+func (j *RunServiceJob) waitRemoval(ctx *Context, svcID string) error {
+	timeout := time.Duration(j.RemovalTimeout)
+	if timeout <= 0 {
+		timeout = defaultRemovalTimeout
+	}
+
+	expired := time.After(timeout)
+	for {
+		_, err := j.Client.InspectService(svcID)
+		if _, is := err.(*docker.NoSuchService); is {
+			return nil
+		}
+
+		select {
+		case <-time.After(j.pollInterval()):
+		case <-expired:
+			return fmt.Errorf("service %s still exists %s after its removal", svcID, timeout)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// defaultLogFlushDelay is the time waited before deleting the service when a
+// remote log driver is used and no log-flush-delay is given
+var defaultLogFlushDelay = 2 * time.Second
+
+// localLogDrivers are the log drivers storing the logs at the node, their logs
+// are written before the task finishes
+var localLogDrivers = map[string]bool{
+	"json-file": true,
+	"local":     true,
+	"journald":  true,
+	"none":      true,
+}
+
+// logFlushDelay returns the time waited before deleting the service, so a
+// remote log driver, eg. gelf, sends the last lines before the containers of
+// the service are removed. No delay is needed for the local log drivers.
+func (j *RunServiceJob) logFlushDelay() time.Duration {
+	driver := j.LogDriver
+	if driver == "" && j.LoggingGelfAddress != "" {
+		driver = "gelf"
+	}
+
+	if driver == "" || localLogDrivers[driver] {
+		return 0
+	}
+
+	if j.LogFlushDelay > 0 {
+		return time.Duration(j.LogFlushDelay)
+	}
+
+	return defaultLogFlushDelay
+}
+
+// serviceLogsTimeout is the max time spent reading the logs of a finished
+// service, the stream may not close if the daemon can't reach a node
+var serviceLogsTimeout = 10 * time.Second
+
+// captureLogs writes the logs of the reported task of the service to the
+// output of the execution, so the middlewares can report them, leaving out the
+// other replicas and the rescheduled tasks. The logs are only available with
+// the local log drivers, and only the logs since the start of the execution
+// are read. The errors are logged without failing the execution.
+func (j *RunServiceJob) captureLogs(ctx *Context, svcID, taskID string) {
+	driver := j.LogDriver
+	if driver == "" && j.LoggingGelfAddress != "" {
+		driver = "gelf"
+	}
+
+	if driver == "none" || (driver != "" && !localLogDrivers[driver]) {
+		return
+	}
+
+	logsCtx, cancel := context.WithTimeout(context.Background(), serviceLogsTimeout)
+	defer cancel()
+
+	var since int64
+	if !ctx.Execution.StartedAt.IsZero() {
+		since = ctx.Execution.StartedAt.Unix()
+	}
+
+	stdout := &taskLogWriter{w: ctx.Execution.OutputStream, taskID: taskID}
+	stderr := &taskLogWriter{w: ctx.Execution.ErrorStream, taskID: taskID}
+	err := j.Client.GetServiceLogs(docker.LogsServiceOptions{
+		Context:      logsCtx,
+		Service:      svcID,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Since:        since,
+		Stdout:       true,
+		Stderr:       true,
+		Details:      true,
+		RawTerminal:  j.TTY,
+	})
+
+	stdout.Flush()
+	stderr.Flush()
+	if err != nil {
+		ctx.Logger.Warningf("Cannot read the logs of service %s (%s): %s\n", svcID, j.InstanceName, err)
+	}
+}
+
+// taskLogAttr is the attribute with the ID of the task at the details of the
+// lines of the logs of a service, as `com.docker.swarm.task.id=ID,...`
+const taskLogAttr = "com.docker.swarm.task.id="
+
+// taskLogWriter writes the lines of the logs of a service read with their
+// details belonging to the given task, without the details. The lines without
+// the task attribute are written as they are.
+type taskLogWriter struct {
+	w      io.Writer
+	taskID string
+	buf    []byte
+}
+
+func (w *taskLogWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		if err := w.writeLine(w.buf[:i+1]); err != nil {
+			return 0, err
+		}
+
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the last line, if it doesn't end with a newline
+func (w *taskLogWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.writeLine(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *taskLogWriter) writeLine(line []byte) error {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 || !bytes.Contains(line[:i], []byte(taskLogAttr)) {
+		_, err := w.w.Write(line)
+		return err
+	}
+
+	for _, attr := range strings.Split(string(line[:i]), ",") {
+		if attr == taskLogAttr+w.taskID {
+			_, err := w.w.Write(line[i+1:])
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (j *RunServiceJob) removeService(ctx *Context, svcID string) error {
 	err := j.Client.RemoveService(docker.RemoveServiceOptions{
 		ID: svcID,
 	})
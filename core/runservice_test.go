@@ -3,11 +3,17 @@ package core
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/swarm"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/fsouza/go-dockerclient/testing"
@@ -46,50 +52,1688 @@ func (s *SuiteRunServiceJob) SetUpTest(c *C) {
 	s.buildImage(c)
 }
 
+func (s *SuiteRunServiceJob) TestNewRunServiceJob(c *C) {
+	job := NewRunServiceJob(s.client)
+	c.Assert(job.Client, Equals, s.client)
+	c.Assert(job.User, Equals, "root")
+	c.Assert(job.Delete, Equals, true)
+}
+
 func (s *SuiteRunServiceJob) TestRun(c *C) {
 	job := &RunServiceJob{Client: s.client}
 	job.Image = ServiceImageFixture
-	job.Command = `echo -a foo bar`
-	job.User = "foo"
-	job.TTY = true
+	job.Command = `echo -a foo bar`
+	job.User = "foo"
+	job.TTY = true
+	job.Delete = true
+	job.Network = []string{"foo"}
+
+	e := NewExecution()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		time.Sleep(time.Millisecond * 600)
+
+		tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+
+		c.Assert(err, IsNil)
+		fmt.Printf("found tasks %v\n", tasks[0].Spec.ContainerSpec.Args)
+
+		c.Assert(strings.Join(tasks[0].Spec.ContainerSpec.Args, ","), Equals, "echo,-a,foo,bar")
+
+		c.Assert(tasks[0].Status.State, Equals, swarm.TaskStateReady)
+
+		err = s.client.RemoveService(docker.RemoveServiceOptions{
+			ID: tasks[0].ServiceID,
+		})
+
+		c.Assert(err, IsNil)
+
+		wg.Done()
+
+	}()
+
+	// the service is removed before the task finishes, so its exit code is unknown
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, Equals, ErrTaskNotFound)
+	wg.Wait()
+
+	containers, err := s.client.ListTasks(docker.ListTasksOptions{})
+
+	c.Assert(err, IsNil)
+	c.Assert(containers, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskComplete(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+
+	go s.finishTask(c, swarm.TaskStateComplete, 0)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskFailed(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+
+	go s.finishTask(c, swarm.TaskStateFailed, 3)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+}
+
+func (s *SuiteRunServiceJob) TestRunRetries(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "retries"
+	job.InstanceNameTemplate = "{{.Name}}-{{.Seq}}"
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.Retries = 2
+	job.RetryDelay = Duration(time.Millisecond * 10)
+
+	go func() {
+		s.finishTask(c, swarm.TaskStateFailed, 3)
+		s.finishTask(c, swarm.TaskStateComplete, 0)
+	}()
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, IsNil)
+	c.Assert(e.Attempts, Equals, 2)
+	c.Assert(e.Note, Equals, "")
+}
+
+func (s *SuiteRunServiceJob) TestRunRetriesExhausted(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "retries"
+	job.InstanceNameTemplate = "{{.Name}}-{{.Seq}}"
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+	job.Retries = 1
+	job.RetryDelay = Duration(time.Millisecond * 10)
+
+	go func() {
+		s.finishTask(c, swarm.TaskStateFailed, 3)
+		s.finishTask(c, swarm.TaskStateFailed, 4)
+	}()
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 4})
+	c.Assert(e.Attempts, Equals, 2)
+	c.Assert(e.Note, Equals, "failed after 1 retry")
+}
+
+func (s *SuiteRunServiceJob) TestRunRetriesOnFailureCommand(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "retries"
+	job.InstanceNameTemplate = "{{.Name}}-{{.Seq}}"
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.OnFailureCommand = `rm -rf /tmp/foo`
+	job.DeleteOnFailure = "false"
+	job.Delete = true
+	job.Retries = 1
+	job.RetryDelay = Duration(time.Millisecond * 10)
+
+	go func() {
+		s.finishTask(c, swarm.TaskStateFailed, 3)
+		// the service of the first attempt is gone, without on-failure-command
+		s.finishTask(c, swarm.TaskStateFailed, 4)
+		time.Sleep(time.Millisecond * 300)
+
+		services, err := s.client.ListServices(docker.ListServicesOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(services, HasLen, 2)
+
+		for _, svc := range services {
+			if strings.HasSuffix(svc.Spec.Name, onFailureSuffix) {
+				s.finishTaskWith(c, 0, func(task *swarm.Task) {
+					if task.ServiceID == svc.ID {
+						task.Status.State = swarm.TaskStateComplete
+					}
+				})
+			}
+		}
+	}()
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 4})
+	c.Assert(e.Attempts, Equals, 2)
+
+	// only the service of the last attempt is kept
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].Spec.Name, Equals, "retries-2")
+}
+
+func (s *SuiteRunServiceJob) TestRetryDelay(c *C) {
+	job := &RunServiceJob{}
+	c.Assert(job.retryDelay(1), Equals, defaultRetryDelay)
+
+	job.RetryDelay = Duration(time.Second)
+	c.Assert(job.retryDelay(1), Equals, time.Second)
+	c.Assert(job.retryDelay(3), Equals, time.Second*4)
+	c.Assert(job.retryDelay(13), Equals, maxRetryDelay)
+	c.Assert(job.retryDelay(1000), Equals, maxRetryDelay)
+
+	job.RetryDelay = Duration(time.Hour * 2)
+	c.Assert(job.retryDelay(3), Equals, time.Hour*2)
+	c.Assert(isRetryable(ErrMaxTimeRunning), Equals, false)
+	c.Assert(isRetryable(ErrCancelled), Equals, false)
+}
+
+func (s *SuiteRunServiceJob) TestRunConcurrent(c *C) {
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+
+		tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+		c.Assert(err, IsNil)
+		c.Assert(tasks, HasLen, 2)
+
+		for _, task := range tasks {
+			task.Status.State = swarm.TaskStateComplete
+			if task.Spec.ContainerSpec.Args[0] == "false" {
+				task.Status.State = swarm.TaskStateFailed
+				task.Status.ContainerStatus.ExitCode = 3
+			}
+
+			c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+		}
+	}()
+
+	// every job polls its own tasks, the executions fired at the same time
+	// don't share the polling nor their exit codes
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, command := range []string{"true", "false"} {
+		wg.Add(1)
+		go func(i int, command string) {
+			defer wg.Done()
+
+			job := &RunServiceJob{Client: s.client}
+			job.Name = command
+			job.Image = ServiceImageFixture
+			job.Command = command
+			job.Delete = true
+
+			errs[i] = job.Run(&Context{Execution: NewExecution(), Logger: logger})
+		}(i, command)
+	}
+
+	wg.Wait()
+	c.Assert(errs[0], IsNil)
+	c.Assert(errs[1], Equals, NonZeroExitError{ExitCode: 3})
+}
+
+func (s *SuiteRunServiceJob) TestRunCaptureLogs(c *C) {
+	reported := make(chan string, 1)
+	s.server.CustomHandler("/services/.*/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Query().Get("follow"), Not(Equals), "1")
+		c.Assert(r.URL.Query().Get("details"), Equals, "1")
+
+		// the lines of the other tasks of the service are left out
+		attrs := "com.docker.swarm.node.id=node1,com.docker.swarm.task.id="
+		id := <-reported
+		writeLogFrame(w, 1, attrs+id+" foo\n")
+		writeLogFrame(w, 1, attrs+"other qux\n")
+		writeLogFrame(w, 2, attrs+id+" bar\n")
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateFailed
+		task.Status.ContainerStatus.ExitCode = 1
+		reported <- task.ID
+	})
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 1})
+	c.Assert(e.OutputStream.(*bytes.Buffer).String(), Equals, "foo\n")
+	c.Assert(e.ErrorStream.(*bytes.Buffer).String(), Equals, "bar\n")
+}
+
+func (s *SuiteRunServiceJob) TestTaskLogWriter(c *C) {
+	var b bytes.Buffer
+	w := &taskLogWriter{w: &b, taskID: "foo"}
+
+	w.Write([]byte("com.docker.swarm.task.id=foo one\ncom.docker.swarm.task.id=bar two\nno"))
+	w.Write([]byte(" details\ncom.docker.swarm.node.id=n,com.docker.swarm.task.id=foo last"))
+	c.Assert(b.String(), Equals, "one\nno details\n")
+
+	c.Assert(w.Flush(), IsNil)
+	c.Assert(b.String(), Equals, "one\nno details\nlast")
+}
+
+func (s *SuiteRunServiceJob) TestRunCaptureLogsRemoteDriver(c *C) {
+	s.server.CustomHandler("/services/.*/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Error("the logs of a remote log driver aren't readable")
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.LogDriver = "syslog"
+	job.LogFlushDelay = Duration(time.Millisecond)
+
+	go s.finishTask(c, swarm.TaskStateComplete, 0)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskFailedKeep(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+	job.DeleteOnFailure = "false"
+
+	go s.finishTask(c, swarm.TaskStateFailed, 3)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+}
+
+func (s *SuiteRunServiceJob) TestRunUpdateExisting(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.UpdateExisting = true
+
+	go s.finishTask(c, swarm.TaskStateComplete, 0)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+
+	// the second execution updates the service, waiting for its new task
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+
+		tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+		c.Assert(err, IsNil)
+
+		for _, task := range tasks {
+			if task.Spec.ForceUpdate == 1 {
+				task.Status.State = swarm.TaskStateFailed
+				task.Status.ContainerStatus.ExitCode = 3
+				c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+			}
+		}
+	}()
+
+	err = job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3})
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+	c.Assert(services[0].Spec.Name, Equals, "foo")
+	c.Assert(services[0].Spec.Labels[LabelPersistent], Equals, "true")
+}
+
+func (s *SuiteRunServiceJob) TestRunNoSuitableNodeRetry(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.NoNodeRetries = 2
+	job.NoNodeRetryDelay = Duration(time.Millisecond * 10)
+
+	go func() {
+		s.finishTaskWith(c, 0, func(task *swarm.Task) {
+			task.Status.State = swarm.TaskStateRejected
+			task.Status.Err = "no suitable node (scheduling constraints not satisfied on 3 nodes)"
+		})
+
+		s.finishTaskWith(c, 1, func(task *swarm.Task) {
+			task.Status.State = swarm.TaskStateComplete
+		})
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunServiceJob) TestRunNoSuitableNodeDisabled(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateRejected
+		task.Status.Err = "no suitable node"
+	})
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, TaskRejectedError{Reason: "no suitable node"})
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskRejected(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.SuccessExitCodes = []int{255}
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateRejected
+		task.Status.Err = "No such image: test-image:latest"
+	})
+
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, Equals, TaskRejectedError{Reason: "No such image: test-image:latest"})
+	c.Assert(err, ErrorMatches, "the task of the service has been rejected: No such image: test-image:latest")
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskFailedReason(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateFailed
+		task.Status.ContainerStatus.ExitCode = 137
+		task.Status.Err = "starting container failed: OCI runtime create failed"
+	})
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 137, Reason: "starting container failed: OCI runtime create failed"})
+}
+
+func (s *SuiteRunServiceJob) TestTaskReason(c *C) {
+	task := swarm.Task{}
+	task.Status.Err = "task: non-zero exit (3)"
+	c.Assert(taskReason(task), Equals, "")
+
+	task.Status.Err = " no suitable node "
+	c.Assert(taskReason(task), Equals, "no suitable node")
+}
+
+func (s *SuiteRunServiceJob) TestRunPlatformMismatch(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `echo foo`
+	job.Delete = true
+	job.Platform = "linux/amd64"
+
+	nodes, err := s.client.ListNodes(docker.ListNodesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(nodes, Not(HasLen), 0)
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.NodeID = nodes[0].ID
+		task.Status.State = swarm.TaskStateRejected
+		task.Status.Err = "failed to start: exec /bin/echo: exec format error"
+	})
+
+	err = job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, FitsTypeOf, PlatformMismatchError{})
+	c.Assert(err, ErrorMatches, "image .* platform linux/amd64 incompatible with node .*: failed to start: exec /bin/echo: exec format error")
+}
+
+func (s *SuiteRunServiceJob) TestIsPlatformMismatch(c *C) {
+	task := swarm.Task{}
+	task.Status.State = swarm.TaskStateRejected
+	task.Status.Err = "no matching manifest for linux/arm64/v8 in the manifest list entries"
+	c.Assert(isPlatformMismatch(task), Equals, true)
+
+	task.Status.Err = "no suitable node"
+	c.Assert(isPlatformMismatch(task), Equals, false)
+
+	task.Status.State = swarm.TaskStateComplete
+	task.Status.Err = "exec format error"
+	c.Assert(isPlatformMismatch(task), Equals, false)
+}
+
+func (s *SuiteRunServiceJob) TestIsNoSuitableNode(c *C) {
+	task := swarm.Task{}
+	task.Status.State = swarm.TaskStateRejected
+	task.Status.Err = "no suitable node (1 node not available for new tasks)"
+	c.Assert(isNoSuitableNode(task), Equals, true)
+
+	task.Status.Err = "invalid mount config"
+	c.Assert(isNoSuitableNode(task), Equals, false)
+
+	task.Status.State = swarm.TaskStateFailed
+	task.Status.Err = "no suitable node"
+	c.Assert(isNoSuitableNode(task), Equals, false)
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskSuccessExitCode(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+	job.SuccessExitCodes = []int{0, 2}
+
+	go s.finishTask(c, swarm.TaskStateFailed, 2)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteRunServiceJob) TestFindTaskStatusReaped(c *C) {
+	job := &RunServiceJob{Client: s.client}
+
+	// no tasks are found, a task seen running and reaped by swarm is a failure
+	last := swarm.TaskStateRunning
+	exitCode, _, found := job.findTaskStatus(&Context{Logger: logger}, "foo", 1, 0, false, map[int]swarm.Task{}, &last)
+	c.Assert(found, Equals, true)
+	c.Assert(exitCode, Equals, swarmError)
+
+	last = swarm.TaskStateComplete
+	exitCode, _, found = job.findTaskStatus(&Context{Logger: logger}, "foo", 1, 0, false, map[int]swarm.Task{}, &last)
+	c.Assert(found, Equals, true)
+	c.Assert(exitCode, Equals, 0)
+}
+
+func (s *SuiteRunServiceJob) TestFindTaskStatusCached(c *C) {
+	job := &RunServiceJob{Client: s.client}
+
+	// the finished replicas seen on a previous tick are reported even if swarm
+	// reaped them
+	failed := swarm.Task{Slot: 2}
+	failed.Status.State = swarm.TaskStateFailed
+	failed.Status.ContainerStatus.ExitCode = 3
+
+	finished := map[int]swarm.Task{
+		1: {Slot: 1, Status: swarm.TaskStatus{State: swarm.TaskStateComplete}},
+		2: failed,
+	}
+
+	last := swarm.TaskStateRunning
+	exitCode, task, found := job.findTaskStatus(&Context{Logger: logger}, "foo", 2, 0, false, finished, &last)
+	c.Assert(found, Equals, true)
+	c.Assert(exitCode, Equals, 3)
+	c.Assert(task.Slot, Equals, 2)
+}
+
+func (s *SuiteRunServiceJob) TestRunMaxRuntime(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = false
+	job.MaxRuntime = Duration(time.Millisecond * 300)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, ErrMaxTimeRunning)
+
+	tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(tasks, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunShutdown(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sleep 3600`
+
+	sh := &Scheduler{done: make(chan struct{})}
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		close(sh.done)
+	}()
+
+	err := job.Run(&Context{Scheduler: sh, Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, ErrCancelled)
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunShutdownKeepService(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sleep 3600`
+	job.DeleteOnShutdown = "false"
+
+	sh := &Scheduler{done: make(chan struct{})}
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		close(sh.done)
+	}()
+
+	err := job.Run(&Context{Scheduler: sh, Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, ErrCancelled)
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 1)
+}
+
+func (s *SuiteRunServiceJob) TestRunCancelledKeepService(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sleep 3600`
+	job.DeleteOnShutdown = "false"
+
+	ctx := &Context{
+		Scheduler: &Scheduler{done: make(chan struct{})},
+		Execution: NewExecution(),
+		Logger:    logger,
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		ctx.Cancel()
+	}()
+
+	c.Assert(job.Run(ctx), Equals, ErrCancelled)
+
+	// cancelled by the API, not on shutdown, the service is removed anyway
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunWaitHealthy(c *C) {
+	s.server.CustomHandler("/images/.*/json", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Id": "foo", "Config": {"Healthcheck": {"Test": ["CMD-SHELL", "true"]}}}`))
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sleep 3600`
+	job.Delete = true
+	job.WaitFor = WaitForHealthy
+
+	go s.finishTaskWith(c, 0, func(task *swarm.Task) {
+		task.Status.State = swarm.TaskStateRunning
+	})
+
+	ctx := &Context{Execution: NewExecution(), Logger: logger}
+	c.Assert(job.Run(ctx), IsNil)
+	c.Assert(ctx.Execution.Note, Equals, "")
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunWaitHealthyNoHealthcheck(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+	job.WaitFor = WaitForHealthy
+
+	go s.finishTask(c, swarm.TaskStateFailed, 1)
+
+	ctx := &Context{Execution: NewExecution(), Logger: logger}
+	c.Assert(job.Run(ctx), Equals, NonZeroExitError{ExitCode: 1})
+	c.Assert(ctx.Execution.Note, Equals, "wait-for = healthy ignored, the image has no HEALTHCHECK")
+}
+
+func (s *SuiteRunServiceJob) TestRunWaitForInvalid(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.WaitFor = "ready"
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, ErrorMatches, `invalid wait-for "ready", expected one of: exit, healthy`)
+}
+
+func (s *SuiteRunServiceJob) TestHasHealthcheck(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	ctx := &Context{Execution: NewExecution(), Logger: logger}
+
+	// the healthcheck of the service is used before the one of the image
+	svc := &swarm.Service{}
+	svc.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{
+		Image:       "missing",
+		Healthcheck: &container.HealthConfig{Test: []string{"CMD-SHELL", "true"}},
+	}
+
+	c.Assert(job.hasHealthcheck(ctx, svc), Equals, true)
+	c.Assert(ctx.Execution.Note, Equals, "")
+
+	// an image that can't be inspected falls back to wait for the exit
+	svc.Spec.TaskTemplate.ContainerSpec.Healthcheck = nil
+	c.Assert(job.hasHealthcheck(ctx, svc), Equals, false)
+	c.Assert(ctx.Execution.Note, Equals, "wait-for = healthy ignored, the image can't be inspected")
+}
+
+func (s *SuiteRunServiceJob) TestResolveImageFromService(c *C) {
+	image := ServiceImageFixture + ":1.0@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+
+	opts := docker.CreateServiceOptions{}
+	opts.ServiceSpec.Annotations.Name = "app"
+	opts.ServiceSpec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: image}
+
+	svc, err := s.client.CreateService(opts)
+	c.Assert(err, IsNil)
+
+	job := &RunServiceJob{Client: s.client}
+	job.ImageFromService = svc.ID
+
+	resolved, err := job.resolveImage(&Context{Logger: logger})
+	c.Assert(err, IsNil)
+	c.Assert(resolved, Equals, image)
+
+	job.ImageFromService = "foo"
+	_, err = job.resolveImage(&Context{Logger: logger})
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceQuotedCommand(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `sh -c "echo hello world"`
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Args, DeepEquals, []string{"sh", "-c", "echo hello world"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceEntrypoint(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ServiceImageFixture
+	job.Entrypoint = `/bin/sh -c`
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Command, DeepEquals, []string{"/bin/sh", "-c"})
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Args, IsNil)
+
+	job.Name = "bar"
+	job.Command = `"echo foo"`
+	svc, err = job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Command, DeepEquals, []string{"/bin/sh", "-c"})
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Args, DeepEquals, []string{"echo foo"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceWorkDir(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.WorkDir = "/opt/scripts"
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Dir, Equals, "/opt/scripts")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceNetworks(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	foo, err := s.client.CreateNetwork(docker.CreateNetworkOptions{Name: "foo", Driver: "overlay"})
+	c.Assert(err, IsNil)
+
+	bar, err := s.client.CreateNetwork(docker.CreateNetworkOptions{Name: "bar", Driver: "overlay"})
+	c.Assert(err, IsNil)
+
+	job.Network = []string{"foo", bar.ID + ":db, database"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.Networks, DeepEquals, []swarm.NetworkAttachmentConfig{
+		{Target: foo.ID},
+		{Target: bar.ID, Aliases: []string{"db", "database"}},
+	})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceNetworkNotFound(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Network = []string{"missing"}
+
+	_, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `network "missing" not found`)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServicePlacement(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "placement"
+	job.Command = `ls`
+	job.PlacementConstraint = []string{"node.role == worker", "node.labels.storage==true"}
+	job.PlacementPreference = []string{"spread=node.labels.zone"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+
+	p := svc.Spec.TaskTemplate.Placement
+	c.Assert(p.Constraints, DeepEquals, []string{"node.role == worker", "node.labels.storage==true"})
+	c.Assert(p.Preferences, HasLen, 1)
+	c.Assert(p.Preferences[0].Spread.SpreadDescriptor, Equals, "node.labels.zone")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServicePlatform(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "platform"
+	job.Command = `ls`
+	job.Platform = "linux/arm64"
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.Placement.Platforms, DeepEquals, []swarm.Platform{
+		{OS: "linux", Architecture: "arm64"},
+	})
+
+	job.Platform = "arm64"
+	_, err = job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `invalid platform "arm64".*`)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServicePlacementInvalid(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Command = `ls`
+	job.PlacementConstraint = []string{"node.role"}
+
+	_, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `invalid placement constraint "node.role"`)
+
+	job.PlacementConstraint = nil
+	job.PlacementPreference = []string{"spread="}
+
+	_, err = job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `invalid placement preference "spread="`)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceInit(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "init"
+	job.Command = `ls`
+	job.Init = true
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(*svc.Spec.TaskTemplate.ContainerSpec.Init, Equals, true)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceStop(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "stop"
+	job.Command = `ls`
+	job.StopSignal = "SIGINT"
+	job.StopTimeout = Duration(time.Second * 30)
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.StopSignal, Equals, "SIGINT")
+	c.Assert(*svc.Spec.TaskTemplate.ContainerSpec.StopGracePeriod, Equals, time.Second*30)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceStopGracePeriod(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "stop"
+	job.Command = `ls`
+	job.StopTimeout = Duration(time.Second * 30)
+	job.StopGracePeriod = Duration(time.Minute)
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(*svc.Spec.TaskTemplate.ContainerSpec.StopGracePeriod, Equals, time.Minute)
+	c.Assert(svc.Spec.UpdateConfig, IsNil)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceUpdateConfig(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "update"
+	job.Command = `ls`
+	job.UpdateParallelism = 2
+	job.UpdateDelay = Duration(time.Second * 10)
+	job.UpdateFailureAction = "rollback"
+	job.UpdateOrder = "start-first"
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.UpdateConfig, DeepEquals, &swarm.UpdateConfig{
+		Parallelism:   2,
+		Delay:         time.Second * 10,
+		FailureAction: "rollback",
+		Order:         "start-first",
+	})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceUpdateConfigInvalid(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Command = `ls`
+	job.UpdateOrder = "foo"
+
+	_, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `invalid update-order "foo", expected one of: stop-first, start-first`)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceHosts(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "hosts"
+	job.Command = `ls`
+	job.Hostname = "legacy"
+	job.ExtraHosts = []string{"db:10.0.0.2"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Hostname, Equals, "legacy")
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Hosts, DeepEquals, []string{"10.0.0.2 db"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceEnvironment(c *C) {
+	f, err := ioutil.TempFile("", "env")
+	c.Assert(err, IsNil)
+	defer os.Remove(f.Name())
+
+	f.WriteString("FOO=file\nBAR=file\n")
+	f.Close()
+
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "env"
+	job.Command = `env`
+	job.EnvFile = f.Name()
+	job.Environment = []string{"BAR=job", "BAZ=job"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Env, DeepEquals, []string{"FOO=file", "BAR=job", "BAZ=job"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceEnvironmentInvalid(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Command = `env`
+	job.Environment = []string{"FOO"}
+
+	_, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, `invalid environment variable "FOO", expected KEY=VALUE`)
+
+	job.Environment = nil
+	job.EnvFile = "/nonexistent/env"
+	_, err = job.buildService(ServiceImageFixture)
+	c.Assert(err, ErrorMatches, "error reading env-file: .*")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceSecrets(c *C) {
+	s.server.CustomHandler("/secrets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"ID": "s1", "Spec": {"Name": "db-password"}}, {"ID": "s2", "Spec": {"Name": "db-password-old"}}]`))
+	}))
+
+	s.server.CustomHandler("/configs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"ID": "c1", "Spec": {"Name": "app.conf"}}]`))
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "secrets"
+	job.Command = `ls`
+	job.Secrets = []string{"db-password", "db-password:password.txt"}
+	job.Configs = []string{"app.conf", "app.conf:/etc/app/app.conf"}
+
+	spec, err := job.buildServiceSpec(ServiceImageFixture, "secrets", 1, nil)
+	c.Assert(err, IsNil)
+
+	secrets := spec.TaskTemplate.ContainerSpec.Secrets
+	c.Assert(secrets, HasLen, 2)
+	c.Assert(secrets[0].SecretID, Equals, "s1")
+	c.Assert(secrets[0].SecretName, Equals, "db-password")
+	c.Assert(secrets[0].File.Name, Equals, "db-password")
+	c.Assert(secrets[1].File.Name, Equals, "password.txt")
+
+	configs := spec.TaskTemplate.ContainerSpec.Configs
+	c.Assert(configs, HasLen, 2)
+	c.Assert(configs[0].ConfigID, Equals, "c1")
+	c.Assert(configs[0].File.Name, Equals, "/app.conf")
+	c.Assert(configs[1].File.Name, Equals, "/etc/app/app.conf")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceSecretNotFound(c *C) {
+	s.server.CustomHandler("/secrets", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"ID": "s2", "Spec": {"Name": "db-password-old"}}]`))
+	}))
+
+	job := &RunServiceJob{Client: s.client}
+	job.Command = `ls`
+	job.Secrets = []string{"db-password"}
+
+	_, err := job.buildServiceSpec(ServiceImageFixture, "secrets", 1, nil)
+	c.Assert(err, ErrorMatches, `secret "db-password" not found`)
+}
+
+func (s *SuiteRunServiceJob) TestParseFileReference(c *C) {
+	name, target, err := ParseFileReference("foo")
+	c.Assert(err, IsNil)
+	c.Assert([]string{name, target}, DeepEquals, []string{"foo", ""})
+
+	name, target, err = ParseFileReference("foo:/etc/foo")
+	c.Assert(err, IsNil)
+	c.Assert([]string{name, target}, DeepEquals, []string{"foo", "/etc/foo"})
+
+	for _, ref := range []string{"", ":/etc/foo", "foo:"} {
+		_, _, err := ParseFileReference(ref)
+		c.Assert(err, ErrorMatches, "invalid reference .*")
+	}
+}
+
+func (s *SuiteRunServiceJob) TestBuildLogDriver(c *C) {
+	job := &RunServiceJob{}
+	d, err := job.buildLogDriver()
+	c.Assert(err, IsNil)
+	c.Assert(d, IsNil)
+
+	job.LoggingGelfAddress = "udp://graylog:4711"
+	d, err = job.buildLogDriver()
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, &swarm.Driver{
+		Name:    "gelf",
+		Options: map[string]string{"gelf-address": "udp://graylog:4711"},
+	})
+
+	job.LogDriver = "json-file"
+	job.LogOpt = []string{"max-size=10m", "max-file=3"}
+	d, err = job.buildLogDriver()
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, &swarm.Driver{
+		Name:    "json-file",
+		Options: map[string]string{"max-size": "10m", "max-file": "3"},
+	})
+}
+
+func (s *SuiteRunServiceJob) TestLogFlushDelay(c *C) {
+	job := &RunServiceJob{}
+	c.Assert(job.logFlushDelay(), Equals, time.Duration(0))
+
+	job.LogDriver = "json-file"
+	c.Assert(job.logFlushDelay(), Equals, time.Duration(0))
+
+	job.LogDriver = ""
+	job.LoggingGelfAddress = "udp://graylog:4711"
+	c.Assert(job.logFlushDelay(), Equals, defaultLogFlushDelay)
+
+	job.LogDriver = "loki"
+	job.LogFlushDelay = Duration(5 * time.Second)
+	c.Assert(job.logFlushDelay(), Equals, 5*time.Second)
+}
+
+func (s *SuiteRunServiceJob) TestRunLogFlushDelay(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `ls`
 	job.Delete = true
-	job.Network = "foo"
+	job.LogDriver = "syslog"
+	job.LogFlushDelay = Duration(time.Millisecond * 500)
 
-	e := NewExecution()
+	go s.finishTask(c, swarm.TaskStateComplete, 0)
 
-	var wg sync.WaitGroup
-	wg.Add(1)
+	start := time.Now()
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+	c.Assert(time.Since(start) > time.Millisecond*700, Equals, true)
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestRunWaitForRemoval(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `ls`
+	job.Delete = true
+	job.WaitForRemoval = true
+	job.RemovalTimeout = Duration(time.Second)
+
+	go s.finishTask(c, swarm.TaskStateComplete, 0)
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, IsNil)
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 0)
+}
+
+func (s *SuiteRunServiceJob) TestWaitRemovalTimeout(c *C) {
+	opts := docker.CreateServiceOptions{}
+	opts.ServiceSpec.Annotations.Name = "lingering"
+	opts.ServiceSpec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: ServiceImageFixture}
+
+	svc, err := s.client.CreateService(opts)
+	c.Assert(err, IsNil)
+
+	job := &RunServiceJob{Client: s.client}
+	job.PollInterval = Duration(time.Millisecond * 10)
+	job.RemovalTimeout = Duration(time.Millisecond * 100)
+
+	err = job.waitRemoval(&Context{Logger: logger}, svc.ID)
+	c.Assert(err, ErrorMatches, "service .* still exists 100ms after its removal")
+}
+
+func (s *SuiteRunServiceJob) TestBuildLogDriverInvalid(c *C) {
+	job := &RunServiceJob{LogOpt: []string{"max-size=10m"}}
+	_, err := job.buildLogDriver()
+	c.Assert(err, ErrorMatches, "log-opt requires a log-driver")
+
+	job.LogDriver = "json-file"
+	job.LogOpt = []string{"max-size"}
+	_, err = job.buildLogDriver()
+	c.Assert(err, ErrorMatches, `invalid log-opt "max-size", expected key=value`)
+}
+
+func (s *SuiteRunServiceJob) TestBuildLogDriverGelfTCP(c *C) {
+	job := &RunServiceJob{LoggingGelfAddress: "tcp://graylog:12201"}
+	job.LogOpt = []string{"gelf-tcp-max-reconnect=5", "tag=ofelia"}
+
+	d, err := job.buildLogDriver()
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, &swarm.Driver{
+		Name: "gelf",
+		Options: map[string]string{
+			"gelf-address":           "tcp://graylog:12201",
+			"gelf-tcp-max-reconnect": "5",
+			"tag":                    "ofelia",
+		},
+	})
+}
+
+func (s *SuiteRunServiceJob) TestValidateGelfOptions(c *C) {
+	for options, expected := range map[string]string{
+		"gelf-address=udp://graylog:12201,gelf-compression-type=gzip": "",
+		"gelf-address=tcp://graylog:12201,gelf-tcp-reconnect-delay=1": "",
+		"gelf-address=tls://graylog:12201":                            `invalid gelf-address "tls://graylog:12201", .*`,
+		"gelf-address=tcp://graylog":                                  `invalid gelf-address "tcp://graylog", .*`,
+		"gelf-address=tcp://graylog:12201,gelf-tls=true":              `invalid log-opt "gelf-tls", the gelf driver doesn't support TLS, .*`,
+		"gelf-address=tcp://graylog:12201,gelf-foo=bar":               `invalid log-opt "gelf-foo", unknown option of the gelf driver`,
+		"gelf-address=udp://graylog:12201,gelf-tcp-max-reconnect=5":   `invalid log-opt "gelf-tcp-max-reconnect", it requires a tcp:// gelf-address`,
+		"gelf-address=tcp://graylog:12201,gelf-compression-level=1":   `invalid log-opt "gelf-compression-level", the compression is not supported .*`,
+		"tag=ofelia": "the gelf driver requires a gelf-address",
+	} {
+		job := &RunServiceJob{LogDriver: "gelf", LogOpt: strings.Split(options, ",")}
+		err := job.ValidateLogDriver()
+		if expected == "" {
+			c.Assert(err, IsNil, Commentf(options))
+		} else {
+			c.Assert(err, ErrorMatches, expected, Commentf(options))
+		}
+	}
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceLogDriver(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "logging"
+	job.Command = `ls`
+	job.LogDriver = "journald"
+	job.LogOpt = []string{"tag=ofelia"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.LogDriver.Name, Equals, "journald")
+	c.Assert(svc.Spec.TaskTemplate.LogDriver.Options, DeepEquals, map[string]string{"tag": "ofelia"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceDNS(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "dns"
+	job.Command = `ls`
+	job.DNS = []string{"10.0.0.53"}
+	job.DNSSearch = []string{"internal.example.com"}
+	job.DNSOption = []string{"ndots:2"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(*svc.Spec.TaskTemplate.ContainerSpec.DNSConfig, DeepEquals, swarm.DNSConfig{
+		Nameservers: []string{"10.0.0.53"},
+		Search:      []string{"internal.example.com"},
+		Options:     []string{"ndots:2"},
+	})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceTmpfs(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "tmpfs"
+	job.Command = `ls`
+	job.Tmpfs = []string{"/scratch:1g"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+
+	mounts := svc.Spec.TaskTemplate.ContainerSpec.Mounts
+	c.Assert(mounts, HasLen, 1)
+	c.Assert(mounts[0].Type, Equals, mount.TypeTmpfs)
+	c.Assert(mounts[0].Target, Equals, "/scratch")
+	c.Assert(mounts[0].TmpfsOptions.SizeBytes, Equals, int64(1<<30))
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceReadOnly(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "read-only"
+	job.Command = `ls`
+	job.ReadOnly = true
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.ReadOnly, Equals, true)
+}
+
+func (s *SuiteRunServiceJob) TestBuildInstanceName(c *C) {
+	now := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	job := &RunServiceJob{}
+	job.Name = "foo"
+
+	name, err := job.buildInstanceName(now)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, fmt.Sprintf("foo_%d", now.Unix()))
+
+	job.InstanceNameTemplate = "{{.Name}}-{{.Date}}-{{.Seq}}"
+	name, err = job.buildInstanceName(now)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "foo-20180102030405-2")
+
+	job.Name = "foo bar/baz"
+	job.InstanceNameTemplate = "_{{.Name}}"
+	name, err = job.buildInstanceName(now)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "foo-bar-baz")
+
+	job.Name = strings.Repeat("a", 60)
+	job.InstanceNameTemplate = "{{.Name}}-{{.Timestamp}}"
+	name, err = job.buildInstanceName(now)
+	c.Assert(err, IsNil)
+	c.Assert(name, HasLen, maxServiceNameLength)
+
+	job.InstanceNameTemplate = "{{.Foo}}"
+	_, err = job.buildInstanceName(now)
+	c.Assert(err, NotNil)
+
+	job.InstanceNameTemplate = "---"
+	_, err = job.buildInstanceName(now)
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceInstanceNameTemplate(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "foo"
+	job.Image = ServiceImageFixture
+	job.InstanceNameTemplate = "{{.Name}}-{{.Seq}}"
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+	c.Assert(job.InstanceName, Equals, "foo-1")
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.Annotations.Name, Equals, "foo-1")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceUser(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.User = "1000:1000"
+	job.Groups = []string{"999"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.User, Equals, "1000:1000")
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Groups, DeepEquals, []string{"999"})
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceReplicas(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "replicas"
+	job.Command = `ls`
+	job.Replicas = 3
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(*svc.Spec.Mode.Replicated.Replicas, Equals, uint64(3))
+}
+
+func (s *SuiteRunServiceJob) TestTasksExitCode(c *C) {
+	task := func(slot int, state swarm.TaskState, exitCode int) swarm.Task {
+		t := swarm.Task{Slot: slot}
+		t.Status.State = state
+		t.Status.ContainerStatus.ExitCode = exitCode
+		return t
+	}
+
+	var last swarm.TaskState
+	success := (&BareJob{}).IsSuccessExitCode
+
+	// a replica is still running
+	_, _, done := tasksExitCode([]swarm.Task{
+		task(1, swarm.TaskStateComplete, 0),
+		task(2, swarm.TaskStateRunning, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, false)
+
+	// a replica has not been created yet
+	_, _, done = tasksExitCode([]swarm.Task{
+		task(1, swarm.TaskStateComplete, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, false)
+
+	exitCode, _, done := tasksExitCode([]swarm.Task{
+		task(2, swarm.TaskStateComplete, 0),
+		task(1, swarm.TaskStateComplete, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 0)
+	c.Assert(last, Equals, swarm.TaskStateComplete)
+
+	// the exit code of the first failed replica is returned
+	exitCode, _, done = tasksExitCode([]swarm.Task{
+		task(3, swarm.TaskStateFailed, 2),
+		task(1, swarm.TaskStateComplete, 0),
+		task(2, swarm.TaskStateFailed, 3),
+	}, 3, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 3)
+
+	exitCode, _, done = tasksExitCode([]swarm.Task{
+		task(1, swarm.TaskStateRejected, 0),
+	}, 1, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 255)
+
+	// the exit codes at success-exit-codes are not failures
+	success = (&BareJob{SuccessExitCodes: []int{0, 2}}).IsSuccessExitCode
+	exitCode, _, done = tasksExitCode([]swarm.Task{
+		task(1, swarm.TaskStateFailed, 2),
+		task(2, swarm.TaskStateComplete, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 2)
+
+	exitCode, _, done = tasksExitCode([]swarm.Task{
+		task(1, swarm.TaskStateFailed, 2),
+		task(2, swarm.TaskStateFailed, 3),
+	}, 2, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 3)
+}
+
+func (s *SuiteRunServiceJob) TestTasksHealthy(c *C) {
+	task := func(slot int, state swarm.TaskState, exitCode int) swarm.Task {
+		t := swarm.Task{Slot: slot}
+		t.Status.State = state
+		t.Status.ContainerStatus.ExitCode = exitCode
+		return t
+	}
+
+	var last swarm.TaskState
+	success := (&BareJob{}).IsSuccessExitCode
+
+	// a replica is still starting, waiting to be healthy
+	_, _, done := tasksHealthy([]swarm.Task{
+		task(1, swarm.TaskStateRunning, 0),
+		task(2, swarm.TaskStateStarting, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, false)
+
+	exitCode, reported, done := tasksHealthy([]swarm.Task{
+		task(2, swarm.TaskStateRunning, 0),
+		task(1, swarm.TaskStateRunning, 0),
+	}, 2, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 0)
+	c.Assert(reported.Slot, Equals, 1)
+
+	// a replica failing before being healthy is reported by its exit code
+	exitCode, reported, done = tasksHealthy([]swarm.Task{
+		task(1, swarm.TaskStateRunning, 0),
+		task(2, swarm.TaskStateFailed, 137),
+	}, 2, &last, success)
+	c.Assert(done, Equals, true)
+	c.Assert(exitCode, Equals, 137)
+	c.Assert(reported.Slot, Equals, 2)
+}
+
+func (s *SuiteRunServiceJob) TestTasksExitCodeNode(c *C) {
+	task := func(slot int, node string, exitCode int) swarm.Task {
+		t := swarm.Task{Slot: slot, NodeID: node}
+		t.Status.State = swarm.TaskStateComplete
+		t.Status.ContainerStatus.ExitCode = exitCode
+		return t
+	}
+
+	var last swarm.TaskState
+	success := (&BareJob{}).IsSuccessExitCode
+
+	// the node of the failed replica is returned
+	exitCode, reported, _ := tasksExitCode([]swarm.Task{
+		task(1, "foo", 0),
+		task(2, "bar", 3),
+	}, 2, &last, success)
+	c.Assert(exitCode, Equals, 3)
+	c.Assert(reported.NodeID, Equals, "bar")
+
+	_, reported, _ = tasksExitCode([]swarm.Task{
+		task(2, "bar", 0),
+		task(1, "foo", 0),
+	}, 2, &last, success)
+	c.Assert(reported.NodeID, Equals, "foo")
+}
+
+func (s *SuiteRunServiceJob) TestRunTaskFailedNode(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.Delete = true
+
+	nodes, err := s.client.ListNodes(docker.ListNodesOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(nodes, Not(HasLen), 0)
+
+	expected := nodes[0].Description.Hostname
+	if expected == "" {
+		expected = nodes[0].ID
+	}
+
+	go s.finishTaskOnNode(c, swarm.TaskStateFailed, 3, nodes[0].ID)
+
+	err = job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 3, Node: expected})
+	c.Assert(err, ErrorMatches, "error non-zero exit code: 3, node: "+expected)
+}
+
+func (s *SuiteRunServiceJob) TestRunContainerID(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `ls`
+	job.Delete = true
 
 	go func() {
-		time.Sleep(time.Millisecond * 600)
+		time.Sleep(time.Millisecond * 300)
 
 		tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
-
 		c.Assert(err, IsNil)
-		fmt.Printf("found tasks %v\n", tasks[0].Spec.ContainerSpec.Command)
+		c.Assert(tasks, HasLen, 1)
 
-		c.Assert(strings.Join(tasks[0].Spec.ContainerSpec.Command, ","), Equals, "echo,-a,foo,bar")
+		task := tasks[0]
+		task.Status.State = swarm.TaskStateComplete
+		task.Status.ContainerStatus.ContainerID = "foo"
+		c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+	}()
 
-		c.Assert(tasks[0].Status.State, Equals, swarm.TaskStateReady)
+	e := NewExecution()
+	err := job.Run(&Context{Execution: e, Logger: logger})
+	c.Assert(err, IsNil)
+	c.Assert(e.ContainerID, Equals, "foo")
+}
 
-		err = s.client.RemoveService(docker.RemoveServiceOptions{
-			ID: tasks[0].ServiceID,
-		})
+func (s *SuiteRunServiceJob) TestRunOnFailureCommand(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.OnFailureCommand = `rm -rf /tmp/foo`
+	job.Delete = true
+
+	done := make(chan []string, 1)
+	go func() {
+		s.finishTask(c, swarm.TaskStateFailed, 1)
+		time.Sleep(time.Millisecond * 300)
 
+		services, err := s.client.ListServices(docker.ListServicesOptions{})
 		c.Assert(err, IsNil)
 
-		wg.Done()
+		var cleanup swarm.Service
+		for _, svc := range services {
+			if strings.HasSuffix(svc.Spec.Name, onFailureSuffix) {
+				cleanup = svc
+			}
+		}
+
+		c.Assert(cleanup.ID, Not(Equals), "")
+		done <- cleanup.Spec.TaskTemplate.ContainerSpec.Args
+
+		tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+		c.Assert(err, IsNil)
 
+		for _, task := range tasks {
+			if task.ServiceID == cleanup.ID {
+				task.Status.State = swarm.TaskStateFailed
+				task.Status.ContainerStatus.ExitCode = 3
+				c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+			}
+		}
 	}()
 
-	err := job.Run(&Context{Execution: e, Logger: logger})
+	// the failure of the on-failure-command doesn't mask the one of the job
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 1})
+	c.Assert(<-done, DeepEquals, []string{"rm", "-rf", "/tmp/foo"})
+
+	services, err := s.client.ListServices(docker.ListServicesOptions{})
 	c.Assert(err, IsNil)
-	wg.Wait()
+	c.Assert(services, HasLen, 0)
+}
 
-	containers, err := s.client.ListTasks(docker.ListTasksOptions{})
+func (s *SuiteRunServiceJob) TestRunOnFailureCommandShell(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Image = ServiceImageFixture
+	job.Command = `false`
+	job.OnFailureCommand = `rm -rf /tmp/foo && echo done`
+	job.Shell = "true"
+	job.Delete = true
 
+	done := make(chan []string, 1)
+	go func() {
+		s.finishTask(c, swarm.TaskStateFailed, 1)
+		time.Sleep(time.Millisecond * 300)
+
+		services, err := s.client.ListServices(docker.ListServicesOptions{})
+		c.Assert(err, IsNil)
+
+		for _, svc := range services {
+			if strings.HasSuffix(svc.Spec.Name, onFailureSuffix) {
+				done <- svc.Spec.TaskTemplate.ContainerSpec.Args
+				s.finishTaskWith(c, 0, func(task *swarm.Task) {
+					if task.ServiceID == svc.ID {
+						task.Status.State = swarm.TaskStateComplete
+					}
+				})
+			}
+		}
+	}()
+
+	err := job.Run(&Context{Execution: NewExecution(), Logger: logger})
+	c.Assert(err, Equals, NonZeroExitError{ExitCode: 1})
+	c.Assert(<-done, DeepEquals, []string{"/bin/sh", "-c", "rm -rf /tmp/foo && echo done"})
+}
+
+func (s *SuiteRunServiceJob) TestNodeHostnameUnknown(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	c.Assert(job.nodeHostname(&Context{Logger: logger}, "foo"), Equals, "foo")
+	c.Assert(job.nodeHostname(&Context{Logger: logger}, ""), Equals, "")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceGenericResources(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "resources"
+	job.Command = `ls`
+	job.GenericResources = []string{"gpu=2", "fpga=UUID1"}
+
+	svc, err := job.buildService(ServiceImageFixture)
 	c.Assert(err, IsNil)
-	c.Assert(containers, HasLen, 0)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+
+	r := svc.Spec.TaskTemplate.Resources.Reservations.GenericResources
+	c.Assert(r, HasLen, 2)
+	c.Assert(*r[0].DiscreteResourceSpec, Equals, swarm.DiscreteGenericResource{Kind: "gpu", Value: 2})
+	c.Assert(*r[1].NamedResourceSpec, Equals, swarm.NamedGenericResource{Kind: "fpga", Value: "UUID1"})
+}
+
+func (s *SuiteRunServiceJob) TestRegistryAuth(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Registry = "registry.example.com"
+	c.Assert(job.registryAuth(), DeepEquals, docker.AuthConfiguration{})
+
+	job.RegistryUser = "foo"
+	job.RegistryPassword = "bar"
+	c.Assert(job.registryAuth(), DeepEquals, docker.AuthConfiguration{
+		Username:      "foo",
+		Password:      "bar",
+		ServerAddress: "registry.example.com",
+	})
+
+	job = &RunServiceJob{Client: s.client, RegistryAuthToken: "qux"}
+	c.Assert(job.registryAuth().RegistryToken, Equals, "qux")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceResources(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "limits"
+	job.Command = `ls`
+	job.MemoryLimit = "2g"
+	job.MemoryReservation = "512m"
+	job.CPULimit = "1.5"
+	job.GenericResources = []string{"gpu=1"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+
+	r := svc.Spec.TaskTemplate.Resources
+	c.Assert(r.Limits.MemoryBytes, Equals, int64(2<<30))
+	c.Assert(r.Limits.NanoCPUs, Equals, int64(1500000000))
+	c.Assert(r.Reservations.MemoryBytes, Equals, int64(512<<20))
+	c.Assert(r.Reservations.NanoCPUs, Equals, int64(0))
+	c.Assert(r.Reservations.GenericResources, HasLen, 1)
+}
+
+func (s *SuiteRunServiceJob) TestBuildResources(c *C) {
+	job := &RunServiceJob{}
+	r, err := job.buildResources()
+	c.Assert(err, IsNil)
+	c.Assert(r, IsNil)
+
+	job.CPUReservation = "0.5"
+	r, err = job.buildResources()
+	c.Assert(err, IsNil)
+	c.Assert(r.Limits, IsNil)
+	c.Assert(r.Reservations.NanoCPUs, Equals, int64(500000000))
+
+	job.CPULimit = "0.25"
+	_, err = job.buildResources()
+	c.Assert(err, ErrorMatches, `cpu-reservation "0.5" exceeds the cpu-limit "0.25"`)
+
+	job = &RunServiceJob{MemoryLimit: "lots"}
+	_, err = job.buildResources()
+	c.Assert(err, ErrorMatches, `invalid memory "lots", .*`)
+
+	job = &RunServiceJob{CPULimit: "-1"}
+	_, err = job.buildResources()
+	c.Assert(err, ErrorMatches, `invalid cpus "-1", .*`)
+}
+
+func (s *SuiteRunServiceJob) TestParseGenericResourceInvalid(c *C) {
+	for _, r := range []string{"gpu", "gpu=", "=1", "gpu=0", "gpu=-1"} {
+		_, err := ParseGenericResource(r)
+		c.Assert(err, NotNil)
+	}
+}
+
+func (s *SuiteRunServiceJob) TestBuildServicePorts(c *C) {
+	job := &RunServiceJob{Client: s.client}
+	job.Name = "ports"
+	job.Command = `ls`
+	job.Ports = []string{"8080:80", "5353:53/udp"}
+
+	svc, err := job.buildService(ServiceImageFixture)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+
+	c.Assert(svc.Spec.EndpointSpec.Ports, DeepEquals, []swarm.PortConfig{
+		{Protocol: swarm.PortConfigProtocolTCP, PublishedPort: 8080, TargetPort: 80},
+		{Protocol: swarm.PortConfigProtocolUDP, PublishedPort: 5353, TargetPort: 53},
+	})
+}
+
+func (s *SuiteRunServiceJob) TestParsePortConfigInvalid(c *C) {
+	for _, p := range []string{"80", "a:80", "8080:b", "0:80", "8080:70000", "8080:80/foo"} {
+		_, err := ParsePortConfig(p)
+		c.Assert(err, NotNil)
+	}
 }
 
 func (s *SuiteRunServiceJob) TestBuildPullImageOptionsBareImage(c *C) {
@@ -113,6 +1757,73 @@ func (s *SuiteRunServiceJob) TestBuildPullImageOptionsRegistry(c *C) {
 	c.Assert(o.Registry, Equals, "docker-registry.company.de:5000")
 }
 
+func (s *SuiteRunServiceJob) TestBuildPullImageOptionsDigest(c *C) {
+	o, _ := buildPullOptions("srcd/rest@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "")
+	c.Assert(o.Repository, Equals, "srcd/rest")
+	c.Assert(o.Tag, Equals, "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+}
+
+func (s *SuiteRunServiceJob) TestBuildServiceDigest(c *C) {
+	image := fullImageName("docker-registry.company.de:5000", "srcd/rest@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+
+	job := &RunServiceJob{Client: s.client}
+	job.Command = `ls`
+
+	svc, err := job.buildService(image)
+	c.Assert(err, IsNil)
+
+	svc, err = s.client.InspectService(svc.ID)
+	c.Assert(err, IsNil)
+	c.Assert(svc.Spec.TaskTemplate.ContainerSpec.Image, Equals, "docker-registry.company.de:5000/srcd/rest@sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+}
+
+func (s *SuiteRunServiceJob) finishTask(c *C, state swarm.TaskState, exitCode int) {
+	s.finishTaskOnNode(c, state, exitCode, "")
+}
+
+// finishTaskOnNode finishes the task of the service placing it at the given
+// node, the tasks of finishTask have no node so their errors have no node.
+func (s *SuiteRunServiceJob) finishTaskOnNode(c *C, state swarm.TaskState, exitCode int, node string) {
+	time.Sleep(time.Millisecond * 300)
+
+	tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(tasks, HasLen, 1)
+
+	task := tasks[0]
+	task.NodeID = node
+	task.Status.State = state
+	task.Status.ContainerStatus.ExitCode = exitCode
+	c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+}
+
+// finishTaskWith mutates the tasks of the service with the given ForceUpdate
+// counter by the given function
+func (s *SuiteRunServiceJob) finishTaskWith(c *C, forceUpdate uint64, fn func(*swarm.Task)) {
+	time.Sleep(time.Millisecond * 300)
+
+	tasks, err := s.client.ListTasks(docker.ListTasksOptions{})
+	c.Assert(err, IsNil)
+
+	for _, task := range tasks {
+		if task.Spec.ForceUpdate == forceUpdate {
+			fn(&task)
+			c.Assert(s.server.MutateTask(task.ID, task), IsNil)
+		}
+	}
+}
+
+// writeLogFrame writes a frame of the multiplexed stream of the logs, as the
+// docker daemon does for the containers without a TTY
+func writeLogFrame(w http.ResponseWriter, stream byte, content string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(content)))
+
+	w.Write(header)
+	w.Write([]byte(content))
+}
+
 func (s *SuiteRunServiceJob) buildImage(c *C) {
 	inputbuf := bytes.NewBuffer(nil)
 	tr := tar.NewWriter(inputbuf)
@@ -127,3 +1838,16 @@ func (s *SuiteRunServiceJob) buildImage(c *C) {
 	})
 	c.Assert(err, IsNil)
 }
+
+func (s *SuiteRunServiceJob) TestPollInterval(c *C) {
+	job := &RunServiceJob{}
+	c.Assert(job.pollInterval(), Equals, watchDuration)
+	c.Assert(job.nextPollInterval(watchDuration), Equals, watchDuration)
+
+	job.PollInterval = Duration(time.Second)
+	job.PollMaxInterval = Duration(time.Second * 5)
+	c.Assert(job.pollInterval(), Equals, time.Second)
+	c.Assert(job.nextPollInterval(time.Second), Equals, time.Second*2)
+	c.Assert(job.nextPollInterval(time.Second*4), Equals, time.Second*5)
+	c.Assert(job.nextPollInterval(time.Second*5), Equals, time.Second*5)
+}
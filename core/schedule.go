@@ -0,0 +1,61 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron"
+)
+
+// ParseSchedule parses a job schedule. The standard cron expressions, with 5
+// fields (minute, hour, day of month, month and day of week), are supported as
+// well as expressions with a leading seconds field, 6 fields, and the
+// descriptors like @hourly, @daily or @every 1h30m.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, ErrEmptySchedule
+	}
+
+	if spec[0] != '@' {
+		fields := strings.Fields(spec)
+		switch len(fields) {
+		case 5:
+			fields = append([]string{"0"}, fields...)
+		case 6:
+		default:
+			return nil, fmt.Errorf("expected 5 or 6 fields, found %d", len(fields))
+		}
+
+		spec = strings.Join(fields, " ")
+	}
+
+	return cron.Parse(spec)
+}
+
+// IsStandardSchedule returns true if the given schedule is a standard cron
+// expression with 5 fields, read minute first. Before, they were read seconds
+// first, as the 6 fields ones with an optional day of week, eg. `0 */5 * * *`
+// ran every 5 minutes and now every 5 hours.
+func IsStandardSchedule(spec string) bool {
+	spec = strings.TrimSpace(spec)
+	return spec != "" && spec[0] != '@' && len(strings.Fields(spec)) == 5
+}
+
+// IsDue returns true if the given schedule has an activation at the minute of
+// the given time. The @every schedules, relative to the start of the scheduler,
+// are never due.
+func IsDue(spec string, t time.Time) bool {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return false
+	}
+
+	if _, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		return false
+	}
+
+	minute := t.Truncate(time.Minute)
+	return schedule.Next(minute.Add(-time.Second)).Before(minute.Add(time.Minute))
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteSchedule struct{}
+
+var _ = Suite(&SuiteSchedule{})
+
+var scheduleFixtureDate = time.Date(2017, 3, 1, 10, 20, 15, 0, time.UTC)
+
+func (s *SuiteSchedule) TestParseScheduleFiveFields(c *C) {
+	sc, err := ParseSchedule("30 * * * *")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, time.Date(2017, 3, 1, 10, 30, 0, 0, time.UTC))
+}
+
+func (s *SuiteSchedule) TestParseScheduleFiveFieldsDayOfWeek(c *C) {
+	sc, err := ParseSchedule("0 12 * * 0")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, time.Date(2017, 3, 5, 12, 0, 0, 0, time.UTC))
+}
+
+func (s *SuiteSchedule) TestParseScheduleSixFields(c *C) {
+	sc, err := ParseSchedule("*/10 * * * * *")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, time.Date(2017, 3, 1, 10, 20, 20, 0, time.UTC))
+}
+
+func (s *SuiteSchedule) TestParseScheduleDescriptor(c *C) {
+	sc, err := ParseSchedule("@hourly")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, time.Date(2017, 3, 1, 11, 0, 0, 0, time.UTC))
+
+	sc, err = ParseSchedule("@daily")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC))
+}
+
+func (s *SuiteSchedule) TestParseScheduleEvery(c *C) {
+	sc, err := ParseSchedule("@every 1h30m")
+	c.Assert(err, IsNil)
+	c.Assert(sc.Next(scheduleFixtureDate), Equals, scheduleFixtureDate.Add(90*time.Minute))
+}
+
+func (s *SuiteSchedule) TestParseScheduleInvalid(c *C) {
+	_, err := ParseSchedule("")
+	c.Assert(err, Equals, ErrEmptySchedule)
+
+	_, err = ParseSchedule("* * *")
+	c.Assert(err, ErrorMatches, "expected 5 or 6 fields, found 3")
+
+	_, err = ParseSchedule("61 * * * *")
+	c.Assert(err, NotNil)
+
+	_, err = ParseSchedule("@every foo")
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteSchedule) TestIsStandardSchedule(c *C) {
+	c.Assert(IsStandardSchedule("*/5 * * * *"), Equals, true)
+	c.Assert(IsStandardSchedule(" 0 */5 * * * * "), Equals, false)
+	c.Assert(IsStandardSchedule("@every 5m"), Equals, false)
+	c.Assert(IsStandardSchedule(""), Equals, false)
+}
+
+func (s *SuiteSchedule) TestIsDue(c *C) {
+	c.Assert(IsDue("20 10 * * *", scheduleFixtureDate), Equals, true)
+	c.Assert(IsDue("21 10 * * *", scheduleFixtureDate), Equals, false)
+	c.Assert(IsDue("@hourly", scheduleFixtureDate), Equals, false)
+	c.Assert(IsDue("@hourly", scheduleFixtureDate.Truncate(time.Hour)), Equals, true)
+	c.Assert(IsDue("*/10 * * * * *", scheduleFixtureDate), Equals, true)
+	c.Assert(IsDue("@every 1m", scheduleFixtureDate), Equals, false)
+	c.Assert(IsDue("foo", scheduleFixtureDate), Equals, false)
+}
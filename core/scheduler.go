@@ -3,65 +3,368 @@ package core
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron"
 )
 
 var (
-	ErrEmptyScheduler = errors.New("unable to start a empty scheduler.")
-	ErrEmptySchedule  = errors.New("unable to add a job with a empty schedule.")
+	ErrEmptyScheduler    = errors.New("unable to start a empty scheduler.")
+	ErrEmptySchedule     = errors.New("unable to add a job with a empty schedule.")
+	ErrDependencyCycle   = errors.New("unable to start a scheduler with a dependency cycle.")
+	ErrUnknownDependency = errors.New("unable to start a scheduler with a dependency on a unknown job.")
+	ErrNotRunning        = errors.New("unable to trigger a job, the scheduler is not running.")
 )
 
 type Scheduler struct {
 	Jobs   []Job
 	Logger Logger
+	// DryRun makes the executions only log what would be run, without running
+	// the jobs, the middlewares are still called.
+	DryRun bool
+	// MaxConcurrentRuns limits the executions running at the same time, the
+	// executions over the limit wait for a free slot, zero means no limit.
+	MaxConcurrentRuns int
+	// StartupDelay delays the run-on-start and the scheduled executions until
+	// it has passed since the scheduler started, eg. waiting for the services
+	// started along with the daemon, the jobs override it with start-delay.
+	StartupDelay time.Duration
 
 	middlewareContainer
-	cron      *cron.Cron
-	wg        sync.WaitGroup
-	isRunning bool
+	cron       *cron.Cron
+	wg         sync.WaitGroup
+	isRunning  bool
+	history    *History
+	done       chan struct{}
+	cancelOnce sync.Once
+	running    map[string]*Context
+	runLock    sync.Mutex
+	slots      *runQueue
+	dependents map[string][]Job
+	finished   map[string]map[string]*Execution
+	depLock    sync.Mutex
+	failures   map[string]int
+	tripped    map[string]bool
+	tripLock   sync.Mutex
+	started    time.Time
 }
 
 func NewScheduler(l Logger) *Scheduler {
 	return &Scheduler{
-		Logger: l,
-		cron:   cron.New(),
+		Logger:   l,
+		cron:     cron.New(),
+		history:  NewHistory(),
+		done:     make(chan struct{}),
+		running:  make(map[string]*Context, 0),
+		failures: make(map[string]int, 0),
+		tripped:  make(map[string]bool, 0),
 	}
 }
 
+// AddJob registers a job, jobs depending on other jobs or run on start may
+// have no schedule, in that case they are only executed after its dependencies
+// or when the scheduler starts. The disabled jobs are registered but never
+// executed.
 func (s *Scheduler) AddJob(j Job) error {
 	s.Logger.Noticef("New job registered %q - %q - %q", j.GetName(), j.GetCommand(), j.GetSchedule())
 
-	if j.GetSchedule() == "" {
+	if j.GetSchedule() == "" && len(j.GetDependencies()) == 0 && !j.ShouldRunOnStart() {
 		return ErrEmptySchedule
 	}
 
-	err := s.cron.AddJob(j.GetSchedule(), &jobWrapper{s, j})
-	if err != nil {
+	if _, err := j.GetCalendar(); err != nil {
+		return err
+	}
+
+	if err := j.ValidateCommand(); err != nil {
 		return err
 	}
 
+	if j.GetSchedule() != "" {
+		schedule, err := ParseSchedule(j.GetSchedule())
+		if err != nil {
+			return fmt.Errorf("invalid schedule %q: %s", j.GetSchedule(), err)
+		}
+
+		if IsStandardSchedule(j.GetSchedule()) {
+			s.Logger.Warningf(
+				"Job %q schedule %q has 5 fields, read minute first, the previous versions read the first field as the seconds, add a leading `0` to keep that meaning",
+				j.GetName(), j.GetSchedule(),
+			)
+		}
+
+		if j.IsEnabled() {
+			s.cron.Schedule(schedule, &jobWrapper{s, j, TriggerScheduled})
+			s.Logger.Noticef("Job %q next run at %s", j.GetName(), schedule.Next(time.Now()).Format(time.RFC3339))
+		}
+	}
+
+	if !j.IsEnabled() {
+		s.Logger.Noticef("Job %q is disabled, it will not be executed", j.GetName())
+	}
+
+	s.history.limit(j)
 	s.Jobs = append(s.Jobs, j)
 	return nil
 }
 
+// ScheduleJob registers a job with the given schedule, the way to add the jobs
+// built without a config file, eg:
+//
+//	j := core.NewRunServiceJob(client)
+//	j.Name, j.Image, j.Command = "backup", "postgres:11", "pg_dump app"
+//	err := s.ScheduleJob("@every 1h", j)
+//
+// The job must have a SetSchedule method, as the ones embedding a BareJob.
+func (s *Scheduler) ScheduleJob(schedule string, j Job) error {
+	sj, ok := j.(interface{ SetSchedule(string) })
+	if !ok {
+		return fmt.Errorf("job %q doesn't support setting its schedule", j.GetName())
+	}
+
+	sj.SetSchedule(schedule)
+	return s.AddJob(j)
+}
+
+// SetHistory replaces the history of the executions, eg. by one persisted to
+// a file with OpenHistory, it must be called before adding the jobs.
+func (s *Scheduler) SetHistory(h *History) {
+	s.history = h
+}
+
+// History returns the last finished executions of the given job, from the
+// oldest to the newest, up to the max-history of the job.
+func (s *Scheduler) History(name string) []ExecutionRecord {
+	return s.history.Get(name)
+}
+
+// NextRun returns the time of the next scheduled execution of the given job,
+// false if the job is not scheduled, eg. a job only triggered by its
+// dependencies, or the scheduler is not started.
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	for _, e := range s.cron.Entries() {
+		w, ok := e.Job.(*jobWrapper)
+		if !ok || w.j.GetName() != name || e.Next.IsZero() {
+			continue
+		}
+
+		return e.Next, true
+	}
+
+	return time.Time{}, false
+}
+
+// IsTripped returns true if the given job reached its failure-threshold, the
+// tripped jobs are not executed by cron nor by its dependencies until they
+// are reset or succeed when triggered on demand.
+func (s *Scheduler) IsTripped(name string) bool {
+	s.tripLock.Lock()
+	defer s.tripLock.Unlock()
+
+	return s.tripped[name]
+}
+
+// ConsecutiveFailures returns the number of failed executions of the given job
+// since its last success
+func (s *Scheduler) ConsecutiveFailures(name string) int {
+	s.tripLock.Lock()
+	defer s.tripLock.Unlock()
+
+	return s.failures[name]
+}
+
+// Reset clears the consecutive failures of the given job, scheduling it again
+// if it was tripped.
+func (s *Scheduler) Reset(name string) {
+	s.tripLock.Lock()
+	defer s.tripLock.Unlock()
+
+	if s.tripped[name] {
+		s.Logger.Noticef("Job %q has been reset, it will be executed again", name)
+	}
+
+	delete(s.failures, name)
+	delete(s.tripped, name)
+}
+
+// trackFailures counts the consecutive failures of the job, tripping it when
+// its failure-threshold is reached, the skipped executions are not counted.
+func (s *Scheduler) trackFailures(j Job, e *Execution) {
+	if e.Skipped {
+		return
+	}
+
+	s.tripLock.Lock()
+	defer s.tripLock.Unlock()
+
+	name := j.GetName()
+	if !e.Failed {
+		delete(s.failures, name)
+		delete(s.tripped, name)
+		return
+	}
+
+	s.failures[name]++
+	threshold := j.GetFailureThreshold()
+	if threshold > 0 && s.failures[name] >= threshold && !s.tripped[name] {
+		s.tripped[name] = true
+		s.Logger.Errorf(
+			"Job %q disabled after %d consecutive failures, it will not be executed until it is reset",
+			name, s.failures[name],
+		)
+	}
+}
+
+// GetJob returns the job with the given name, nil if the job doesn't exist
+func (s *Scheduler) GetJob(name string) Job {
+	for _, j := range s.Jobs {
+		if j.GetName() == name {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// RunJob executes immediately the given job, using the given execution, the
+// scheduler doesn't need to be started. The dependent jobs are not executed.
+// The execution is a TriggerManual one, unless it has a source.
+func (s *Scheduler) RunJob(j Job, e *Execution) {
+	s.mergeMiddlewares()
+
+	if e.TriggerSource == "" {
+		e.TriggerSource = TriggerManual
+	}
+
+	w := &jobWrapper{s, j, e.TriggerSource}
+	w.exec(e)
+}
+
+// Trigger executes immediately the given job, on demand, as any scheduled
+// execution: the concurrency limit applies and the dependent jobs are executed
+// after it. It waits until the execution finishes. The source is recorded at the
+// execution, eg. TriggerAPI.
+func (s *Scheduler) Trigger(j Job, source string) (*Execution, error) {
+	e := (&jobWrapper{s, j, source}).run()
+	if e == nil {
+		return nil, ErrNotRunning
+	}
+
+	return e, nil
+}
+
 func (s *Scheduler) Start() error {
 	if len(s.Jobs) == 0 {
 		return ErrEmptyScheduler
 	}
 
+	if err := s.buildDependencies(); err != nil {
+		return err
+	}
+
 	s.Logger.Debugf("Starting scheduler with %d jobs", len(s.Jobs))
 
+	if s.MaxConcurrentRuns > 0 {
+		s.slots = newRunQueue(s.MaxConcurrentRuns)
+	}
+
 	s.mergeMiddlewares()
 	s.isRunning = true
+	s.started = time.Now()
+	if s.StartupDelay > 0 {
+		s.Logger.Noticef("Startup delay of %s in effect, the jobs run after it", s.StartupDelay)
+	}
+
 	s.cron.Start()
+	s.runOnStart()
 	return nil
 }
 
+// RunOnce executes, without starting the cron, the enabled jobs without
+// dependencies whose schedule is due at the minute of the given time, or all of
+// them if all is true, followed by their dependent jobs. It waits until every
+// execution finishes and returns the names of the jobs that failed.
+func (s *Scheduler) RunOnce(t time.Time, all bool) ([]string, error) {
+	if len(s.Jobs) == 0 {
+		return nil, ErrEmptyScheduler
+	}
+
+	if err := s.buildDependencies(); err != nil {
+		return nil, err
+	}
+
+	if s.MaxConcurrentRuns > 0 {
+		s.slots = newRunQueue(s.MaxConcurrentRuns)
+	}
+
+	s.mergeMiddlewares()
+	s.isRunning = true
+
+	source := TriggerScheduled
+	if all {
+		source = TriggerManual
+	}
+
+	for _, j := range s.Jobs {
+		if !j.IsEnabled() || len(j.GetDependencies()) != 0 {
+			continue
+		}
+
+		if !all && !IsDue(j.GetSchedule(), t) {
+			continue
+		}
+
+		s.Logger.Noticef("Job %q is executed once", j.GetName())
+
+		s.wg.Add(1)
+		go func(j Job) {
+			defer s.wg.Done()
+			(&jobWrapper{s, j, source}).Run()
+		}(j)
+	}
+
+	s.wg.Wait()
+	s.isRunning = false
+
+	var failed []string
+	for _, j := range s.Jobs {
+		if s.ConsecutiveFailures(j.GetName()) != 0 {
+			failed = append(failed, j.GetName())
+		}
+	}
+
+	return failed, nil
+}
+
+// runOnStart executes the enabled jobs with run-on-start, through the whole
+// middleware chain, as any scheduled execution.
+func (s *Scheduler) runOnStart() {
+	for _, j := range s.Jobs {
+		if !j.IsEnabled() || !j.ShouldRunOnStart() {
+			continue
+		}
+
+		s.Logger.Noticef("Job %q is executed on start", j.GetName())
+
+		s.wg.Add(1)
+		go func(j Job) {
+			defer s.wg.Done()
+
+			w := &jobWrapper{s, j, TriggerOnStart}
+			if w.waitStartDelay() {
+				w.execute()
+			}
+		}(j)
+	}
+}
+
 func (s *Scheduler) mergeMiddlewares() {
 	for _, j := range s.Jobs {
 		j.Use(s.Middlewares()...)
+		s.Logger.Debugf("Middlewares of job %q: %s", j.GetName(), strings.Join(MiddlewareChain(j), ", "))
 	}
 }
 
@@ -73,29 +376,413 @@ func (s *Scheduler) Stop() error {
 	return nil
 }
 
+// Shutdown stops the scheduler, no new executions are started and the running
+// executions are waited up to the given grace period, after it, the running
+// jobs are cancelled and waited until they clean up.
+func (s *Scheduler) Shutdown(grace time.Duration) error {
+	s.isRunning = false
+	s.cron.Stop()
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-time.After(grace):
+	}
+
+	s.Logger.Warningf("Grace period of %s exceeded, cancelling the running jobs", grace)
+	s.cancel()
+
+	<-finished
+	return nil
+}
+
+func (s *Scheduler) cancel() {
+	s.cancelOnce.Do(func() {
+		close(s.done)
+	})
+
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	for _, ctx := range s.running {
+		ctx.Cancel()
+	}
+}
+
+// RunningExecution is an execution being run by the scheduler
+type RunningExecution struct {
+	Job       string
+	ID        string
+	StartedAt time.Time
+	// Target is the ID of the container, service or task running the
+	// execution, empty until the job creates it.
+	Target string
+}
+
+// Running returns the executions being run, sorted by its start date.
+func (s *Scheduler) Running() []RunningExecution {
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	running := make([]RunningExecution, 0, len(s.running))
+	for id, ctx := range s.running {
+		running = append(running, RunningExecution{
+			Job:       ctx.Job.GetName(),
+			ID:        id,
+			StartedAt: ctx.Execution.StartedAt,
+			Target:    ctx.Target(),
+		})
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].StartedAt.Before(running[j].StartedAt)
+	})
+
+	return running
+}
+
+// Cancel cancels the running execution with the given ID, the job stops and
+// cleans up its container or service as on shutdown. Returns false if there
+// is no running execution with the ID.
+func (s *Scheduler) Cancel(id string) bool {
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	ctx, ok := s.running[id]
+	if ok {
+		ctx.Logger.Warningf("%s - Cancelling the execution %q", ctx.Job.GetName(), id)
+		ctx.Cancel()
+	}
+
+	return ok
+}
+
+// track registers the context of a running execution until the returned
+// function is called, the executions starting after a shutdown are cancelled
+// right away.
+func (s *Scheduler) track(ctx *Context) func() {
+	s.runLock.Lock()
+	defer s.runLock.Unlock()
+
+	s.running[ctx.Execution.ID] = ctx
+	select {
+	case <-s.done:
+		ctx.Cancel()
+	default:
+	}
+
+	return func() {
+		s.runLock.Lock()
+		defer s.runLock.Unlock()
+
+		delete(s.running, ctx.Execution.ID)
+	}
+}
+
 func (s *Scheduler) IsRunning() bool {
 	return s.isRunning
 }
 
+// buildDependencies indexes the jobs by its dependencies, returns an error if
+// a dependency is unknown or if the dependencies contain a cycle.
+func (s *Scheduler) buildDependencies() error {
+	jobs := make(map[string]Job, len(s.Jobs))
+	for _, j := range s.Jobs {
+		jobs[j.GetName()] = j
+	}
+
+	s.dependents = make(map[string][]Job, 0)
+	s.finished = make(map[string]map[string]*Execution, 0)
+	for _, j := range s.Jobs {
+		for _, name := range j.GetDependencies() {
+			if _, ok := jobs[name]; !ok {
+				return fmt.Errorf("%s: %q depends on %q", ErrUnknownDependency, j.GetName(), name)
+			}
+
+			s.dependents[name] = append(s.dependents[name], j)
+		}
+	}
+
+	visited := make(map[string]int, len(jobs))
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch visited[name] {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+
+		visited[name] = 1
+		for _, dep := range jobs[name].GetDependencies() {
+			if !visit(dep) {
+				return false
+			}
+		}
+
+		visited[name] = 2
+		return true
+	}
+
+	for name := range jobs {
+		if !visit(name) {
+			return ErrDependencyCycle
+		}
+	}
+
+	return nil
+}
+
+// jobDone is called every time a job execution finishes, when all the
+// dependencies of a job have finished since its last run, the job is executed
+// if all of them were successful, otherwise is marked as skipped.
+func (s *Scheduler) jobDone(j Job, e *Execution) {
+	for _, d := range s.dependents[j.GetName()] {
+		if !d.IsEnabled() {
+			continue
+		}
+
+		executions, ready := s.collectDependency(d, j, e)
+		if !ready {
+			continue
+		}
+
+		var failed string
+		for name, e := range executions {
+			if e.Failed || e.Skipped {
+				failed = name
+				break
+			}
+		}
+
+		s.wg.Add(1)
+		go func(d Job, failed string) {
+			defer s.wg.Done()
+
+			w := &jobWrapper{s, d, TriggerDependency}
+			if failed == "" {
+				w.Run()
+				return
+			}
+
+			w.skip(fmt.Sprintf("dependency %q didn't succeed", failed))
+		}(d, failed)
+	}
+}
+
+func (s *Scheduler) collectDependency(d, j Job, e *Execution) (map[string]*Execution, bool) {
+	s.depLock.Lock()
+	defer s.depLock.Unlock()
+
+	executions, ok := s.finished[d.GetName()]
+	if !ok {
+		executions = make(map[string]*Execution, 0)
+		s.finished[d.GetName()] = executions
+	}
+
+	executions[j.GetName()] = e
+	if len(executions) < len(d.GetDependencies()) {
+		return nil, false
+	}
+
+	delete(s.finished, d.GetName())
+	return executions, true
+}
+
 type jobWrapper struct {
-	s *Scheduler
-	j Job
+	s      *Scheduler
+	j      Job
+	source string
 }
 
+// Run is called by cron and after the dependencies of the job, the executions
+// on the days excluded by the calendar of the job are skipped and the tripped
+// jobs are not executed at all.
 func (w *jobWrapper) Run() {
+	if w.s.IsTripped(w.j.GetName()) {
+		w.s.Logger.Debugf("Job %q not executed, it reached its failure-threshold", w.j.GetName())
+		return
+	}
+
+	if !w.waitStartDelay() {
+		return
+	}
+
+	if allowed, reason := w.allowed(time.Now()); !allowed {
+		w.skip(reason)
+		return
+	}
+
+	w.run()
+}
+
+// waitStartDelay waits, for the run-on-start and the scheduled executions,
+// until the start delay of the job has passed since the scheduler started,
+// returns false if the scheduler is stopped meanwhile.
+func (w *jobWrapper) waitStartDelay() bool {
+	if w.source != TriggerScheduled && w.source != TriggerOnStart {
+		return true
+	}
+
+	delay := w.j.GetStartDelay()
+	if delay <= 0 {
+		delay = w.s.StartupDelay
+	}
+
+	wait := w.s.started.Add(delay).Sub(time.Now())
+	if delay <= 0 || wait <= 0 {
+		return true
+	}
+
+	w.s.Logger.Noticef("Job %q waits %s for its start delay", w.j.GetName(), wait.Round(time.Millisecond))
+
+	select {
+	case <-time.After(wait):
+	case <-w.s.done:
+		return false
+	}
+
+	return w.s.IsRunning()
+}
+
+// allowed returns false, with the reason, if the execution at the given time
+// is excluded by the calendar of the job or by its flag files.
+func (w *jobWrapper) allowed(t time.Time) (bool, string) {
+	c, err := w.j.GetCalendar()
+	if err != nil {
+		return false, err.Error()
+	}
+
+	if allowed, reason := c.Allows(t); !allowed {
+		return false, reason
+	}
+
+	return w.j.CheckFlagFiles()
+}
+
+// run executes the job if the scheduler is running, returning the execution,
+// nil if it wasn't executed.
+func (w *jobWrapper) run() *Execution {
+	if !w.s.IsRunning() {
+		return nil
+	}
+
+	w.s.wg.Add(1)
+	defer w.s.wg.Done()
+
+	return w.execute()
+}
+
+// execute executes the job once a slot of the concurrency limit is taken,
+// returns nil if the scheduler is shut down while waiting for it.
+func (w *jobWrapper) execute() *Execution {
+	if !w.acquire() {
+		return nil
+	}
+
+	defer w.release()
+
+	e := w.newExecution()
+	w.exec(e)
+
+	return e
+}
+
+// acquire takes a slot of the max-concurrent-runs limit, waiting until one is
+// free, the waiting executions are admitted by the priority of its job. Returns
+// false if the scheduler is shut down while waiting.
+func (w *jobWrapper) acquire() bool {
+	if w.s.slots == nil || !w.j.IsConcurrencyLimited() {
+		return true
+	}
+
+	if w.s.slots.tryAcquire() {
+		return true
+	}
+
+	w.s.Logger.Noticef(
+		"Job %q is waiting, the limit of %d concurrent runs is reached",
+		w.j.GetName(), w.s.slots.size,
+	)
+
+	e := w.s.slots.enqueue(w.j.GetPriority())
+	select {
+	case <-e.admitted:
+	case <-w.s.done:
+		if !w.s.slots.cancel(e) {
+			w.s.slots.release()
+		}
+
+		return false
+	}
+
+	if !w.s.IsRunning() {
+		w.s.slots.release()
+		w.s.Logger.Warningf("Job %q not executed, the scheduler is shutting down", w.j.GetName())
+		return false
+	}
+
+	return true
+}
+
+func (w *jobWrapper) release() {
+	if w.s.slots == nil || !w.j.IsConcurrencyLimited() {
+		return
+	}
+
+	w.s.slots.release()
+}
+
+func (w *jobWrapper) exec(e *Execution) {
+	ctx := NewContext(w.s, w.j, e)
+
+	w.start(ctx)
+	untrack := w.s.track(ctx)
+	defer untrack()
+
+	err := ctx.Next()
+	w.stop(ctx, err)
+	w.s.trackFailures(w.j, e)
+	w.s.jobDone(w.j, e)
+}
+
+// skip registers a skipped execution, the middlewares are still called so the
+// skipped execution is reported.
+func (w *jobWrapper) skip(reason string) {
 	if w.s.IsRunning() {
 		w.s.wg.Add(1)
 		defer w.s.wg.Done()
 
-		e := NewExecution()
+		e := w.newExecution()
 		ctx := NewContext(w.s, w.j, e)
 
 		w.start(ctx)
+		ctx.Logger.Warningf("%s - Job skipped %q, %s", ctx.Job.GetName(), ctx.Execution.ID, reason)
+		ctx.Stop(ErrSkippedExecution)
 		err := ctx.Next()
 		w.stop(ctx, err)
+		w.s.jobDone(w.j, e)
 	}
 }
 
+func (w *jobWrapper) newExecution() *Execution {
+	e := NewExecution()
+	e.DryRun = w.s.DryRun
+	e.TriggerSource = w.source
+	e.LimitOutput(w.j.GetMaxOutputBytes())
+	if w.j.ShouldStripANSI() {
+		e.StripANSI()
+	}
+
+	return e
+}
+
 func (w *jobWrapper) start(ctx *Context) {
 	ctx.Start()
 
@@ -107,6 +794,9 @@ func (w *jobWrapper) start(ctx *Context) {
 
 func (w *jobWrapper) stop(ctx *Context, err error) {
 	ctx.Stop(err)
+	if err := w.s.history.Add(ctx.Job, ctx.Execution); err != nil {
+		ctx.Logger.Errorf("%s - Error saving the history: %s", ctx.Job.GetName(), err)
+	}
 
 	errText := "none"
 	if ctx.Execution.Error != nil {
@@ -24,6 +24,41 @@ func (s *SuiteScheduler) TestAddJob(c *C) {
 	c.Assert(e[0].Job.(*jobWrapper).j, DeepEquals, job)
 }
 
+func (s *SuiteScheduler) TestScheduleJob(c *C) {
+	job := &TestJob{}
+
+	sc := NewScheduler(&TestLogger{})
+	err := sc.ScheduleJob("@hourly", job)
+	c.Assert(err, IsNil)
+	c.Assert(job.GetSchedule(), Equals, "@hourly")
+	c.Assert(sc.cron.Entries(), HasLen, 1)
+
+	err = sc.ScheduleJob("foo", &TestJob{})
+	c.Assert(err, NotNil)
+}
+
+func (s *SuiteScheduler) TestAddJobDisabled(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	job.Enabled = "false"
+
+	sc := NewScheduler(&TestLogger{})
+	err := sc.AddJob(job)
+	c.Assert(err, IsNil)
+	c.Assert(sc.Jobs, HasLen, 1)
+	c.Assert(sc.cron.Entries(), HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestAddJobInvalidSchedule(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@every foo"
+
+	sc := NewScheduler(&TestLogger{})
+	err := sc.AddJob(job)
+	c.Assert(err, ErrorMatches, `invalid schedule "@every foo": .*`)
+	c.Assert(sc.Jobs, HasLen, 0)
+}
+
 func (s *SuiteScheduler) TestStartStop(c *C) {
 	job := &TestJob{}
 	job.Schedule = "@every 1s"
@@ -43,9 +78,251 @@ func (s *SuiteScheduler) TestStartStop(c *C) {
 	h := job.History()
 	c.Assert(h, HasLen, 2)
 	c.Assert(h[0].IsRunning, Equals, false)
-	c.Assert(h[0].Date.IsZero(), Equals, false)
+	c.Assert(h[0].StartedAt.IsZero(), Equals, false)
 	c.Assert(h[1].IsRunning, Equals, false)
-	c.Assert(h[1].Date.IsZero(), Equals, false)
+	c.Assert(h[1].StartedAt.IsZero(), Equals, false)
+}
+
+func (s *SuiteScheduler) TestMaxConcurrentRuns(c *C) {
+	jobA, jobB, jobC := &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "a", "@hourly"
+	jobB.Name, jobB.Schedule = "b", "@hourly"
+	jobC.Name, jobC.Schedule = "c", "@hourly"
+	jobC.NoConcurrencyLimit = true
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxConcurrentRuns = 1
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	for _, j := range []Job{jobA, jobB, jobC} {
+		go (&jobWrapper{sc, j, TriggerScheduled}).Run()
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	c.Assert(jobA.Running()+jobB.Running(), Equals, int32(1))
+	c.Assert(jobC.Running(), Equals, int32(1))
+
+	time.Sleep(time.Millisecond * 1000)
+	sc.Stop()
+
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Called, Equals, 1)
+	c.Assert(jobC.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestMaxConcurrentRunsPriority(c *C) {
+	jobA, jobB, jobC := &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "a", "@hourly"
+	jobB.Name, jobB.Schedule = "b", "@hourly"
+	jobC.Name, jobC.Schedule, jobC.Priority = "c", "@hourly", 10
+
+	sc := NewScheduler(&TestLogger{})
+	sc.MaxConcurrentRuns = 1
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	for _, j := range []Job{jobA, jobB, jobC} {
+		go (&jobWrapper{sc, j, TriggerScheduled}).Run()
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Running(), Equals, int32(0))
+	c.Assert(jobC.Running(), Equals, int32(1))
+
+	time.Sleep(time.Millisecond * 600)
+	sc.Stop()
+
+	c.Assert(jobB.Called, Equals, 1)
+	c.Assert(jobC.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestRunOnStart(c *C) {
+	jobA, jobB, jobC := &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobA.RunOnStart = "a", true
+	jobB.Name, jobB.Schedule = "b", "@hourly"
+	jobC.Name, jobC.RunOnStart, jobC.Enabled = "c", true, "false"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.AddJob(jobC), IsNil)
+	c.Assert(sc.cron.Entries(), HasLen, 1)
+
+	c.Assert(sc.Start(), IsNil)
+	sc.Stop()
+
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Called, Equals, 0)
+	c.Assert(jobC.Called, Equals, 0)
+	c.Assert(sc.History("a"), HasLen, 1)
+	c.Assert(sc.History("a")[0].Trigger, Equals, TriggerOnStart)
+}
+
+func (s *SuiteScheduler) TestRunOnStartDelay(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Name, jobA.RunOnStart = "a", true
+	jobB.Name, jobB.RunOnStart = "b", true
+	jobB.StartDelay = Duration(time.Millisecond * 600)
+
+	sc := NewScheduler(&TestLogger{})
+	sc.StartupDelay = time.Millisecond * 300
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	time.Sleep(time.Millisecond * 100)
+	c.Assert(jobA.Called, Equals, 0)
+	c.Assert(jobB.Called, Equals, 0)
+
+	time.Sleep(time.Millisecond * 400)
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Called, Equals, 0)
+
+	time.Sleep(time.Millisecond * 300)
+	sc.Stop()
+	c.Assert(jobB.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestExcludedDate(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.ExcludeDates = []string{time.Now().Format(CalendarDateFormat)}
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	(&jobWrapper{sc, job, TriggerScheduled}).Run()
+	sc.Stop()
+
+	c.Assert(job.Called, Equals, 0)
+
+	history := sc.History("foo")
+	c.Assert(history, HasLen, 1)
+	c.Assert(history[0].Status, Equals, StatusSkipped)
+}
+
+func (s *SuiteScheduler) TestSkipIfExists(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.SkipIfExists = c.MkDir()
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+
+	(&jobWrapper{sc, job, TriggerScheduled}).Run()
+	sc.Stop()
+
+	c.Assert(job.Called, Equals, 0)
+
+	history := sc.History("foo")
+	c.Assert(history, HasLen, 1)
+	c.Assert(history[0].Status, Equals, StatusSkipped)
+}
+
+func (s *SuiteScheduler) TestFailureThreshold(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.FailureThreshold = 2
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	defer sc.Stop()
+
+	sc.trackFailures(job, &Execution{Failed: true})
+	sc.trackFailures(job, &Execution{Skipped: true})
+	c.Assert(sc.IsTripped("foo"), Equals, false)
+	c.Assert(sc.ConsecutiveFailures("foo"), Equals, 1)
+
+	sc.trackFailures(job, &Execution{Failed: true})
+	c.Assert(sc.IsTripped("foo"), Equals, true)
+
+	(&jobWrapper{sc, job, TriggerScheduled}).Run()
+	c.Assert(job.Called, Equals, 0)
+
+	sc.Reset("foo")
+	c.Assert(sc.IsTripped("foo"), Equals, false)
+	c.Assert(sc.ConsecutiveFailures("foo"), Equals, 0)
+
+	(&jobWrapper{sc, job, TriggerScheduled}).Run()
+	c.Assert(job.Called, Equals, 1)
+}
+
+func (s *SuiteScheduler) TestFailureThresholdTriggerSuccess(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+	job.FailureThreshold = 1
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+	c.Assert(sc.Start(), IsNil)
+	defer sc.Stop()
+
+	sc.trackFailures(job, &Execution{Failed: true})
+	c.Assert(sc.IsTripped("foo"), Equals, true)
+
+	// a successful execution triggered on demand resets the job
+	_, err := sc.Trigger(job, TriggerAPI)
+	c.Assert(err, IsNil)
+	c.Assert(job.Called, Equals, 1)
+	c.Assert(sc.IsTripped("foo"), Equals, false)
+}
+
+func (s *SuiteScheduler) TestFailureThresholdDisabled(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	for i := 0; i < 50; i++ {
+		sc.trackFailures(job, &Execution{Failed: true})
+	}
+
+	c.Assert(sc.IsTripped("foo"), Equals, false)
+	c.Assert(sc.ConsecutiveFailures("foo"), Equals, 50)
+}
+
+func (s *SuiteScheduler) TestAddJobInvalidCalendar(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+	job.OnlyDates = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), NotNil)
+}
+
+func (s *SuiteScheduler) TestTrigger(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(job), IsNil)
+
+	_, err := sc.Trigger(job, TriggerAPI)
+	c.Assert(err, Equals, ErrNotRunning)
+	c.Assert(job.Called, Equals, 0)
+
+	c.Assert(sc.Start(), IsNil)
+	e, err := sc.Trigger(job, TriggerAPI)
+	c.Assert(err, IsNil)
+	c.Assert(e.TriggerSource, Equals, TriggerAPI)
+	c.Assert(e.IsRunning, Equals, false)
+	c.Assert(e.Failed, Equals, false)
+	c.Assert(job.Called, Equals, 1)
+
+	sc.Stop()
 }
 
 func (s *SuiteScheduler) TestMergeMiddlewaresSame(c *C) {
@@ -64,3 +341,275 @@ func (s *SuiteScheduler) TestMergeMiddlewaresSame(c *C) {
 	c.Assert(m, HasLen, 1)
 	c.Assert(m[0], Equals, mB)
 }
+
+func (s *SuiteScheduler) TestAddJobDependsOnWithoutSchedule(c *C) {
+	job := &TestJob{}
+	job.DependsOn = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	err := sc.AddJob(job)
+	c.Assert(err, IsNil)
+	c.Assert(sc.Jobs, HasLen, 1)
+	c.Assert(sc.cron.Entries(), HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestStartUnknownDependency(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.DependsOn = "bar"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+
+	c.Assert(sc.Start(), ErrorMatches, ".*depends on \"bar\"")
+}
+
+func (s *SuiteScheduler) TestStartDependencyCycle(c *C) {
+	jobA := &TestJob{}
+	jobA.Name = "foo"
+	jobA.DependsOn = "bar"
+
+	jobB := &TestJob{}
+	jobB.Name = "bar"
+	jobB.DependsOn = "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(jobA)
+	sc.AddJob(jobB)
+
+	c.Assert(sc.Start(), Equals, ErrDependencyCycle)
+}
+
+func (s *SuiteScheduler) TestJobDone(c *C) {
+	jobA, jobB, jobC := &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "foo", "@hourly"
+	jobB.Name, jobB.Schedule = "bar", "@hourly"
+	jobC.Name, jobC.DependsOn = "qux", "foo, bar"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(jobA)
+	sc.AddJob(jobB)
+	sc.AddJob(jobC)
+	c.Assert(sc.Start(), IsNil)
+
+	sc.jobDone(jobA, &Execution{})
+	sc.wg.Wait()
+	c.Assert(jobC.Called, Equals, 0)
+
+	sc.jobDone(jobB, &Execution{})
+	sc.wg.Wait()
+	c.Assert(jobC.Called, Equals, 1)
+	c.Assert(sc.History("qux")[0].Trigger, Equals, TriggerDependency)
+
+	sc.Stop()
+}
+
+func (s *SuiteScheduler) TestJobDoneFailed(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "foo", "@hourly"
+	jobB.Name, jobB.DependsOn = "bar", "foo"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(jobA)
+	sc.AddJob(jobB)
+	c.Assert(sc.Start(), IsNil)
+
+	sc.jobDone(jobA, &Execution{Failed: true})
+	sc.wg.Wait()
+	c.Assert(jobB.Called, Equals, 0)
+
+	h := jobB.History()
+	c.Assert(h, HasLen, 1)
+	c.Assert(h[0].Skipped, Equals, true)
+
+	sc.Stop()
+}
+
+func (s *SuiteScheduler) TestGetJob(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+
+	c.Assert(sc.GetJob("foo"), Equals, job)
+	c.Assert(sc.GetJob("bar"), IsNil)
+}
+
+func (s *SuiteScheduler) TestRunJob(c *C) {
+	m := &TestMiddleware{}
+
+	job := &TestJob{}
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.Use(m)
+	sc.AddJob(job)
+
+	e := NewExecution()
+	sc.RunJob(job, e)
+
+	c.Assert(sc.IsRunning(), Equals, false)
+	c.Assert(job.Called, Equals, 0)
+	c.Assert(m.Called, Equals, 1)
+	c.Assert(e.IsRunning, Equals, false)
+	c.Assert(job.History(), HasLen, 1)
+
+	h := sc.History(job.GetName())
+	c.Assert(h, HasLen, 1)
+	c.Assert(h[0].ID, Equals, e.ID)
+	c.Assert(h[0].Status, Equals, StatusSuccessful)
+	c.Assert(h[0].Trigger, Equals, TriggerManual)
+}
+
+func (s *SuiteScheduler) TestShutdown(c *C) {
+	job := &TestJob{}
+	job.Schedule = "@every 1s"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+	sc.Start()
+
+	time.Sleep(time.Millisecond * 1200)
+
+	err := sc.Shutdown(time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(sc.IsRunning(), Equals, false)
+
+	h := job.History()
+	c.Assert(h, HasLen, 1)
+	c.Assert(h[0].IsRunning, Equals, false)
+	c.Assert(h[0].Failed, Equals, false)
+}
+
+func (s *SuiteScheduler) TestShutdownCancel(c *C) {
+	job := &LocalJob{}
+	job.Schedule = "@every 1s"
+	job.Command = "sleep 10"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+	sc.Start()
+
+	time.Sleep(time.Millisecond * 1200)
+
+	err := sc.Shutdown(time.Millisecond * 100)
+	c.Assert(err, IsNil)
+
+	h := job.History()
+	c.Assert(h, HasLen, 1)
+	c.Assert(h[0].Error, Equals, ErrCancelled)
+}
+
+func (s *SuiteScheduler) TestCancel(c *C) {
+	job := &LocalJob{}
+	job.Name = "foo"
+	job.Command = "sleep 10"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+
+	e := NewExecution()
+	done := make(chan struct{})
+	go func() {
+		sc.RunJob(job, e)
+		close(done)
+	}()
+
+	time.Sleep(time.Millisecond * 200)
+
+	running := sc.Running()
+	c.Assert(running, HasLen, 1)
+	c.Assert(running[0].Job, Equals, "foo")
+	c.Assert(running[0].ID, Equals, e.ID)
+
+	c.Assert(sc.Cancel("missing"), Equals, false)
+	c.Assert(sc.Cancel(e.ID), Equals, true)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		c.Fatal("the execution was not cancelled")
+	}
+
+	c.Assert(e.Error, Equals, ErrCancelled)
+	c.Assert(sc.Running(), HasLen, 0)
+}
+
+func (s *SuiteScheduler) TestNextRun(c *C) {
+	job := &TestJob{}
+	job.Name = "foo"
+	job.Schedule = "@hourly"
+
+	sc := NewScheduler(&TestLogger{})
+	sc.AddJob(job)
+	sc.Start()
+	defer sc.Stop()
+
+	next, ok := sc.NextRun("foo")
+	c.Assert(ok, Equals, true)
+	c.Assert(next.After(time.Now()), Equals, true)
+
+	_, ok = sc.NextRun("bar")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *SuiteScheduler) TestRunOnce(c *C) {
+	jobA, jobB, jobC, jobD := &TestJob{}, &TestJob{}, &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "a", "20 10 * * *"
+	jobB.Name, jobB.Schedule = "b", "30 10 * * *"
+	jobC.Name, jobC.DependsOn = "c", "a"
+	jobD.Name, jobD.Schedule, jobD.Enabled = "d", "20 10 * * *", "false"
+
+	sc := NewScheduler(&TestLogger{})
+	for _, j := range []Job{jobA, jobB, jobC, jobD} {
+		c.Assert(sc.AddJob(j), IsNil)
+	}
+
+	failed, err := sc.RunOnce(time.Date(2017, 3, 1, 10, 20, 45, 0, time.UTC), false)
+	c.Assert(err, IsNil)
+	c.Assert(failed, HasLen, 0)
+	c.Assert(sc.IsRunning(), Equals, false)
+
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Called, Equals, 0)
+	c.Assert(jobC.Called, Equals, 1)
+	c.Assert(jobD.Called, Equals, 0)
+	c.Assert(sc.History("a")[0].Trigger, Equals, TriggerScheduled)
+}
+
+func (s *SuiteScheduler) TestRunOnceAll(c *C) {
+	jobA, jobB := &TestJob{}, &TestJob{}
+	jobA.Name, jobA.Schedule = "a", "20 10 * * *"
+	jobB.Name, jobB.Schedule = "b", "30 10 * * *"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+
+	_, err := sc.RunOnce(time.Date(2017, 3, 1, 10, 20, 45, 0, time.UTC), true)
+	c.Assert(err, IsNil)
+	c.Assert(jobA.Called, Equals, 1)
+	c.Assert(jobB.Called, Equals, 1)
+	c.Assert(sc.History("b")[0].Trigger, Equals, TriggerManual)
+}
+
+func (s *SuiteScheduler) TestRunOnceFailed(c *C) {
+	jobA, jobB := &TestJob{}, &LocalJob{}
+	jobA.Name, jobA.Schedule = "a", "@hourly"
+	jobB.Name, jobB.Schedule, jobB.Command = "b", "@hourly", "false"
+
+	sc := NewScheduler(&TestLogger{})
+	c.Assert(sc.AddJob(jobA), IsNil)
+	c.Assert(sc.AddJob(jobB), IsNil)
+
+	failed, err := sc.RunOnce(time.Now(), true)
+	c.Assert(err, IsNil)
+	c.Assert(failed, DeepEquals, []string{"b"})
+}
+
+func (s *SuiteScheduler) TestRunOnceEmpty(c *C) {
+	_, err := NewScheduler(&TestLogger{}).RunOnce(time.Now(), true)
+	c.Assert(err, Equals, ErrEmptyScheduler)
+}
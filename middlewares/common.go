@@ -1,6 +1,14 @@
 package middlewares
 
-import "reflect"
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Postcon/ofelia/core"
+)
 
 func IsEmpty(i interface{}) bool {
 	t := reflect.TypeOf(i).Elem()
@@ -8,3 +16,87 @@ func IsEmpty(i interface{}) bool {
 
 	return reflect.DeepEqual(i, e)
 }
+
+func executionLabel(e *core.Execution) string {
+	status := "successful"
+	if e.Skipped {
+		status = "skipped"
+	} else if e.Failed {
+		status = "failed"
+	}
+
+	return status
+}
+
+// shouldNotify returns true if a notifier reports the given execution, the
+// suppressed and the cancelled executions are never reported and the ones
+// with a note, eg. a recovery, are reported even if the notifier reports only
+// the errors.
+func shouldNotify(e *core.Execution, onlyOnError bool) bool {
+	switch {
+	case e.Suppressed, e.Cancelled:
+		return false
+	case e.Failed, e.Note != "":
+		return true
+	}
+
+	return !onlyOnError
+}
+
+// executionColor returns the color used by the chat middlewares to report the
+// status of an execution
+func executionColor(e *core.Execution) string {
+	color := "#7CD197"
+	if e.Failed {
+		color = "#F35A00"
+	} else if e.Skipped {
+		color = "#FFA500"
+	}
+
+	return color
+}
+
+// executionFooter returns the ID of the execution as reported by the
+// notifiers, the same ID of the save files, the logs and the status API, so
+// a notification can be correlated with them.
+func executionFooter(e *core.Execution) string {
+	return "Execution " + e.ID
+}
+
+// outputTail returns the last given lines of the output, up to the given bytes,
+// the lines beyond them are cut at the start, marked with an ellipsis.
+func outputTail(output []byte, lines, max int) string {
+	s := strings.TrimRight(string(output), "\r\n")
+	if s == "" {
+		return ""
+	}
+
+	parts := strings.Split(s, "\n")
+	if len(parts) > lines {
+		parts = parts[len(parts)-lines:]
+	}
+
+	tail := strings.Join(parts, "\n")
+	if len(tail) <= max {
+		return tail
+	}
+
+	// the cut shouldn't split a multi-byte character
+	cut := len(tail) - max
+	for cut < len(tail) && !utf8.RuneStart(tail[cut]) {
+		cut++
+	}
+
+	return "…" + tail[cut:]
+}
+
+// streamBytes returns the content of the stream, without consuming it when
+// possible, so other middlewares can still read it.
+func streamBytes(s io.ReadWriter) []byte {
+	if b, ok := s.(interface{ Bytes() []byte }); ok {
+		return b.Bytes()
+	}
+
+	content, _ := ioutil.ReadAll(s)
+	return content
+}
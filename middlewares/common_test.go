@@ -1,6 +1,11 @@
 package middlewares
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"github.com/Postcon/ofelia/core"
@@ -27,6 +32,15 @@ func (s *SuiteCommon) TestIsEmpty(c *C) {
 	c.Assert(IsEmpty(config), Equals, false)
 }
 
+func (s *SuiteCommon) TestShouldNotify(c *C) {
+	c.Assert(shouldNotify(&core.Execution{}, false), Equals, true)
+	c.Assert(shouldNotify(&core.Execution{}, true), Equals, false)
+	c.Assert(shouldNotify(&core.Execution{Failed: true}, true), Equals, true)
+	c.Assert(shouldNotify(&core.Execution{Note: "foo"}, true), Equals, true)
+	c.Assert(shouldNotify(&core.Execution{Failed: true, Suppressed: true}, false), Equals, false)
+	c.Assert(shouldNotify(&core.Execution{Failed: true, Cancelled: true}, false), Equals, false)
+}
+
 type BaseSuite struct {
 	ctx *core.Context
 	job *TestJob
@@ -40,6 +54,61 @@ func (s *BaseSuite) SetUpTest(c *C) {
 	s.ctx = core.NewContext(sh, s.job, e)
 }
 
+// finishExecution starts and stops the execution of the context with the given
+// error, as the scheduler does, nil for a successful execution, any error for
+// a failed one and core.ErrSkippedExecution for a skipped one.
+func (s *BaseSuite) finishExecution(err error) {
+	s.ctx.Start()
+	s.ctx.Stop(err)
+}
+
+// TestServer is a fake HTTP server recording every request received, allowing
+// to assert the payloads sent by the notification middlewares.
+type TestServer struct {
+	*httptest.Server
+	Status int
+
+	mu       sync.Mutex
+	requests []*TestRequest
+}
+
+// TestRequest is a request received by a TestServer, the body is already read
+// so the form values are parsed from it.
+type TestRequest struct {
+	*http.Request
+	Body []byte
+}
+
+// NewTestServer returns a running TestServer replying with a 200 status code,
+// it should be closed after the test.
+func NewTestServer() *TestServer {
+	ts := &TestServer{Status: http.StatusOK}
+	ts.Server = httptest.NewServer(http.HandlerFunc(ts.handle))
+
+	return ts
+}
+
+func (ts *TestServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ParseForm()
+
+	ts.mu.Lock()
+	ts.requests = append(ts.requests, &TestRequest{Request: r, Body: body})
+	status := ts.Status
+	ts.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+// Requests returns the requests received so far, in order.
+func (ts *TestServer) Requests() []*TestRequest {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return append([]*TestRequest(nil), ts.requests...)
+}
+
 type TestConfig struct {
 	Foo string
 	Qux int
@@ -61,3 +130,12 @@ func (*TestLogger) Debugf(format string, args ...interface{})    {}
 func (*TestLogger) Errorf(format string, args ...interface{})    {}
 func (*TestLogger) Noticef(format string, args ...interface{})   {}
 func (*TestLogger) Warningf(format string, args ...interface{})  {}
+
+func (s *SuiteCommon) TestOutputTail(c *C) {
+	c.Assert(outputTail(nil, 20, 100), Equals, "")
+	c.Assert(outputTail([]byte("\n"), 20, 100), Equals, "")
+	c.Assert(outputTail([]byte("foo\nbar\nbaz\n"), 2, 100), Equals, "bar\nbaz")
+	c.Assert(outputTail([]byte("foo\nbar\n"), 20, 100), Equals, "foo\nbar")
+	c.Assert(outputTail([]byte("foo bar"), 20, 3), Equals, "…bar")
+	c.Assert(outputTail([]byte("foo ñu"), 20, 2), Equals, "…u")
+}
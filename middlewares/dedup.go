@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// DedupConfig configuration for the Dedup middleware
+type DedupConfig struct {
+	DedupWindow core.Duration `gcfg:"dedup-window"`
+}
+
+// NewDedup returns a Dedup middleware if the given configuration is not empty
+func NewDedup(c *DedupConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Dedup{DedupConfig: *c, failures: make(map[string]*dedupFailure, 0)}
+	}
+
+	return m
+}
+
+// Dedup middleware suppresses the notifications of the repeated failures of
+// a job, a failure with the same error than the last one notified is not
+// reported until the dedup-window expires, then a single "still failing"
+// notification is sent. The first success after a failure is always reported
+// as a recovery.
+type Dedup struct {
+	DedupConfig
+
+	mu       sync.Mutex
+	failures map[string]*dedupFailure
+}
+
+type dedupFailure struct {
+	err        string
+	count      int
+	notifiedAt time.Time
+}
+
+// ContinueOnStop returns false, the skipped executions don't change the state
+// of the job
+func (m *Dedup) ContinueOnStop() bool {
+	return false
+}
+
+// Priority returns MiddlewarePriorityReport, the notifiers wrap the Dedup
+// middleware so they know if the execution was suppressed.
+func (m *Dedup) Priority() int {
+	return core.MiddlewarePriorityReport
+}
+
+// Run stops the execution and decides how it is notified, the state is kept
+// by job name, so a global Dedup tracks every job on its own.
+func (m *Dedup) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if !ctx.Execution.Skipped {
+		m.track(ctx.Job.GetName(), ctx.Execution, time.Now())
+	}
+
+	return err
+}
+
+func (m *Dedup) track(name string, e *core.Execution, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.failures[name]
+	if !e.Failed {
+		if ok {
+			e.Note = fmt.Sprintf("recovered after %d failures", f.count)
+			if f.count == 1 {
+				e.Note = "recovered after 1 failure"
+			}
+
+			delete(m.failures, name)
+		}
+
+		return
+	}
+
+	if !ok || f.err != e.Error.Error() {
+		m.failures[name] = &dedupFailure{err: e.Error.Error(), count: 1, notifiedAt: now}
+		return
+	}
+
+	f.count++
+	if now.Sub(f.notifiedAt) < time.Duration(m.DedupWindow) {
+		e.Suppressed = true
+		return
+	}
+
+	e.Note = fmt.Sprintf("still failing (%d times)", f.count)
+	f.notifiedAt = now
+}
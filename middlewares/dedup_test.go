@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteDedup struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteDedup{})
+
+func (s *SuiteDedup) TestNewDedupEmpty(c *C) {
+	c.Assert(NewDedup(&DedupConfig{}), IsNil)
+}
+
+func (s *SuiteDedup) TestRunFailed(c *C) {
+	s.finishExecution(errors.New("foo"))
+
+	m := NewDedup(&DedupConfig{DedupWindow: core.Duration(time.Hour)})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Suppressed, Equals, false)
+	c.Assert(s.ctx.Execution.Note, Equals, "")
+}
+
+func (s *SuiteDedup) TestTrack(c *C) {
+	m := NewDedup(&DedupConfig{DedupWindow: core.Duration(time.Hour)}).(*Dedup)
+	now := time.Now()
+
+	e := s.track(m, errors.New("foo"), now)
+	c.Assert(e.Suppressed, Equals, false)
+
+	e = s.track(m, errors.New("foo"), now.Add(5*time.Minute))
+	c.Assert(e.Suppressed, Equals, true)
+
+	e = s.track(m, errors.New("foo"), now.Add(10*time.Minute))
+	c.Assert(e.Suppressed, Equals, true)
+
+	e = s.track(m, errors.New("foo"), now.Add(time.Hour))
+	c.Assert(e.Suppressed, Equals, false)
+	c.Assert(e.Note, Equals, "still failing (4 times)")
+
+	e = s.track(m, errors.New("foo"), now.Add(65*time.Minute))
+	c.Assert(e.Suppressed, Equals, true)
+
+	e = s.track(m, nil, now.Add(70*time.Minute))
+	c.Assert(e.Suppressed, Equals, false)
+	c.Assert(e.Note, Equals, "recovered after 5 failures")
+
+	e = s.track(m, nil, now.Add(75*time.Minute))
+	c.Assert(e.Note, Equals, "")
+}
+
+func (s *SuiteDedup) TestTrackDifferentError(c *C) {
+	m := NewDedup(&DedupConfig{DedupWindow: core.Duration(time.Hour)}).(*Dedup)
+	now := time.Now()
+
+	s.track(m, errors.New("foo"), now)
+	e := s.track(m, errors.New("bar"), now.Add(time.Minute))
+	c.Assert(e.Suppressed, Equals, false)
+	c.Assert(e.Note, Equals, "")
+
+	e = s.track(m, nil, now.Add(2*time.Minute))
+	c.Assert(e.Note, Equals, "recovered after 1 failure")
+}
+
+func (s *SuiteDedup) TestTrackByJob(c *C) {
+	m := NewDedup(&DedupConfig{DedupWindow: core.Duration(time.Hour)}).(*Dedup)
+	now := time.Now()
+
+	m.track("foo", &core.Execution{Failed: true, Error: errors.New("qux")}, now)
+
+	e := &core.Execution{Failed: true, Error: errors.New("qux")}
+	m.track("bar", e, now)
+	c.Assert(e.Suppressed, Equals, false)
+}
+
+func (s *SuiteDedup) track(m *Dedup, err error, t time.Time) *core.Execution {
+	e := &core.Execution{Failed: err != nil, Error: err}
+	m.track("foo", e, t)
+
+	return e
+}
@@ -0,0 +1,149 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+const defaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubConfig configuration for the GitHub middleware
+type GitHubConfig struct {
+	GitHubToken     string `gcfg:"github-token"`
+	GitHubTokenFile string `gcfg:"github-token-file"`
+	GitHubRepo      string `gcfg:"github-repo"`
+	GitHubSHA       string `gcfg:"github-sha"`
+	GitHubSHAEnv    string `gcfg:"github-sha-env"`
+	GitHubContext   string `gcfg:"github-context"`
+	GitHubAPIURL    string `gcfg:"github-api-url"`
+}
+
+// NewGitHub returns a GitHub middleware if the given configuration is not
+// empty
+func NewGitHub(c *GitHubConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &GitHub{*c}
+	}
+
+	return m
+}
+
+// GitHub middleware posts the status of every execution of a job as a commit
+// status of a GitHub repository, pending when it starts and success or failure
+// when it finishes, eg. reporting a deploy verification job to its PR.
+type GitHub struct {
+	GitHubConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *GitHub) ContinueOnStop() bool {
+	return true
+}
+
+// Run posts the pending status, and the final one once the execution finishes,
+// its close stop the exection to collect the metrics. The skipped executions
+// don't change the status of the commit.
+func (m *GitHub) Run(ctx *core.Context) error {
+	sha := m.sha()
+	if sha == "" {
+		ctx.Logger.Warningf("GitHub no commit SHA for job %q, the status is not reported", ctx.Job.GetName())
+		return ctx.Next()
+	}
+
+	if ctx.Execution.IsRunning {
+		m.pushStatus(ctx, sha, "pending", "Running")
+	}
+
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.Skipped {
+		return err
+	}
+
+	state, description := "success", fmt.Sprintf("Successful in %s", ctx.Execution.Duration)
+	if ctx.Execution.Failed {
+		state, description = "failure", fmt.Sprintf("Failed in %s: %s", ctx.Execution.Duration, ctx.Execution.Error)
+	}
+
+	m.pushStatus(ctx, sha, state, description)
+	return err
+}
+
+// sha returns the commit of the status, github-sha or the value of the
+// environment variable given at github-sha-env, read on every execution
+func (m *GitHub) sha() string {
+	if m.GitHubSHA != "" {
+		return m.GitHubSHA
+	}
+
+	if m.GitHubSHAEnv != "" {
+		return strings.TrimSpace(os.Getenv(m.GitHubSHAEnv))
+	}
+
+	return ""
+}
+
+type gitHubStatus struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+// gitHubMaxDescription is the longest description accepted by GitHub
+const gitHubMaxDescription = 140
+
+func (m *GitHub) pushStatus(ctx *core.Context, sha, state, description string) {
+	if len(description) > gitHubMaxDescription {
+		description = description[:gitHubMaxDescription-3] + "..."
+	}
+
+	statusContext := m.GitHubContext
+	if statusContext == "" {
+		statusContext = "ofelia/" + ctx.Job.GetName()
+	}
+
+	content, _ := json.Marshal(&gitHubStatus{
+		State:       state,
+		Description: description,
+		Context:     statusContext,
+	})
+
+	url := m.statusURL(sha)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("GitHub error building request to %q error: %q", url, err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+m.GitHubToken)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("GitHub error calling %q error: %q", url, err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusCreated {
+		ctx.Logger.Errorf("GitHub error non-201 status code calling %q: %d", url, r.StatusCode)
+	}
+}
+
+func (m *GitHub) statusURL(sha string) string {
+	api := m.GitHubAPIURL
+	if api == "" {
+		api = defaultGitHubAPIURL
+	}
+
+	return fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(api, "/"), m.GitHubRepo, sha)
+}
@@ -0,0 +1,106 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteGitHub struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteGitHub{})
+
+func (s *SuiteGitHub) TestNewGitHubEmpty(c *C) {
+	c.Assert(NewGitHub(&GitHubConfig{}), IsNil)
+}
+
+func (s *SuiteGitHub) TestRun(c *C) {
+	ts := NewTestServer()
+	ts.Status = http.StatusCreated
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+
+	m := NewGitHub(&GitHubConfig{
+		GitHubToken:  "qux",
+		GitHubRepo:   "company/app",
+		GitHubSHA:    "abc123",
+		GitHubAPIURL: ts.URL + "/",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	statuses := s.statuses(c, ts)
+	c.Assert(statuses, HasLen, 2)
+	c.Assert(statuses[0].State, Equals, "pending")
+	c.Assert(statuses[0].Context, Equals, "ofelia/foo")
+	c.Assert(statuses[1].State, Equals, "success")
+}
+
+func (s *SuiteGitHub) TestRunFailed(c *C) {
+	ts := NewTestServer()
+	ts.Status = http.StatusCreated
+	defer ts.Close()
+
+	s.finishExecution(errors.New("foo"))
+
+	m := NewGitHub(&GitHubConfig{
+		GitHubRepo:    "company/app",
+		GitHubSHA:     "abc123",
+		GitHubContext: "deploy/verify",
+		GitHubAPIURL:  ts.URL,
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	statuses := s.statuses(c, ts)
+	c.Assert(statuses, HasLen, 1)
+	c.Assert(statuses[0].State, Equals, "failure")
+	c.Assert(statuses[0].Context, Equals, "deploy/verify")
+	c.Assert(statuses[0].Description, Matches, "Failed in .*: foo")
+}
+
+func (s *SuiteGitHub) TestRunSkipped(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(core.ErrSkippedExecution)
+
+	m := NewGitHub(&GitHubConfig{GitHubRepo: "company/app", GitHubSHA: "abc123", GitHubAPIURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteGitHub) TestSHAEnv(c *C) {
+	os.Setenv("OFELIA_TEST_SHA", "def456\n")
+	defer os.Unsetenv("OFELIA_TEST_SHA")
+
+	m := &GitHub{GitHubConfig{GitHubSHAEnv: "OFELIA_TEST_SHA"}}
+	c.Assert(m.sha(), Equals, "def456")
+
+	m.GitHubSHA = "abc123"
+	c.Assert(m.sha(), Equals, "abc123")
+}
+
+// statuses decodes the commit statuses received by the given server
+func (s *SuiteGitHub) statuses(c *C, ts *TestServer) []*gitHubStatus {
+	var statuses []*gitHubStatus
+	for _, r := range ts.Requests() {
+		c.Assert(r.Method, Equals, "POST")
+		c.Assert(r.URL.Path, Equals, "/repos/company/app/statuses/abc123")
+
+		status := &gitHubStatus{}
+		c.Assert(json.Unmarshal(r.Body, status), IsNil)
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/Postcon/ofelia/core"
+	"github.com/gobs/args"
+)
+
+// HooksConfig configuration for the Hooks middleware
+type HooksConfig struct {
+	BeforeCommand string `gcfg:"before-command"`
+	AfterCommand  string `gcfg:"after-command"`
+}
+
+// NewHooks returns a Hooks middleware if the given configuration is not empty
+func NewHooks(c *HooksConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Hooks{*c}
+	}
+
+	return m
+}
+
+// Hooks middleware runs a command, at the host as a job-local does, before
+// and after every execution of a job. A failed before-command aborts the
+// execution, the after-command always runs, even if the execution failed.
+type Hooks struct {
+	HooksConfig
+}
+
+// ContinueOnStop returns false, the hooks don't run for skipped executions
+func (m *Hooks) ContinueOnStop() bool {
+	return false
+}
+
+// Priority returns MiddlewarePriorityExecution, the hooks wrap the job itself
+// so the notifiers report the failures of the hooks.
+func (m *Hooks) Priority() int {
+	return core.MiddlewarePriorityExecution
+}
+
+// Run runs the before-command, the job and the after-command, the output of
+// the hooks is captured with the output of the job.
+func (m *Hooks) Run(ctx *core.Context) error {
+	if m.BeforeCommand != "" {
+		if err := m.runHook(ctx, m.BeforeCommand, nil); err != nil {
+			return fmt.Errorf("before-command failed: %s", err)
+		}
+	}
+
+	err := ctx.Next()
+
+	if m.AfterCommand != "" {
+		env := []string{fmt.Sprintf("OFELIA_EXECUTION_FAILED=%t", ctx.Execution.Failed)}
+		if herr := m.runHook(ctx, m.AfterCommand, env); herr != nil {
+			ctx.Logger.Errorf("%s - after-command failed: %s", ctx.Job.GetName(), herr)
+			if err == nil && !ctx.Execution.Failed {
+				err = fmt.Errorf("after-command failed: %s", herr)
+			}
+		}
+	}
+
+	return err
+}
+
+func (m *Hooks) runHook(ctx *core.Context, command string, env []string) error {
+	argv := args.GetArgs(command)
+	if len(argv) == 0 {
+		return core.ErrEmptyCommand
+	}
+
+	bin, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+
+	cmd := &exec.Cmd{
+		Path:   bin,
+		Args:   argv,
+		Stdout: ctx.Execution.OutputStream,
+		Stderr: ctx.Execution.ErrorStream,
+		Env: append(os.Environ(), append([]string{
+			"OFELIA_JOB_NAME=" + ctx.Job.GetName(),
+			"OFELIA_EXECUTION_ID=" + ctx.Execution.ID,
+		}, env...)...),
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	wait := make(chan error, 1)
+	go func() {
+		wait <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-wait:
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-wait
+		return core.ErrCancelled
+	}
+
+	return err
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"errors"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteHooks struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteHooks{})
+
+type failedJob struct {
+	TestJob
+}
+
+func (j *failedJob) Run(ctx *core.Context) error {
+	return errors.New("foo")
+}
+
+func (s *SuiteHooks) TestNewHooksEmpty(c *C) {
+	c.Assert(NewHooks(&HooksConfig{}), IsNil)
+}
+
+func (s *SuiteHooks) TestRun(c *C) {
+	m := NewHooks(&HooksConfig{
+		BeforeCommand: `sh -c "echo before $OFELIA_JOB_NAME"`,
+		AfterCommand:  `sh -c "echo after $OFELIA_EXECUTION_FAILED"`,
+	})
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.output(), Equals, "before foo\nafter false\n")
+}
+
+func (s *SuiteHooks) TestRunBeforeFailed(c *C) {
+	m := NewHooks(&HooksConfig{BeforeCommand: "false", AfterCommand: "echo after"})
+
+	s.ctx.Start()
+	err := m.Run(s.ctx)
+	c.Assert(err, ErrorMatches, "before-command failed: .*")
+	c.Assert(s.output(), Equals, "")
+}
+
+func (s *SuiteHooks) TestRunAfterOnFailure(c *C) {
+	m := NewHooks(&HooksConfig{AfterCommand: `sh -c "echo after $OFELIA_EXECUTION_FAILED"`})
+
+	s.ctx = core.NewContext(s.ctx.Scheduler, &failedJob{}, core.NewExecution())
+	s.ctx.Start()
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Error, ErrorMatches, "foo")
+	c.Assert(s.output(), Equals, "after true\n")
+}
+
+func (s *SuiteHooks) TestRunAfterFailed(c *C) {
+	m := NewHooks(&HooksConfig{AfterCommand: "false"})
+
+	s.ctx.Start()
+	c.Assert(m.Run(s.ctx), ErrorMatches, "after-command failed: .*")
+}
+
+func (s *SuiteHooks) output() string {
+	return string(streamBytes(s.ctx.Execution.OutputStream))
+}
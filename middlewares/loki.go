@@ -0,0 +1,163 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// LokiConfig configuration for the Loki middleware
+type LokiConfig struct {
+	LokiURL         string `gcfg:"loki-url"`
+	LokiLabels      string `gcfg:"loki-labels"`
+	LokiOnlyOnError bool   `gcfg:"loki-only-on-error"`
+}
+
+// NewLoki returns a Loki middleware if the given configuration is not empty
+func NewLoki(c *LokiConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Loki{*c}
+	}
+
+	return m
+}
+
+// Loki middleware pushes the output of every execution to a Grafana Loki push
+// endpoint, the lines of an execution are sent in a single push.
+type Loki struct {
+	LokiConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Loki) ContinueOnStop() bool {
+	return true
+}
+
+// Run pushes the output of the execution, its close stop the exection to
+// collect the metrics
+func (m *Loki) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.Failed || !m.LokiOnlyOnError {
+		if err := m.push(ctx); err != nil {
+			ctx.Logger.Errorf("Loki error pushing to %q: %q", m.LokiURL, err)
+		}
+	}
+
+	return err
+}
+
+func (m *Loki) push(ctx *core.Context) error {
+	req, err := m.buildRequest(ctx)
+	if err != nil || req == nil {
+		return err
+	}
+
+	content, _ := json.Marshal(req)
+	r, err := http.Post(m.LokiURL, "application/json", bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+// buildRequest returns the push request of the execution, with a stream for
+// the stdout and another for the stderr, nil if there is no output. The lines
+// carry no time of their own, so they are timestamped from the start of the
+// execution, a nanosecond apart, keeping the order Loki requires in a stream.
+func (m *Loki) buildRequest(ctx *core.Context) (*lokiPushRequest, error) {
+	labels, err := parseLokiLabels(m.LokiLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := ctx.Job.GetInstanceName()
+	if instance == "" {
+		instance = ctx.Job.GetName()
+	}
+
+	labels["job"] = ctx.Job.GetName()
+	labels["instance"] = instance
+	labels["status"] = executionLabel(ctx.Execution)
+
+	req := &lokiPushRequest{}
+	for _, output := range []struct {
+		name    string
+		content []byte
+	}{
+		{"stdout", streamBytes(ctx.Execution.OutputStream)},
+		{"stderr", streamBytes(ctx.Execution.ErrorStream)},
+	} {
+		values := lokiValues(ctx.Execution.StartedAt.UnixNano(), output.content)
+		if len(values) == 0 {
+			continue
+		}
+
+		stream := map[string]string{"stream": output.name}
+		for k, v := range labels {
+			stream[k] = v
+		}
+
+		req.Streams = append(req.Streams, lokiStream{Stream: stream, Values: values})
+	}
+
+	if len(req.Streams) == 0 {
+		return nil, nil
+	}
+
+	return req, nil
+}
+
+func lokiValues(start int64, content []byte) [][2]string {
+	var values [][2]string
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(nil, len(content)+1)
+	for i := int64(0); scanner.Scan(); i++ {
+		values = append(values, [2]string{strconv.FormatInt(start+i, 10), scanner.Text()})
+	}
+
+	return values
+}
+
+// parseLokiLabels parses the loki-labels option, eg. "env=prod,team=data"
+func parseLokiLabels(labels string) (map[string]string, error) {
+	parsed := make(map[string]string, 0)
+	for _, label := range strings.Split(labels, ",") {
+		if label = strings.TrimSpace(label); label == "" {
+			continue
+		}
+
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid loki-labels %q, expected key=value", label)
+		}
+
+		parsed[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return parsed, nil
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteLoki struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteLoki{})
+
+func (s *SuiteLoki) TestNewLokiEmpty(c *C) {
+	c.Assert(NewLoki(&LokiConfig{}), IsNil)
+}
+
+func (s *SuiteLoki) TestRun(c *C) {
+	ts := NewTestServer()
+	ts.Status = http.StatusNoContent
+	defer ts.Close()
+
+	s.job.Name = "backup"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("foo\nbar\n"))
+	s.ctx.Execution.ErrorStream.Write([]byte("qux"))
+	s.ctx.Stop(errors.New("baz"))
+	s.ctx.Execution.StartedAt = time.Unix(0, 1000)
+
+	m := NewLoki(&LokiConfig{LokiURL: ts.URL + "/loki/api/v1/push", LokiLabels: "env=prod, team = data"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	reqs := ts.Requests()
+	c.Assert(reqs, HasLen, 1)
+	c.Assert(reqs[0].URL.Path, Equals, "/loki/api/v1/push")
+	c.Assert(reqs[0].Header.Get("Content-Type"), Equals, "application/json")
+
+	push := &lokiPushRequest{}
+	c.Assert(json.Unmarshal(reqs[0].Body, push), IsNil)
+	c.Assert(push.Streams, HasLen, 2)
+	c.Assert(push.Streams[0].Stream, DeepEquals, map[string]string{
+		"job": "backup", "instance": "backup", "status": "failed",
+		"env": "prod", "team": "data", "stream": "stdout",
+	})
+
+	c.Assert(push.Streams[0].Values, DeepEquals, [][2]string{{"1000", "foo"}, {"1001", "bar"}})
+	c.Assert(push.Streams[1].Stream["stream"], Equals, "stderr")
+	c.Assert(push.Streams[1].Values, DeepEquals, [][2]string{{"1000", "qux"}})
+}
+
+func (s *SuiteLoki) TestRunNoOutput(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(nil)
+
+	m := NewLoki(&LokiConfig{LokiURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteLoki) TestRunOnlyOnError(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("foo"))
+	s.ctx.Stop(nil)
+
+	m := NewLoki(&LokiConfig{LokiURL: ts.URL, LokiOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteLoki) TestParseLokiLabels(c *C) {
+	labels, err := parseLokiLabels("env=prod,,team=")
+	c.Assert(err, IsNil)
+	c.Assert(labels, DeepEquals, map[string]string{"env": "prod", "team": ""})
+
+	_, err = parseLokiLabels("env")
+	c.Assert(err, NotNil)
+
+	_, err = parseLokiLabels("=prod")
+	c.Assert(err, NotNil)
+}
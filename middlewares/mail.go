@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -16,13 +17,17 @@ import (
 
 // MailConfig configuration for the Mail middleware
 type MailConfig struct {
-	SMTPHost        string `gcfg:"smtp-host"`
-	SMTPPort        int    `gcfg:"smtp-port"`
-	SMTPUser        string `gcfg:"smtp-user"`
-	SMTPPassword    string `gcfg:"smtp-password"`
-	EmailTo         string `gcfg:"email-to"`
-	EmailFrom       string `gcfg:"email-from"`
-	MailOnlyOnError bool   `gcfg:"mail-only-on-error"`
+	SMTPHost          string `gcfg:"smtp-host"`
+	SMTPPort          int    `gcfg:"smtp-port"`
+	SMTPUser          string `gcfg:"smtp-user"`
+	SMTPPassword      string `gcfg:"smtp-password"`
+	SMTPPasswordFile  string `gcfg:"smtp-password-file"`
+	SMTPSSL           bool   `gcfg:"smtp-ssl"`
+	SMTPTLSSkipVerify bool   `gcfg:"smtp-tls-skip-verify"`
+	EmailTo           string `gcfg:"email-to"`
+	EmailFrom         string `gcfg:"email-from"`
+	MailOnlyOnError   bool   `gcfg:"mail-only-on-error"`
+	MailSkipLogs      bool   `gcfg:"mail-skip-logs"`
 }
 
 // NewMail returns a Mail middleware if the given configuration is not empty
@@ -51,7 +56,7 @@ func (m *Mail) Run(ctx *core.Context) error {
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.MailOnlyOnError {
+	if shouldNotify(ctx.Execution, m.MailOnlyOnError) {
 		err := m.sendMail(ctx)
 		if err != nil {
 			ctx.Logger.Errorf("Mail error: %q", err)
@@ -68,14 +73,41 @@ func (m *Mail) sendMail(ctx *core.Context) error {
 	msg.SetHeader("Subject", m.subject(ctx))
 	msg.SetBody("text/html", m.body(ctx))
 
+	if !m.MailSkipLogs {
+		m.attachLogs(ctx, msg)
+	}
+
+	if err := m.dialer().DialAndSend(msg); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// dialer returns the dialer for the SMTP server, STARTTLS is used if the server
+// supports it, implicit TLS is used with smtp-ssl or when the port is 465.
+func (m *Mail) dialer() *gomail.Dialer {
+	d := gomail.NewDialer(m.SMTPHost, m.SMTPPort, m.SMTPUser, m.SMTPPassword)
+	if m.SMTPSSL {
+		d.SSL = true
+	}
+
+	if m.SMTPTLSSkipVerify {
+		d.TLSConfig = &tls.Config{InsecureSkipVerify: true, ServerName: m.SMTPHost}
+	}
+
+	return d
+}
+
+func (m *Mail) attachLogs(ctx *core.Context, msg *gomail.Message) {
 	base := fmt.Sprintf("%s_%s", ctx.Job.GetName(), ctx.Execution.ID)
 	msg.Attach(base+".stdout.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := io.Copy(w, ctx.Execution.OutputStream)
+		_, err := w.Write(streamBytes(ctx.Execution.OutputStream))
 		return err
 	}))
 
 	msg.Attach(base+".stderr.log", gomail.SetCopyFunc(func(w io.Writer) error {
-		_, err := io.Copy(w, ctx.Execution.ErrorStream)
+		_, err := w.Write(streamBytes(ctx.Execution.ErrorStream))
 		return err
 	}))
 
@@ -88,13 +120,6 @@ func (m *Mail) sendMail(ctx *core.Context) error {
 		_, err := w.Write(js)
 		return err
 	}))
-
-	d := gomail.NewPlainDialer(m.SMTPHost, m.SMTPPort, m.SMTPUser, m.SMTPPassword)
-	if err := d.DialAndSend(msg); err != nil {
-		return err
-	}
-
-	return nil
 }
 
 func (m *Mail) from() string {
@@ -138,20 +163,19 @@ func init() {
 			Execution <b>{{status .Execution}}</b> in ​<b>{{.Execution.Duration}}</b>​,
 			command: ​<pre>{{.Job.GetCommand}}</pre>​
 		</p>
+		{{if .Execution.Failed}}
+		<p>
+			Error: <pre>{{.Execution.Error}}</pre>
+		</p>
+		{{end}}
+		{{if .Execution.Note}}
+		<p>
+			<i>{{.Execution.Note}}</i>
+		</p>
+		{{end}}
   `))
 
 	template.Must(mailSubjectTemplate.Parse(
 		"[Execution {{status .Execution}}] Job {{.Job.GetName}} finished in {{.Execution.Duration}}",
 	))
 }
-
-func executionLabel(e *core.Execution) string {
-	status := "successful"
-	if e.Skipped {
-		status = "skipped"
-	} else if e.Failed {
-		status = "failed"
-	}
-
-	return status
-}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"net"
 	"strconv"
 	"strings"
@@ -51,6 +52,24 @@ func (s *MailSuite) TestNewSlackEmpty(c *C) {
 	c.Assert(NewMail(&MailConfig{}), IsNil)
 }
 
+func (s *MailSuite) TestBodyError(c *C) {
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := &Mail{}
+	c.Assert(strings.Contains(m.body(s.ctx), "Error: <pre>foo</pre>"), Equals, true)
+}
+
+func (s *MailSuite) TestDialer(c *C) {
+	m := &Mail{MailConfig{SMTPHost: "foo", SMTPPort: 587}}
+	c.Assert(m.dialer().SSL, Equals, false)
+	c.Assert(m.dialer().TLSConfig, IsNil)
+
+	m = &Mail{MailConfig{SMTPHost: "foo", SMTPPort: 2525, SMTPSSL: true, SMTPTLSSkipVerify: true}}
+	c.Assert(m.dialer().SSL, Equals, true)
+	c.Assert(m.dialer().TLSConfig.InsecureSkipVerify, Equals, true)
+}
+
 func (s *MailSuite) TestRunSuccess(c *C) {
 	s.ctx.Start()
 	s.ctx.Stop(nil)
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// MatrixConfig configuration for the Matrix middleware
+type MatrixConfig struct {
+	MatrixHomeserver  string `gcfg:"matrix-homeserver"`
+	MatrixToken       string `gcfg:"matrix-token"`
+	MatrixTokenFile   string `gcfg:"matrix-token-file"`
+	MatrixRoom        string `gcfg:"matrix-room"`
+	MatrixOnlyOnError bool   `gcfg:"matrix-only-on-error"`
+}
+
+// NewMatrix returns a Matrix middleware if the given configuration is not empty
+func NewMatrix(c *MatrixConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Matrix{*c}
+	}
+
+	return m
+}
+
+// Matrix middleware sends a message to a Matrix room after every execution of
+// a job
+type Matrix struct {
+	MatrixConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Matrix) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Matrix room, its close stop the exection to
+// collect the metrics
+func (m *Matrix) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx.Execution, m.MatrixOnlyOnError) {
+		m.pushMessage(ctx)
+	}
+
+	return err
+}
+
+func (m *Matrix) pushMessage(ctx *core.Context) {
+	content, _ := json.Marshal(m.buildMessage(ctx))
+
+	// the execution ID is used as transaction ID, so a retried request doesn't
+	// post the message twice
+	endpoint := fmt.Sprintf(
+		"%s/_matrix/client/r0/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(m.MatrixHomeserver, "/"),
+		url.PathEscape(m.MatrixRoom),
+		url.PathEscape(ctx.Execution.ID),
+	)
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Matrix error building request %q error: %q", endpoint, err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.MatrixToken)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("Matrix error calling %q error: %q", m.MatrixHomeserver, err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		ctx.Logger.Errorf("Matrix error non-200 status code calling %q", m.MatrixHomeserver)
+	}
+}
+
+func (m *Matrix) buildMessage(ctx *core.Context) *matrixMessage {
+	status := executionLabel(ctx.Execution)
+
+	msg := &matrixMessage{
+		MsgType: "m.text",
+		Format:  "org.matrix.custom.html",
+	}
+
+	msg.Body = fmt.Sprintf(
+		"Job %s finished in %s, execution %s",
+		ctx.Job.GetName(), ctx.Execution.Duration, status,
+	)
+
+	msg.FormattedBody = fmt.Sprintf(
+		"Job <b>%s</b> finished in <b>%s</b>, execution <font color=\"%s\">%s</font>",
+		html.EscapeString(ctx.Job.GetName()), ctx.Execution.Duration,
+		executionColor(ctx.Execution), status,
+	)
+
+	if ctx.Execution.Failed {
+		msg.Body += "\n" + ctx.Execution.Error.Error()
+		msg.FormattedBody += "<br><pre>" + html.EscapeString(ctx.Execution.Error.Error()) + "</pre>"
+	}
+
+	if n := ctx.Execution.Note; n != "" {
+		msg.Body += "\n" + n
+		msg.FormattedBody += "<br><i>" + html.EscapeString(n) + "</i>"
+	}
+
+	return msg
+}
+
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
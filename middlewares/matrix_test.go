@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMatrix struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteMatrix{})
+
+func (s *SuiteMatrix) TestNewMatrixEmpty(c *C) {
+	c.Assert(NewMatrix(&MatrixConfig{}), IsNil)
+}
+
+func (s *SuiteMatrix) TestRunSuccess(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Assert(r.Method, Equals, "PUT")
+		c.Assert(strings.HasPrefix(r.URL.Path, "/_matrix/client/r0/rooms/!foo:example.com/send/m.room.message/"), Equals, true)
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer bar")
+
+		var m matrixMessage
+		c.Assert(json.NewDecoder(r.Body).Decode(&m), IsNil)
+		c.Assert(m.MsgType, Equals, "m.text")
+		c.Assert(m.Format, Equals, "org.matrix.custom.html")
+		c.Assert(strings.Contains(m.FormattedBody, `<font color="#7CD197">successful</font>`), Equals, true)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewMatrix(&MatrixConfig{
+		MatrixHomeserver: ts.URL,
+		MatrixToken:      "bar",
+		MatrixRoom:       "!foo:example.com",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteMatrix) TestRunSuccessFailed(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m matrixMessage
+		c.Assert(json.NewDecoder(r.Body).Decode(&m), IsNil)
+		c.Assert(strings.HasSuffix(m.Body, "\nfoo"), Equals, true)
+		c.Assert(strings.Contains(m.FormattedBody, `<font color="#F35A00">failed</font>`), Equals, true)
+		c.Assert(strings.HasSuffix(m.FormattedBody, "<pre>foo</pre>"), Equals, true)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewMatrix(&MatrixConfig{MatrixHomeserver: ts.URL, MatrixRoom: "!foo:example.com"})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteMatrix) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewMatrix(&MatrixConfig{MatrixHomeserver: ts.URL, MatrixOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
@@ -0,0 +1,121 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var (
+	mattermostUsername  = "Ofelia"
+	mattermostIconEmoji = ":alarm_clock:"
+)
+
+// MattermostConfig configuration for the Mattermost middleware
+type MattermostConfig struct {
+	MattermostWebhook     string `gcfg:"mattermost-webhook"`
+	MattermostWebhookFile string `gcfg:"mattermost-webhook-file"`
+	MattermostChannel     string `gcfg:"mattermost-channel"`
+	MattermostOnlyOnError bool   `gcfg:"mattermost-only-on-error"`
+}
+
+// NewMattermost returns a Mattermost middleware if the given configuration is
+// not empty
+func NewMattermost(c *MattermostConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Mattermost{*c}
+	}
+
+	return m
+}
+
+// Mattermost middleware calls to a Mattermost incoming webhook after every
+// execution of a job
+type Mattermost struct {
+	MattermostConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Mattermost) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Mattermost channel, its close stop the exection
+// to collect the metrics
+func (m *Mattermost) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx.Execution, m.MattermostOnlyOnError) {
+		m.pushMessage(ctx)
+	}
+
+	return err
+}
+
+func (m *Mattermost) pushMessage(ctx *core.Context) {
+	content, _ := json.Marshal(m.buildMessage(ctx))
+
+	r, err := http.Post(m.MattermostWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Mattermost error calling %q error: %q", m.MattermostWebhook, err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		ctx.Logger.Errorf("Mattermost error non-200 status code calling %q", m.MattermostWebhook)
+	}
+}
+
+func (m *Mattermost) buildMessage(ctx *core.Context) *mattermostMessage {
+	msg := &mattermostMessage{
+		Username:  mattermostUsername,
+		IconEmoji: mattermostIconEmoji,
+		Channel:   m.MattermostChannel,
+	}
+
+	msg.Text = fmt.Sprintf(
+		"Job **%s** finished in **%s**\n```\n%s\n```",
+		ctx.Job.GetName(), ctx.Execution.Duration, ctx.Job.GetCommand(),
+	)
+
+	if n := ctx.Execution.Note; n != "" {
+		msg.Text += fmt.Sprintf("\n*%s*", n)
+	}
+
+	a := mattermostAttachment{
+		Title:  "Execution " + executionLabel(ctx.Execution),
+		Color:  executionColor(ctx.Execution),
+		Footer: executionFooter(ctx.Execution),
+	}
+
+	if ctx.Execution.Failed {
+		a.Text = ctx.Execution.Error.Error()
+	}
+
+	a.Fallback = fmt.Sprintf("Job %s: %s", ctx.Job.GetName(), a.Title)
+	msg.Attachments = append(msg.Attachments, a)
+
+	return msg
+}
+
+type mattermostMessage struct {
+	Text        string                 `json:"text"`
+	Username    string                 `json:"username"`
+	Channel     string                 `json:"channel,omitempty"`
+	IconEmoji   string                 `json:"icon_emoji"`
+	Attachments []mattermostAttachment `json:"attachments"`
+}
+
+type mattermostAttachment struct {
+	Fallback string `json:"fallback"`
+	Color    string `json:"color,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Text     string `json:"text"`
+	Footer   string `json:"footer,omitempty"`
+}
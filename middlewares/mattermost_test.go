@@ -0,0 +1,76 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMattermost struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteMattermost{})
+
+func (s *SuiteMattermost) TestNewMattermostEmpty(c *C) {
+	c.Assert(NewMattermost(&MattermostConfig{}), IsNil)
+}
+
+func (s *SuiteMattermost) TestRunSuccess(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+
+		var m mattermostMessage
+		c.Assert(json.NewDecoder(r.Body).Decode(&m), IsNil)
+		c.Assert(m.Channel, Equals, "town-square")
+		c.Assert(m.IconEmoji, Equals, mattermostIconEmoji)
+		c.Assert(m.Attachments[0].Title, Equals, "Execution successful")
+		c.Assert(m.Attachments[0].Color, Equals, "#7CD197")
+		c.Assert(m.Attachments[0].Footer, Equals, "Execution "+s.ctx.Execution.ID)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewMattermost(&MattermostConfig{MattermostWebhook: ts.URL, MattermostChannel: "town-square"})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteMattermost) TestRunSuccessFailed(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m mattermostMessage
+		c.Assert(json.NewDecoder(r.Body).Decode(&m), IsNil)
+		c.Assert(m.Attachments[0].Title, Equals, "Execution failed")
+		c.Assert(m.Attachments[0].Text, Equals, "foo")
+		c.Assert(m.Attachments[0].Color, Equals, "#F35A00")
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewMattermost(&MattermostConfig{MattermostWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteMattermost) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewMattermost(&MattermostConfig{MattermostWebhook: ts.URL, MattermostOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
@@ -0,0 +1,147 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var (
+	metricsPrefix        = "ofelia"
+	metricsInvalidRegexp = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+	influxDBTagEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// MetricsConfig configuration for the Metrics middleware
+type MetricsConfig struct {
+	StatsdAddress  string `gcfg:"statsd-address"`
+	InfluxDBURL    string `gcfg:"influxdb-url"`
+	MetricsAddress string `gcfg:"metrics-address"`
+	MetricPrefix   string `gcfg:"metric-prefix"`
+}
+
+// NewMetrics returns a Metrics middleware if the given configuration is not
+// empty
+func NewMetrics(c *MetricsConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Metrics{*c}
+	}
+
+	return m
+}
+
+// Metrics middleware pushes the duration and the status of every execution to
+// a StatsD server, over UDP, and/or to InfluxDB, using the line protocol, and/or
+// records them at DefaultPrometheusRegistry, scraped by Prometheus.
+type Metrics struct {
+	MetricsConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Metrics) ContinueOnStop() bool {
+	return true
+}
+
+// Run pushes the metrics of the execution, its close stop the exection to
+// collect the metrics
+func (m *Metrics) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if m.StatsdAddress != "" {
+		if err := m.pushStatsd(ctx); err != nil {
+			ctx.Logger.Errorf("Metrics error sending to statsd %q: %q", m.StatsdAddress, err)
+		}
+	}
+
+	if m.InfluxDBURL != "" {
+		if err := m.pushInfluxDB(ctx); err != nil {
+			ctx.Logger.Errorf("Metrics error writing to influxdb %q: %q", m.InfluxDBURL, err)
+		}
+	}
+
+	if m.MetricsAddress != "" {
+		DefaultPrometheusRegistry.Observe(prometheusPrefix(m.prefix()), ctx.Job.GetName(), ctx.Execution)
+	}
+
+	return err
+}
+
+func (m *Metrics) prefix() string {
+	if m.MetricPrefix == "" {
+		return metricsPrefix
+	}
+
+	return m.MetricPrefix
+}
+
+// pushStatsd sends the metrics to StatsD in a single packet, plain StatsD has
+// no tags so the job name is part of the metric name, eg.
+// `ofelia.backup.duration:1500|ms` and `ofelia.backup.successful:1|c`
+func (m *Metrics) pushStatsd(ctx *core.Context) error {
+	conn, err := net.Dial("udp", m.StatsdAddress)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write(m.buildStatsd(ctx))
+	return err
+}
+
+func (m *Metrics) buildStatsd(ctx *core.Context) []byte {
+	name := m.prefix() + "." + metricsInvalidRegexp.ReplaceAllString(ctx.Job.GetName(), "_")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s.duration:%d|ms\n", name, ctx.Execution.Duration.Nanoseconds()/1e6)
+	fmt.Fprintf(&b, "%s.%s:1|c", name, executionLabel(ctx.Execution))
+	if n := ctx.Execution.UnhealthyPeriods; n != 0 {
+		fmt.Fprintf(&b, "\n%s.unhealthy:%d|c", name, n)
+	}
+
+	return b.Bytes()
+}
+
+// pushInfluxDB writes a point to the given write URL, eg.
+// `http://influxdb:8086/write?db=ofelia`, with the job name as tag
+func (m *Metrics) pushInfluxDB(ctx *core.Context) error {
+	r, err := http.Post(m.InfluxDBURL, "text/plain", bytes.NewReader(m.buildInfluxDB(ctx)))
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+func (m *Metrics) buildInfluxDB(ctx *core.Context) []byte {
+	e := ctx.Execution
+
+	var successful, failed, skipped int
+	switch {
+	case e.Skipped:
+		skipped = 1
+	case e.Failed:
+		failed = 1
+	default:
+		successful = 1
+	}
+
+	return []byte(fmt.Sprintf(
+		"%s_execution,job=%s duration=%f,successful=%di,failed=%di,skipped=%di,unhealthy=%di,status=\"%s\" %d",
+		influxDBTagEscaper.Replace(m.prefix()), influxDBTagEscaper.Replace(ctx.Job.GetName()),
+		e.Duration.Seconds(), successful, failed, skipped, e.UnhealthyPeriods,
+		executionLabel(e), e.StartedAt.UnixNano(),
+	))
+}
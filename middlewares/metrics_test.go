@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteMetrics struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteMetrics{})
+
+func (s *SuiteMetrics) TestNewMetricsEmpty(c *C) {
+	c.Assert(NewMetrics(&MetricsConfig{}), IsNil)
+}
+
+func (s *SuiteMetrics) TestRunStatsd(c *C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	s.job.Name = "foo bar"
+	s.finishExecution(errors.New("foo"))
+	s.ctx.Execution.Duration = 1500 * time.Millisecond
+
+	m := NewMetrics(&MetricsConfig{StatsdAddress: conn.LocalAddr().String(), MetricPrefix: "jobs"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "jobs.foo_bar.duration:1500|ms\njobs.foo_bar.failed:1|c")
+}
+
+func (s *SuiteMetrics) TestRunInfluxDB(c *C) {
+	ts := NewTestServer()
+	ts.Status = 204
+	defer ts.Close()
+
+	s.job.Name = "foo bar"
+	s.finishExecution(nil)
+	s.ctx.Execution.Duration = 1500 * time.Millisecond
+
+	m := NewMetrics(&MetricsConfig{InfluxDBURL: ts.URL + "/write?db=ofelia"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	requests := ts.Requests()
+	c.Assert(requests, HasLen, 1)
+	c.Assert(requests[0].URL.Path, Equals, "/write")
+	c.Assert(requests[0].URL.Query().Get("db"), Equals, "ofelia")
+	c.Assert(string(requests[0].Body), Equals, fmt.Sprintf(
+		`ofelia_execution,job=foo\ bar duration=1.500000,successful=1i,failed=0i,skipped=0i,unhealthy=0i,status="successful" %d`,
+		s.ctx.Execution.StartedAt.UnixNano(),
+	))
+}
+
+func (s *SuiteMetrics) TestBuildStatsdUnhealthy(c *C) {
+	s.job.Name = "foo"
+	s.finishExecution(nil)
+	s.ctx.Execution.UnhealthyPeriods = 2
+
+	m := &Metrics{}
+	c.Assert(string(m.buildStatsd(s.ctx)), Matches, `(?s).*\nofelia\.foo\.unhealthy:2\|c`)
+}
+
+func (s *SuiteMetrics) TestBuildStatsdSkipped(c *C) {
+	s.job.Name = "foo"
+	s.finishExecution(core.ErrSkippedExecution)
+
+	m := &Metrics{}
+	c.Assert(string(m.buildStatsd(s.ctx)), Matches, `(?s)ofelia\.foo\.duration:\d+\|ms\nofelia\.foo\.skipped:1\|c`)
+}
@@ -0,0 +1,169 @@
+package middlewares
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var (
+	natsPort    = "4222"
+	natsTimeout = 5 * time.Second
+)
+
+// NATSConfig configuration for the NATS middleware
+type NATSConfig struct {
+	NATSURL       string `gcfg:"nats-url"`
+	NATSSubject   string `gcfg:"nats-subject"`
+	NATSToken     string `gcfg:"nats-token"`
+	NATSTokenFile string `gcfg:"nats-token-file"`
+}
+
+// NewNATS returns a NATS middleware if the given configuration is not empty
+func NewNATS(c *NATSConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &NATS{*c}
+	}
+
+	return m
+}
+
+// NATS middleware publishes an event to a NATS subject after every execution
+// of a job, a broker unreachable is logged without failing the job.
+type NATS struct {
+	NATSConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *NATS) ContinueOnStop() bool {
+	return true
+}
+
+// Run publishes the event of the execution, its close stop the exection to
+// collect the metrics
+func (m *NATS) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if err := m.publish(m.buildEvent(ctx)); err != nil {
+		ctx.Logger.Errorf("NATS error publishing to %q: %q", m.NATSSubject, err)
+	}
+
+	return err
+}
+
+func (m *NATS) buildEvent(ctx *core.Context) []byte {
+	record := core.NewExecutionRecord(ctx.Execution)
+	event := &natsEvent{
+		Job:       ctx.Job.GetName(),
+		Execution: record.ID,
+		Status:    record.Status,
+		StartedAt: record.StartedAt,
+		EndedAt:   record.EndedAt,
+		Duration:  record.Duration.Seconds(),
+		Error:     record.Error,
+	}
+
+	if exit, ok := ctx.Execution.Error.(core.NonZeroExitError); ok {
+		event.ExitCode = &exit.ExitCode
+	} else if record.Status == core.StatusSuccessful {
+		code := 0
+		event.ExitCode = &code
+	}
+
+	content, _ := json.Marshal(event)
+	return content
+}
+
+// publish sends the payload using the NATS client protocol, the PING sent
+// after it makes the server acknowledge that the message was processed.
+func (m *NATS) publish(payload []byte) error {
+	u, err := url.Parse(m.NATSURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), natsPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, natsTimeout)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	r := bufio.NewReader(conn)
+	info, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(info, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(info))
+	}
+
+	options, _ := json.Marshal(m.connectOptions(u))
+	if _, err := fmt.Fprintf(
+		conn, "CONNECT %s\r\nPUB %s %d\r\n%s\r\nPING\r\n",
+		options, m.NATSSubject, len(payload), payload,
+	); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (m *NATS) connectOptions(u *url.URL) *natsConnect {
+	c := &natsConnect{Name: "ofelia", Lang: "go", Version: "1.0", AuthToken: m.NATSToken}
+	if u.User != nil {
+		c.User = u.User.Username()
+		c.Pass, _ = u.User.Password()
+	}
+
+	return c
+}
+
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+type natsEvent struct {
+	Job       string    `json:"job"`
+	Execution string    `json:"execution"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Duration  float64   `json:"duration"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteNATS struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteNATS{})
+
+func (s *SuiteNATS) TestNewNATSEmpty(c *C) {
+	c.Assert(NewNATS(&NATSConfig{}), IsNil)
+}
+
+func (s *SuiteNATS) TestRunFailed(c *C) {
+	l, received := s.listen(c)
+	defer l.Close()
+
+	s.job.Name = "foo"
+	s.finishExecution(core.NonZeroExitError{ExitCode: 42})
+
+	m := NewNATS(&NATSConfig{NATSURL: "nats://bar:qux@" + l.Addr().String(), NATSSubject: "ofelia.jobs"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := <-received
+	c.Assert(lines, HasLen, 4)
+	c.Assert(lines[0], Matches, `CONNECT .*"user":"bar","pass":"qux".*`)
+
+	var e natsEvent
+	c.Assert(lines[1], Equals, fmt.Sprintf("PUB ofelia.jobs %d", len(lines[2])))
+	c.Assert(json.Unmarshal([]byte(lines[2]), &e), IsNil)
+	c.Assert(e.Job, Equals, "foo")
+	c.Assert(e.Status, Equals, "failed")
+	c.Assert(*e.ExitCode, Equals, 42)
+	c.Assert(lines[3], Equals, "PING")
+}
+
+func (s *SuiteNATS) TestRunSuccess(c *C) {
+	l, received := s.listen(c)
+	defer l.Close()
+
+	s.finishExecution(nil)
+
+	m := NewNATS(&NATSConfig{NATSURL: "nats://" + l.Addr().String(), NATSSubject: "ofelia.jobs", NATSToken: "baz"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	lines := <-received
+	c.Assert(lines, HasLen, 4)
+	c.Assert(lines[0], Matches, `CONNECT .*"auth_token":"baz".*`)
+
+	var e natsEvent
+	c.Assert(json.Unmarshal([]byte(lines[2]), &e), IsNil)
+	c.Assert(e.Status, Equals, "successful")
+	c.Assert(*e.ExitCode, Equals, 0)
+}
+
+func (s *SuiteNATS) TestRunUnreachable(c *C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	addr := l.Addr().String()
+	l.Close()
+
+	s.finishExecution(errors.New("foo"))
+
+	m := NewNATS(&NATSConfig{NATSURL: "nats://" + addr, NATSSubject: "ofelia.jobs"})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+// listen starts a fake NATS server accepting a single connection, the lines
+// received until the PING are sent to the returned channel.
+func (s *SuiteNATS) listen(c *C) (net.Listener, chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+
+		var lines []string
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+
+			lines = append(lines, strings.TrimSpace(line))
+			if lines[len(lines)-1] == "PING" {
+				io.WriteString(conn, "PONG\r\n")
+				break
+			}
+		}
+
+		received <- lines
+	}()
+
+	return l, received
+}
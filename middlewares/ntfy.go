@@ -0,0 +1,118 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// NtfyConfig configuration for the Ntfy middleware
+type NtfyConfig struct {
+	NtfyURL         string `gcfg:"ntfy-url"`
+	NtfyTopic       string `gcfg:"ntfy-topic"`
+	NtfyToken       string `gcfg:"ntfy-token"`
+	NtfyTokenFile   string `gcfg:"ntfy-token-file"`
+	NtfyOnlyOnError bool   `gcfg:"ntfy-only-on-error"`
+}
+
+// NewNtfy returns a Ntfy middleware if the given configuration is not empty
+func NewNtfy(c *NtfyConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Ntfy{*c}
+	}
+
+	return m
+}
+
+// Ntfy middleware publishes a push notification to a ntfy topic after every
+// execution of a job
+type Ntfy struct {
+	NtfyConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Ntfy) ContinueOnStop() bool {
+	return true
+}
+
+// Run publishes the notification, its close stop the exection to collect the
+// metrics
+func (m *Ntfy) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx.Execution, m.NtfyOnlyOnError) {
+		m.pushNotification(ctx)
+	}
+
+	return err
+}
+
+func (m *Ntfy) pushNotification(ctx *core.Context) {
+	req, err := m.buildRequest(ctx)
+	if err != nil {
+		ctx.Logger.Errorf("Ntfy error building request to %q error: %q", m.topicURL(), err)
+		return
+	}
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("Ntfy error calling %q error: %q", m.topicURL(), err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		ctx.Logger.Errorf("Ntfy error non-200 status code calling %q", m.topicURL())
+	}
+}
+
+func (m *Ntfy) buildRequest(ctx *core.Context) (*http.Request, error) {
+	body := fmt.Sprintf(
+		"Execution %s in %s",
+		executionLabel(ctx.Execution), ctx.Execution.Duration,
+	)
+
+	if ctx.Execution.Failed {
+		body += fmt.Sprintf("\nerror: %s", ctx.Execution.Error)
+	}
+
+	if n := ctx.Execution.Note; n != "" {
+		body += "\n" + n
+	}
+
+	body += "\n" + executionFooter(ctx.Execution)
+
+	req, err := http.NewRequest("POST", m.topicURL(), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	priority, tags := "default", "white_check_mark"
+	if ctx.Execution.Failed {
+		priority, tags = "high", "rotating_light"
+	} else if ctx.Execution.Skipped {
+		tags = "warning"
+	}
+
+	req.Header.Set("Title", fmt.Sprintf("Job %s", ctx.Job.GetName()))
+	req.Header.Set("Priority", priority)
+	req.Header.Set("Tags", tags)
+
+	if m.NtfyToken != "" {
+		req.Header.Set("Authorization", "Bearer "+m.NtfyToken)
+	}
+
+	return req, nil
+}
+
+func (m *Ntfy) topicURL() string {
+	if m.NtfyTopic == "" {
+		return m.NtfyURL
+	}
+
+	return strings.TrimSuffix(m.NtfyURL, "/") + "/" + m.NtfyTopic
+}
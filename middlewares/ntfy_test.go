@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteNtfy struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteNtfy{})
+
+func (s *SuiteNtfy) TestNewNtfyEmpty(c *C) {
+	c.Assert(NewNtfy(&NtfyConfig{}), IsNil)
+}
+
+func (s *SuiteNtfy) TestRunSuccess(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Assert(r.URL.Path, Equals, "/backups")
+		c.Assert(r.Header.Get("Title"), Equals, "Job foo")
+		c.Assert(r.Header.Get("Priority"), Equals, "default")
+		c.Assert(r.Header.Get("Tags"), Equals, "white_check_mark")
+		c.Assert(r.Header.Get("Authorization"), Equals, "Bearer qux")
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewNtfy(&NtfyConfig{NtfyURL: ts.URL + "/", NtfyTopic: "backups", NtfyToken: "qux"})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteNtfy) TestRunSuccessFailed(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Header.Get("Priority"), Equals, "high")
+		c.Assert(r.Header.Get("Tags"), Equals, "rotating_light")
+		c.Assert(r.Header.Get("Authorization"), Equals, "")
+
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Assert(string(body), Matches, "(?s)Execution failed in .*error: foo")
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("foo"))
+
+	m := NewNtfy(&NtfyConfig{NtfyURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteNtfy) TestRunSuccessOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewNtfy(&NtfyConfig{NtfyURL: ts.URL, NtfyOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
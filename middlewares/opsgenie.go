@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var (
+	opsGenieURL      = "https://api.opsgenie.com"
+	opsGeniePriority = "P3"
+	opsGenieSource   = "ofelia"
+)
+
+// OpsGenieConfig configuration for the OpsGenie middleware
+type OpsGenieConfig struct {
+	OpsGenieAPIKey     string `gcfg:"opsgenie-api-key"`
+	OpsGenieAPIKeyFile string `gcfg:"opsgenie-api-key-file"`
+	OpsGenieURL        string `gcfg:"opsgenie-url"`
+	OpsGeniePriority   string `gcfg:"opsgenie-priority"`
+	OpsGenieTags       string `gcfg:"opsgenie-tags"`
+}
+
+// NewOpsGenie returns a OpsGenie middleware if the given configuration is not
+// empty
+func NewOpsGenie(c *OpsGenieConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &OpsGenie{*c}
+	}
+
+	return m
+}
+
+// OpsGenie middleware creates an alert when an execution of a job fails, and
+// closes it after a successful one. The alerts are deduplicated by OpsGenie
+// using an alias based on the job name.
+type OpsGenie struct {
+	OpsGenieConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *OpsGenie) ContinueOnStop() bool {
+	return true
+}
+
+// Run creates or closes the alert of the job, its close stop the exection to
+// collect the metrics
+func (m *OpsGenie) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.Failed {
+		if !ctx.Execution.Suppressed {
+			m.createAlert(ctx)
+		}
+	} else if !ctx.Execution.Skipped {
+		m.closeAlert(ctx)
+	}
+
+	return err
+}
+
+func (m *OpsGenie) createAlert(ctx *core.Context) {
+	priority := m.OpsGeniePriority
+	if priority == "" {
+		priority = opsGeniePriority
+	}
+
+	description := ctx.Execution.Error.Error()
+	if n := ctx.Execution.Note; n != "" {
+		description += "\n" + n
+	}
+
+	alert := &opsGenieAlert{
+		Message:     fmt.Sprintf("Job %s failed", ctx.Job.GetName()),
+		Alias:       m.alias(ctx),
+		Description: description,
+		Priority:    priority,
+		Source:      opsGenieSource,
+		Tags:        m.tags(),
+	}
+
+	m.post(ctx, "/v2/alerts", alert)
+}
+
+func (m *OpsGenie) closeAlert(ctx *core.Context) {
+	path := fmt.Sprintf("/v2/alerts/%s/close?identifierType=alias", url.PathEscape(m.alias(ctx)))
+	m.post(ctx, path, &opsGenieClose{Source: opsGenieSource})
+}
+
+func (m *OpsGenie) post(ctx *core.Context, path string, body interface{}) {
+	content, _ := json.Marshal(body)
+
+	endpoint := m.baseURL() + path
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("OpsGenie error building request %q error: %q", endpoint, err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+m.OpsGenieAPIKey)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ctx.Logger.Errorf("OpsGenie error calling %q error: %q", endpoint, err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != 202 {
+		ctx.Logger.Errorf("OpsGenie error non-202 status code calling %q", endpoint)
+	}
+}
+
+func (m *OpsGenie) alias(ctx *core.Context) string {
+	return "ofelia-" + ctx.Job.GetName()
+}
+
+func (m *OpsGenie) tags() []string {
+	var tags []string
+	for _, tag := range strings.Split(m.OpsGenieTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func (m *OpsGenie) baseURL() string {
+	if m.OpsGenieURL == "" {
+		return opsGenieURL
+	}
+
+	return strings.TrimSuffix(m.OpsGenieURL, "/")
+}
+
+type opsGenieAlert struct {
+	Message     string   `json:"message"`
+	Alias       string   `json:"alias"`
+	Description string   `json:"description,omitempty"`
+	Priority    string   `json:"priority"`
+	Source      string   `json:"source"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+type opsGenieClose struct {
+	Source string `json:"source"`
+}
@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteOpsGenie struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteOpsGenie{})
+
+func (s *SuiteOpsGenie) TestNewOpsGenieEmpty(c *C) {
+	c.Assert(NewOpsGenie(&OpsGenieConfig{}), IsNil)
+}
+
+func (s *SuiteOpsGenie) TestRunFailed(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Assert(r.Method, Equals, "POST")
+		c.Assert(r.URL.Path, Equals, "/v2/alerts")
+		c.Assert(r.Header.Get("Authorization"), Equals, "GenieKey qux")
+
+		var a opsGenieAlert
+		c.Assert(json.NewDecoder(r.Body).Decode(&a), IsNil)
+		c.Assert(a.Message, Equals, "Job foo failed")
+		c.Assert(a.Alias, Equals, "ofelia-foo")
+		c.Assert(a.Description, Equals, "bar")
+		c.Assert(a.Priority, Equals, "P1")
+		c.Assert(a.Tags, DeepEquals, []string{"backup", "db"})
+
+		w.WriteHeader(202)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(errors.New("bar"))
+
+	m := NewOpsGenie(&OpsGenieConfig{
+		OpsGenieAPIKey:   "qux",
+		OpsGenieURL:      ts.URL,
+		OpsGeniePriority: "P1",
+		OpsGenieTags:     "backup, db",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteOpsGenie) TestRunSuccess(c *C) {
+	var called bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		c.Assert(r.URL.Path, Equals, "/v2/alerts/ofelia-foo/close")
+		c.Assert(r.URL.Query().Get("identifierType"), Equals, "alias")
+
+		w.WriteHeader(202)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewOpsGenie(&OpsGenieConfig{OpsGenieAPIKey: "qux", OpsGenieURL: ts.URL + "/"})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(called, Equals, true)
+}
+
+func (s *SuiteOpsGenie) TestRunSkipped(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(core.ErrSkippedExecution)
+
+	m := NewOpsGenie(&OpsGenieConfig{OpsGenieAPIKey: "qux", OpsGenieURL: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
@@ -28,6 +28,12 @@ func (m *Overlap) ContinueOnStop() bool {
 	return false
 }
 
+// Priority Overlap wraps the rest of the middlewares, so a skipped execution is
+// still reported by the notifiers
+func (m *Overlap) Priority() int {
+	return core.MiddlewarePriorityGuard
+}
+
 // Run stops the execution if the another execution is already running
 func (m *Overlap) Run(ctx *core.Context) error {
 	if m.NoOverlap && ctx.Job.Running() > 1 {
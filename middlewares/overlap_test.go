@@ -1,6 +1,10 @@
 package middlewares
 
-import . "gopkg.in/check.v1"
+import (
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
 
 type SuiteOverlap struct {
 	BaseSuite
@@ -27,3 +31,13 @@ func (s *SuiteOverlap) TestRunOverlap(c *C) {
 	c.Assert(s.ctx.Execution.IsRunning, Equals, false)
 	c.Assert(s.ctx.Execution.Skipped, Equals, true)
 }
+
+func (s *SuiteOverlap) TestPriority(c *C) {
+	s.job.Use(NewSlack(&SlackConfig{SlackWebhook: "http://localhost"}))
+	s.job.Use(NewOverlap(&OverlapConfig{NoOverlap: true}))
+
+	ms := s.job.Middlewares()
+	c.Assert(ms, HasLen, 2)
+	c.Assert(ms[0], FitsTypeOf, &Overlap{})
+	c.Assert(ms[0].(core.PrioritizedMiddleware).Priority(), Equals, core.MiddlewarePriorityGuard)
+}
@@ -0,0 +1,143 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// prometheusBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histogram, from a second to a day since the jobs may run for hours
+var prometheusBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 21600, 86400}
+
+var prometheusEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusSeries are the metrics of a job
+type prometheusSeries struct {
+	prefix  string
+	job     string
+	total   uint64
+	failed  uint64
+	skipped uint64
+	buckets []uint64
+	sum     float64
+}
+
+// PrometheusRegistry keeps the metrics of the executions of every job, shared
+// by all the Metrics middlewares and exposed in the Prometheus text format.
+type PrometheusRegistry struct {
+	lock   sync.Mutex
+	series map[string]*prometheusSeries
+}
+
+// DefaultPrometheusRegistry is the registry of the Metrics middlewares with a
+// metrics-address, served by the daemon
+var DefaultPrometheusRegistry = NewPrometheusRegistry()
+
+// NewPrometheusRegistry returns a new empty PrometheusRegistry
+func NewPrometheusRegistry() *PrometheusRegistry {
+	return &PrometheusRegistry{series: make(map[string]*prometheusSeries, 0)}
+}
+
+// Observe records the given finished execution of the job
+func (r *PrometheusRegistry) Observe(prefix, job string, e *core.Execution) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := prefix + "\x00" + job
+	s, ok := r.series[key]
+	if !ok {
+		s = &prometheusSeries{
+			prefix:  prefix,
+			job:     job,
+			buckets: make([]uint64, len(prometheusBuckets)),
+		}
+
+		r.series[key] = s
+	}
+
+	s.total++
+	if e.Failed {
+		s.failed++
+	} else if e.Skipped {
+		s.skipped++
+	}
+
+	seconds := e.Duration.Seconds()
+	s.sum += seconds
+	for i, le := range prometheusBuckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (r *PrometheusRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(r.render())
+}
+
+func (r *PrometheusRegistry) render() []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	byPrefix := make(map[string][]*prometheusSeries, 0)
+	for _, s := range r.series {
+		byPrefix[s.prefix] = append(byPrefix[s.prefix], s)
+	}
+
+	prefixes := make([]string, 0, len(byPrefix))
+	for prefix, series := range byPrefix {
+		prefixes = append(prefixes, prefix)
+		sort.Slice(series, func(i, j int) bool { return series[i].job < series[j].job })
+	}
+
+	sort.Strings(prefixes)
+
+	var b bytes.Buffer
+	for _, prefix := range prefixes {
+		series := byPrefix[prefix]
+		counters := []struct {
+			name, help string
+			value      func(*prometheusSeries) uint64
+		}{
+			{"executions_total", "Executions of the job.", func(s *prometheusSeries) uint64 { return s.total }},
+			{"execution_failures_total", "Failed executions of the job.", func(s *prometheusSeries) uint64 { return s.failed }},
+			{"execution_skips_total", "Skipped executions of the job.", func(s *prometheusSeries) uint64 { return s.skipped }},
+		}
+
+		for _, c := range counters {
+			name := prefix + "_" + c.name
+			fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, c.help, name)
+			for _, s := range series {
+				fmt.Fprintf(&b, "%s{job=\"%s\"} %d\n", name, prometheusEscaper.Replace(s.job), c.value(s))
+			}
+		}
+
+		name := prefix + "_execution_duration_seconds"
+		fmt.Fprintf(&b, "# HELP %s Duration of the executions of the job.\n# TYPE %s histogram\n", name, name)
+		for _, s := range series {
+			job := prometheusEscaper.Replace(s.job)
+			for i, le := range prometheusBuckets {
+				fmt.Fprintf(&b, "%s_bucket{job=\"%s\",le=\"%g\"} %d\n", name, job, le, s.buckets[i])
+			}
+
+			fmt.Fprintf(&b, "%s_bucket{job=\"%s\",le=\"+Inf\"} %d\n", name, job, s.total)
+			fmt.Fprintf(&b, "%s_sum{job=\"%s\"} %g\n", name, job, s.sum)
+			fmt.Fprintf(&b, "%s_count{job=\"%s\"} %d\n", name, job, s.total)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// prometheusPrefix returns the prefix as a valid Prometheus metric name
+func prometheusPrefix(prefix string) string {
+	return strings.Replace(metricsInvalidRegexp.ReplaceAllString(prefix, "_"), "-", "_", -1)
+}
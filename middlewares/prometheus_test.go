@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuitePrometheus struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuitePrometheus{})
+
+func (s *SuitePrometheus) TestObserve(c *C) {
+	r := NewPrometheusRegistry()
+	r.Observe("ofelia", "foo", &core.Execution{Duration: time.Second * 10})
+	r.Observe("ofelia", "foo", &core.Execution{Duration: time.Minute * 2, Failed: true})
+	r.Observe("ofelia", `b"ar`, &core.Execution{Skipped: true})
+
+	out := string(r.render())
+	c.Assert(out, Matches, `(?s).*# TYPE ofelia_executions_total counter\n`+
+		`ofelia_executions_total\{job="b\\"ar"\} 1\nofelia_executions_total\{job="foo"\} 2\n.*`)
+	c.Assert(strings.Contains(out, `ofelia_execution_failures_total{job="foo"} 1`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_skips_total{job="b\"ar"} 1`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_duration_seconds_bucket{job="foo",le="15"} 1`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_duration_seconds_bucket{job="foo",le="300"} 2`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_duration_seconds_bucket{job="foo",le="+Inf"} 2`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_duration_seconds_sum{job="foo"} 130`), Equals, true)
+	c.Assert(strings.Contains(out, `ofelia_execution_duration_seconds_count{job="foo"} 2`), Equals, true)
+}
+
+func (s *SuitePrometheus) TestObserveConcurrent(c *C) {
+	r := NewPrometheusRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Observe("ofelia", "foo", &core.Execution{Duration: time.Second})
+			r.render()
+		}()
+	}
+
+	wg.Wait()
+	c.Assert(strings.Contains(string(r.render()), `ofelia_executions_total{job="foo"} 50`), Equals, true)
+}
+
+func (s *SuitePrometheus) TestRunMetricsAddress(c *C) {
+	s.job.Name = "prometheus-run"
+	s.finishExecution(errors.New("foo"))
+
+	m := NewMetrics(&MetricsConfig{MetricsAddress: ":9100", MetricPrefix: "my-jobs"})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	w := httptest.NewRecorder()
+	DefaultPrometheusRegistry.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := ioutil.ReadAll(w.Body)
+	c.Assert(strings.Contains(string(body), `my_jobs_execution_failures_total{job="prometheus-run"} 1`), Equals, true)
+}
@@ -0,0 +1,304 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+const (
+	defaultSheetsAPIURL = "https://sheets.googleapis.com"
+	defaultSheetsRange  = "Sheet1"
+	sheetsScope         = "https://www.googleapis.com/auth/spreadsheets"
+	sheetsTimeout       = time.Second * 30
+)
+
+var reportHeader = []string{"date", "job", "status", "duration", "error"}
+
+// ReportConfig configuration for the Report middleware
+type ReportConfig struct {
+	ReportCSVFile               string `gcfg:"report-csv-file"`
+	ReportSheetsID              string `gcfg:"report-sheets-id"`
+	ReportSheetsRange           string `gcfg:"report-sheets-range"`
+	ReportSheetsCredentials     string `gcfg:"report-sheets-credentials"`
+	ReportSheetsCredentialsFile string `gcfg:"report-sheets-credentials-file"`
+	ReportSheetsAPIURL          string `gcfg:"report-sheets-api-url"`
+}
+
+// NewReport returns a Report middleware if the given configuration is not
+// empty
+func NewReport(c *ReportConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Report{ReportConfig: *c}
+	}
+
+	return m
+}
+
+// Report middleware appends a row with the date, the job, the status, the
+// duration and the error of every execution to a CSV file and/or a Google
+// Sheet, a simple report of the executions readable without a dashboard.
+type Report struct {
+	ReportConfig
+
+	lock  sync.Mutex
+	token string
+	until time.Time
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *Report) ContinueOnStop() bool {
+	return true
+}
+
+// Run appends the row of the execution once it finishes, the errors are logged
+// without failing the job.
+func (m *Report) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	row := reportRow(ctx)
+	if m.ReportCSVFile != "" {
+		if err := appendCSV(m.ReportCSVFile, row); err != nil {
+			ctx.Logger.Errorf("Report error writing %q: %q", m.ReportCSVFile, err)
+		}
+	}
+
+	if m.ReportSheetsID != "" {
+		if err := m.appendSheet(row); err != nil {
+			ctx.Logger.Errorf("Report error appending to sheet %q: %q", m.ReportSheetsID, err)
+		}
+	}
+
+	return err
+}
+
+func reportRow(ctx *core.Context) []string {
+	var msg string
+	if ctx.Execution.Error != nil {
+		msg = ctx.Execution.Error.Error()
+	}
+
+	return []string{
+		ctx.Execution.StartedAt.Format(time.RFC3339),
+		ctx.Job.GetName(),
+		executionLabel(ctx.Execution),
+		ctx.Execution.Duration.String(),
+		msg,
+	}
+}
+
+// csvLocks avoids concurrent executions writing the same file at the same time
+var (
+	csvLocks     = make(map[string]*sync.Mutex)
+	csvLocksLock sync.Mutex
+)
+
+func csvLock(path string) *sync.Mutex {
+	csvLocksLock.Lock()
+	defer csvLocksLock.Unlock()
+
+	l, ok := csvLocks[path]
+	if !ok {
+		l = &sync.Mutex{}
+		csvLocks[path] = l
+	}
+
+	return l
+}
+
+// appendCSV appends the row to the file, the header is written when the file
+// is created or empty.
+func appendCSV(path string, row []string) error {
+	l := csvLock(path)
+	l.Lock()
+	defer l.Unlock()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(reportHeader)
+	}
+
+	w.Write(row)
+	w.Flush()
+
+	return w.Error()
+}
+
+type sheetsCredentials struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+func (m *Report) appendSheet(row []string) error {
+	token, err := m.accessToken()
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(row))
+	for i, v := range row {
+		values[i] = v
+	}
+
+	content, _ := json.Marshal(map[string]interface{}{
+		"values": [][]interface{}{values},
+	})
+
+	api := m.ReportSheetsAPIURL
+	if api == "" {
+		api = defaultSheetsAPIURL
+	}
+
+	sheet := m.ReportSheetsRange
+	if sheet == "" {
+		sheet = defaultSheetsRange
+	}
+
+	u := fmt.Sprintf(
+		"%s/v4/spreadsheets/%s/values/%s:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		strings.TrimSuffix(api, "/"), url.PathEscape(m.ReportSheetsID), url.PathEscape(sheet),
+	)
+
+	req, err := http.NewRequest("POST", u, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: sheetsTimeout}
+	r, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(r.Body)
+		return fmt.Errorf("unexpected status code %d: %s", r.StatusCode, body)
+	}
+
+	return nil
+}
+
+// accessToken returns a token of the service account, exchanging a signed JWT
+// at its token URI, the token is reused until it's about to expire.
+func (m *Report) accessToken() (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.token != "" && time.Now().Before(m.until) {
+		return m.token, nil
+	}
+
+	creds := &sheetsCredentials{}
+	if err := json.Unmarshal([]byte(m.ReportSheetsCredentials), creds); err != nil {
+		return "", fmt.Errorf("invalid service account credentials: %s", err)
+	}
+
+	assertion, err := signJWT(creds, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: sheetsTimeout}
+	r, err := client.PostForm(creds.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d requesting a token", r.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %s", err)
+	}
+
+	m.token = token.AccessToken
+	m.until = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+
+	return m.token, nil
+}
+
+// signJWT returns the JWT assertion of the service account, signed with its
+// private key using RS256
+func signJWT(creds *sheetsCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid service account private key: %s", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("invalid service account private key: not a RSA key")
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
@@ -0,0 +1,118 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteReport struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteReport{})
+
+func (s *SuiteReport) TestNewReportEmpty(c *C) {
+	c.Assert(NewReport(&ReportConfig{}), IsNil)
+}
+
+func (s *SuiteReport) TestRunCSV(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "report")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	s.job.Name = "foo"
+	s.finishExecution(errors.New("foo, bar"))
+
+	file := filepath.Join(dir, "report.csv")
+	m := NewReport(&ReportConfig{ReportCSVFile: file})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	f, err := os.Open(file)
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	rows, err := csv.NewReader(f).ReadAll()
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 3)
+	c.Assert(rows[0], DeepEquals, reportHeader)
+	c.Assert(rows[1][1], Equals, "foo")
+	c.Assert(rows[1][2], Equals, "failed")
+	c.Assert(rows[1][4], Equals, "foo, bar")
+}
+
+func (s *SuiteReport) TestRunSheets(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, IsNil)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	c.Assert(err, IsNil)
+
+	var tokens int
+	var appended [][][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			tokens++
+			c.Assert(r.FormValue("grant_type"), Equals, "urn:ietf:params:oauth:grant-type:jwt-bearer")
+			c.Assert(strings.Count(r.FormValue("assertion"), "."), Equals, 2)
+			w.Write([]byte(`{"access_token": "qux", "expires_in": 3600}`))
+		case r.URL.Path == "/v4/spreadsheets/abc/values/Jobs:append":
+			c.Assert(r.Header.Get("Authorization"), Equals, "Bearer qux")
+			c.Assert(r.URL.Query().Get("valueInputOption"), Equals, "USER_ENTERED")
+
+			var body struct {
+				Values [][]string `json:"values"`
+			}
+
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), IsNil)
+			appended = append(appended, body.Values)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer ts.Close()
+
+	creds, _ := json.Marshal(&sheetsCredentials{
+		ClientEmail: "ofelia@project.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:    ts.URL + "/token",
+	})
+
+	s.job.Name = "foo"
+	s.finishExecution(nil)
+
+	m := NewReport(&ReportConfig{
+		ReportSheetsID:          "abc",
+		ReportSheetsRange:       "Jobs",
+		ReportSheetsCredentials: string(creds),
+		ReportSheetsAPIURL:      ts.URL,
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	c.Assert(tokens, Equals, 1)
+	c.Assert(appended, HasLen, 2)
+	c.Assert(appended[0][0][1], Equals, "foo")
+	c.Assert(appended[0][0][2], Equals, "successful")
+}
+
+func (s *SuiteReport) TestSignJWTInvalidKey(c *C) {
+	_, err := signJWT(&sheetsCredentials{PrivateKey: "foo"}, s.ctx.Execution.StartedAt)
+	c.Assert(err, ErrorMatches, "invalid service account private key")
+}
@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// ResultFileConfig configuration for the ResultFile middleware
+type ResultFileConfig struct {
+	ResultFile string `gcfg:"result-file"`
+}
+
+// NewResultFile returns a ResultFile middleware if the given configuration is
+// not empty
+func NewResultFile(c *ResultFileConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &ResultFile{*c}
+	}
+
+	return m
+}
+
+// ResultFile middleware writes the result of the last execution of a job to a
+// file, as JSON, eg. to be polled by a script at the host.
+type ResultFile struct {
+	ResultFileConfig
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *ResultFile) ContinueOnStop() bool {
+	return true
+}
+
+type result struct {
+	Job       string    `json:"job"`
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Duration  float64   `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Run writes the result once the execution finishes, replacing the one of the
+// previous execution, the errors are logged without failing the job.
+func (m *ResultFile) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if err := m.write(ctx); err != nil {
+		ctx.Logger.Errorf("ResultFile error writing %q: %q", m.ResultFile, err)
+	}
+
+	return err
+}
+
+// write replaces the file atomically, a temporary file at the same folder is
+// renamed to it, so the readers never see a partial result.
+func (m *ResultFile) write(ctx *core.Context) error {
+	record := core.NewExecutionRecord(ctx.Execution)
+	r := &result{
+		Job:       ctx.Job.GetName(),
+		ID:        record.ID,
+		Status:    record.Status,
+		StartedAt: record.StartedAt,
+		EndedAt:   record.EndedAt,
+		Duration:  record.Duration.Seconds(),
+		Error:     record.Error,
+	}
+
+	code := 0
+	if exit, ok := ctx.Execution.Error.(core.NonZeroExitError); ok {
+		code = exit.ExitCode
+	}
+
+	if record.Status == core.StatusSuccessful || code != 0 {
+		r.ExitCode = &code
+	}
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(m.ResultFile), filepath.Base(m.ResultFile)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(content, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// the temporary files are created with 0600
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), m.ResultFile)
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Postcon/ofelia/core"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteResultFile struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteResultFile{})
+
+func (s *SuiteResultFile) TestNewResultFileEmpty(c *C) {
+	c.Assert(NewResultFile(&ResultFileConfig{}), IsNil)
+}
+
+func (s *SuiteResultFile) TestRun(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "result")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	s.job.Name = "foo"
+	s.finishExecution(core.NonZeroExitError{ExitCode: 3})
+
+	file := filepath.Join(dir, "foo.json")
+	m := NewResultFile(&ResultFileConfig{ResultFile: file})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	r := s.readResult(c, file)
+	c.Assert(r.Job, Equals, "foo")
+	c.Assert(r.ID, Equals, s.ctx.Execution.ID)
+	c.Assert(r.Status, Equals, core.StatusFailed)
+	c.Assert(*r.ExitCode, Equals, 3)
+	c.Assert(r.Error, Equals, "error non-zero exit code: 3")
+
+	s.SetUpTest(c)
+	s.finishExecution(nil)
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	r = s.readResult(c, file)
+	c.Assert(r.Status, Equals, core.StatusSuccessful)
+	c.Assert(*r.ExitCode, Equals, 0)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 1)
+}
+
+func (s *SuiteResultFile) TestRunFailedWithoutExitCode(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "result")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	s.finishExecution(errors.New("foo"))
+
+	file := filepath.Join(dir, "foo.json")
+	c.Assert(NewResultFile(&ResultFileConfig{ResultFile: file}).Run(s.ctx), IsNil)
+	c.Assert(s.readResult(c, file).ExitCode, IsNil)
+}
+
+func (s *SuiteResultFile) readResult(c *C, file string) *result {
+	content, err := ioutil.ReadFile(file)
+	c.Assert(err, IsNil)
+
+	r := &result{}
+	c.Assert(json.Unmarshal(content, r), IsNil)
+
+	return r
+}
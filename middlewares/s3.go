@@ -0,0 +1,205 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var s3Region = "us-east-1"
+
+// S3Config configuration for the S3 middleware
+type S3Config struct {
+	S3Endpoint      string `gcfg:"s3-endpoint"`
+	S3Bucket        string `gcfg:"s3-bucket"`
+	S3Region        string `gcfg:"s3-region"`
+	S3AccessKey     string `gcfg:"s3-access-key"`
+	S3SecretKey     string `gcfg:"s3-secret-key"`
+	S3SecretKeyFile string `gcfg:"s3-secret-key-file"`
+	S3Prefix        string `gcfg:"s3-prefix"`
+	S3OnlyOnError   bool   `gcfg:"s3-only-on-error"`
+}
+
+// NewS3 returns a S3 middleware if the given configuration is not empty
+func NewS3(c *S3Config) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &S3{*c}
+	}
+
+	return m
+}
+
+// S3 middleware uploads the output of every execution to a bucket of a S3
+// compatible storage, as AWS S3 or MinIO, as the save middleware does to disk.
+type S3 struct {
+	S3Config
+}
+
+// ContinueOnStop return allways true, we want always report the final status
+func (m *S3) ContinueOnStop() bool {
+	return true
+}
+
+// Run uploads the result of the execution, its close stop the exection to
+// collect the metrics
+func (m *S3) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.Failed || !m.S3OnlyOnError {
+		if err := m.upload(ctx); err != nil {
+			ctx.Logger.Errorf("S3 error: %q", err)
+		}
+	}
+
+	return err
+}
+
+// upload puts the reports of the execution at the bucket, keyed by the job
+// name and the date of the execution, the execution ID is part of the key so
+// concurrent executions never write to the same objects.
+func (m *S3) upload(ctx *core.Context) error {
+	root := m.key(ctx)
+
+	e := ctx.Execution
+	if err := m.putObject(root+".stderr.log", streamBytes(e.ErrorStream)); err != nil {
+		return err
+	}
+
+	if err := m.putObject(root+".stdout.log", streamBytes(e.OutputStream)); err != nil {
+		return err
+	}
+
+	js, _ := json.MarshalIndent(map[string]interface{}{
+		"Job":       ctx.Job,
+		"Execution": ctx.Execution,
+	}, "", "  ")
+
+	return m.putObject(root+".json", js)
+}
+
+func (m *S3) key(ctx *core.Context) string {
+	return fmt.Sprintf(
+		"%s%s/%s_%s",
+		m.S3Prefix, ctx.Job.GetName(),
+		ctx.Execution.StartedAt.Format("20060102_150405"), ctx.Execution.ID,
+	)
+}
+
+func (m *S3) putObject(key string, content []byte) error {
+	endpoint, err := url.Parse(strings.TrimSuffix(m.S3Endpoint, "/"))
+	if err != nil {
+		return err
+	}
+
+	// path style, supported by AWS and by MinIO, without wildcard DNS
+	path := endpoint.EscapedPath() + "/" + s3Escape(m.S3Bucket) + "/" + s3Escape(key)
+	req, err := http.NewRequest("PUT", endpoint.Scheme+"://"+endpoint.Host+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	contentType := "text/plain"
+	if strings.HasSuffix(key, ".json") {
+		contentType = "application/json"
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	m.sign(req, path, content, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status code %d uploading %q: %s", resp.StatusCode, key, body)
+	}
+
+	return nil
+}
+
+// sign signs the request using AWS Signature Version 4
+func (m *S3) sign(req *http.Request, path string, content []byte, now time.Time) {
+	region := m.S3Region
+	if region == "" {
+		region = s3Region
+	}
+
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(content)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+m.S3SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		m.S3AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// s3Escape escapes a key as required by the signature, every byte except the
+// unreserved characters and the slashes are percent-encoded.
+func s3Escape(key string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
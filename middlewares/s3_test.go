@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteS3 struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteS3{})
+
+func (s *SuiteS3) TestNewS3Empty(c *C) {
+	c.Assert(NewS3(&S3Config{}), IsNil)
+}
+
+func (s *SuiteS3) TestRun(c *C) {
+	objects := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, Equals, "PUT")
+		c.Assert(strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=foo/"), Equals, true)
+
+		body, _ := ioutil.ReadAll(r.Body)
+		objects[r.URL.Path] = string(body)
+	}))
+
+	defer ts.Close()
+
+	s.job.Name = "backup"
+	s.ctx.Start()
+	s.ctx.Execution.OutputStream.Write([]byte("output"))
+	s.ctx.Stop(errors.New("bar"))
+	s.ctx.Execution.StartedAt = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewS3(&S3Config{
+		S3Endpoint:  ts.URL,
+		S3Bucket:    "logs",
+		S3AccessKey: "foo",
+		S3SecretKey: "bar",
+		S3Prefix:    "ofelia/",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	root := "/logs/ofelia/backup/20180101_000000_" + s.ctx.Execution.ID
+	c.Assert(objects, HasLen, 3)
+	c.Assert(objects[root+".stdout.log"], Equals, "output")
+	c.Assert(objects[root+".stderr.log"], Equals, "")
+	c.Assert(strings.Contains(objects[root+".json"], `"Execution"`), Equals, true)
+
+	// the output is not consumed by the upload
+	c.Assert(streamBytes(s.ctx.Execution.OutputStream), DeepEquals, []byte("output"))
+}
+
+func (s *SuiteS3) TestRunOnlyOnError(c *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(true, Equals, false)
+	}))
+
+	defer ts.Close()
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	m := NewS3(&S3Config{S3Endpoint: ts.URL, S3Bucket: "logs", S3OnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+}
+
+func (s *SuiteS3) TestSign(c *C) {
+	m := &S3{S3Config{S3AccessKey: "foo", S3SecretKey: "bar", S3Region: "eu-west-1"}}
+
+	req, _ := http.NewRequest("PUT", "http://minio:9000/logs/foo.log", nil)
+	m.sign(req, "/logs/foo.log", []byte("foo"), time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	c.Assert(req.Header.Get("X-Amz-Date"), Equals, "20180101T000000Z")
+	c.Assert(req.Header.Get("X-Amz-Content-Sha256"), Equals, sha256Hex([]byte("foo")))
+
+	auth := req.Header.Get("Authorization")
+	prefix := "AWS4-HMAC-SHA256 Credential=foo/20180101/eu-west-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+	c.Assert(strings.HasPrefix(auth, prefix), Equals, true)
+	c.Assert(strings.TrimPrefix(auth, prefix), HasLen, 64)
+}
+
+func (s *SuiteS3) TestS3Escape(c *C) {
+	c.Assert(s3Escape("foo/bar baz_1.log"), Equals, "foo/bar%20baz_1.log")
+	c.Assert(s3Escape("a+b!"), Equals, "a%2Bb%21")
+}
@@ -5,18 +5,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Postcon/ofelia/core"
 )
 
 // SaveConfig configuration for the Save middleware
 type SaveConfig struct {
-	SaveFolder      string `gcfg:"save-folder"`
-	SaveOnlyOnError bool   `gcfg:"save-only-on-error"`
+	SaveFolder      string        `gcfg:"save-folder"`
+	SaveOnlyOnError bool          `gcfg:"save-only-on-error"`
+	SaveMaxAge      core.Duration `gcfg:"save-max-age"`
+	SaveMaxFiles    int           `gcfg:"save-max-files"`
 }
 
+var saveExtensions = []string{".json", ".stdout.log", ".stderr.log"}
+
 // NewSave returns a Save middleware if the given configuration is not empty
 func NewSave(c *SaveConfig) core.Middleware {
 	var m core.Middleware
@@ -50,22 +59,33 @@ func (m *Save) Run(ctx *core.Context) error {
 		}
 	}
 
+	if err := m.prune(); err != nil {
+		ctx.Logger.Errorf("Save error pruning %q: %q", m.SaveFolder, err)
+	}
+
 	return err
 }
 
+// saveToDisk writes the reports of the execution, the execution ID is part of
+// the filename so concurrent executions never write to the same files.
 func (m *Save) saveToDisk(ctx *core.Context) error {
+	name := ctx.Job.GetInstanceName()
+	if name == "" {
+		name = ctx.Job.GetName()
+	}
+
 	root := filepath.Join(m.SaveFolder, fmt.Sprintf(
-		"%s_%s",
-		ctx.Execution.Date.Format("20060102_150405"), ctx.Job.GetName(),
+		"%s_%s_%s",
+		ctx.Execution.StartedAt.Format("20060102_150405"), name, ctx.Execution.ID,
 	))
 
 	e := ctx.Execution
-	err := m.saveReaderToDisk(e.ErrorStream, fmt.Sprintf("%s.stderr.log", root))
+	err := m.saveReaderToDisk(bytes.NewReader(streamBytes(e.ErrorStream)), fmt.Sprintf("%s.stderr.log", root))
 	if err != nil {
 		return err
 	}
 
-	err = m.saveReaderToDisk(e.OutputStream, fmt.Sprintf("%s.stdout.log", root))
+	err = m.saveReaderToDisk(bytes.NewReader(streamBytes(e.OutputStream)), fmt.Sprintf("%s.stdout.log", root))
 	if err != nil {
 		return err
 	}
@@ -100,3 +120,75 @@ func (m *Save) saveReaderToDisk(r io.Reader, filename string) error {
 
 	return nil
 }
+
+// pruneLock avoids concurrent jobs pruning the same folder at the same time
+var pruneLock sync.Mutex
+
+// prune removes the reports older than SaveMaxAge and the oldest reports when
+// the folder contains more than SaveMaxFiles executions.
+func (m *Save) prune() error {
+	if m.SaveMaxAge <= 0 && m.SaveMaxFiles <= 0 {
+		return nil
+	}
+
+	pruneLock.Lock()
+	defer pruneLock.Unlock()
+
+	files, err := ioutil.ReadDir(m.SaveFolder)
+	if err != nil {
+		return err
+	}
+
+	dates := make(map[string]time.Time, 0)
+	for _, f := range files {
+		if root, ok := reportRoot(f.Name()); ok && !f.IsDir() {
+			if f.ModTime().After(dates[root]) {
+				dates[root] = f.ModTime()
+			}
+		}
+	}
+
+	var roots []string
+	for root := range dates {
+		roots = append(roots, root)
+	}
+
+	// reports are prefixed by the execution date, so the names sort by date
+	sort.Strings(roots)
+
+	var remove []string
+	if m.SaveMaxFiles > 0 && len(roots) > m.SaveMaxFiles {
+		remove = roots[:len(roots)-m.SaveMaxFiles]
+		roots = roots[len(roots)-m.SaveMaxFiles:]
+	}
+
+	if m.SaveMaxAge > 0 {
+		limit := time.Now().Add(-time.Duration(m.SaveMaxAge))
+		for _, root := range roots {
+			if dates[root].Before(limit) {
+				remove = append(remove, root)
+			}
+		}
+	}
+
+	for _, root := range remove {
+		for _, ext := range saveExtensions {
+			err := os.Remove(filepath.Join(m.SaveFolder, root+ext))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func reportRoot(filename string) (string, bool) {
+	for _, ext := range saveExtensions {
+		if strings.HasSuffix(filename, ext) {
+			return strings.TrimSuffix(filename, ext), true
+		}
+	}
+
+	return "", false
+}
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/Postcon/ofelia/core"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -27,21 +29,96 @@ func (s *SuiteSave) TestRunSuccess(c *C) {
 	s.ctx.Stop(nil)
 
 	s.job.Name = "foo"
-	s.ctx.Execution.Date = time.Time{}
+	s.ctx.Execution.ID = "bar"
+	s.ctx.Execution.StartedAt = time.Time{}
 
 	m := NewSave(&SaveConfig{SaveFolder: dir})
 	c.Assert(m.Run(s.ctx), IsNil)
 
-	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.json"))
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_bar.json"))
 	c.Assert(err, IsNil)
 
-	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.stdout.log"))
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_bar.stdout.log"))
 	c.Assert(err, IsNil)
 
-	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.stderr.log"))
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_bar.stderr.log"))
 	c.Assert(err, IsNil)
 }
 
+func (s *SuiteSave) TestRunSuccessInstanceName(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	s.job.Name = "foo"
+	s.job.InstanceName = "foo_42"
+	s.ctx.Execution.ID = "bar"
+	s.ctx.Execution.StartedAt = time.Time{}
+
+	m := NewSave(&SaveConfig{SaveFolder: dir})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_42_bar.json"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteSave) TestRunMaxFiles(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+
+	s.createReport(c, dir, "00010101_000000_foo_old", time.Now())
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	s.job.Name = "foo"
+	s.ctx.Execution.ID = "bar"
+	s.ctx.Execution.StartedAt = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveMaxFiles: 1})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+
+	_, err = os.Stat(filepath.Join(dir, "20180101_000000_foo_bar.json"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SuiteSave) TestRunMaxAge(c *C) {
+	dir, err := ioutil.TempDir("/tmp", "save")
+	c.Assert(err, IsNil)
+
+	s.createReport(c, dir, "00010101_000000_foo_old", time.Now().Add(-time.Hour))
+
+	s.ctx.Start()
+	s.ctx.Stop(nil)
+
+	s.job.Name = "foo"
+	s.ctx.Execution.ID = "bar"
+
+	m := NewSave(&SaveConfig{SaveFolder: dir, SaveMaxAge: core.Duration(time.Minute)})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 3)
+
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_old.json"))
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *SuiteSave) createReport(c *C, dir, root string, date time.Time) {
+	for _, ext := range saveExtensions {
+		filename := filepath.Join(dir, root+ext)
+		c.Assert(ioutil.WriteFile(filename, nil, 0644), IsNil)
+		c.Assert(os.Chtimes(filename, date, date), IsNil)
+	}
+}
+
 func (s *SuiteSave) TestRunSuccessOnError(c *C) {
 	dir, err := ioutil.TempDir("/tmp", "save")
 	c.Assert(err, IsNil)
@@ -50,11 +127,13 @@ func (s *SuiteSave) TestRunSuccessOnError(c *C) {
 	s.ctx.Stop(nil)
 
 	s.job.Name = "foo"
-	s.ctx.Execution.Date = time.Time{}
+	s.ctx.Execution.StartedAt = time.Time{}
+
+	s.ctx.Execution.ID = "bar"
 
 	m := NewSave(&SaveConfig{SaveFolder: dir, SaveOnlyOnError: true})
 	c.Assert(m.Run(s.ctx), IsNil)
 
-	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo.json"))
+	_, err = os.Stat(filepath.Join(dir, "00010101_000000_foo_bar.json"))
 	c.Assert(err, Not(IsNil))
 }
@@ -0,0 +1,176 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+var (
+	sentryClient  = "ofelia/1.0"
+	sentryLogger  = "ofelia"
+	sentryVersion = 7
+)
+
+// SentryConfig configuration for the Sentry middleware
+type SentryConfig struct {
+	SentryDSN         string `gcfg:"sentry-dsn"`
+	SentryDSNFile     string `gcfg:"sentry-dsn-file"`
+	SentryEnvironment string `gcfg:"sentry-environment"`
+}
+
+// NewSentry returns a Sentry middleware if the given configuration is not empty
+func NewSentry(c *SentryConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Sentry{*c}
+	}
+
+	return m
+}
+
+// Sentry middleware captures an event at Sentry for every failed execution of
+// a job, the successful executions are not reported.
+type Sentry struct {
+	SentryConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Sentry) ContinueOnStop() bool {
+	return true
+}
+
+// Run captures the event when the execution fails, its close stop the
+// exection to collect the metrics
+func (m *Sentry) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if ctx.Execution.Failed && !ctx.Execution.Suppressed {
+		if err := m.capture(ctx); err != nil {
+			ctx.Logger.Errorf("Sentry error: %q", err)
+		}
+	}
+
+	return err
+}
+
+func (m *Sentry) capture(ctx *core.Context) error {
+	endpoint, auth, err := parseSentryDSN(m.SentryDSN)
+	if err != nil {
+		return err
+	}
+
+	content, _ := json.Marshal(m.buildEvent(ctx))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", auth)
+
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d calling %q", r.StatusCode, endpoint)
+	}
+
+	return nil
+}
+
+func (m *Sentry) buildEvent(ctx *core.Context) *sentryEvent {
+	e := ctx.Execution
+	job := map[string]interface{}{
+		"command":   ctx.Job.GetCommand(),
+		"execution": e.ID,
+		"duration":  e.Duration.String(),
+	}
+
+	if exit, ok := e.Error.(core.NonZeroExitError); ok {
+		job["exit_code"] = exit.ExitCode
+	}
+
+	if e.Note != "" {
+		job["note"] = e.Note
+	}
+
+	return &sentryEvent{
+		EventID:     newSentryEventID(),
+		Timestamp:   e.EndedAt.UTC().Format(time.RFC3339),
+		Level:       "error",
+		Logger:      sentryLogger,
+		Platform:    "other",
+		Transaction: ctx.Job.GetName(),
+		Message:     fmt.Sprintf("Job %s failed: %s", ctx.Job.GetName(), e.Error),
+		Environment: m.SentryEnvironment,
+		Tags: map[string]string{
+			"job":      ctx.Job.GetName(),
+			"job_type": core.JobType(ctx.Job),
+		},
+		Contexts: map[string]map[string]interface{}{
+			"job": job,
+		},
+	}
+}
+
+// parseSentryDSN returns the store endpoint and the auth header of the given
+// DSN, eg. "https://<key>@o0.ingest.sentry.io/<project>"
+func parseSentryDSN(dsn string) (endpoint, auth string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid sentry-dsn: %s", err)
+	}
+
+	project := path.Base(u.Path)
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "/" || project == "." {
+		return "", "", fmt.Errorf("invalid sentry-dsn, a key, host and project are required")
+	}
+
+	prefix := strings.TrimSuffix(path.Dir(u.Path), "/")
+	endpoint = fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project)
+
+	auth = fmt.Sprintf(
+		"Sentry sentry_version=%d, sentry_client=%s, sentry_key=%s",
+		sentryVersion, sentryClient, u.User.Username(),
+	)
+
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	return endpoint, auth, nil
+}
+
+func newSentryEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+type sentryEvent struct {
+	EventID     string                            `json:"event_id"`
+	Timestamp   string                            `json:"timestamp"`
+	Level       string                            `json:"level"`
+	Logger      string                            `json:"logger"`
+	Platform    string                            `json:"platform"`
+	Transaction string                            `json:"transaction"`
+	Message     string                            `json:"message"`
+	Environment string                            `json:"environment,omitempty"`
+	Tags        map[string]string                 `json:"tags"`
+	Contexts    map[string]map[string]interface{} `json:"contexts"`
+}
@@ -1,25 +1,40 @@
 package middlewares
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/Postcon/ofelia/core"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"text/template"
 )
 
 var (
 	slackUsername   = "Ofelia"
 	slackAvatarURL  = ""
 	slackPayloadVar = "payload"
+	slackStartColor = "#439FE0"
+
+	// slackDefaultLogLines is the lines of the output of a failed execution
+	// included at the message when no slack-log-lines is given
+	slackDefaultLogLines = 20
+	// slackMaxLogBytes keeps the output included at a message, of every
+	// stream, far below the size limit of the messages of Slack
+	slackMaxLogBytes = 3000
 )
 
 // SlackConfig configuration for the Slack middleware
 type SlackConfig struct {
-	SlackWebhook     string `gcfg:"slack-webhook"`
-	SlackOnlyOnError bool   `gcfg:"slack-only-on-error"`
-	SlackLogsUrl     string `gcfg:"slack-logs-url"`
+	SlackWebhook         string `gcfg:"slack-webhook"`
+	SlackWebhookFile     string `gcfg:"slack-webhook-file"`
+	SlackOnlyOnError     bool   `gcfg:"slack-only-on-error"`
+	SlackLogsUrl         string `gcfg:"slack-logs-url"`
+	SlackNotifyStart     bool   `gcfg:"slack-notify-start"`
+	SlackMessageTemplate string `gcfg:"slack-message-template"`
+	SlackLogLines        int    `gcfg:"slack-log-lines"`
 }
 
 // NewSlack returns a Slack middleware if the given configuration is not empty
@@ -43,21 +58,26 @@ func (m *Slack) ContinueOnStop() bool {
 }
 
 // Run sends a message to the slack channel, its close stop the exection to
-// collect the metrics
+// collect the metrics. If slack-notify-start is set a message is also sent
+// when the execution starts.
 func (m *Slack) Run(ctx *core.Context) error {
+	if m.SlackNotifyStart && ctx.Execution.IsRunning {
+		m.pushMessage(ctx, m.buildStartMessage(ctx))
+	}
+
 	err := ctx.Next()
 	ctx.Stop(err)
 
-	if ctx.Execution.Failed || !m.SlackOnlyOnError {
-		m.pushMessage(ctx)
+	if shouldNotify(ctx.Execution, m.SlackOnlyOnError) {
+		m.pushMessage(ctx, m.buildMessage(ctx))
 	}
 
 	return err
 }
 
-func (m *Slack) pushMessage(ctx *core.Context) {
+func (m *Slack) pushMessage(ctx *core.Context, msg *slackMessage) {
 	values := make(url.Values, 0)
-	content, _ := json.Marshal(m.buildMessage(ctx))
+	content, _ := json.Marshal(msg)
 	values.Add(slackPayloadVar, string(content))
 
 	r, err := http.PostForm(m.SlackWebhook, values)
@@ -68,45 +88,158 @@ func (m *Slack) pushMessage(ctx *core.Context) {
 	}
 }
 
+func (m *Slack) buildStartMessage(ctx *core.Context) *slackMessage {
+	msg := &slackMessage{
+		Username: slackUsername,
+		IconURL:  slackAvatarURL,
+	}
+
+	msg.Text = fmt.Sprintf(
+		"Job *%s* started\n```%s```",
+		ctx.Job.GetName(), ctx.Job.GetCommand(),
+	)
+
+	msg.Attachments = append(msg.Attachments, slackAttachment{
+		Title:  "Execution started",
+		Color:  slackStartColor,
+		Footer: executionFooter(ctx.Execution),
+	})
+
+	return msg
+}
+
 func (m *Slack) buildMessage(ctx *core.Context) *slackMessage {
 	msg := &slackMessage{
 		Username: slackUsername,
 		IconURL:  slackAvatarURL,
 	}
 
+	if m.SlackMessageTemplate != "" {
+		text, err := m.executeTemplate(ctx)
+		if err == nil {
+			msg.Text = text
+			m.appendAttachment(ctx, msg)
+			return msg
+		}
+
+		ctx.Logger.Errorf("Slack error executing the slack-message-template: %q", err)
+	}
+
 	msg.Text = fmt.Sprintf(
 		"Job *%s* finished in *%s*\n```%s```",
 		ctx.Job.GetName(), ctx.Execution.Duration, ctx.Job.GetCommand(),
 	)
 
+	if s := ctx.Execution.Stats; s != nil {
+		msg.Text += fmt.Sprintf(
+			"\nMax memory *%.1f MiB*, CPU *%.2fs*",
+			float64(s.MaxMemory)/1024/1024, s.CPUSeconds,
+		)
+	}
+
+	if n := ctx.Execution.Note; n != "" {
+		msg.Text += fmt.Sprintf("\n_%s_", n)
+	}
+
+	m.appendAttachment(ctx, msg)
+	return msg
+}
+
+// appendAttachment appends the status of the execution to the message, with
+// the error and the link to the logs on failure.
+func (m *Slack) appendAttachment(ctx *core.Context, msg *slackMessage) {
 	if ctx.Execution.Failed {
 		logsUrl := ""
 
 		if m.SlackLogsUrl != "" {
 			logsUrl = fmt.Sprintf(
 				"\n<%s|show logs>",
-				strings.Replace(m.SlackLogsUrl, "###instance_name###", strings.SplitN(ctx.Job.GetInstanceName(), "_", 2)[1], 1),
+				strings.Replace(m.SlackLogsUrl, "###instance_name###", slackInstanceName(ctx.Job), 1),
 			)
 		}
 
 		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution failed",
-			Text:  fmt.Sprintf("%s%s", ctx.Execution.Error.Error(), logsUrl),
-			Color: "#F35A00",
-		})
-	} else if ctx.Execution.Skipped {
-		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution skipped",
-			Color: "#FFA500",
+			Title:  "Execution failed",
+			Text:   fmt.Sprintf("%s%s%s", ctx.Execution.Error.Error(), logsUrl, m.outputTail(ctx.Execution)),
+			Color:  executionColor(ctx.Execution),
+			Footer: executionFooter(ctx.Execution),
 		})
 	} else {
 		msg.Attachments = append(msg.Attachments, slackAttachment{
-			Title: "Execution successful",
-			Color: "#7CD197",
+			Title:  "Execution " + executionLabel(ctx.Execution),
+			Color:  executionColor(ctx.Execution),
+			Footer: executionFooter(ctx.Execution),
 		})
 	}
+}
 
-	return msg
+// outputTail returns the last slack-log-lines of the output of the execution,
+// by stream, as code blocks, empty if the job produced no output or
+// slack-log-lines is negative.
+func (m *Slack) outputTail(e *core.Execution) string {
+	lines := m.SlackLogLines
+	if lines == 0 {
+		lines = slackDefaultLogLines
+	}
+
+	if lines < 0 {
+		return ""
+	}
+
+	var text string
+	for _, stream := range []struct {
+		name   string
+		stream io.ReadWriter
+	}{{"stdout", e.OutputStream}, {"stderr", e.ErrorStream}} {
+		if stream.stream == nil {
+			continue
+		}
+
+		tail := outputTail(streamBytes(stream.stream), lines, slackMaxLogBytes)
+		if tail != "" {
+			// a fence at the output would close the code block
+			tail = strings.Replace(tail, "```", "'''", -1)
+			text += fmt.Sprintf("\n%s:\n```%s```", stream.name, tail)
+		}
+	}
+
+	return text
+}
+
+func (m *Slack) executeTemplate(ctx *core.Context) (string, error) {
+	t, err := ParseSlackMessageTemplate(m.SlackMessageTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, ctx); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// ParseSlackMessageTemplate parses a slack-message-template, the template is
+// executed with the core.Context of the execution, as .Job and .Execution, and
+// the function status, returning the status of the execution as "failed".
+func ParseSlackMessageTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("slack-message").
+		Funcs(template.FuncMap{"status": executionLabel}).
+		Parse(tmpl)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid slack-message-template %q: %s", tmpl, err)
+	}
+
+	return t, nil
+}
+
+// slackInstanceName returns the value of ###instance_name### at the logs URL,
+// the timestamp of the default instance names, `name_timestamp`, or the whole
+// instance name when given by an instance-name-template.
+func slackInstanceName(j core.Job) string {
+	return strings.TrimPrefix(j.GetInstanceName(), j.GetName()+"_")
 }
 
 type slackMessage struct {
@@ -117,7 +250,8 @@ type slackMessage struct {
 }
 
 type slackAttachment struct {
-	Color string `json:"color,omitempty"`
-	Title string `json:"title,omitempty"`
-	Text  string `json:"text"`
+	Color  string `json:"color,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Text   string `json:"text"`
+	Footer string `json:"footer,omitempty"`
 }
@@ -3,8 +3,12 @@ package middlewares
 import (
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
-	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
 
 	. "gopkg.in/check.v1"
 )
@@ -20,47 +24,294 @@ func (s *SuiteSlack) TestNewSlackEmpty(c *C) {
 }
 
 func (s *SuiteSlack) TestRunSuccess(c *C) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var m slackMessage
-		json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), &m)
-		c.Assert(m.Attachments[0].Title, Equals, "Execution successful")
-	}))
-
+	ts := NewTestServer()
 	defer ts.Close()
 
-	s.ctx.Start()
-	s.ctx.Stop(nil)
+	s.finishExecution(nil)
 
 	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
 	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Username, Equals, slackUsername)
+	c.Assert(msgs[0].Attachments[0].Title, Equals, "Execution successful")
+	c.Assert(msgs[0].Attachments[0].Color, Equals, "#7CD197")
+	c.Assert(msgs[0].Attachments[0].Footer, Equals, "Execution "+s.ctx.Execution.ID)
 }
 
 func (s *SuiteSlack) TestRunSuccessFailed(c *C) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var m slackMessage
-		json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), &m)
-		c.Assert(m.Attachments[0].Title, Equals, "Execution failed")
-	}))
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(errors.New("foo"))
 
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Title, Equals, "Execution failed")
+	c.Assert(msgs[0].Attachments[0].Text, Equals, "foo")
+}
+
+func (s *SuiteSlack) TestRunSkipped(c *C) {
+	ts := NewTestServer()
 	defer ts.Close()
 
-	s.ctx.Start()
-	s.ctx.Stop(errors.New("foo"))
+	s.finishExecution(core.ErrSkippedExecution)
 
 	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
 	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Title, Equals, "Execution skipped")
 }
 
 func (s *SuiteSlack) TestRunSuccessOnError(c *C) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c.Assert(true, Equals, false)
-	}))
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(nil)
 
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteSlack) TestRunFailedOnError(c *C) {
+	ts := NewTestServer()
 	defer ts.Close()
 
-	s.ctx.Start()
-	s.ctx.Stop(nil)
+	s.finishExecution(errors.New("foo"))
 
 	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true})
 	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 1)
+}
+
+func (s *SuiteSlack) TestRunSuppressed(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(errors.New("foo"))
+	s.ctx.Execution.Suppressed = true
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteSlack) TestRunRecoveredOnError(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(nil)
+	s.ctx.Execution.Note = "recovered after 3 failures"
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(strings.HasSuffix(msgs[0].Text, "\n_recovered after 3 failures_"), Equals, true)
+}
+
+func (s *SuiteSlack) TestRunNon200(c *C) {
+	ts := NewTestServer()
+	ts.Status = http.StatusInternalServerError
+	defer ts.Close()
+
+	s.finishExecution(nil)
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 1)
+}
+
+func (s *SuiteSlack) TestRunLogsURL(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.InstanceName = "foo_1234"
+	s.finishExecution(errors.New("foo"))
+
+	m := NewSlack(&SlackConfig{
+		SlackWebhook: ts.URL,
+		SlackLogsUrl: "http://logs/###instance_name###",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Text, Equals, "foo\n<http://logs/1234|show logs>")
+}
+
+func (s *SuiteSlack) TestRunFailedOutput(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.ctx.Execution.OutputStream.Write([]byte("foo\nbar\nbaz\n"))
+	s.ctx.Execution.ErrorStream.Write([]byte("qux ```\n"))
+	s.finishExecution(errors.New("foo"))
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackLogLines: 2})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Text, Equals, "foo\nstdout:\n```bar\nbaz```\nstderr:\n```qux '''```")
+}
+
+func (s *SuiteSlack) TestRunCancelled(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	// a service job cancelled on shutdown returns core.ErrCancelled
+	s.finishExecution(core.ErrCancelled)
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.ctx.Execution.Cancelled, Equals, true)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
+
+func (s *SuiteSlack) TestRunFailedOutputChained(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "slack")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	// the inner middlewares must not consume the output read by Slack
+	job := &failedJob{}
+	job.Use(NewSlack(&SlackConfig{SlackWebhook: ts.URL}))
+	job.Use(NewSave(&SaveConfig{SaveFolder: dir}))
+
+	ctx := core.NewContext(core.NewScheduler(&TestLogger{}), job, core.NewExecution())
+	ctx.Execution.OutputStream.Write([]byte("foo\n"))
+	ctx.Start()
+	c.Assert(ctx.Next(), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Text, Equals, "foo\nstdout:\n```foo```")
+
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, IsNil)
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".stdout.log") {
+			content, err := ioutil.ReadFile(dir + "/" + f.Name())
+			c.Assert(err, IsNil)
+			c.Assert(string(content), Equals, "foo\n")
+		}
+	}
+}
+
+func (s *SuiteSlack) TestRunFailedOutputDisabled(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.ctx.Execution.OutputStream.Write([]byte("foo\n"))
+	s.finishExecution(errors.New("foo"))
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackLogLines: -1})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(s.messages(c, ts)[0].Attachments[0].Text, Equals, "foo")
+}
+
+func (s *SuiteSlack) TestRunLogsURLTemplated(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.InstanceName = "bar-20180101-1"
+	s.finishExecution(errors.New("foo"))
+
+	m := NewSlack(&SlackConfig{
+		SlackWebhook: ts.URL,
+		SlackLogsUrl: "http://logs/###instance_name###",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	msgs := s.messages(c, ts)
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Attachments[0].Text, Equals, "foo\n<http://logs/bar-20180101-1|show logs>")
+}
+
+func (s *SuiteSlack) TestBuildMessageStats(c *C) {
+	s.finishExecution(nil)
+	s.ctx.Execution.Stats = &core.ContainerStats{MaxMemory: 1024 * 1024 * 3, CPUSeconds: 1.5}
+
+	m := &Slack{}
+	msg := m.buildMessage(s.ctx)
+	c.Assert(strings.HasSuffix(msg.Text, "Max memory *3.0 MiB*, CPU *1.50s*"), Equals, true)
+}
+
+func (s *SuiteSlack) TestBuildMessageTemplate(c *C) {
+	s.finishExecution(errors.New("foo"))
+
+	m := &Slack{SlackConfig{
+		SlackMessageTemplate: ":fire: {{.Job.GetName}} {{status .Execution}}: {{.Execution.Error}}",
+	}}
+
+	msg := m.buildMessage(s.ctx)
+	c.Assert(msg.Text, Equals, ":fire: "+s.job.GetName()+" failed: foo")
+	c.Assert(msg.Attachments[0].Title, Equals, "Execution failed")
+}
+
+func (s *SuiteSlack) TestBuildMessageTemplateError(c *C) {
+	s.finishExecution(nil)
+
+	m := &Slack{SlackConfig{SlackMessageTemplate: "{{.Job.Foo}}"}}
+	msg := m.buildMessage(s.ctx)
+	c.Assert(strings.HasPrefix(msg.Text, "Job *"+s.job.GetName()+"* finished"), Equals, true)
+}
+
+func (s *SuiteSlack) TestParseSlackMessageTemplate(c *C) {
+	_, err := ParseSlackMessageTemplate("{{.Job.GetName}")
+	c.Assert(err, ErrorMatches, `invalid slack-message-template "{{.Job.GetName}": .*`)
+}
+
+func (s *SuiteSlack) TestRunNotifyStart(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.ctx.Start()
+
+	m := NewSlack(&SlackConfig{SlackWebhook: ts.URL, SlackNotifyStart: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	var titles []string
+	for _, msg := range s.messages(c, ts) {
+		titles = append(titles, msg.Attachments[0].Title)
+	}
+
+	c.Assert(titles, DeepEquals, []string{"Execution started", "Execution successful"})
+}
+
+func (s *SuiteSlack) TestBuildStartMessage(c *C) {
+	m := &Slack{}
+	msg := m.buildStartMessage(s.ctx)
+	c.Assert(strings.HasPrefix(msg.Text, "Job *"+s.job.GetName()+"* started"), Equals, true)
+	c.Assert(msg.Attachments[0].Color, Equals, slackStartColor)
+}
+
+// messages decodes the slack messages received by the given server
+func (s *SuiteSlack) messages(c *C, ts *TestServer) []*slackMessage {
+	var msgs []*slackMessage
+	for _, r := range ts.Requests() {
+		c.Assert(r.Method, Equals, "POST")
+
+		msg := &slackMessage{}
+		c.Assert(json.Unmarshal([]byte(r.FormValue(slackPayloadVar)), msg), IsNil)
+		msgs = append(msgs, msg)
+	}
+
+	return msgs
 }
@@ -0,0 +1,146 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Postcon/ofelia/core"
+)
+
+// TeamsConfig configuration for the Teams middleware
+type TeamsConfig struct {
+	TeamsWebhook     string `gcfg:"teams-webhook"`
+	TeamsWebhookFile string `gcfg:"teams-webhook-file"`
+	TeamsOnlyOnError bool   `gcfg:"teams-only-on-error"`
+	TeamsLogsUrl     string `gcfg:"teams-logs-url"`
+}
+
+// NewTeams returns a Teams middleware if the given configuration is not empty
+func NewTeams(c *TeamsConfig) core.Middleware {
+	var m core.Middleware
+	if !IsEmpty(c) {
+		m = &Teams{*c}
+	}
+
+	return m
+}
+
+// Teams middleware calls to a Microsoft Teams incoming webhook after every
+// execution of a job
+type Teams struct {
+	TeamsConfig
+}
+
+// ContinueOnStop return allways true, we want alloways report the final status
+func (m *Teams) ContinueOnStop() bool {
+	return true
+}
+
+// Run sends a message to the Teams channel, its close stop the exection to
+// collect the metrics
+func (m *Teams) Run(ctx *core.Context) error {
+	err := ctx.Next()
+	ctx.Stop(err)
+
+	if shouldNotify(ctx.Execution, m.TeamsOnlyOnError) {
+		m.pushMessage(ctx)
+	}
+
+	return err
+}
+
+func (m *Teams) pushMessage(ctx *core.Context) {
+	content, _ := json.Marshal(m.buildMessage(ctx))
+
+	r, err := http.Post(m.TeamsWebhook, "application/json", bytes.NewReader(content))
+	if err != nil {
+		ctx.Logger.Errorf("Teams error calling %q error: %q", m.TeamsWebhook, err)
+		return
+	}
+
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		ctx.Logger.Errorf("Teams error non-200 status code calling %q", m.TeamsWebhook)
+	}
+}
+
+// buildMessage returns the MessageCard of the execution, the color of its
+// theme is the one of the status, as the Slack attachments.
+func (m *Teams) buildMessage(ctx *core.Context) *teamsMessage {
+	title := fmt.Sprintf("Job %s finished in %s", ctx.Job.GetName(), ctx.Execution.Duration)
+	section := teamsSection{
+		ActivityTitle:    "Execution " + executionLabel(ctx.Execution),
+		ActivitySubtitle: executionFooter(ctx.Execution),
+		Facts: []teamsFact{
+			{Name: "Job", Value: ctx.Job.GetName()},
+			{Name: "Duration", Value: ctx.Execution.Duration.String()},
+			{Name: "Command", Value: ctx.Job.GetCommand()},
+		},
+	}
+
+	if ctx.Execution.Failed {
+		section.Text = ctx.Execution.Error.Error()
+	}
+
+	if n := ctx.Execution.Note; n != "" {
+		section.Facts = append(section.Facts, teamsFact{Name: "Note", Value: n})
+	}
+
+	msg := &teamsMessage{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: strings.TrimPrefix(executionColor(ctx.Execution), "#"),
+		Summary:    fmt.Sprintf("Job %s: %s", ctx.Job.GetName(), section.ActivityTitle),
+		Title:      title,
+		Sections:   []teamsSection{section},
+	}
+
+	if ctx.Execution.Failed && m.TeamsLogsUrl != "" {
+		msg.PotentialAction = append(msg.PotentialAction, teamsAction{
+			Type: "OpenUri",
+			Name: "Show logs",
+			Targets: []teamsTarget{{
+				OS:  "default",
+				URI: strings.Replace(m.TeamsLogsUrl, "###instance_name###", slackInstanceName(ctx.Job), 1),
+			}},
+		})
+	}
+
+	return msg
+}
+
+type teamsMessage struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []teamsSection `json:"sections"`
+	PotentialAction []teamsAction  `json:"potentialAction,omitempty"`
+}
+
+type teamsSection struct {
+	ActivityTitle    string      `json:"activityTitle"`
+	ActivitySubtitle string      `json:"activitySubtitle,omitempty"`
+	Text             string      `json:"text,omitempty"`
+	Facts            []teamsFact `json:"facts"`
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
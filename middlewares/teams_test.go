@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "gopkg.in/check.v1"
+)
+
+type SuiteTeams struct {
+	BaseSuite
+}
+
+var _ = Suite(&SuiteTeams{})
+
+func (s *SuiteTeams) TestNewTeamsEmpty(c *C) {
+	c.Assert(NewTeams(&TeamsConfig{}), IsNil)
+}
+
+func (s *SuiteTeams) TestRunSuccess(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.finishExecution(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL})
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	requests := ts.Requests()
+	c.Assert(requests, HasLen, 1)
+
+	var msg teamsMessage
+	c.Assert(json.Unmarshal(requests[0].Body, &msg), IsNil)
+	c.Assert(msg.Type, Equals, "MessageCard")
+	c.Assert(msg.ThemeColor, Equals, "7CD197")
+	c.Assert(msg.Sections[0].ActivityTitle, Equals, "Execution successful")
+	c.Assert(msg.Sections[0].ActivitySubtitle, Equals, "Execution "+s.ctx.Execution.ID)
+	c.Assert(msg.Sections[0].Facts[0], Equals, teamsFact{Name: "Job", Value: "foo"})
+	c.Assert(msg.PotentialAction, HasLen, 0)
+}
+
+func (s *SuiteTeams) TestRunFailed(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.job.Name = "foo"
+	s.job.InstanceName = "foo_1234"
+	s.finishExecution(errors.New("bar"))
+
+	m := NewTeams(&TeamsConfig{
+		TeamsWebhook: ts.URL,
+		TeamsLogsUrl: "http://logs/###instance_name###",
+	})
+
+	c.Assert(m.Run(s.ctx), IsNil)
+
+	var msg teamsMessage
+	c.Assert(json.Unmarshal(ts.Requests()[0].Body, &msg), IsNil)
+	c.Assert(msg.ThemeColor, Equals, "F35A00")
+	c.Assert(msg.Sections[0].ActivityTitle, Equals, "Execution failed")
+	c.Assert(msg.Sections[0].Text, Equals, "bar")
+	c.Assert(msg.PotentialAction[0].Targets[0].URI, Equals, "http://logs/1234")
+}
+
+func (s *SuiteTeams) TestRunSuccessOnError(c *C) {
+	ts := NewTestServer()
+	defer ts.Close()
+
+	s.finishExecution(nil)
+
+	m := NewTeams(&TeamsConfig{TeamsWebhook: ts.URL, TeamsOnlyOnError: true})
+	c.Assert(m.Run(s.ctx), IsNil)
+	c.Assert(ts.Requests(), HasLen, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/Postcon/ofelia/cli"
+	"github.com/Postcon/ofelia/core"
 
 	"github.com/jessevdk/go-flags"
 )
@@ -16,6 +17,8 @@ func main() {
 	parser := flags.NewNamedParser("ofelia", flags.Default)
 	parser.AddCommand("daemon", "daemon process", "", &cli.DaemonCommand{})
 	parser.AddCommand("validate", "validates the config file", "", &cli.ValidateCommand{})
+	parser.AddCommand("run", "runs a job immediately", "", &cli.RunCommand{})
+	parser.AddCommand("config", "inspects the config file", "", &cli.ConfigCommand{})
 
 	if _, err := parser.Parse(); err != nil {
 		if _, ok := err.(*flags.Error); ok {
@@ -23,6 +26,10 @@ func main() {
 			fmt.Printf("\nBuild information\n  commit: %s\n  date:%s\n", version, build)
 		}
 
+		if e, ok := err.(core.NonZeroExitError); ok && e.ExitCode > 0 && e.ExitCode < 256 {
+			os.Exit(e.ExitCode)
+		}
+
 		os.Exit(1)
 	}
 }